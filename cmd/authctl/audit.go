@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"strconv"
+)
+
+var errAuditChainBroken = errors.New("audit chain is broken")
+
+/*
+Проверяем цепочки журнала аудита. Отчёт выводится всегда,
+при повреждённой цепочке команда завершается с ошибкой
+*/
+func verifyAudit(ctx context.Context, env *env, args []string) (*result, error) {
+	flags := flag.NewFlagSet("audit verify", flag.ExitOnError)
+	stream := flags.String("stream", "", "verify only this stream, all streams when empty")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		return nil, errUsage
+	}
+	// Со временным ключом ни одна контрольная точка не проверится
+	if env.cfg.OIDC.SigningKeyFile == "" {
+		return nil, errNoSigningKeyFile
+	}
+
+	verifications, err := env.audit(ctx).Verify(ctx, *stream)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &result{
+		value:  verifications,
+		header: []string{"STREAM", "EVENTS", "CHECKPOINTS", "LAST_SEQUENCE", "VALID", "BROKEN_SEQUENCE", "REASON"},
+	}
+	for _, v := range verifications {
+		brokenSequence, reason := "-", "-"
+		if v.Broken != nil {
+			brokenSequence, reason = strconv.FormatInt(v.Broken.Sequence, 10), v.Broken.Reason
+			err = errAuditChainBroken
+		}
+		res.rows = append(res.rows, []string{
+			v.Stream, strconv.Itoa(v.Events), strconv.Itoa(v.Checkpoints), strconv.FormatInt(v.LastSequence, 10),
+			strconv.FormatBool(v.Valid), brokenSequence, reason,
+		})
+	}
+	return res, err
+}
+
+// Подписываем хвост потока AUDIT_STREAM ключом ID токенов, не дожидаясь сервиса
+func checkpointAudit(ctx context.Context, env *env, args []string) (*result, error) {
+	if len(args) != 0 {
+		return nil, errUsage
+	}
+	if env.cfg.OIDC.SigningKeyFile == "" {
+		return nil, errNoSigningKeyFile
+	}
+	checkpoint, err := env.audit(ctx).Checkpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint == nil {
+		env.log.Info("no new audit events since the last checkpoint", "stream", env.cfg.Audit.Stream)
+		return nil, nil
+	}
+	return &result{
+		value:  checkpoint,
+		header: []string{"STREAM", "SEQUENCE", "HASH", "CREATED_AT"},
+		rows: [][]string{{
+			checkpoint.Stream, strconv.FormatInt(checkpoint.Sequence, 10), checkpoint.Hash, formatTime(&checkpoint.CreatedAt),
+		}},
+	}, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"strconv"
+
+	"github.com/v7ktory/test/internal/model"
+)
+
+var errUsage = errors.New(usage)
+
+func createClient(ctx context.Context, env *env, args []string) (*result, error) {
+	flags := flag.NewFlagSet("client create", flag.ExitOnError)
+	var (
+		reg           model.ClientRegistration
+		redirectURIs  string
+		scopes        string
+		audiences     string
+		publicKeyFile string
+	)
+	flags.StringVar(&reg.ID, "id", "", "client_id, generated when empty")
+	flags.StringVar(&reg.Name, "name", "", "human readable client name")
+	flags.BoolVar(&reg.Public, "public", false, "public client without a secret (SPA, mobile)")
+	flags.StringVar(&redirectURIs, "redirect-uris", "", "comma separated redirect URIs")
+	flags.StringVar(&scopes, "scopes", "", "comma separated scopes for client_credentials")
+	flags.StringVar(&audiences, "audiences", "", "comma separated audiences the client may request tokens for")
+	flags.StringVar(&publicKeyFile, "public-key-file", "", "PEM public key for private_key_jwt")
+	flags.Parse(args)
+
+	reg.RedirectURIs = splitList(redirectURIs)
+	reg.Scopes = splitList(scopes)
+	reg.Audiences = splitList(audiences)
+	if publicKeyFile != "" {
+		key, err := os.ReadFile(publicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		reg.PublicKey = string(key)
+	}
+
+	credentials, err := env.clients(ctx).CreateClient(ctx, reg)
+	if err != nil {
+		return nil, err
+	}
+	return clientResult(credentials), nil
+}
+
+func rotateClientSecret(ctx context.Context, env *env, args []string) (*result, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	credentials, err := env.clients(ctx).RotateClientSecret(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return clientResult(credentials), nil
+}
+
+func clientResult(credentials *model.ClientCredentials) *result {
+	client := credentials.Client
+	secret := credentials.ClientSecret
+	if secret == "" {
+		secret = "-"
+	}
+	return &result{
+		value:  credentials,
+		header: []string{"CLIENT_ID", "NAME", "PUBLIC", "SCOPES", "AUDIENCES", "CLIENT_SECRET"},
+		rows: [][]string{{
+			client.ID, client.Name, strconv.FormatBool(client.Public),
+			formatList(client.Scopes), formatList(client.Audiences), secret,
+		}},
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+var (
+	errNoSigningKeyFile      = errors.New("OIDC_SIGNING_KEY_FILE is not set")
+	errNoPreviousKeyFile     = errors.New("OIDC_PREVIOUS_SIGNING_KEY_FILE is not set")
+	errPreviousKeyFileExists = errors.New("OIDC_PREVIOUS_SIGNING_KEY_FILE already exists, use -force to overwrite it")
+)
+
+type keyRotation struct {
+	KeyFile         string `json:"key_file"`
+	KeyID           string `json:"key_id"`
+	PreviousKeyFile string `json:"previous_key_file,omitempty"`
+	PreviousKeyID   string `json:"previous_key_id,omitempty"`
+}
+
+/*
+Ротируем ключ подписи ID токенов: текущий ключ переезжает в
+OIDC_PREVIOUS_SIGNING_KEY_FILE и остаётся в JWKS, чтобы уже выданные
+токены проверялись до истечения. Сервис подхватит ключи после перезапуска.
+Секрет access токенов (JWT_SIGNING_KEY) команда не трогает, его меняют вручную.
+Новый ключ сначала пишется во временный файл, так что при ошибке текущий остаётся на месте.
+Существующий предыдущий ключ перезаписываем только с -force: токены, подписанные им, перестанут проверяться
+*/
+func rotateKeys(_ context.Context, env *env, args []string) (*result, error) {
+	flags := flag.NewFlagSet("keys rotate", flag.ExitOnError)
+	force := flags.Bool("force", false, "overwrite the previous signing key file")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		return nil, errUsage
+	}
+	cfg := env.cfg.OIDC
+	if cfg.SigningKeyFile == "" {
+		return nil, errNoSigningKeyFile
+	}
+	if cfg.PreviousSigningKeyFile == "" {
+		return nil, errNoPreviousKeyFile
+	}
+
+	var current *rsa.PrivateKey
+	if _, err := os.Stat(cfg.SigningKeyFile); err == nil {
+		if current, err = jwt.LoadRSAKey(cfg.SigningKeyFile); err != nil {
+			return nil, err
+		}
+		if !*force {
+			if _, err := os.Stat(cfg.PreviousSigningKeyFile); err == nil {
+				return nil, errPreviousKeyFileExists
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := jwt.GenerateRSAKey()
+	if err != nil {
+		return nil, err
+	}
+	next := cfg.SigningKeyFile + ".next"
+	if err := jwt.WriteRSAKey(next, key); err != nil {
+		return nil, err
+	}
+
+	rotation := keyRotation{KeyFile: cfg.SigningKeyFile, KeyID: jwt.KeyID(&key.PublicKey)}
+	if current != nil {
+		if err := os.Rename(cfg.SigningKeyFile, cfg.PreviousSigningKeyFile); err != nil {
+			os.Remove(next)
+			return nil, err
+		}
+		rotation.PreviousKeyFile = cfg.PreviousSigningKeyFile
+		rotation.PreviousKeyID = jwt.KeyID(&current.PublicKey)
+	}
+	if err := os.Rename(next, cfg.SigningKeyFile); err != nil {
+		return nil, err
+	}
+	env.log.Info("signing key rotated, restart the service to start using it", "key_id", rotation.KeyID)
+
+	previous := rotation.PreviousKeyID
+	if previous == "" {
+		previous = "-"
+	}
+	return &result{
+		value:  rotation,
+		header: []string{"KEY_FILE", "KEY_ID", "PREVIOUS_KEY_ID"},
+		rows:   [][]string{{rotation.KeyFile, rotation.KeyID, previous}},
+	}, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"flag"
+)
+
+type mailTestResult struct {
+	To     string `json:"to"`
+	Driver string `json:"driver"`
+}
+
+// Отправляем тестовое письмо сразу, мимо очереди, чтобы проверить настройки MAIL_DRIVER
+func testMail(ctx context.Context, env *env, args []string) (*result, error) {
+	flags := flag.NewFlagSet("mail test", flag.ExitOnError)
+	to := flags.String("to", "", "recipient address")
+	locale := flags.String("locale", "", "template locale, MAIL_LOCALE when empty")
+	flags.Parse(args)
+	if *to == "" || flags.NArg() != 0 {
+		return nil, errUsage
+	}
+
+	if err := env.mail(ctx).SendTest(ctx, *to, *locale); err != nil {
+		return nil, err
+	}
+	return &result{
+		value:  mailTestResult{To: *to, Driver: env.cfg.Mail.Driver},
+		header: []string{"TO", "DRIVER"},
+		rows:   [][]string{{*to, env.cfg.Mail.Driver}},
+	}, nil
+}
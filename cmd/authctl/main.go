@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/v7ktory/test/internal/config"
+	"github.com/v7ktory/test/internal/mail"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/service"
+	"github.com/v7ktory/test/internal/storage"
+	"github.com/v7ktory/test/pkg/hash"
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+const usage = `usage: authctl [-o json|table] COMMAND
+
+  authctl client create -name NAME [-id ID] [-public] [-redirect-uris URI,...] [-scopes SCOPE,...] [-audiences AUD,...] [-public-key-file FILE]
+  authctl client rotate-secret CLIENT_ID
+
+  authctl user create -email EMAIL [-password PASSWORD] [-roles ROLE,...] [-admin]
+  authctl user list [-email TEXT] [-disabled true|false] [-offset N] [-limit N]
+  authctl user reset-password USER [-password PASSWORD] [-temporary]
+  authctl user revoke-sessions USER
+
+  authctl audit verify [-stream STREAM]
+  authctl audit checkpoint
+
+  authctl mail test -to EMAIL [-locale LOCALE]
+
+  authctl keys rotate [-force]
+  authctl migrate up|down|status
+  authctl purge
+
+USER is a user id or email.
+keys rotate rotates only the OIDC ID token key, JWT_SIGNING_KEY for access tokens is changed by hand`
+
+// Команда получает окружение и аргументы после своего имени
+type command func(ctx context.Context, env *env, args []string) (*result, error)
+
+var commands = map[string]command{
+	"client create":        createClient,
+	"client rotate-secret": rotateClientSecret,
+	"user create":          createUser,
+	"user list":            listUsers,
+	"user reset-password":  resetPassword,
+	"user revoke-sessions": revokeSessions,
+	"audit verify":         verifyAudit,
+	"audit checkpoint":     checkpointAudit,
+	"mail test":            testMail,
+	"keys rotate":          rotateKeys,
+	"migrate up":           migrateUp,
+	"migrate down":         migrateDown,
+	"migrate status":       migrateStatus,
+	"purge":                purge,
+}
+
+func main() {
+	flags := flag.NewFlagSet("authctl", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	format := flags.String("o", formatJSON, "output format: json or table")
+	flags.Parse(os.Args[1:])
+	if *format != formatJSON && *format != formatTable {
+		log.Fatal(usage)
+	}
+
+	cmd, args := lookupCommand(flags.Args())
+	if cmd == nil {
+		log.Fatal(usage)
+	}
+
+	cfg, err := config.InitCfg()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Действия из CLI попадают в журнал аудита от имени пользователя ОС
+	ctx := service.WithAuditMeta(context.Background(), service.AuditMeta{Actor: cliActor()})
+	env := newEnv(cfg)
+	defer env.close(ctx)
+
+	// Команда может вернуть частичный результат вместе с ошибкой
+	res, err := cmd(ctx, env, args)
+	if res != nil {
+		if err := res.print(os.Stdout, *format); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Ищем команду из одного или двух слов, остальное - её аргументы
+func lookupCommand(args []string) (command, []string) {
+	for n := min(2, len(args)); n > 0; n-- {
+		if cmd, ok := commands[strings.Join(args[:n], " ")]; ok {
+			return cmd, args[n:]
+		}
+	}
+	return nil, nil
+}
+
+/*
+Конфиг и сервисы для команд. Хранилище открывается при первом обращении,
+чтобы keys rotate работал без доступа к базе
+*/
+type env struct {
+	cfg   *config.Cfg
+	store *storage.Storage
+	keys  *jwt.IDTokenSigner
+	// Логи сервиса уходят в stderr, чтобы в stdout оставался только результат
+	log *slog.Logger
+}
+
+func newEnv(cfg *config.Cfg) *env {
+	return &env{
+		cfg: cfg,
+		log: slog.New(slog.NewTextHandler(os.Stderr, nil)),
+	}
+}
+
+func (e *env) storage(ctx context.Context) *storage.Storage {
+	if e.store == nil {
+		store, err := storage.Open(ctx, e.cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		e.store = store
+	}
+	return e.store
+}
+
+func (e *env) idTokens() *jwt.IDTokenSigner {
+	if e.keys == nil {
+		keys, err := jwt.LoadIDTokenSigner(e.cfg.OIDC.Issuer, e.cfg.OIDC.SigningKeyFile, e.cfg.OIDC.PreviousSigningKeyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		e.keys = keys
+	}
+	return e.keys
+}
+
+func (e *env) close(ctx context.Context) {
+	if e.store != nil {
+		e.store.Close(ctx)
+	}
+}
+
+func (e *env) clients(ctx context.Context) *service.ClientService {
+	return service.NewClientService(*e.storage(ctx).Repository, e.log, e.audit(ctx))
+}
+
+func (e *env) roles(ctx context.Context) *service.RoleService {
+	return service.NewRoleService(*e.storage(ctx).Repository, e.log, e.revocations(ctx), e.audit(ctx))
+}
+
+func (e *env) users(ctx context.Context) *service.UserService {
+	return service.NewUserService(*e.storage(ctx).Repository, *hash.NewHasher(e.cfg.Auth.PasswordSalt), e.log, e.revocations(ctx), e.audit(ctx))
+}
+
+/*
+Отзывы пишутся в хранилище, запущенные реплики сервиса
+подхватывают их при следующей синхронизации
+*/
+func (e *env) revocations(ctx context.Context) *service.RevocationService {
+	repo := e.storage(ctx).Repository.Revocation
+	return service.NewRevocationService(repo, e.log, e.cfg.Auth.JWT.AccessTokenTTL, e.cfg.Auth.RevocationSyncInterval)
+}
+
+// Контрольные точки аудита подписываются ключом ID токенов
+func (e *env) audit(ctx context.Context) *service.AuditService {
+	return service.NewAuditService(e.storage(ctx).Repository.Audit, e.idTokens(), e.log, e.cfg.Audit.Stream, e.cfg.Audit.CheckpointInterval)
+}
+
+func (e *env) mail(ctx context.Context) *service.MailService {
+	mailer, err := mail.NewMailer(e.cfg.Mail)
+	if err != nil {
+		log.Fatal(err)
+	}
+	templates, err := mail.LoadTemplates(e.cfg.Mail)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return service.NewMailService(e.storage(ctx).Repository.MailQueue, mailer, templates, e.log)
+}
+
+func cliActor() model.AuditActor {
+	actor := model.AuditActor{Type: model.AuditActorCLI}
+	if u, err := user.Current(); err == nil {
+		actor.ID = u.Username
+	}
+	return actor
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/v7ktory/test/internal/service"
+	"github.com/v7ktory/test/pkg/migrate"
+)
+
+type migrationInfo struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+func migrateUp(ctx context.Context, env *env, args []string) (*result, error) {
+	if len(args) != 0 {
+		return nil, errUsage
+	}
+	done, err := env.storage(ctx).Migrator.Up(ctx)
+	// Успешно применённые миграции выводим и при ошибке на следующей
+	return migrationsResult(done, true), err
+}
+
+func migrateDown(ctx context.Context, env *env, args []string) (*result, error) {
+	if len(args) != 0 {
+		return nil, errUsage
+	}
+	m, err := env.storage(ctx).Migrator.Down(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return migrationsResult([]migrate.Migration{*m}, false), nil
+}
+
+func migrateStatus(ctx context.Context, env *env, args []string) (*result, error) {
+	if len(args) != 0 {
+		return nil, errUsage
+	}
+	statuses, err := env.storage(ctx).Migrator.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]migrationInfo, 0, len(statuses))
+	for _, s := range statuses {
+		info := migrationInfo{Version: s.Version, Name: s.Name, Applied: s.Applied}
+		if s.Applied {
+			appliedAt := s.AppliedAt
+			info.AppliedAt = &appliedAt
+		}
+		infos = append(infos, info)
+	}
+	return migrationInfoResult(infos), nil
+}
+
+func migrationsResult(migrations []migrate.Migration, applied bool) *result {
+	infos := make([]migrationInfo, 0, len(migrations))
+	for _, m := range migrations {
+		infos = append(infos, migrationInfo{Version: m.Version, Name: m.Name, Applied: applied})
+	}
+	return migrationInfoResult(infos)
+}
+
+func migrationInfoResult(infos []migrationInfo) *result {
+	res := &result{
+		value:  infos,
+		header: []string{"VERSION", "NAME", "APPLIED", "APPLIED_AT"},
+	}
+	for _, info := range infos {
+		res.rows = append(res.rows, []string{
+			strconv.Itoa(info.Version), info.Name, strconv.FormatBool(info.Applied), formatTime(info.AppliedAt),
+		})
+	}
+	return res
+}
+
+// Удаляем истёкшие сессии клиентов, коды авторизации, коды устройств, отзывы, опубликованные события outbox и отправленные письма
+func purge(ctx context.Context, env *env, args []string) (*result, error) {
+	if len(args) != 0 {
+		return nil, errUsage
+	}
+	maintenance := service.NewMaintenanceService(*env.storage(ctx).Repository, env.log)
+	purged, err := maintenance.PurgeExpired(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &result{
+		value:  purged,
+		header: []string{"SESSIONS", "AUTHORIZATION_CODES", "DEVICE_AUTHORIZATIONS", "REVOCATIONS", "OUTBOX", "MAIL"},
+		rows: [][]string{{
+			strconv.Itoa(purged.Sessions), strconv.Itoa(purged.AuthorizationCodes),
+			strconv.Itoa(purged.DeviceAuthorizations), strconv.Itoa(purged.Revocations), strconv.Itoa(purged.Outbox), strconv.Itoa(purged.Mail),
+		}},
+	}, nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/internal/service"
+)
+
+const adminRole = "admin"
+
+// Учётные данные созданного пользователя, пароль выводится только сгенерированный
+type userCredentials struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	Roles     []string  `json:"roles,omitempty"`
+	Password  string    `json:"password,omitempty"`
+	Temporary bool      `json:"temporary"`
+}
+
+type userAction struct {
+	UserID uuid.UUID `json:"user_id"`
+	Action string    `json:"action"`
+}
+
+/*
+Создаём пользователя. Без -password генерируется временный пароль,
+который пользователь обязан сменить через /auth/password
+*/
+func createUser(ctx context.Context, env *env, args []string) (*result, error) {
+	flags := flag.NewFlagSet("user create", flag.ExitOnError)
+	var (
+		email    string
+		password string
+		roles    string
+		admin    bool
+	)
+	flags.StringVar(&email, "email", "", "user email")
+	flags.StringVar(&password, "password", "", "password, a temporary one is generated when empty")
+	flags.StringVar(&roles, "roles", "", "comma separated roles to assign")
+	flags.BoolVar(&admin, "admin", false, "assign the admin role with all permissions, creating it if needed")
+	flags.Parse(args)
+
+	creds := userCredentials{Email: email, Roles: splitList(roles)}
+	if password == "" {
+		generated, err := generatePassword()
+		if err != nil {
+			return nil, err
+		}
+		password = generated
+		creds.Password = generated
+		creds.Temporary = true
+	}
+	if admin {
+		if err := ensureAdminRole(ctx, env); err != nil {
+			return nil, err
+		}
+		creds.Roles = append(creds.Roles, adminRole)
+	}
+
+	users := env.users(ctx)
+	userID, err := users.CreateUser(ctx, email, password, creds.Roles)
+	if err != nil {
+		return nil, err
+	}
+	if creds.Temporary {
+		if err := users.RequirePasswordReset(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	creds.UserID = userID
+	return credentialsResult(creds), nil
+}
+
+func listUsers(ctx context.Context, env *env, args []string) (*result, error) {
+	flags := flag.NewFlagSet("user list", flag.ExitOnError)
+	var (
+		filter   model.UserFilter
+		disabled string
+	)
+	flags.StringVar(&filter.Email, "email", "", "filter by email substring")
+	flags.StringVar(&disabled, "disabled", "", "filter by status: true or false")
+	flags.IntVar(&filter.Offset, "offset", 0, "number of users to skip")
+	flags.IntVar(&filter.Limit, "limit", 0, "page size, 50 by default")
+	flags.Parse(args)
+
+	if disabled != "" {
+		value, err := strconv.ParseBool(disabled)
+		if err != nil {
+			return nil, err
+		}
+		filter.Disabled = &value
+	}
+
+	page, err := env.users(ctx).ListUsers(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &result{
+		value:  page,
+		header: []string{"USER_ID", "EMAIL", "VERIFIED", "DISABLED", "RESET_REQUIRED", "LOCKED_UNTIL"},
+	}
+	for _, user := range page.Users {
+		res.rows = append(res.rows, []string{
+			user.UserID.String(), user.Email, strconv.FormatBool(user.EmailVerified),
+			strconv.FormatBool(user.Disabled), strconv.FormatBool(user.PasswordResetRequired),
+			formatTime(user.LockedUntil),
+		})
+	}
+	return res, nil
+}
+
+// Задаём новый пароль, сессии пользователя при этом завершаются
+func resetPassword(ctx context.Context, env *env, args []string) (*result, error) {
+	if len(args) < 1 {
+		return nil, errUsage
+	}
+	flags := flag.NewFlagSet("user reset-password", flag.ExitOnError)
+	var (
+		password  string
+		temporary bool
+	)
+	flags.StringVar(&password, "password", "", "new password, a temporary one is generated when empty")
+	flags.BoolVar(&temporary, "temporary", false, "require the user to change the password on next login")
+	flags.Parse(args[1:])
+
+	user, err := findUser(ctx, env, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	creds := userCredentials{UserID: user.UUID, Email: user.Email, Temporary: temporary}
+	if password == "" {
+		generated, err := generatePassword()
+		if err != nil {
+			return nil, err
+		}
+		password = generated
+		creds.Password = generated
+		creds.Temporary = true
+	}
+
+	if err := env.users(ctx).SetPassword(ctx, user.UUID, password, creds.Temporary); err != nil {
+		return nil, err
+	}
+	return credentialsResult(creds), nil
+}
+
+func revokeSessions(ctx context.Context, env *env, args []string) (*result, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	user, err := findUser(ctx, env, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := env.users(ctx).LogoutUser(ctx, user.UUID); err != nil {
+		return nil, err
+	}
+
+	action := userAction{UserID: user.UUID, Action: "sessions revoked"}
+	return &result{
+		value:  action,
+		header: []string{"USER_ID", "ACTION"},
+		rows:   [][]string{{action.UserID.String(), action.Action}},
+	}, nil
+}
+
+// Пользователя можно указать по id или по email
+func findUser(ctx context.Context, env *env, ref string) (*model.User, error) {
+	repo := env.storage(ctx).Repository.Auth
+	if id, err := uuid.Parse(ref); err == nil {
+		return repo.GetByID(ctx, id)
+	}
+	return repo.GetByEmail(ctx, ref)
+}
+
+// Роль admin со всеми правами создаётся при первом -admin
+func ensureAdminRole(ctx context.Context, env *env) error {
+	_, err := env.roles(ctx).CreateRole(ctx, model.Role{
+		Name:        adminRole,
+		Description: "Full access, created by authctl",
+		Permissions: []string{service.PermissionAll},
+	})
+	if err != nil && !errors.Is(err, repository.ErrRoleExists) {
+		return err
+	}
+	return nil
+}
+
+func generatePassword() (string, error) {
+	buf := make([]byte, 18)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func credentialsResult(creds userCredentials) *result {
+	password := creds.Password
+	if password == "" {
+		password = "-"
+	}
+	return &result{
+		value:  creds,
+		header: []string{"USER_ID", "EMAIL", "ROLES", "PASSWORD", "TEMPORARY"},
+		rows: [][]string{{
+			creds.UserID.String(), creds.Email, formatList(creds.Roles),
+			password, strconv.FormatBool(creds.Temporary),
+		}},
+	}
+}
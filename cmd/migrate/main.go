@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/v7ktory/test/internal/config"
+	"github.com/v7ktory/test/internal/storage"
+)
+
+const usage = "usage: migrate up|down|status"
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal(usage)
+	}
+
+	cfg, err := config.InitCfg()
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := storage.Open(context.Background(), cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close(context.Background())
+
+	migrator := store.Migrator
+
+	ctx := context.Background()
+	switch os.Args[1] {
+	case "up":
+		done, err := migrator.Up(ctx)
+		for _, m := range done {
+			fmt.Printf("applied %d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "down":
+		m, err := migrator.Down(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("reverted %d %s\n", m.Version, m.Name)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+	default:
+		log.Fatal(usage)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,15 +12,16 @@ import (
 	"time"
 
 	"github.com/v7ktory/test/internal/config"
-	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/internal/mail"
 	"github.com/v7ktory/test/internal/server"
 	"github.com/v7ktory/test/internal/service"
+	"github.com/v7ktory/test/internal/storage"
 	h "github.com/v7ktory/test/internal/transport/http"
 
-	"github.com/v7ktory/test/pkg/database/mongodb"
 	"github.com/v7ktory/test/pkg/hash"
 	"github.com/v7ktory/test/pkg/jwt"
 	"github.com/v7ktory/test/pkg/logger"
+	"github.com/v7ktory/test/pkg/policy"
 )
 
 const timeout = 5 * time.Second
@@ -29,31 +31,94 @@ func Run() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	mongo, err := mongodb.NewMongoDB(context.Background(), cfg.Mongo)
+	store, err := storage.Open(context.Background(), cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if store.AutoMigrate {
+		if _, err := store.Migrator.Up(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	log := logger.NewLogger()
 	hash := hash.NewHasher(cfg.Auth.PasswordSalt)
+
+	idTokens, err := jwt.LoadIDTokenSigner(cfg.OIDC.Issuer, cfg.OIDC.SigningKeyFile, cfg.OIDC.PreviousSigningKeyFile)
+	if err != nil {
+		log.Error("failed to load id token signing keys", "error", err)
+		os.Exit(1)
+	}
+	if cfg.OIDC.SigningKeyFile == "" {
+		log.Warn("OIDC_SIGNING_KEY_FILE is not set, id tokens and audit checkpoints are signed with an ephemeral key")
+	}
+
+	authzPolicy := policy.Empty()
+	if cfg.Authz.PolicyFile == "" {
+		log.Warn("AUTHZ_POLICY_FILE is not set, all authorization checks are denied")
+	} else if authzPolicy, err = policy.Load(cfg.Authz.PolicyFile); err != nil {
+		log.Error("failed to load authorization policy", "error", err)
+		os.Exit(1)
+	}
+
+	mailer, err := mail.NewMailer(cfg.Mail)
+	if err != nil {
+		log.Error("failed to configure mail", "error", err)
+		os.Exit(1)
+	}
+	mailTemplates, err := mail.LoadTemplates(cfg.Mail)
+	if err != nil {
+		log.Error("failed to load mail templates", "error", err)
+		os.Exit(1)
+	}
+
 	jwt := jwt.NewJWT(cfg.Auth.JWT.SigningKey)
 	accessTTL := cfg.Auth.JWT.AccessTokenTTL
 	refreshTTL := cfg.Auth.JWT.RefreshTokenTTL
-	repository := repository.NewRepository(mongo)
+
 	service := service.NewService(
-		*repository,
+		*store.Repository,
 		*hash,
 		*jwt,
+		idTokens,
 		log,
 		accessTTL,
 		refreshTTL,
+		cfg.Auth.RevocationSyncInterval,
+		cfg.OIDC.DeviceVerificationURI,
+		cfg.Auth.DeviceReportURI,
+		cfg.Auth.PasswordResetURI,
+		cfg.Audit.Stream,
+		cfg.Audit.CheckpointInterval,
+		mailer,
+		mailTemplates,
+		service.TokenPolicy{
+			Issuer:    cfg.OIDC.Issuer,
+			Scopes:    cfg.Auth.UserScopes,
+			Audiences: cfg.Auth.Audiences,
+		},
+		service.RiskPolicy{
+			StepUpScore: cfg.Risk.StepUpScore,
+			DenyScore:   cfg.Risk.DenyScore,
+		},
+		authzPolicy,
 	)
-	handler := h.NewHandler(*service)
+
+	syncCtx, stopSync := context.WithCancel(context.Background())
+	defer stopSync()
+	go service.Revocation.Run(syncCtx)
+	go service.AuditLog.Run(syncCtx)
+	go service.WebhookDispatcher.Run(syncCtx)
+	addOutboxSinks(service, cfg.Outbox.Sinks, log)
+	go service.Outbox.Run(syncCtx)
+	go service.Mail.Run(syncCtx)
+	handler := h.NewHandler(*service, cfg.Admin.APIToken, cfg.Server.TrustedProxies)
 	srv := server.NewServer(cfg, handler.InitRoutes())
 
 	go func() {
 		if err := srv.Run(); !errors.Is(err, http.ErrServerClosed) {
-			log.Error("error occurred while running http server: %s", err)
+			log.Error("error occurred while running http server", "error", err)
 
 		}
 	}()
@@ -70,10 +135,27 @@ func Run() {
 	defer shutdown()
 
 	if err := srv.Stop(ctx); err != nil {
-		log.Error("failed to stop server: %v", err)
+		log.Error("failed to stop server", "error", err)
 	}
 
-	if err := mongo.GetClient().Disconnect(context.Background()); err != nil {
+	// Закрепляем события, записанные после последней контрольной точки
+	if _, err := service.AuditLog.Checkpoint(ctx); err != nil {
+		log.Error("failed to create audit checkpoint", "error", err)
+	}
+
+	if err := store.Close(context.Background()); err != nil {
 		log.Error(err.Error())
 	}
 }
+
+// Подключаем к outbox получателей из OUTBOX_SINKS
+func addOutboxSinks(svc *service.Service, sinks []string, log *slog.Logger) {
+	for _, sink := range sinks {
+		switch sink {
+		case config.OutboxSinkWebhooks:
+			svc.Outbox.AddSink(svc.WebhookDispatcher)
+		case config.OutboxSinkLog:
+			svc.Outbox.AddSink(service.NewLogSink(log))
+		}
+	}
+}
@@ -2,7 +2,11 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -10,11 +14,42 @@ import (
 )
 
 const (
+	StorageMongo    = "mongo"
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+	StorageSQLite   = "sqlite"
+
+	// Хранилище сессий, выбирается независимо от хранилища пользователей
+	SessionRedis = "redis"
+
+	// Получатели событий из outbox
+	OutboxSinkWebhooks = "webhooks"
+	OutboxSinkLog      = "log"
+
+	// Способ отправки писем
+	MailSMTP    = "smtp"
+	MailFile    = "file"
+	MailConsole = "console"
+)
+
+const (
+	defaultStorageDriver = StorageMongo
+
 	defaultAccessTokenTTL  = 30 * time.Minute
 	defaultRefreshTokenTTL = 24 * time.Hour * 30 // 30 days
 
+	defaultRevocationSyncInterval  = 5 * time.Second
+	defaultAuditCheckpointInterval = 10 * time.Minute
+
 	defaultQueryTimeout = 10 * time.Second
 
+	defaultMailDriver = MailConsole
+	defaultMailFrom   = "no-reply@localhost"
+	defaultMailLocale = "en"
+
+	defaultRiskStepUpScore = 50
+	defaultRiskDenyScore   = 80
+
 	defaultPort           = "8080"
 	defaultMaxHeaderBytes = 1 << 20
 	defaultReadTimeout    = 10 * time.Second
@@ -23,9 +58,24 @@ const (
 
 type (
 	Cfg struct {
-		Mongo  MongoCfg
-		Auth   AuthCfg
-		Server Server
+		Storage  StorageCfg
+		Mongo    MongoCfg
+		Postgres PostgresCfg
+		SQLite   SQLiteCfg
+		Redis    RedisCfg
+		Auth     AuthCfg
+		OIDC     OIDCCfg
+		Admin    AdminCfg
+		Authz    AuthzCfg
+		Audit    AuditCfg
+		Outbox   OutboxCfg
+		Mail     MailCfg
+		Risk     RiskCfg
+		Server   Server
+	}
+	StorageCfg struct {
+		Driver        string
+		SessionDriver string
 	}
 	MongoCfg struct {
 		Hosts        []string
@@ -33,10 +83,84 @@ type (
 		Password     string
 		DB           string
 		QueryTimeout time.Duration
+		AutoMigrate  bool
+	}
+	PostgresCfg struct {
+		DSN          string
+		QueryTimeout time.Duration
+		AutoMigrate  bool
+	}
+	SQLiteCfg struct {
+		Path         string
+		QueryTimeout time.Duration
+		AutoMigrate  bool
+	}
+	RedisCfg struct {
+		Addr         string
+		Username     string
+		Password     string
+		DB           int
+		QueryTimeout time.Duration
 	}
 	AuthCfg struct {
-		JWT          JWTCfg
-		PasswordSalt string
+		JWT                    JWTCfg
+		PasswordSalt           string
+		RevocationSyncInterval time.Duration
+		// Scope и audience, которые пользователь может запросить при входе
+		UserScopes []string
+		Audiences  []string
+		// Страница из письма о новом устройстве, где пользователь сообщает о чужом входе
+		DeviceReportURI string
+		// Страница из письма, где после сообщения о чужом входе задаётся новый пароль
+		PasswordResetURI string
+	}
+	OIDCCfg struct {
+		// Публичный адрес сервиса, попадает в iss ID токенов и discovery
+		Issuer string
+		// PEM файл с RSA ключом для подписи ID токенов
+		SigningKeyFile string
+		// Ключ до последней ротации, публикуется в JWKS, если файл есть
+		PreviousSigningKeyFile string
+		// Страница, где пользователь вводит код устройства
+		DeviceVerificationURI string
+	}
+	AdminCfg struct {
+		// Bearer токен для /admin, без него admin API выключен
+		APIToken string
+	}
+	AuthzCfg struct {
+		// JSON файл с политикой для /authz/check, без него все проверки получают отказ
+		PolicyFile string
+	}
+	AuditCfg struct {
+		// Поток цепочки событий, у каждой реплики сервиса должен быть свой
+		Stream             string
+		CheckpointInterval time.Duration
+	}
+	OutboxCfg struct {
+		// Куда диспетчер outbox передаёт события
+		Sinks []string
+	}
+	MailCfg struct {
+		Driver string
+		From   string
+		// Локаль писем, если у получателя она неизвестна или для неё нет шаблона
+		Locale string
+		// Каталог с шаблонами вместо встроенных
+		TemplatesDir string
+		// Куда драйвер file пишет письма
+		Dir  string
+		SMTP SMTPCfg
+	}
+	RiskCfg struct {
+		// С какой оценки риска вход требует код из письма и с какой отклоняется
+		StepUpScore int
+		DenyScore   int
+	}
+	SMTPCfg struct {
+		Addr     string
+		Username string
+		Password string
 	}
 	JWTCfg struct {
 		AccessTokenTTL  time.Duration
@@ -48,12 +172,15 @@ type (
 		MaxHeaderBytes int
 		ReadTimeout    time.Duration
 		WriteTimeout   time.Duration
+		// Прокси перед сервисом, только их X-Forwarded-For и Forwarded определяют IP клиента
+		TrustedProxies []netip.Prefix
 	}
 )
 
 func InitCfg() (*Cfg, error) {
+	// .env необязателен: в single-binary установке конфиг приходит из окружения
 	err := godotenv.Load()
-	if err != nil {
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return nil, err
 	}
 
@@ -72,18 +199,137 @@ func InitCfg() (*Cfg, error) {
 }
 
 func loadEnv(cfg *Cfg) error {
-	mongoHosts := os.Getenv("MONGO_HOSTS")
-	if mongoHosts == "" {
-		return errors.New("missing MONGO_HOSTS")
+	cfg.Storage.Driver = os.Getenv("STORAGE_DRIVER")
+	if cfg.Storage.Driver == "" {
+		cfg.Storage.Driver = defaultStorageDriver
+	}
+
+	switch cfg.Storage.Driver {
+	case StorageMongo:
+		mongoHosts := os.Getenv("MONGO_HOSTS")
+		if mongoHosts == "" {
+			return errors.New("missing MONGO_HOSTS")
+		}
+		cfg.Mongo.Hosts = strings.Split(mongoHosts, ",")
+	case StoragePostgres:
+		cfg.Postgres.DSN = os.Getenv("POSTGRES_DSN")
+		if cfg.Postgres.DSN == "" {
+			return errors.New("missing POSTGRES_DSN")
+		}
+	case StorageSQLite:
+		cfg.SQLite.Path = os.Getenv("SQLITE_PATH")
+		if cfg.SQLite.Path == "" {
+			return errors.New("missing SQLITE_PATH")
+		}
+	case StorageMemory:
+	default:
+		return fmt.Errorf("unknown STORAGE_DRIVER: %s", cfg.Storage.Driver)
+	}
+
+	cfg.Storage.SessionDriver = os.Getenv("SESSION_DRIVER")
+	switch cfg.Storage.SessionDriver {
+	case "":
+	case SessionRedis:
+		cfg.Redis.Addr = os.Getenv("REDIS_ADDR")
+		if cfg.Redis.Addr == "" {
+			return errors.New("missing REDIS_ADDR")
+		}
+		if db := os.Getenv("REDIS_DB"); db != "" {
+			n, err := strconv.Atoi(db)
+			if err != nil {
+				return fmt.Errorf("invalid REDIS_DB: %w", err)
+			}
+			cfg.Redis.DB = n
+		}
+		cfg.Redis.Username = os.Getenv("REDIS_USERNAME")
+		cfg.Redis.Password = os.Getenv("REDIS_PASSWORD")
+	default:
+		return fmt.Errorf("unknown SESSION_DRIVER: %s", cfg.Storage.SessionDriver)
 	}
 
-	cfg.Mongo.Hosts = strings.Split(mongoHosts, ",")
 	cfg.Mongo.Username = os.Getenv("MONGO_USERNAME")
 	cfg.Mongo.Password = os.Getenv("MONGO_PASS")
 	cfg.Mongo.DB = os.Getenv("MONGO_DBNAME")
+	cfg.Mongo.AutoMigrate = os.Getenv("MONGO_AUTO_MIGRATE") != "false"
+
+	cfg.Postgres.AutoMigrate = os.Getenv("POSTGRES_AUTO_MIGRATE") != "false"
+	cfg.SQLite.AutoMigrate = os.Getenv("SQLITE_AUTO_MIGRATE") != "false"
 
 	cfg.Auth.PasswordSalt = os.Getenv("PASSWORD_SALT")
 	cfg.Auth.JWT.SigningKey = os.Getenv("JWT_SIGNING_KEY")
+	cfg.Auth.UserScopes = envList("AUTH_USER_SCOPES")
+	cfg.Auth.Audiences = envList("AUTH_AUDIENCES")
+	cfg.Auth.DeviceReportURI = os.Getenv("DEVICE_REPORT_URI")
+	cfg.Auth.PasswordResetURI = os.Getenv("PASSWORD_RESET_URI")
+
+	for _, proxy := range envList("TRUSTED_PROXIES") {
+		prefix, err := parsePrefix(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid TRUSTED_PROXIES entry: %s", proxy)
+		}
+		cfg.Server.TrustedProxies = append(cfg.Server.TrustedProxies, prefix)
+	}
+
+	cfg.OIDC.Issuer = strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/")
+	cfg.OIDC.SigningKeyFile = os.Getenv("OIDC_SIGNING_KEY_FILE")
+	cfg.OIDC.PreviousSigningKeyFile = os.Getenv("OIDC_PREVIOUS_SIGNING_KEY_FILE")
+	cfg.OIDC.DeviceVerificationURI = os.Getenv("DEVICE_VERIFICATION_URI")
+
+	cfg.Admin.APIToken = os.Getenv("ADMIN_API_TOKEN")
+	cfg.Authz.PolicyFile = os.Getenv("AUTHZ_POLICY_FILE")
+
+	cfg.Audit.Stream = os.Getenv("AUDIT_STREAM")
+	if interval := os.Getenv("AUDIT_CHECKPOINT_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return fmt.Errorf("invalid AUDIT_CHECKPOINT_INTERVAL: %w", err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("invalid AUDIT_CHECKPOINT_INTERVAL: %s", interval)
+		}
+		cfg.Audit.CheckpointInterval = d
+	}
+
+	cfg.Outbox.Sinks = envList("OUTBOX_SINKS")
+	for _, sink := range cfg.Outbox.Sinks {
+		switch sink {
+		case OutboxSinkWebhooks, OutboxSinkLog:
+		default:
+			return fmt.Errorf("unknown OUTBOX_SINKS entry: %s", sink)
+		}
+	}
+
+	cfg.Mail.Driver = os.Getenv("MAIL_DRIVER")
+	switch cfg.Mail.Driver {
+	case "", MailConsole:
+	case MailSMTP:
+		cfg.Mail.SMTP.Addr = os.Getenv("SMTP_ADDR")
+		if cfg.Mail.SMTP.Addr == "" {
+			return errors.New("missing SMTP_ADDR")
+		}
+		cfg.Mail.SMTP.Username = os.Getenv("SMTP_USERNAME")
+		cfg.Mail.SMTP.Password = os.Getenv("SMTP_PASSWORD")
+	case MailFile:
+		cfg.Mail.Dir = os.Getenv("MAIL_DIR")
+		if cfg.Mail.Dir == "" {
+			return errors.New("missing MAIL_DIR")
+		}
+	default:
+		return fmt.Errorf("unknown MAIL_DRIVER: %s", cfg.Mail.Driver)
+	}
+	cfg.Mail.From = os.Getenv("MAIL_FROM")
+	cfg.Mail.Locale = os.Getenv("MAIL_LOCALE")
+	cfg.Mail.TemplatesDir = os.Getenv("MAIL_TEMPLATES_DIR")
+
+	for key, score := range map[string]*int{"RISK_STEP_UP_SCORE": &cfg.Risk.StepUpScore, "RISK_DENY_SCORE": &cfg.Risk.DenyScore} {
+		if v := os.Getenv(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid %s: must be a positive number", key)
+			}
+			*score = n
+		}
+	}
 
 	return nil
 }
@@ -91,13 +337,92 @@ func loadEnv(cfg *Cfg) error {
 func loadDefault(cfg *Cfg) error {
 	cfg.Auth.JWT.AccessTokenTTL = defaultAccessTokenTTL
 	cfg.Auth.JWT.RefreshTokenTTL = defaultRefreshTokenTTL
+	cfg.Auth.RevocationSyncInterval = defaultRevocationSyncInterval
 
 	cfg.Mongo.QueryTimeout = defaultQueryTimeout
+	cfg.Postgres.QueryTimeout = defaultQueryTimeout
+	cfg.SQLite.QueryTimeout = defaultQueryTimeout
+	cfg.Redis.QueryTimeout = defaultQueryTimeout
 
 	cfg.Server.Port = defaultPort
 	cfg.Server.MaxHeaderBytes = defaultMaxHeaderBytes
 	cfg.Server.ReadTimeout = defaultReadTimeout
 	cfg.Server.WriteTimeout = defaultWriteTimeout
 
+	if cfg.OIDC.Issuer == "" {
+		cfg.OIDC.Issuer = "http://localhost:" + cfg.Server.Port
+	}
+	if cfg.OIDC.PreviousSigningKeyFile == "" && cfg.OIDC.SigningKeyFile != "" {
+		cfg.OIDC.PreviousSigningKeyFile = cfg.OIDC.SigningKeyFile + ".prev"
+	}
+	if cfg.OIDC.DeviceVerificationURI == "" {
+		cfg.OIDC.DeviceVerificationURI = cfg.OIDC.Issuer + "/oauth/device"
+	}
+	if cfg.Auth.DeviceReportURI == "" {
+		cfg.Auth.DeviceReportURI = cfg.OIDC.Issuer + "/auth/devices/report"
+	}
+	if cfg.Auth.PasswordResetURI == "" {
+		cfg.Auth.PasswordResetURI = cfg.OIDC.Issuer + "/auth/password/reset"
+	}
+
+	if cfg.Audit.Stream == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("AUDIT_STREAM is not set and hostname is unavailable: %w", err)
+		}
+		cfg.Audit.Stream = hostname
+	}
+	if cfg.Audit.CheckpointInterval == 0 {
+		cfg.Audit.CheckpointInterval = defaultAuditCheckpointInterval
+	}
+	if len(cfg.Outbox.Sinks) == 0 {
+		cfg.Outbox.Sinks = []string{OutboxSinkWebhooks}
+	}
+
+	if cfg.Mail.Driver == "" {
+		cfg.Mail.Driver = defaultMailDriver
+	}
+	if cfg.Mail.From == "" {
+		cfg.Mail.From = defaultMailFrom
+	}
+	if cfg.Mail.Locale == "" {
+		cfg.Mail.Locale = defaultMailLocale
+	}
+
+	if cfg.Risk.StepUpScore == 0 {
+		cfg.Risk.StepUpScore = defaultRiskStepUpScore
+	}
+	if cfg.Risk.DenyScore == 0 {
+		cfg.Risk.DenyScore = max(defaultRiskDenyScore, cfg.Risk.StepUpScore+1)
+	}
+	if cfg.Risk.DenyScore <= cfg.Risk.StepUpScore {
+		return errors.New("RISK_DENY_SCORE must be greater than RISK_STEP_UP_SCORE")
+	}
+
 	return nil
 }
+
+// Список через запятую, пустые элементы отбрасываем
+func envList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Сеть в CIDR нотации или один адрес
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,77 @@
+// Пакет mail выбирает отправку писем по конфигу и хранит встроенные шаблоны
+package mail
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/v7ktory/test/internal/config"
+	"github.com/v7ktory/test/pkg/mailer"
+)
+
+// Шаблоны, которые использует сервис
+const (
+	TemplatePasswordChanged = "password_changed"
+	TemplatePasswordReset   = "password_reset"
+	TemplateNewDevice       = "new_device"
+	TemplateLoginCode       = "login_code"
+	TemplateTest            = "test"
+)
+
+//go:embed templates/*
+var templatesFS embed.FS
+
+// Отправка писем, выбранная через MAIL_DRIVER
+func NewMailer(cfg config.MailCfg) (mailer.Mailer, error) {
+	switch cfg.Driver {
+	case config.MailSMTP:
+		return mailer.NewSMTPMailer(cfg.SMTP.Addr, cfg.SMTP.Username, cfg.SMTP.Password, cfg.From)
+	case config.MailFile:
+		return mailer.NewFileMailer(cfg.Dir, cfg.From)
+	case config.MailConsole:
+		return mailer.NewConsoleMailer(os.Stdout, cfg.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %s", cfg.Driver)
+	}
+}
+
+/*
+Встроенные шаблоны или шаблоны из MAIL_TEMPLATES_DIR. Каталог заменяет
+встроенные целиком, поэтому в нём должны быть все шаблоны сервиса
+*/
+func LoadTemplates(cfg config.MailCfg) (*mailer.Templates, error) {
+	var fsys fs.FS
+	if cfg.TemplatesDir != "" {
+		fsys = os.DirFS(cfg.TemplatesDir)
+	} else {
+		sub, err := fs.Sub(templatesFS, "templates")
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	}
+
+	templates, err := mailer.NewTemplates(fsys, cfg.Locale)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{TemplatePasswordChanged, TemplatePasswordReset, TemplateNewDevice, TemplateLoginCode, TemplateTest} {
+		if _, err := templates.Render(name, cfg.Locale, sampleData); err != nil {
+			return nil, fmt.Errorf("mail template %s: %w", name, err)
+		}
+	}
+	return templates, nil
+}
+
+// Данные для проверки шаблонов при загрузке, содержат все поля, которые передаёт сервис
+var sampleData = map[string]string{
+	"Email":     "user@example.com",
+	"Time":      "2006-01-02 15:04 UTC",
+	"Device":    "Firefox on Linux",
+	"IP":        "192.0.2.1",
+	"ReportURL": "https://auth.example.com/auth/devices/report?token=example",
+	"ResetURL":  "https://auth.example.com/auth/password/reset?token=example",
+	"Code":      "123456",
+}
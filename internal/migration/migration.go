@@ -0,0 +1,283 @@
+package migration
+
+import (
+	"context"
+	"embed"
+	"time"
+
+	"github.com/v7ktory/test/pkg/database/mongodb"
+	"github.com/v7ktory/test/pkg/database/postgres"
+	"github.com/v7ktory/test/pkg/database/sqlite"
+	"github.com/v7ktory/test/pkg/migrate"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//go:embed postgres/*.sql
+var postgresFS embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFS embed.FS
+
+// Список миграций схемы MongoDB. Новые миграции добавляем только в конец
+func Mongo(provider *mongodb.Provider) []migrate.Migration {
+	return []migrate.Migration{
+		{
+			Version: 1,
+			Name:    "users_email_unique",
+			// Имя по умолчанию: индекс мог быть создан при старте до появления миграций,
+			// тогда повторное создание ничего не меняет
+			Up: createIndex(provider, "users", mongo.IndexModel{
+				Keys:    bson.D{{Key: "email", Value: 1}},
+				Options: options.Index().SetName("email_1").SetUnique(true),
+			}),
+			Down: dropIndex(provider, "users", "email_1"),
+		},
+		{
+			Version: 2,
+			Name:    "sessions_user_id",
+			Up: createIndex(provider, "sessions", mongo.IndexModel{
+				Keys:    bson.D{{Key: "refresh_token.user_id", Value: 1}},
+				Options: options.Index().SetName("refresh_token_user_id"),
+			}),
+			Down: dropIndex(provider, "sessions", "refresh_token_user_id"),
+		},
+		{
+			Version: 3,
+			Name:    "sessions_expires_at_ttl",
+			// TTL применяем только к сессиям OAuth клиентов с реальным сроком. First-party сессия
+			// у пользователя одна и создаётся при регистрации, её удаление закрыло бы ему вход
+			Up: createIndex(provider, "sessions", mongo.IndexModel{
+				Keys: bson.D{{Key: "refresh_token.expires_at", Value: 1}},
+				Options: options.Index().
+					SetName("refresh_token_expires_at_ttl").
+					SetExpireAfterSeconds(0).
+					SetPartialFilterExpression(bson.M{
+						"client_id":                bson.M{"$gt": ""},
+						"refresh_token.expires_at": bson.M{"$gt": time.Unix(0, 0)},
+					}),
+			}),
+			Down: dropIndex(provider, "sessions", "refresh_token_expires_at_ttl"),
+		},
+		{
+			Version: 4,
+			Name:    "revocations_expires_at_ttl",
+			Up: createIndex(provider, "revocations", mongo.IndexModel{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+			}),
+			Down: dropIndex(provider, "revocations", "expires_at_ttl"),
+		},
+		{
+			Version: 5,
+			Name:    "revocations_revoked_at",
+			Up: createIndex(provider, "revocations", mongo.IndexModel{
+				Keys:    bson.D{{Key: "revoked_at", Value: 1}},
+				Options: options.Index().SetName("revoked_at"),
+			}),
+			Down: dropIndex(provider, "revocations", "revoked_at"),
+		},
+		{
+			Version: 6,
+			Name:    "authorization_codes_expires_at_ttl",
+			Up: createIndex(provider, "authorization_codes", mongo.IndexModel{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+			}),
+			Down: dropIndex(provider, "authorization_codes", "expires_at_ttl"),
+		},
+		{
+			Version: 7,
+			Name:    "consents_user_client_unique",
+			Up: createIndex(provider, "consents", mongo.IndexModel{
+				Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "client_id", Value: 1}},
+				Options: options.Index().SetName("user_client_unique").SetUnique(true),
+			}),
+			Down: dropIndex(provider, "consents", "user_client_unique"),
+		},
+		{
+			Version: 8,
+			Name:    "device_authorizations_user_code_unique",
+			Up: createIndex(provider, "device_authorizations", mongo.IndexModel{
+				Keys:    bson.D{{Key: "user_code", Value: 1}},
+				Options: options.Index().SetName("user_code_unique").SetUnique(true),
+			}),
+			Down: dropIndex(provider, "device_authorizations", "user_code_unique"),
+		},
+		{
+			Version: 9,
+			Name:    "device_authorizations_expires_at_ttl",
+			Up: createIndex(provider, "device_authorizations", mongo.IndexModel{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+			}),
+			Down: dropIndex(provider, "device_authorizations", "expires_at_ttl"),
+		},
+		{
+			Version: 10,
+			Name:    "user_roles_user_role_unique",
+			Up: createIndex(provider, "user_roles", mongo.IndexModel{
+				Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "role", Value: 1}},
+				Options: options.Index().SetName("user_role_unique").SetUnique(true),
+			}),
+			Down: dropIndex(provider, "user_roles", "user_role_unique"),
+		},
+		{
+			Version: 11,
+			Name:    "user_roles_role",
+			Up: createIndex(provider, "user_roles", mongo.IndexModel{
+				Keys:    bson.D{{Key: "role", Value: 1}},
+				Options: options.Index().SetName("role"),
+			}),
+			Down: dropIndex(provider, "user_roles", "role"),
+		},
+		{
+			Version: 12,
+			Name:    "audit_events_time",
+			Up: createIndex(provider, "audit_events", mongo.IndexModel{
+				Keys:    bson.D{{Key: "time", Value: -1}},
+				Options: options.Index().SetName("time"),
+			}),
+			Down: dropIndex(provider, "audit_events", "time"),
+		},
+		{
+			Version: 13,
+			Name:    "audit_events_actor_id",
+			Up: createIndex(provider, "audit_events", mongo.IndexModel{
+				Keys:    bson.D{{Key: "actor.id", Value: 1}, {Key: "time", Value: -1}},
+				Options: options.Index().SetName("actor_id"),
+			}),
+			Down: dropIndex(provider, "audit_events", "actor_id"),
+		},
+		{
+			Version: 14,
+			Name:    "audit_events_subject_id",
+			Up: createIndex(provider, "audit_events", mongo.IndexModel{
+				Keys:    bson.D{{Key: "subject.id", Value: 1}, {Key: "time", Value: -1}},
+				Options: options.Index().SetName("subject_id"),
+			}),
+			Down: dropIndex(provider, "audit_events", "subject_id"),
+		},
+		{
+			Version: 15,
+			Name:    "audit_events_stream_sequence_unique",
+			// События, записанные до цепочки, номера не имеют и под индекс не попадают
+			Up: createIndex(provider, "audit_events", mongo.IndexModel{
+				Keys: bson.D{{Key: "stream", Value: 1}, {Key: "sequence", Value: 1}},
+				Options: options.Index().
+					SetName("stream_sequence_unique").
+					SetUnique(true).
+					SetPartialFilterExpression(bson.M{"sequence": bson.M{"$gt": 0}}),
+			}),
+			Down: dropIndex(provider, "audit_events", "stream_sequence_unique"),
+		},
+		{
+			Version: 16,
+			Name:    "audit_checkpoints_stream_sequence_unique",
+			Up: createIndex(provider, "audit_checkpoints", mongo.IndexModel{
+				Keys:    bson.D{{Key: "stream", Value: 1}, {Key: "sequence", Value: 1}},
+				Options: options.Index().SetName("stream_sequence_unique").SetUnique(true),
+			}),
+			Down: dropIndex(provider, "audit_checkpoints", "stream_sequence_unique"),
+		},
+		{
+			Version: 17,
+			Name:    "webhook_deliveries_due",
+			Up: createIndex(provider, "webhook_deliveries", mongo.IndexModel{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+				Options: options.Index().SetName("due"),
+			}),
+			Down: dropIndex(provider, "webhook_deliveries", "due"),
+		},
+		{
+			Version: 18,
+			Name:    "webhook_deliveries_webhook_id",
+			Up: createIndex(provider, "webhook_deliveries", mongo.IndexModel{
+				Keys:    bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}},
+				Options: options.Index().SetName("webhook_id"),
+			}),
+			Down: dropIndex(provider, "webhook_deliveries", "webhook_id"),
+		},
+		{
+			Version: 19,
+			Name:    "outbox_due",
+			Up: createIndex(provider, "outbox", mongo.IndexModel{
+				Keys:    bson.D{{Key: "published_at", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+				Options: options.Index().SetName("due"),
+			}),
+			Down: dropIndex(provider, "outbox", "due"),
+		},
+		{
+			Version: 20,
+			Name:    "webhook_deliveries_event_unique",
+			// Outbox может передать событие повторно, доставка подписчику создаётся один раз
+			Up: createIndex(provider, "webhook_deliveries", mongo.IndexModel{
+				Keys:    bson.D{{Key: "webhook_id", Value: 1}, {Key: "event_id", Value: 1}},
+				Options: options.Index().SetName("event_unique").SetUnique(true),
+			}),
+			Down: dropIndex(provider, "webhook_deliveries", "event_unique"),
+		},
+		{
+			Version: 21,
+			Name:    "mail_queue_due",
+			Up: createIndex(provider, "mail_queue", mongo.IndexModel{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+				Options: options.Index().SetName("due"),
+			}),
+			Down: dropIndex(provider, "mail_queue", "due"),
+		},
+		{
+			Version: 22,
+			Name:    "mail_queue_created_at",
+			Up: createIndex(provider, "mail_queue", mongo.IndexModel{
+				Keys:    bson.D{{Key: "created_at", Value: 1}},
+				Options: options.Index().SetName("created_at"),
+			}),
+			Down: dropIndex(provider, "mail_queue", "created_at"),
+		},
+		{
+			Version: 23,
+			Name:    "known_devices_device_unique",
+			Up: createIndex(provider, "known_devices", mongo.IndexModel{
+				Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "user_agent", Value: 1}, {Key: "network", Value: 1}},
+				Options: options.Index().SetName("device_unique").SetUnique(true),
+			}),
+			Down: dropIndex(provider, "known_devices", "device_unique"),
+		},
+	}
+}
+
+func NewMongoMigrator(provider *mongodb.Provider) (*migrate.Migrator, error) {
+	return migrate.NewMigrator(mongodb.NewMigrationStore(provider), Mongo(provider))
+}
+
+func NewPostgresMigrator(provider *postgres.Provider) (*migrate.Migrator, error) {
+	migrations, err := migrate.FromFS(provider.DB, postgresFS, "postgres")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.NewMigrator(migrate.NewSQLStore(provider.DB), migrations)
+}
+
+func NewSQLiteMigrator(provider *sqlite.Provider) (*migrate.Migrator, error) {
+	migrations, err := migrate.FromFS(provider.DB, sqliteFS, "sqlite")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.NewMigrator(migrate.NewSQLStore(provider.DB), migrations)
+}
+
+func createIndex(provider *mongodb.Provider, collection string, index mongo.IndexModel) migrate.Func {
+	return func(ctx context.Context) error {
+		_, err := provider.GetCollection(collection).Indexes().CreateOne(ctx, index)
+		return err
+	}
+}
+
+func dropIndex(provider *mongodb.Provider, collection, name string) migrate.Func {
+	return func(ctx context.Context) error {
+		_, err := provider.GetCollection(collection).Indexes().DropOne(ctx, name)
+		return err
+	}
+}
@@ -0,0 +1,19 @@
+CREATE TABLE users (
+    id       UUID PRIMARY KEY,
+    email    TEXT NOT NULL,
+    password TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX users_email_unique ON users (email);
+
+CREATE TABLE sessions (
+    id               UUID PRIMARY KEY,
+    user_id          UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    refresh_token_id UUID NOT NULL,
+    access_token_id  UUID NOT NULL,
+    token            TEXT NOT NULL,
+    expires_at       TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX sessions_user_id ON sessions (user_id);
+CREATE INDEX sessions_expires_at ON sessions (expires_at);
@@ -0,0 +1,10 @@
+CREATE TABLE revocations (
+    id         UUID PRIMARY KEY,
+    kind       TEXT NOT NULL,
+    subject    UUID NOT NULL,
+    revoked_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX revocations_revoked_at ON revocations (revoked_at);
+CREATE INDEX revocations_expires_at ON revocations (expires_at);
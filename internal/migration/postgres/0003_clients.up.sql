@@ -0,0 +1,6 @@
+CREATE TABLE clients (
+    id          TEXT PRIMARY KEY,
+    name        TEXT NOT NULL,
+    secret_hash TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL
+);
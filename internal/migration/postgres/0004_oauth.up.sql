@@ -0,0 +1,23 @@
+ALTER TABLE clients ADD COLUMN public BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE clients ADD COLUMN redirect_uris TEXT NOT NULL DEFAULT '[]';
+
+ALTER TABLE sessions ADD COLUMN client_id TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE authorization_codes (
+    code_hash             TEXT PRIMARY KEY,
+    client_id             TEXT NOT NULL,
+    user_id               UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redirect_uri          TEXT NOT NULL,
+    scope                 TEXT NOT NULL,
+    code_challenge        TEXT NOT NULL,
+    code_challenge_method TEXT NOT NULL,
+    expires_at            TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE consents (
+    user_id    UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    client_id  TEXT NOT NULL,
+    scopes     TEXT NOT NULL,
+    granted_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, client_id)
+);
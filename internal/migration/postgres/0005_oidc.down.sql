@@ -0,0 +1,7 @@
+ALTER TABLE authorization_codes DROP COLUMN auth_time;
+ALTER TABLE authorization_codes DROP COLUMN nonce;
+
+ALTER TABLE sessions DROP COLUMN auth_time;
+ALTER TABLE sessions DROP COLUMN scope;
+
+ALTER TABLE users DROP COLUMN email_verified;
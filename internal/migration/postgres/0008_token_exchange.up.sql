@@ -0,0 +1 @@
+ALTER TABLE clients ADD COLUMN audiences TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,19 @@
+CREATE TABLE audit_events (
+    id           UUID PRIMARY KEY,
+    time         TIMESTAMPTZ NOT NULL,
+    action       TEXT NOT NULL,
+    outcome      TEXT NOT NULL,
+    actor_type   TEXT NOT NULL,
+    actor_id     TEXT NOT NULL,
+    subject_type TEXT NOT NULL,
+    subject_id   TEXT NOT NULL,
+    ip           TEXT NOT NULL,
+    user_agent   TEXT NOT NULL,
+    request_id   TEXT NOT NULL,
+    reason       TEXT NOT NULL,
+    details      TEXT NOT NULL
+);
+
+CREATE INDEX audit_events_time ON audit_events (time);
+CREATE INDEX audit_events_actor_id ON audit_events (actor_id, time);
+CREATE INDEX audit_events_subject_id ON audit_events (subject_id, time);
@@ -0,0 +1,17 @@
+CREATE TABLE outbox (
+    id              UUID PRIMARY KEY,
+    event_type      TEXT NOT NULL,
+    partition_key   TEXT NOT NULL DEFAULT '',
+    payload         TEXT NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    locked_by       TEXT NOT NULL DEFAULT '',
+    published_at    TIMESTAMPTZ,
+    error           TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX outbox_due ON outbox (next_attempt_at) WHERE published_at IS NULL;
+CREATE INDEX outbox_published_at ON outbox (published_at) WHERE published_at IS NOT NULL;
+
+CREATE UNIQUE INDEX webhook_deliveries_event ON webhook_deliveries (webhook_id, event_id);
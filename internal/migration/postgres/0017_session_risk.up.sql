@@ -0,0 +1 @@
+ALTER TABLE sessions ADD COLUMN risk TEXT NOT NULL DEFAULT '';
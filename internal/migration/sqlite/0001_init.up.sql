@@ -0,0 +1,19 @@
+CREATE TABLE users (
+    id       TEXT PRIMARY KEY,
+    email    TEXT NOT NULL,
+    password TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX users_email_unique ON users (email);
+
+CREATE TABLE sessions (
+    id               TEXT PRIMARY KEY,
+    user_id          TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    refresh_token_id TEXT NOT NULL,
+    access_token_id  TEXT NOT NULL,
+    token            TEXT NOT NULL,
+    expires_at       DATETIME NOT NULL
+);
+
+CREATE INDEX sessions_user_id ON sessions (user_id);
+CREATE INDEX sessions_expires_at ON sessions (expires_at);
@@ -0,0 +1,10 @@
+CREATE TABLE revocations (
+    id         TEXT PRIMARY KEY,
+    kind       TEXT NOT NULL,
+    subject    TEXT NOT NULL,
+    revoked_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX revocations_revoked_at ON revocations (revoked_at);
+CREATE INDEX revocations_expires_at ON revocations (expires_at);
@@ -0,0 +1,7 @@
+DROP TABLE consents;
+DROP TABLE authorization_codes;
+
+ALTER TABLE sessions DROP COLUMN client_id;
+
+ALTER TABLE clients DROP COLUMN redirect_uris;
+ALTER TABLE clients DROP COLUMN public;
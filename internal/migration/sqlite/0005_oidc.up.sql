@@ -0,0 +1,7 @@
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE sessions ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN auth_time DATETIME NOT NULL DEFAULT '0001-01-01 00:00:00+00:00';
+
+ALTER TABLE authorization_codes ADD COLUMN nonce TEXT NOT NULL DEFAULT '';
+ALTER TABLE authorization_codes ADD COLUMN auth_time DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
@@ -0,0 +1,2 @@
+ALTER TABLE clients DROP COLUMN public_key;
+ALTER TABLE clients DROP COLUMN scopes;
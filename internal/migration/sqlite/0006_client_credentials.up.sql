@@ -0,0 +1,2 @@
+ALTER TABLE clients ADD COLUMN scopes TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE clients ADD COLUMN public_key TEXT NOT NULL DEFAULT '';
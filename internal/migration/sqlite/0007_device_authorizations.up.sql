@@ -0,0 +1,14 @@
+CREATE TABLE device_authorizations (
+    device_code_hash TEXT PRIMARY KEY,
+    user_code        TEXT NOT NULL,
+    client_id        TEXT NOT NULL,
+    scope            TEXT NOT NULL,
+    status           TEXT NOT NULL,
+    user_id          TEXT REFERENCES users (id) ON DELETE CASCADE,
+    auth_time        DATETIME NOT NULL,
+    next_poll_at     DATETIME NOT NULL,
+    expires_at       DATETIME NOT NULL
+);
+
+CREATE UNIQUE INDEX device_authorizations_user_code_unique ON device_authorizations (user_code);
+CREATE INDEX device_authorizations_expires_at ON device_authorizations (expires_at);
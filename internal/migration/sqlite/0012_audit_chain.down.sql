@@ -0,0 +1,6 @@
+DROP TABLE audit_checkpoints;
+DROP INDEX audit_events_stream_sequence;
+ALTER TABLE audit_events DROP COLUMN hash;
+ALTER TABLE audit_events DROP COLUMN prev_hash;
+ALTER TABLE audit_events DROP COLUMN sequence;
+ALTER TABLE audit_events DROP COLUMN stream;
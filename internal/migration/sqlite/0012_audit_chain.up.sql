@@ -0,0 +1,18 @@
+ALTER TABLE audit_events ADD COLUMN stream TEXT NOT NULL DEFAULT '';
+ALTER TABLE audit_events ADD COLUMN sequence INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE audit_events ADD COLUMN prev_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE audit_events ADD COLUMN hash TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX audit_events_stream_sequence ON audit_events (stream, sequence) WHERE sequence > 0;
+
+CREATE TABLE audit_checkpoints (
+    id         TEXT PRIMARY KEY,
+    stream     TEXT NOT NULL,
+    sequence   INTEGER NOT NULL,
+    hash       TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    key_id     TEXT NOT NULL,
+    signature  TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX audit_checkpoints_stream_sequence ON audit_checkpoints (stream, sequence);
@@ -0,0 +1 @@
+DROP TABLE mail_queue;
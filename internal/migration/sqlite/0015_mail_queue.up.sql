@@ -0,0 +1,17 @@
+CREATE TABLE mail_queue (
+    id              TEXT PRIMARY KEY,
+    recipient       TEXT NOT NULL,
+    template        TEXT NOT NULL,
+    subject         TEXT NOT NULL,
+    text_body       TEXT NOT NULL,
+    html_body       TEXT NOT NULL DEFAULT '',
+    status          TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL,
+    error           TEXT NOT NULL DEFAULT '',
+    created_at      DATETIME NOT NULL,
+    sent_at         DATETIME
+);
+
+CREATE INDEX mail_queue_due ON mail_queue (status, next_attempt_at);
+CREATE INDEX mail_queue_created_at ON mail_queue (created_at);
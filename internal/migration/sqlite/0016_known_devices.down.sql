@@ -0,0 +1,4 @@
+DROP TABLE known_devices;
+
+ALTER TABLE sessions DROP COLUMN device_network;
+ALTER TABLE sessions DROP COLUMN device_user_agent;
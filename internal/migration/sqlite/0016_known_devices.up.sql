@@ -0,0 +1,13 @@
+ALTER TABLE sessions ADD COLUMN device_user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN device_network TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE known_devices (
+    id            TEXT PRIMARY KEY,
+    user_id       TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_agent    TEXT NOT NULL,
+    network       TEXT NOT NULL,
+    first_seen_at DATETIME NOT NULL,
+    last_seen_at  DATETIME NOT NULL
+);
+
+CREATE UNIQUE INDEX known_devices_device ON known_devices (user_id, user_agent, network);
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+/*
+Фильтр списка пользователей для admin API.
+Email ищется подстрокой без учёта регистра, Disabled == nil - без фильтра по статусу
+*/
+type UserFilter struct {
+	Email    string
+	Disabled *bool
+	Offset   int
+	Limit    int
+}
+
+// Пользователь в ответах admin API, без хэша пароля
+type UserSummary struct {
+	UserID                uuid.UUID  `json:"user_id"`
+	Email                 string     `json:"email"`
+	EmailVerified         bool       `json:"email_verified"`
+	Disabled              bool       `json:"disabled"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	LockedUntil           *time.Time `json:"locked_until,omitempty"`
+}
+
+type UserPage struct {
+	Users  []UserSummary `json:"users"`
+	Total  int           `json:"total"`
+	Offset int           `json:"offset"`
+	Limit  int           `json:"limit"`
+}
+
+// Пользователь с ролями и сессиями
+type UserDetails struct {
+	UserSummary
+	Roles    []string      `json:"roles"`
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+/*
+Сессия в ответах admin API, без refresh токена.
+Active - у сессии есть не истёкший refresh токен
+*/
+type SessionInfo struct {
+	ID        uuid.UUID  `json:"id"`
+	ClientID  string     `json:"client_id,omitempty"`
+	Scope     string     `json:"scope,omitempty"`
+	Active    bool       `json:"active"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Device    *Device    `json:"device,omitempty"`
+	Risk      *Risk      `json:"risk,omitempty"`
+}
+
+// Сколько просроченных записей удалено при очистке
+type PurgeResult struct {
+	Sessions             int `json:"sessions"`
+	AuthorizationCodes   int `json:"authorization_codes"`
+	DeviceAuthorizations int `json:"device_authorizations"`
+	Revocations          int `json:"revocations"`
+	Outbox               int `json:"outbox"`
+	Mail                 int `json:"mail"`
+}
@@ -0,0 +1,189 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditOutcome string
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditFailure AuditOutcome = "failure"
+)
+
+// Кто выполнил действие
+const (
+	AuditActorUser       = "user"
+	AuditActorClient     = "client"
+	AuditActorAdminToken = "admin_token"
+	AuditActorCLI        = "cli"
+	AuditActorAnonymous  = "anonymous"
+)
+
+// Над чем выполнено действие
+const (
+	AuditSubjectUser    = "user"
+	AuditSubjectClient  = "client"
+	AuditSubjectRole    = "role"
+	AuditSubjectWebhook = "webhook"
+)
+
+const (
+	AuditSignUp         = "user.signup"
+	AuditLogin          = "user.login"
+	AuditLoginVerify    = "user.login_verify"
+	AuditRefresh        = "user.refresh"
+	AuditLogout         = "user.logout"
+	AuditPasswordChange = "user.password_change"
+	AuditPasswordReset  = "user.password_reset"
+	AuditDeviceReport   = "user.device_report"
+	AuditDeviceForget   = "user.device_forget"
+
+	AuditUserCreate        = "admin.user.create"
+	AuditUserSetPassword   = "admin.user.set_password"
+	AuditUserDisable       = "admin.user.disable"
+	AuditUserEnable        = "admin.user.enable"
+	AuditUserUnlock        = "admin.user.unlock"
+	AuditUserPasswordReset = "admin.user.password_reset"
+	AuditUserLogout        = "admin.user.logout"
+	AuditUserDelete        = "admin.user.delete"
+
+	AuditRoleCreate   = "admin.role.create"
+	AuditRoleUpdate   = "admin.role.update"
+	AuditRoleDelete   = "admin.role.delete"
+	AuditRoleAssign   = "admin.role.assign"
+	AuditRoleUnassign = "admin.role.unassign"
+
+	AuditClientCreate       = "admin.client.create"
+	AuditClientRotateSecret = "admin.client.rotate_secret"
+
+	AuditWebhookCreate        = "admin.webhook.create"
+	AuditWebhookUpdate        = "admin.webhook.update"
+	AuditWebhookDelete        = "admin.webhook.delete"
+	AuditWebhookRotateSecret  = "admin.webhook.rotate_secret"
+	AuditWebhookRetryDelivery = "admin.webhook.retry_delivery"
+)
+
+type AuditActor struct {
+	Type string `json:"type" bson:"type"`
+	ID   string `json:"id,omitempty" bson:"id,omitempty"`
+}
+
+type AuditSubject struct {
+	Type string `json:"type,omitempty" bson:"type,omitempty"`
+	ID   string `json:"id,omitempty" bson:"id,omitempty"`
+}
+
+/*
+Событие безопасности в журнале аудита. Записи только добавляются,
+изменить или удалить их через репозиторий нельзя.
+События каждого потока (обычно одной реплики сервиса) пронумерованы и связаны
+в цепочку: Hash считается от содержимого события вместе с хэшем предыдущего
+*/
+type AuditEvent struct {
+	ID        uuid.UUID    `json:"id" bson:"_id"`
+	Time      time.Time    `json:"time" bson:"time"`
+	Action    string       `json:"action" bson:"action"`
+	Outcome   AuditOutcome `json:"outcome" bson:"outcome"`
+	Actor     AuditActor   `json:"actor" bson:"actor"`
+	Subject   AuditSubject `json:"subject" bson:"subject"`
+	IP        string       `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent string       `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	RequestID string       `json:"request_id,omitempty" bson:"request_id,omitempty"`
+	// Причина отказа для событий с исходом failure
+	Reason  string            `json:"reason,omitempty" bson:"reason,omitempty"`
+	Details map[string]string `json:"details,omitempty" bson:"details,omitempty"`
+
+	// У событий, записанных до появления цепочки, поток пустой, а номер нулевой
+	Stream   string `json:"stream,omitempty" bson:"stream,omitempty"`
+	Sequence int64  `json:"sequence,omitempty" bson:"sequence,omitempty"`
+	PrevHash string `json:"prev_hash,omitempty" bson:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty" bson:"hash,omitempty"`
+}
+
+/*
+Считаем SHA-256 от всех полей события, кроме самого Hash.
+Время берётся с точностью до миллисекунд, с которой его хранят все хранилища
+*/
+func (e *AuditEvent) ComputeHash() string {
+	details := e.Details
+	if len(details) == 0 {
+		details = nil
+	}
+	// json.Marshal сортирует ключи map, поэтому представление однозначно
+	data, _ := json.Marshal([]any{
+		e.Stream, strconv.FormatInt(e.Sequence, 10), e.PrevHash,
+		e.ID, e.Time.UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano),
+		e.Action, e.Outcome, e.Actor.Type, e.Actor.ID, e.Subject.Type, e.Subject.ID,
+		e.IP, e.UserAgent, e.RequestID, e.Reason, details,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+Контрольная точка потока: хэш события с номером Sequence, подписанный RSA ключом
+ID токенов, KeyID - kid этого ключа. Подделать цепочку до контрольной точки
+без закрытого ключа нельзя, даже пересчитав все хэши
+*/
+type AuditCheckpoint struct {
+	ID        uuid.UUID `json:"id" bson:"_id"`
+	Stream    string    `json:"stream" bson:"stream"`
+	Sequence  int64     `json:"sequence" bson:"sequence"`
+	Hash      string    `json:"hash" bson:"hash"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	KeyID     string    `json:"key_id" bson:"key_id"`
+	Signature string    `json:"signature" bson:"signature"`
+}
+
+// Данные, которые подписываются в контрольной точке
+func (c *AuditCheckpoint) SignedData() []byte {
+	data, _ := json.Marshal([]any{
+		c.ID, c.Stream, strconv.FormatInt(c.Sequence, 10), c.Hash,
+		c.CreatedAt.UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano),
+	})
+	return data
+}
+
+// Результат проверки цепочки одного потока
+type AuditVerification struct {
+	Stream       string `json:"stream"`
+	Events       int    `json:"events"`
+	Checkpoints  int    `json:"checkpoints"`
+	LastSequence int64  `json:"last_sequence"`
+	Valid        bool   `json:"valid"`
+	// Первое нарушенное звено, если цепочка повреждена
+	Broken *AuditBreak `json:"broken,omitempty"`
+}
+
+type AuditBreak struct {
+	Sequence int64     `json:"sequence"`
+	EventID  uuid.UUID `json:"event_id,omitempty"`
+	Reason   string    `json:"reason"`
+}
+
+/*
+Фильтр журнала аудита. UserID совпадает и с тем, кто действовал,
+и с тем, над кем действовали. From включительно, To не включительно
+*/
+type AuditFilter struct {
+	UserID uuid.UUID
+	Action string
+	From   time.Time
+	To     time.Time
+	Offset int
+	Limit  int
+}
+
+// События отсортированы от новых к старым
+type AuditPage struct {
+	Events []AuditEvent `json:"events"`
+	Offset int          `json:"offset"`
+	Limit  int          `json:"limit"`
+}
@@ -0,0 +1,20 @@
+package model
+
+/*
+Запрос к /authz/check. SubjectToken - access токен пользователя, от имени
+которого действует вызывающий сервис: атрибуты из него важнее переданных в Subject
+*/
+type AuthzCheckRequest struct {
+	SubjectToken string         `json:"subject_token"`
+	Subject      map[string]any `json:"subject"`
+	Action       string         `json:"action"`
+	Resource     map[string]any `json:"resource"`
+	Context      map[string]any `json:"context"`
+}
+
+// Решение авторизации, DecisionID позволяет найти его в журнале решений
+type AuthzDecision struct {
+	DecisionID string `json:"decision_id"`
+	Allowed    bool   `json:"allowed"`
+	Rule       string `json:"rule,omitempty"`
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+/*
+Зарегистрированный OAuth клиент, секрет хранится только в виде хэша.
+Публичные клиенты (SPA, мобильные) секрета не имеют и защищаются только PKCE.
+Scopes - что клиент может получить через client_credentials,
+PublicKey - PEM ключ для аутентификации через private_key_jwt,
+Audiences - для каких сервисов клиент может запрашивать токены (aud), в том числе обменом (RFC 8693)
+*/
+type Client struct {
+	ID           string    `json:"client_id" bson:"_id"`
+	Name         string    `json:"name" bson:"name"`
+	SecretHash   string    `json:"-" bson:"secret_hash"`
+	Public       bool      `json:"public" bson:"public"`
+	RedirectURIs []string  `json:"redirect_uris" bson:"redirect_uris"`
+	Scopes       []string  `json:"scopes" bson:"scopes"`
+	PublicKey    string    `json:"public_key,omitempty" bson:"public_key"`
+	Audiences    []string  `json:"audiences,omitempty" bson:"audiences"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,18 @@
+package model
+
+// Параметры регистрации OAuth клиента через admin API или CLI
+type ClientRegistration struct {
+	ID           string   `json:"client_id"`
+	Name         string   `json:"name"`
+	Public       bool     `json:"public"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	PublicKey    string   `json:"public_key"`
+	Audiences    []string `json:"audiences"`
+}
+
+// Секрет показывается один раз, в базе хранится только его хэш
+type ClientCredentials struct {
+	Client       *Client `json:"client"`
+	ClientSecret string  `json:"client_secret,omitempty"`
+}
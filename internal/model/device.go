@@ -0,0 +1,40 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DeviceAuthorizationPending  = "pending"
+	DeviceAuthorizationApproved = "approved"
+	DeviceAuthorizationDenied   = "denied"
+)
+
+/*
+Запрос авторизации устройства (RFC 8628), хранится по хэшу device_code.
+UserCode хранится без разделителя, UserID заполняется после подтверждения.
+NextPollAt - раньше этого времени устройство не должно опрашивать /oauth/token
+*/
+type DeviceAuthorization struct {
+	DeviceCodeHash string    `json:"-" bson:"_id"`
+	UserCode       string    `json:"user_code" bson:"user_code"`
+	ClientID       string    `json:"client_id" bson:"client_id"`
+	Scope          string    `json:"scope" bson:"scope"`
+	Status         string    `json:"status" bson:"status"`
+	UserID         uuid.UUID `json:"user_id" bson:"user_id"`
+	AuthTime       time.Time `json:"auth_time" bson:"auth_time"`
+	NextPollAt     time.Time `json:"next_poll_at" bson:"next_poll_at"`
+	ExpiresAt      time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// Ответ /oauth/device_authorization
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// События сервиса, которые уходят во внешние системы
+const (
+	EventUserSignUp         = "user.signup"
+	EventUserLogin          = "user.login"
+	EventUserPasswordChange = "user.password_change"
+	// Вход с устройства или из сети, откуда пользователь ещё не входил
+	EventUserNewDevice = "user.new_device"
+	// Пользователь сообщил, что вход с нового устройства выполнил не он
+	EventUserDeviceReport = "user.device_report"
+)
+
+var EventTypes = []string{EventUserSignUp, EventUserLogin, EventUserPasswordChange, EventUserNewDevice, EventUserDeviceReport}
+
+// Событие в том виде, в котором его получают webhooks и брокеры сообщений
+type Event struct {
+	ID   uuid.UUID         `json:"id"`
+	Type string            `json:"type"`
+	Time time.Time         `json:"time"`
+	Data map[string]string `json:"data"`
+}
+
+/*
+Сообщение outbox: событие, записанное в одной транзакции с изменением, которое его
+породило. Диспетчер берёт сообщение в аренду (LockedBy, NextAttemptAt) и передаёт
+его получателям, пока те не примут его все
+*/
+type OutboxMessage struct {
+	ID   uuid.UUID `json:"id" bson:"_id"`
+	Type string    `json:"type" bson:"type"`
+	// Ключ партиционирования для брокера, например id пользователя
+	Key string `json:"key" bson:"key"`
+	// Event в JSON
+	Payload       string     `json:"payload" bson:"payload"`
+	CreatedAt     time.Time  `json:"created_at" bson:"created_at"`
+	Attempts      int        `json:"attempts" bson:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	LockedBy      string     `json:"locked_by,omitempty" bson:"locked_by,omitempty"`
+	PublishedAt   *time.Time `json:"published_at,omitempty" bson:"published_at,omitempty"`
+	Error         string     `json:"error,omitempty" bson:"error,omitempty"`
+}
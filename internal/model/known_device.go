@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+/*
+Устройство, с которого выполнен вход: семейство браузера и ОС из User-Agent
+и ключевой хэш сети (/24 для IPv4, /48 для IPv6). Сам IP адрес не хранится
+*/
+type Device struct {
+	UserAgent string `json:"user_agent" bson:"user_agent"`
+	Network   string `json:"network" bson:"network"`
+}
+
+// Устройство, с которого пользователь уже входил
+type KnownDevice struct {
+	ID          uuid.UUID `json:"id" bson:"_id"`
+	UserID      uuid.UUID `json:"-" bson:"user_id"`
+	Device      `bson:",inline"`
+	FirstSeenAt time.Time `json:"first_seen_at" bson:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at" bson:"last_seen_at"`
+}
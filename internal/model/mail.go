@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type MailStatus string
+
+const (
+	MailPending MailStatus = "pending"
+	MailSent    MailStatus = "sent"
+	// Попытки исчерпаны, письмо больше не отправляется
+	MailDead MailStatus = "dead"
+)
+
+// Письмо в очереди отправки, собрано из шаблона при постановке в очередь
+type MailMessage struct {
+	ID            uuid.UUID  `json:"id" bson:"_id"`
+	To            string     `json:"to" bson:"to"`
+	Template      string     `json:"template" bson:"template"`
+	Subject       string     `json:"subject" bson:"subject"`
+	Text          string     `json:"text" bson:"text"`
+	HTML          string     `json:"html,omitempty" bson:"html,omitempty"`
+	Status        MailStatus `json:"status" bson:"status"`
+	Attempts      int        `json:"attempts" bson:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	Error         string     `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at" bson:"created_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+}
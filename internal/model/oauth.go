@@ -0,0 +1,77 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Параметры запроса к /oauth/authorize
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// Параметры запроса к /oauth/token
+type TokenRequest struct {
+	GrantType           string
+	ClientID            string
+	ClientSecret        string
+	ClientAssertionType string
+	ClientAssertion     string
+	Code                string
+	RedirectURI         string
+	CodeVerifier        string
+	RefreshToken        string
+	DeviceCode          string
+	Scope               string
+	// Параметры обмена токенов (RFC 8693)
+	SubjectToken       string
+	SubjectTokenType   string
+	ActorToken         string
+	RequestedTokenType string
+	Audience           []string
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	// Заполняется только при обмене токенов (RFC 8693)
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+/*
+Одноразовый код авторизации, хранится по хэшу самого кода.
+RedirectURI - redirect_uri из запроса авторизации, пустой, если клиент его не передал.
+AuthTime - время входа пользователя, попадает в auth_time ID токена
+*/
+type AuthorizationCode struct {
+	CodeHash            string    `json:"-" bson:"_id"`
+	ClientID            string    `json:"client_id" bson:"client_id"`
+	UserID              uuid.UUID `json:"user_id" bson:"user_id"`
+	RedirectURI         string    `json:"redirect_uri" bson:"redirect_uri"`
+	Scope               string    `json:"scope" bson:"scope"`
+	Nonce               string    `json:"-" bson:"nonce"`
+	CodeChallenge       string    `json:"-" bson:"code_challenge"`
+	CodeChallengeMethod string    `json:"-" bson:"code_challenge_method"`
+	AuthTime            time.Time `json:"auth_time" bson:"auth_time"`
+	ExpiresAt           time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// Согласие пользователя на доступ клиента к перечисленным scope
+type Consent struct {
+	UserID    uuid.UUID `json:"user_id" bson:"user_id"`
+	ClientID  string    `json:"client_id" bson:"client_id"`
+	Scopes    []string  `json:"scopes" bson:"scopes"`
+	GrantedAt time.Time `json:"granted_at" bson:"granted_at"`
+}
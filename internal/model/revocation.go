@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RevocationKind string
+
+const (
+	// Отозван один access токен по jti
+	RevokeToken RevocationKind = "token"
+	// Отозваны все токены пользователя, выпущенные до RevokedAt
+	RevokeUser RevocationKind = "user"
+	// Отозваны все токены сессии, выпущенные до RevokedAt
+	RevokeSession RevocationKind = "session"
+)
+
+/*
+Запись об отзыве access токенов.
+Хранится до ExpiresAt, после этого отозванные токены истекают сами
+*/
+type Revocation struct {
+	ID        uuid.UUID      `json:"id" bson:"_id"`
+	Kind      RevocationKind `json:"kind" bson:"kind"`
+	Subject   uuid.UUID      `json:"subject" bson:"subject"`
+	RevokedAt time.Time      `json:"revoked_at" bson:"revoked_at"`
+	ExpiresAt time.Time      `json:"expires_at" bson:"expires_at"`
+}
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+type RiskDecision string
+
+const (
+	RiskAllow RiskDecision = "allow"
+	// Вход завершается только после кода из письма
+	RiskStepUp RiskDecision = "step_up"
+	RiskDeny   RiskDecision = "deny"
+)
+
+// Признаки риска, из которых складывается оценка
+const (
+	RiskNewDevice     = "new_device"
+	RiskNewNetwork    = "new_network"
+	RiskIPVelocity    = "ip_velocity"
+	RiskFailedLogins  = "failed_logins"
+	RiskUnusualHour   = "unusual_hour"
+	RiskNetworkChange = "network_change"
+)
+
+// Уровни проверки пользователя при входе, попадают в claim acr
+const (
+	ACRPassword  = "pwd"
+	ACREmailCode = "pwd+email"
+)
+
+// Оценка риска входа или обновления токенов и принятое решение
+type Risk struct {
+	Score      int          `json:"score" bson:"score"`
+	Signals    []string     `json:"signals,omitempty" bson:"signals,omitempty"`
+	Decision   RiskDecision `json:"decision" bson:"decision"`
+	ACR        string       `json:"acr,omitempty" bson:"acr,omitempty"`
+	AssessedAt time.Time    `json:"assessed_at" bson:"assessed_at"`
+}
+
+// Добавляем к оценке признак риска с его весом
+func (r *Risk) Add(signal string, weight int) {
+	r.Signals = append(r.Signals, signal)
+	r.Score += weight
+}
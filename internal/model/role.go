@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+/*
+Роль - именованный набор разрешений вида resource:action.
+Пользователю назначаются роли, разрешения вычисляются по ним при каждом запросе
+*/
+type Role struct {
+	Name        string    `json:"name" bson:"_id"`
+	Description string    `json:"description" bson:"description"`
+	Permissions []string  `json:"permissions" bson:"permissions"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+}
@@ -1,10 +1,24 @@
 package model
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
+/*
+Сессия пользователя. У first-party сессии ClientID пустой,
+сессии, выданные OAuth клиентам, хранят его client_id, выданные scope
+и время входа пользователя для auth_time обновлённых токенов.
+Device - устройство последнего входа в first-party сессию,
+Risk - оценка риска последнего входа или обновления токенов
+*/
 type Session struct {
 	ID           uuid.UUID    `json:"id" bson:"_id"`
+	ClientID     string       `json:"client_id,omitempty" bson:"client_id"`
+	Scope        string       `json:"scope,omitempty" bson:"scope"`
+	AuthTime     time.Time    `json:"auth_time" bson:"auth_time"`
 	RefreshToken RefreshToken `json:"refresh_token" bson:"refresh_token"`
+	Device       *Device      `json:"device,omitempty" bson:"device,omitempty"`
+	Risk         *Risk        `json:"risk,omitempty" bson:"risk,omitempty"`
 }
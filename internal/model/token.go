@@ -10,6 +10,13 @@ type AccessToken struct {
 	ID     uuid.UUID `json:"id" bson:"_id"`
 	UserID uuid.UUID `json:"user_id" bson:"user_id"`
 	Token  string    `json:"token" bson:"token"`
+	Scope  string    `json:"scope,omitempty" bson:"scope,omitempty"`
+}
+
+// Запрошенные scope и audience токена, выдаётся только их пересечение с разрешёнными
+type ScopeRequest struct {
+	Scope    string   `json:"scope"`
+	Audience []string `json:"audience"`
 }
 
 type RefreshToken struct {
@@ -19,3 +26,12 @@ type RefreshToken struct {
 	Token         string    `json:"token" bson:"token"`
 	ExpiresAt     time.Time `json:"expires_at" bson:"expires_at"`
 }
+
+/*
+Кто действует от имени субъекта токена, claim act (RFC 8693).
+При повторном обмене предыдущий актор вкладывается в Actor
+*/
+type Actor struct {
+	Subject string `json:"sub"`
+	Actor   *Actor `json:"act,omitempty"`
+}
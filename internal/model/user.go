@@ -3,6 +3,7 @@ package model
 import (
 	"errors"
 	"regexp"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -12,10 +13,30 @@ var (
 	ErrPasswordEmpty = errors.New("password cannot be empty")
 )
 
+/*
+Disabled и PasswordResetRequired выставляет администратор, PasswordResetRequired также
+сообщение о чужом входе: тогда пароль стирается, и задать новый можно только по ссылке из письма.
+FailedLogins считает неудачные входы подряд, после блокировки до LockedUntil счётчик сбрасывается
+*/
 type User struct {
-	UUID     uuid.UUID `json:"user_id" bson:"_id"`
-	Email    string    `json:"email" bson:"email"`
-	Password string    `json:"password" bson:"password"`
+	UUID                  uuid.UUID `json:"user_id" bson:"_id"`
+	Email                 string    `json:"email" bson:"email"`
+	Password              string    `json:"password" bson:"password"`
+	EmailVerified         bool      `json:"email_verified" bson:"email_verified"`
+	Disabled              bool      `json:"-" bson:"disabled"`
+	PasswordResetRequired bool      `json:"-" bson:"password_reset_required"`
+	FailedLogins          int       `json:"-" bson:"failed_logins"`
+	LockedUntil           time.Time `json:"-" bson:"locked_until,omitempty"`
+}
+
+// Пользователь заблокирован после неудачных входов
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil.After(now)
+}
+
+// Пароль стёрт после сообщения о чужом входе, старым паролем его не сменить
+func (u *User) PasswordRevoked() bool {
+	return u.Password == ""
 }
 
 func (u *User) Validate() error {
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	// Попытки исчерпаны, доставку можно только перезапустить вручную
+	WebhookDeliveryDead WebhookDeliveryStatus = "dead"
+)
+
+/*
+Подписка внешней системы на события из EventTypes. Тело доставки - Event в JSON,
+оно подписывается секретом подписки (HMAC-SHA256)
+*/
+type Webhook struct {
+	ID          uuid.UUID `json:"id" bson:"_id"`
+	URL         string    `json:"url" bson:"url"`
+	Events      []string  `json:"events" bson:"events"`
+	Description string    `json:"description" bson:"description"`
+	Active      bool      `json:"active" bson:"active"`
+	Secret      string    `json:"-" bson:"secret"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Подписка из admin API, Active по умолчанию true
+type WebhookInput struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	Active      *bool    `json:"active"`
+}
+
+// Секрет возвращается только при создании подписки и его ротации
+type WebhookSecret struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+/*
+Доставка события одному подписчику. Attempts растёт, когда доставку берут в работу,
+NextAttemptAt - когда её можно взять снова (следующая попытка или истечение аренды)
+*/
+type WebhookDelivery struct {
+	ID             uuid.UUID             `json:"id" bson:"_id"`
+	WebhookID      uuid.UUID             `json:"webhook_id" bson:"webhook_id"`
+	EventID        uuid.UUID             `json:"event_id" bson:"event_id"`
+	EventType      string                `json:"event_type" bson:"event_type"`
+	Payload        string                `json:"payload" bson:"payload"`
+	Status         WebhookDeliveryStatus `json:"status" bson:"status"`
+	Attempts       int                   `json:"attempts" bson:"attempts"`
+	NextAttemptAt  time.Time             `json:"next_attempt_at" bson:"next_attempt_at"`
+	LastAttemptAt  *time.Time            `json:"last_attempt_at,omitempty" bson:"last_attempt_at,omitempty"`
+	ResponseStatus int                   `json:"response_status,omitempty" bson:"response_status,omitempty"`
+	// Ошибка соединения или начало тела ответа последней неудачной попытки
+	Error       string     `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at" bson:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+}
+
+// Фильтр журнала доставок подписки, от новых к старым
+type WebhookDeliveryFilter struct {
+	WebhookID uuid.UUID
+	Status    WebhookDeliveryStatus
+	Offset    int
+	Limit     int
+}
+
+type WebhookDeliveryPage struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Offset     int               `json:"offset"`
+	Limit      int               `json:"limit"`
+}
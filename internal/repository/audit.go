@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/pkg/database/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrAuditEventConflict = errors.New("audit event with this sequence already exists")
+	ErrAuditEventNotFound = errors.New("audit event not found")
+	// Контрольная точка на этот номер события уже создана
+	ErrAuditCheckpointExists = errors.New("audit checkpoint already exists")
+)
+
+type AuditRepository struct {
+	provider *mongodb.Provider
+}
+
+func NewAuditRepository(provider *mongodb.Provider) *AuditRepository {
+	return &AuditRepository{
+		provider: provider,
+	}
+}
+
+// Добавляем событие в журнал
+func (r *AuditRepository) Create(ctx context.Context, event model.AuditEvent) error {
+	collection := r.provider.GetCollection("audit_events")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, event)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAuditEventConflict
+	}
+	return err
+}
+
+// Возвращаем события по фильтру, от новых к старым
+func (r *AuditRepository) List(ctx context.Context, filter model.AuditFilter) ([]model.AuditEvent, error) {
+	collection := r.provider.GetCollection("audit_events")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(filter.Offset)).
+		SetLimit(int64(filter.Limit))
+	cursor, err := collection.Find(ctx, auditFilter(filter), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []model.AuditEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Последнее событие потока
+func (r *AuditRepository) Last(ctx context.Context, stream string) (*model.AuditEvent, error) {
+	collection := r.provider.GetCollection("audit_events")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	var event model.AuditEvent
+	opts := options.FindOne().SetSort(bson.D{{Key: "sequence", Value: -1}})
+	err := collection.FindOne(ctx, bson.M{"stream": stream, "sequence": bson.M{"$gt": 0}}, opts).Decode(&event)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAuditEventNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// События потока с номерами больше after, по возрастанию номера
+func (r *AuditRepository) ListStream(ctx context.Context, stream string, after int64, limit int) ([]model.AuditEvent, error) {
+	collection := r.provider.GetCollection("audit_events")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "sequence", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, bson.M{"stream": stream, "sequence": bson.M{"$gt": after}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []model.AuditEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Потоки, в которых есть события или контрольные точки
+func (r *AuditRepository) Streams(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	var streams []string
+	for _, name := range []string{"audit_events", "audit_checkpoints"} {
+		values, err := r.provider.GetCollection(name).Distinct(ctx, "stream", bson.M{"stream": bson.M{"$gt": ""}})
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			if stream, ok := v.(string); ok && !slices.Contains(streams, stream) {
+				streams = append(streams, stream)
+			}
+		}
+	}
+	slices.Sort(streams)
+	return streams, nil
+}
+
+func (r *AuditRepository) CreateCheckpoint(ctx context.Context, checkpoint model.AuditCheckpoint) error {
+	collection := r.provider.GetCollection("audit_checkpoints")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, checkpoint)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAuditCheckpointExists
+	}
+	return err
+}
+
+// Контрольные точки потока по возрастанию номера события
+func (r *AuditRepository) ListCheckpoints(ctx context.Context, stream string) ([]model.AuditCheckpoint, error) {
+	collection := r.provider.GetCollection("audit_checkpoints")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.M{"stream": stream}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoints []model.AuditCheckpoint
+	if err := cursor.All(ctx, &checkpoints); err != nil {
+		return nil, err
+	}
+	return checkpoints, nil
+}
+
+func auditFilter(filter model.AuditFilter) bson.M {
+	query := bson.M{}
+	if filter.UserID != uuid.Nil {
+		id := filter.UserID.String()
+		query["$or"] = bson.A{bson.M{"actor.id": id}, bson.M{"subject.id": id}}
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	period := bson.M{}
+	if !filter.From.IsZero() {
+		period["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		period["$lt"] = filter.To
+	}
+	if len(period) > 0 {
+		query["time"] = period
+	}
+	return query
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+type MemoryAuditRepository struct {
+	db *memoryDB
+}
+
+// Добавляем событие в журнал
+func (r *MemoryAuditRepository) Create(ctx context.Context, event model.AuditEvent) error {
+	return r.db.write(ctx, func() (func(), error) {
+		if event.Sequence > 0 && slices.ContainsFunc(r.db.audit, func(e model.AuditEvent) bool {
+			return e.Stream == event.Stream && e.Sequence == event.Sequence
+		}) {
+			return nil, ErrAuditEventConflict
+		}
+		event.Details = maps.Clone(event.Details)
+		r.db.audit = append(r.db.audit, event)
+		n := len(r.db.audit) - 1
+		return func() {
+			r.db.audit = r.db.audit[:n]
+		}, nil
+	})
+}
+
+// Возвращаем события по фильтру, от новых к старым
+func (r *MemoryAuditRepository) List(ctx context.Context, filter model.AuditFilter) ([]model.AuditEvent, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var events []model.AuditEvent
+	for i := len(r.db.audit) - 1; i >= 0; i-- {
+		event := r.db.audit[i]
+		if !auditMatches(event, filter) {
+			continue
+		}
+		event.Details = maps.Clone(event.Details)
+		events = append(events, event)
+	}
+
+	// События добавляются по порядку, но время задаёт вызывающий
+	slices.SortStableFunc(events, func(a, b model.AuditEvent) int {
+		return b.Time.Compare(a.Time)
+	})
+	if filter.Offset >= len(events) {
+		return nil, nil
+	}
+	events = events[filter.Offset:]
+	return events[:min(filter.Limit, len(events))], nil
+}
+
+// Последнее событие потока
+func (r *MemoryAuditRepository) Last(ctx context.Context, stream string) (*model.AuditEvent, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var last *model.AuditEvent
+	for _, event := range r.db.audit {
+		if event.Stream != stream || event.Sequence == 0 {
+			continue
+		}
+		if last == nil || event.Sequence > last.Sequence {
+			event.Details = maps.Clone(event.Details)
+			last = &event
+		}
+	}
+	if last == nil {
+		return nil, ErrAuditEventNotFound
+	}
+	return last, nil
+}
+
+// События потока с номерами больше after, по возрастанию номера
+func (r *MemoryAuditRepository) ListStream(ctx context.Context, stream string, after int64, limit int) ([]model.AuditEvent, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var events []model.AuditEvent
+	for _, event := range r.db.audit {
+		if event.Stream != stream || event.Sequence <= after {
+			continue
+		}
+		event.Details = maps.Clone(event.Details)
+		events = append(events, event)
+	}
+	slices.SortFunc(events, func(a, b model.AuditEvent) int {
+		return cmp.Compare(a.Sequence, b.Sequence)
+	})
+	return events[:min(limit, len(events))], nil
+}
+
+// Потоки, в которых есть события или контрольные точки
+func (r *MemoryAuditRepository) Streams(ctx context.Context) ([]string, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var streams []string
+	for _, event := range r.db.audit {
+		if event.Stream != "" {
+			streams = append(streams, event.Stream)
+		}
+	}
+	for _, checkpoint := range r.db.auditCheckpoints {
+		streams = append(streams, checkpoint.Stream)
+	}
+	slices.Sort(streams)
+	return slices.Compact(streams), nil
+}
+
+func (r *MemoryAuditRepository) CreateCheckpoint(ctx context.Context, checkpoint model.AuditCheckpoint) error {
+	return r.db.write(ctx, func() (func(), error) {
+		if slices.ContainsFunc(r.db.auditCheckpoints, func(c model.AuditCheckpoint) bool {
+			return c.Stream == checkpoint.Stream && c.Sequence == checkpoint.Sequence
+		}) {
+			return nil, ErrAuditCheckpointExists
+		}
+		r.db.auditCheckpoints = append(r.db.auditCheckpoints, checkpoint)
+		n := len(r.db.auditCheckpoints) - 1
+		return func() {
+			r.db.auditCheckpoints = r.db.auditCheckpoints[:n]
+		}, nil
+	})
+}
+
+// Контрольные точки потока по возрастанию номера события
+func (r *MemoryAuditRepository) ListCheckpoints(ctx context.Context, stream string) ([]model.AuditCheckpoint, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var checkpoints []model.AuditCheckpoint
+	for _, checkpoint := range r.db.auditCheckpoints {
+		if checkpoint.Stream == stream {
+			checkpoints = append(checkpoints, checkpoint)
+		}
+	}
+	slices.SortStableFunc(checkpoints, func(a, b model.AuditCheckpoint) int {
+		return cmp.Compare(a.Sequence, b.Sequence)
+	})
+	return checkpoints, nil
+}
+
+func auditMatches(event model.AuditEvent, filter model.AuditFilter) bool {
+	if filter.UserID != uuid.Nil {
+		id := filter.UserID.String()
+		if event.Actor.ID != id && event.Subject.ID != id {
+			return false
+		}
+	}
+	switch {
+	case filter.Action != "" && event.Action != filter.Action:
+		return false
+	case !filter.From.IsZero() && event.Time.Before(filter.From):
+		return false
+	case !filter.To.IsZero() && !event.Time.Before(filter.To):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+const (
+	auditColumns = `id, time, action, outcome, actor_type, actor_id, subject_type, subject_id,
+	ip, user_agent, request_id, reason, details, stream, sequence, prev_hash, hash`
+	auditCheckpointColumns = `id, stream, sequence, hash, created_at, key_id, signature`
+)
+
+// Детали события храним JSON строкой
+type SQLAuditRepository struct {
+	conn sqlConn
+}
+
+// Добавляем событие в журнал
+func (r *SQLAuditRepository) Create(ctx context.Context, event model.AuditEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return err
+	}
+
+	_, err = executor(ctx, r.conn.db).ExecContext(ctx,
+		`INSERT INTO audit_events (`+auditColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`,
+		event.ID, event.Time.UTC(), event.Action, event.Outcome, event.Actor.Type, event.Actor.ID,
+		event.Subject.Type, event.Subject.ID, event.IP, event.UserAgent, event.RequestID, event.Reason, string(details),
+		event.Stream, event.Sequence, event.PrevHash, event.Hash,
+	)
+	if r.conn.isUniqueViolation(err) {
+		return ErrAuditEventConflict
+	}
+	return err
+}
+
+// Возвращаем события по фильтру, от новых к старым
+func (r *SQLAuditRepository) List(ctx context.Context, filter model.AuditFilter) ([]model.AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	where, args := auditWhere(filter)
+	args = append(args, filter.Limit, filter.Offset)
+	return r.query(ctx,
+		fmt.Sprintf(`SELECT `+auditColumns+` FROM audit_events %s ORDER BY time DESC, id DESC LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args)),
+		args...,
+	)
+}
+
+// Последнее событие потока
+func (r *SQLAuditRepository) Last(ctx context.Context, stream string) (*model.AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	events, err := r.query(ctx,
+		`SELECT `+auditColumns+` FROM audit_events WHERE stream = $1 AND sequence > 0 ORDER BY sequence DESC LIMIT 1`,
+		stream,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, ErrAuditEventNotFound
+	}
+	return &events[0], nil
+}
+
+// События потока с номерами больше after, по возрастанию номера
+func (r *SQLAuditRepository) ListStream(ctx context.Context, stream string, after int64, limit int) ([]model.AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	return r.query(ctx,
+		`SELECT `+auditColumns+` FROM audit_events WHERE stream = $1 AND sequence > $2 ORDER BY sequence LIMIT $3`,
+		stream, after, limit,
+	)
+}
+
+// Потоки, в которых есть события или контрольные точки
+func (r *SQLAuditRepository) Streams(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	rows, err := executor(ctx, r.conn.db).QueryContext(ctx,
+		`SELECT stream FROM audit_events WHERE stream <> ''
+		UNION SELECT stream FROM audit_checkpoints
+		ORDER BY stream`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var streams []string
+	for rows.Next() {
+		var stream string
+		if err := rows.Scan(&stream); err != nil {
+			return nil, err
+		}
+		streams = append(streams, stream)
+	}
+	return streams, rows.Err()
+}
+
+func (r *SQLAuditRepository) CreateCheckpoint(ctx context.Context, checkpoint model.AuditCheckpoint) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	_, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`INSERT INTO audit_checkpoints (`+auditCheckpointColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		checkpoint.ID, checkpoint.Stream, checkpoint.Sequence, checkpoint.Hash, checkpoint.CreatedAt.UTC(), checkpoint.KeyID, checkpoint.Signature,
+	)
+	if r.conn.isUniqueViolation(err) {
+		return ErrAuditCheckpointExists
+	}
+	return err
+}
+
+// Контрольные точки потока по возрастанию номера события
+func (r *SQLAuditRepository) ListCheckpoints(ctx context.Context, stream string) ([]model.AuditCheckpoint, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	rows, err := executor(ctx, r.conn.db).QueryContext(ctx,
+		`SELECT `+auditCheckpointColumns+` FROM audit_checkpoints WHERE stream = $1 ORDER BY sequence`,
+		stream,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []model.AuditCheckpoint
+	for rows.Next() {
+		var c model.AuditCheckpoint
+		if err := rows.Scan(&c.ID, &c.Stream, &c.Sequence, &c.Hash, &c.CreatedAt, &c.KeyID, &c.Signature); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, c)
+	}
+	return checkpoints, rows.Err()
+}
+
+func (r *SQLAuditRepository) query(ctx context.Context, query string, args ...any) ([]model.AuditEvent, error) {
+	rows, err := executor(ctx, r.conn.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.AuditEvent
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+	return events, rows.Err()
+}
+
+func scanAuditEvent(row interface{ Scan(dest ...any) error }) (*model.AuditEvent, error) {
+	var (
+		event   model.AuditEvent
+		details string
+	)
+	err := row.Scan(&event.ID, &event.Time, &event.Action, &event.Outcome, &event.Actor.Type, &event.Actor.ID,
+		&event.Subject.Type, &event.Subject.ID, &event.IP, &event.UserAgent, &event.RequestID, &event.Reason, &details,
+		&event.Stream, &event.Sequence, &event.PrevHash, &event.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(details), &event.Details); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func auditWhere(filter model.AuditFilter) (string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+	if filter.UserID != uuid.Nil {
+		args = append(args, filter.UserID.String())
+		conditions = append(conditions, fmt.Sprintf(`(actor_id = $%d OR subject_id = $%d)`, len(args), len(args)))
+	}
+	if filter.Action != "" {
+		args = append(args, filter.Action)
+		conditions = append(conditions, fmt.Sprintf(`action = $%d`, len(args)))
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From.UTC())
+		conditions = append(conditions, fmt.Sprintf(`time >= $%d`, len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To.UTC())
+		conditions = append(conditions, fmt.Sprintf(`time < $%d`, len(args)))
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
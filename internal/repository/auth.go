@@ -3,12 +3,15 @@ package repository
 import (
 	"context"
 	"errors"
+	"regexp"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/v7ktory/test/internal/model"
 	"github.com/v7ktory/test/pkg/database/mongodb"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
@@ -33,11 +36,10 @@ func (r *AuthRepository) Create(ctx context.Context, user *model.User) (uuid.UUI
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
 	defer cancel()
 
-	if err := collection.FindOne(ctx, bson.M{"email": user.Email}).Err(); err == nil {
+	_, err := collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
 		return uuid.Nil, ErrUserExists
 	}
-
-	_, err := collection.InsertOne(ctx, user)
 	if err != nil {
 		return uuid.Nil, err
 	}
@@ -57,3 +59,116 @@ func (r *AuthRepository) GetByEmail(ctx context.Context, email string) (*model.U
 	}
 	return &user, nil
 }
+
+// Возвращаем пользователя по ID
+func (r *AuthRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	collection := r.provider.GetCollection("users")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	var user model.User
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Возвращаем страницу пользователей по фильтру
+func (r *AuthRepository) List(ctx context.Context, filter model.UserFilter) ([]model.User, error) {
+	collection := r.provider.GetCollection("users")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "email", Value: 1}}).
+		SetSkip(int64(filter.Offset)).
+		SetLimit(int64(filter.Limit))
+	cursor, err := collection.Find(ctx, userFilter(filter), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []model.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// Считаем пользователей по фильтру
+func (r *AuthRepository) Count(ctx context.Context, filter model.UserFilter) (int, error) {
+	collection := r.provider.GetCollection("users")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	n, err := collection.CountDocuments(ctx, userFilter(filter))
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// Обновляем пароль и статус пользователя
+func (r *AuthRepository) Update(ctx context.Context, user model.User) error {
+	collection := r.provider.GetCollection("users")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"password":                user.Password,
+		"email_verified":          user.EmailVerified,
+		"disabled":                user.Disabled,
+		"password_reset_required": user.PasswordResetRequired,
+		"failed_logins":           user.FailedLogins,
+		"locked_until":            user.LockedUntil,
+	}}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": user.UUID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// Удаляем пользователя
+func (r *AuthRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	collection := r.provider.GetCollection("users")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func userFilter(filter model.UserFilter) bson.M {
+	query := bson.M{}
+	if filter.Email != "" {
+		query["email"] = bson.M{"$regex": regexp.QuoteMeta(filter.Email), "$options": "i"}
+	}
+	if filter.Disabled != nil {
+		// У пользователей, созданных до появления поля, его нет
+		if *filter.Disabled {
+			query["disabled"] = true
+		} else {
+			query["disabled"] = bson.M{"$ne": true}
+		}
+	}
+	return query
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+type MemoryAuthRepository struct {
+	db *memoryDB
+}
+
+// Создаём пользователя
+func (r *MemoryAuthRepository) Create(ctx context.Context, user *model.User) (uuid.UUID, error) {
+	err := r.db.write(ctx, func() (func(), error) {
+		if _, ok := r.db.emails[user.Email]; ok {
+			return nil, ErrUserExists
+		}
+		if _, ok := r.db.users[user.UUID]; ok {
+			return nil, ErrUserExists
+		}
+
+		r.db.users[user.UUID] = *user
+		r.db.emails[user.Email] = user.UUID
+		return func() {
+			delete(r.db.users, user.UUID)
+			delete(r.db.emails, user.Email)
+		}, nil
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return user.UUID, nil
+}
+
+// Возвращаем пользователя по email
+func (r *MemoryAuthRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	id, ok := r.db.emails[email]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	user := r.db.users[id]
+	return &user, nil
+}
+
+// Возвращаем пользователя по ID
+func (r *MemoryAuthRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	user, ok := r.db.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// Возвращаем страницу пользователей по фильтру
+func (r *MemoryAuthRepository) List(ctx context.Context, filter model.UserFilter) ([]model.User, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	users := r.filter(filter)
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Email < users[j].Email
+	})
+
+	if filter.Offset >= len(users) {
+		return nil, nil
+	}
+	users = users[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(users) {
+		users = users[:filter.Limit]
+	}
+	return users, nil
+}
+
+// Считаем пользователей по фильтру
+func (r *MemoryAuthRepository) Count(ctx context.Context, filter model.UserFilter) (int, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	return len(r.filter(filter)), nil
+}
+
+func (r *MemoryAuthRepository) filter(filter model.UserFilter) []model.User {
+	email := strings.ToLower(filter.Email)
+
+	var users []model.User
+	for _, user := range r.db.users {
+		if !strings.Contains(strings.ToLower(user.Email), email) {
+			continue
+		}
+		if filter.Disabled != nil && user.Disabled != *filter.Disabled {
+			continue
+		}
+		users = append(users, user)
+	}
+	return users
+}
+
+// Обновляем пароль и статус пользователя
+func (r *MemoryAuthRepository) Update(ctx context.Context, user model.User) error {
+	return r.db.write(ctx, func() (func(), error) {
+		prev, ok := r.db.users[user.UUID]
+		if !ok {
+			return nil, ErrUserNotFound
+		}
+
+		user.Email = prev.Email
+		r.db.users[user.UUID] = user
+		return func() {
+			r.db.users[user.UUID] = prev
+		}, nil
+	})
+}
+
+// Удаляем пользователя вместе с назначенными ролями, как каскад в SQL
+func (r *MemoryAuthRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.db.write(ctx, func() (func(), error) {
+		user, ok := r.db.users[id]
+		if !ok {
+			return nil, ErrUserNotFound
+		}
+
+		roles, hasRoles := r.db.userRoles[id]
+		delete(r.db.users, id)
+		delete(r.db.emails, user.Email)
+		delete(r.db.userRoles, id)
+		return func() {
+			r.db.users[id] = user
+			r.db.emails[user.Email] = id
+			if hasRoles {
+				r.db.userRoles[id] = roles
+			}
+		}, nil
+	})
+}
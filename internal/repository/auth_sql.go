@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+const userColumns = `id, email, password, email_verified, disabled, password_reset_required, failed_logins, locked_until`
+
+// Реализация поверх database/sql, используется для PostgreSQL и SQLite
+type SQLAuthRepository struct {
+	conn sqlConn
+}
+
+// Создаём пользователя
+func (r *SQLAuthRepository) Create(ctx context.Context, user *model.User) (uuid.UUID, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	_, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`INSERT INTO users (`+userColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		user.UUID, user.Email, user.Password, user.EmailVerified,
+		user.Disabled, user.PasswordResetRequired, user.FailedLogins, nullTime(user.LockedUntil),
+	)
+	if r.conn.isUniqueViolation(err) {
+		return uuid.Nil, ErrUserExists
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return user.UUID, nil
+}
+
+// Возвращаем пользователя по email
+func (r *SQLAuthRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	return r.get(ctx, `email = $1`, email)
+}
+
+// Возвращаем пользователя по ID
+func (r *SQLAuthRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	return r.get(ctx, `id = $1`, id)
+}
+
+func (r *SQLAuthRepository) get(ctx context.Context, where string, arg any) (*model.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	user, err := scanUser(executor(ctx, r.conn.db).QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE `+where,
+		arg,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Возвращаем страницу пользователей по фильтру
+func (r *SQLAuthRepository) List(ctx context.Context, filter model.UserFilter) ([]model.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	where, args := userWhere(filter)
+	args = append(args, filter.Limit, filter.Offset)
+	rows, err := executor(ctx, r.conn.db).QueryContext(ctx,
+		fmt.Sprintf(`SELECT `+userColumns+` FROM users %s ORDER BY email LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args)),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+// Считаем пользователей по фильтру
+func (r *SQLAuthRepository) Count(ctx context.Context, filter model.UserFilter) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	where, args := userWhere(filter)
+	var n int
+	err := executor(ctx, r.conn.db).QueryRowContext(ctx, `SELECT COUNT(*) FROM users `+where, args...).Scan(&n)
+	return n, err
+}
+
+// Обновляем пароль и статус пользователя
+func (r *SQLAuthRepository) Update(ctx context.Context, user model.User) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`UPDATE users
+		SET password = $2, email_verified = $3, disabled = $4, password_reset_required = $5, failed_logins = $6, locked_until = $7
+		WHERE id = $1`,
+		user.UUID, user.Password, user.EmailVerified,
+		user.Disabled, user.PasswordResetRequired, user.FailedLogins, nullTime(user.LockedUntil),
+	)
+	if err != nil {
+		return err
+	}
+	return userAffected(result)
+}
+
+// Удаляем пользователя, сессии, роли и согласия удаляются каскадно
+func (r *SQLAuthRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return userAffected(result)
+}
+
+// Условие WHERE для фильтра, плейсхолдеры нумеруются с $1
+func userWhere(filter model.UserFilter) (string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+	if filter.Email != "" {
+		args = append(args, "%"+escapeLike(strings.ToLower(filter.Email))+"%")
+		conditions = append(conditions, fmt.Sprintf(`LOWER(email) LIKE $%d ESCAPE '\'`, len(args)))
+	}
+	if filter.Disabled != nil {
+		args = append(args, *filter.Disabled)
+		conditions = append(conditions, fmt.Sprintf(`disabled = $%d`, len(args)))
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func scanUser(row interface{ Scan(dest ...any) error }) (*model.User, error) {
+	var (
+		user        model.User
+		lockedUntil sql.NullTime
+	)
+	err := row.Scan(&user.UUID, &user.Email, &user.Password, &user.EmailVerified,
+		&user.Disabled, &user.PasswordResetRequired, &user.FailedLogins, &lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		user.LockedUntil = lockedUntil.Time
+	}
+	return &user, nil
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func userAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
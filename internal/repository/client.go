@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/pkg/database/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrClientExists   = errors.New("client already exists")
+	ErrClientNotFound = errors.New("client not found")
+)
+
+type ClientRepository struct {
+	provider *mongodb.Provider
+}
+
+func NewClientRepository(provider *mongodb.Provider) *ClientRepository {
+	return &ClientRepository{
+		provider: provider,
+	}
+}
+
+// Регистрируем клиента
+func (r *ClientRepository) Create(ctx context.Context, client *model.Client) error {
+	collection := r.provider.GetCollection("clients")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, client)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrClientExists
+	}
+	return err
+}
+
+// Возвращаем клиента по client_id
+func (r *ClientRepository) GetByID(ctx context.Context, id string) (*model.Client, error) {
+	collection := r.provider.GetCollection("clients")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	var client model.Client
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&client)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// Заменяем хэш секрета клиента
+func (r *ClientRepository) UpdateSecret(ctx context.Context, id, secretHash string) error {
+	collection := r.provider.GetCollection("clients")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"secret_hash": secretHash}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrClientNotFound
+	}
+	return nil
+}
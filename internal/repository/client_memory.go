@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/v7ktory/test/internal/model"
+)
+
+type MemoryClientRepository struct {
+	db *memoryDB
+}
+
+// Регистрируем клиента
+func (r *MemoryClientRepository) Create(ctx context.Context, client *model.Client) error {
+	return r.db.write(ctx, func() (func(), error) {
+		if _, ok := r.db.clients[client.ID]; ok {
+			return nil, ErrClientExists
+		}
+
+		r.db.clients[client.ID] = *client
+		return func() {
+			delete(r.db.clients, client.ID)
+		}, nil
+	})
+}
+
+// Возвращаем клиента по client_id
+func (r *MemoryClientRepository) GetByID(ctx context.Context, id string) (*model.Client, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	client, ok := r.db.clients[id]
+	if !ok {
+		return nil, ErrClientNotFound
+	}
+	return &client, nil
+}
+
+// Заменяем хэш секрета клиента
+func (r *MemoryClientRepository) UpdateSecret(ctx context.Context, id, secretHash string) error {
+	return r.db.write(ctx, func() (func(), error) {
+		prev, ok := r.db.clients[id]
+		if !ok {
+			return nil, ErrClientNotFound
+		}
+
+		client := prev
+		client.SecretHash = secretHash
+		r.db.clients[id] = client
+		return func() {
+			r.db.clients[id] = prev
+		}, nil
+	})
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/v7ktory/test/internal/model"
+)
+
+type SQLClientRepository struct {
+	conn sqlConn
+}
+
+// Регистрируем клиента
+func (r *SQLClientRepository) Create(ctx context.Context, client *model.Client) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	redirectURIs, err := json.Marshal(client.RedirectURIs)
+	if err != nil {
+		return err
+	}
+	scopes, err := json.Marshal(client.Scopes)
+	if err != nil {
+		return err
+	}
+	audiences, err := json.Marshal(client.Audiences)
+	if err != nil {
+		return err
+	}
+
+	_, err = executor(ctx, r.conn.db).ExecContext(ctx,
+		`INSERT INTO clients (id, name, secret_hash, public, redirect_uris, scopes, public_key, audiences, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		client.ID, client.Name, client.SecretHash, client.Public, string(redirectURIs), string(scopes),
+		client.PublicKey, string(audiences), client.CreatedAt.UTC(),
+	)
+	if r.conn.isUniqueViolation(err) {
+		return ErrClientExists
+	}
+	return err
+}
+
+// Возвращаем клиента по client_id
+func (r *SQLClientRepository) GetByID(ctx context.Context, id string) (*model.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	var (
+		client       model.Client
+		redirectURIs string
+		scopes       string
+		audiences    string
+	)
+	err := executor(ctx, r.conn.db).QueryRowContext(ctx,
+		`SELECT id, name, secret_hash, public, redirect_uris, scopes, public_key, audiences, created_at
+		FROM clients WHERE id = $1`,
+		id,
+	).Scan(&client.ID, &client.Name, &client.SecretHash, &client.Public, &redirectURIs, &scopes,
+		&client.PublicKey, &audiences, &client.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(redirectURIs), &client.RedirectURIs); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &client.Scopes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(audiences), &client.Audiences); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// Заменяем хэш секрета клиента
+func (r *SQLClientRepository) UpdateSecret(ctx context.Context, id, secretHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`UPDATE clients SET secret_hash = $2 WHERE id = $1`,
+		id, secretHash,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrClientNotFound
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/pkg/database/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrDeviceAuthorizationNotFound = errors.New("device authorization not found")
+	ErrDeviceUserCodeExists        = errors.New("device user code already exists")
+	ErrDevicePollTooFrequent       = errors.New("device polls too frequently")
+)
+
+type DeviceAuthorizationRepository struct {
+	provider *mongodb.Provider
+}
+
+func NewDeviceAuthorizationRepository(provider *mongodb.Provider) *DeviceAuthorizationRepository {
+	return &DeviceAuthorizationRepository{
+		provider: provider,
+	}
+}
+
+// Сохраняем запрос авторизации устройства, просроченные удаляет TTL индекс
+func (r *DeviceAuthorizationRepository) Create(ctx context.Context, auth model.DeviceAuthorization) error {
+	collection := r.provider.GetCollection("device_authorizations")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, auth)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDeviceUserCodeExists
+	}
+	return err
+}
+
+// Возвращаем запрос по коду, который ввёл пользователь
+func (r *DeviceAuthorizationRepository) GetByUserCode(ctx context.Context, userCode string) (*model.DeviceAuthorization, error) {
+	collection := r.provider.GetCollection("device_authorizations")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	var auth model.DeviceAuthorization
+	err := collection.FindOne(ctx, bson.M{"user_code": userCode}).Decode(&auth)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrDeviceAuthorizationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &auth, nil
+}
+
+// Фиксируем решение пользователя, только пока запрос ожидает и не истёк
+func (r *DeviceAuthorizationRepository) Decide(ctx context.Context, userCode string, userID uuid.UUID, status string, authTime time.Time) error {
+	collection := r.provider.GetCollection("device_authorizations")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	filter := bson.M{
+		"user_code":  userCode,
+		"status":     model.DeviceAuthorizationPending,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	update := bson.M{"$set": bson.M{"status": status, "user_id": userID, "auth_time": authTime}}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrDeviceAuthorizationNotFound
+	}
+	return nil
+}
+
+/*
+Отмечаем опрос устройства и сдвигаем время следующего.
+Если устройство пришло раньше next_poll_at, возвращаем ErrDevicePollTooFrequent
+*/
+func (r *DeviceAuthorizationRepository) Poll(ctx context.Context, deviceCodeHash string, now, nextPollAt time.Time) (*model.DeviceAuthorization, error) {
+	collection := r.provider.GetCollection("device_authorizations")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	var auth model.DeviceAuthorization
+	filter := bson.M{"_id": deviceCodeHash, "next_poll_at": bson.M{"$lte": now}}
+	update := bson.M{"$set": bson.M{"next_poll_at": nextPollAt}}
+	err := collection.FindOneAndUpdate(ctx, filter, update).Decode(&auth)
+	if err == nil {
+		return &auth, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": deviceCodeHash})
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrDevicePollTooFrequent
+	}
+	return nil, ErrDeviceAuthorizationNotFound
+}
+
+// Атомарно забираем подтверждённый запрос, выдать по нему токены можно один раз
+func (r *DeviceAuthorizationRepository) Consume(ctx context.Context, deviceCodeHash string) (*model.DeviceAuthorization, error) {
+	collection := r.provider.GetCollection("device_authorizations")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	var auth model.DeviceAuthorization
+	filter := bson.M{"_id": deviceCodeHash, "status": model.DeviceAuthorizationApproved}
+	err := collection.FindOneAndDelete(ctx, filter).Decode(&auth)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrDeviceAuthorizationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &auth, nil
+}
+
+// Удаляем просроченные запросы авторизации устройств, не дожидаясь TTL индекса
+func (r *DeviceAuthorizationRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	collection := r.provider.GetCollection("device_authorizations")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	result, err := collection.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lte": now}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
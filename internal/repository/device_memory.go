@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+type MemoryDeviceAuthorizationRepository struct {
+	db *memoryDB
+}
+
+// Сохраняем запрос авторизации устройства и попутно чистим просроченные
+func (r *MemoryDeviceAuthorizationRepository) Create(ctx context.Context, auth model.DeviceAuthorization) error {
+	return r.db.write(ctx, func() (func(), error) {
+		now := time.Now()
+		for hash, d := range r.db.devices {
+			if !d.ExpiresAt.After(now) {
+				delete(r.db.devices, hash)
+			}
+		}
+		for _, d := range r.db.devices {
+			if d.UserCode == auth.UserCode {
+				return nil, ErrDeviceUserCodeExists
+			}
+		}
+
+		r.db.devices[auth.DeviceCodeHash] = auth
+		return func() {
+			delete(r.db.devices, auth.DeviceCodeHash)
+		}, nil
+	})
+}
+
+// Возвращаем запрос по коду, который ввёл пользователь
+func (r *MemoryDeviceAuthorizationRepository) GetByUserCode(ctx context.Context, userCode string) (*model.DeviceAuthorization, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	for _, auth := range r.db.devices {
+		if auth.UserCode == userCode {
+			return &auth, nil
+		}
+	}
+	return nil, ErrDeviceAuthorizationNotFound
+}
+
+// Фиксируем решение пользователя, только пока запрос ожидает и не истёк
+func (r *MemoryDeviceAuthorizationRepository) Decide(ctx context.Context, userCode string, userID uuid.UUID, status string, authTime time.Time) error {
+	return r.db.write(ctx, func() (func(), error) {
+		for hash, prev := range r.db.devices {
+			if prev.UserCode != userCode ||
+				prev.Status != model.DeviceAuthorizationPending ||
+				!prev.ExpiresAt.After(time.Now()) {
+				continue
+			}
+
+			auth := prev
+			auth.Status = status
+			auth.UserID = userID
+			auth.AuthTime = authTime
+			r.db.devices[hash] = auth
+			return func() {
+				r.db.devices[hash] = prev
+			}, nil
+		}
+		return nil, ErrDeviceAuthorizationNotFound
+	})
+}
+
+/*
+Отмечаем опрос устройства и сдвигаем время следующего.
+Если устройство пришло раньше next_poll_at, возвращаем ErrDevicePollTooFrequent
+*/
+func (r *MemoryDeviceAuthorizationRepository) Poll(ctx context.Context, deviceCodeHash string, now, nextPollAt time.Time) (*model.DeviceAuthorization, error) {
+	var auth model.DeviceAuthorization
+	err := r.db.write(ctx, func() (func(), error) {
+		prev, ok := r.db.devices[deviceCodeHash]
+		if !ok {
+			return nil, ErrDeviceAuthorizationNotFound
+		}
+		if prev.NextPollAt.After(now) {
+			return nil, ErrDevicePollTooFrequent
+		}
+
+		auth = prev
+		updated := prev
+		updated.NextPollAt = nextPollAt
+		r.db.devices[deviceCodeHash] = updated
+		return func() {
+			r.db.devices[deviceCodeHash] = prev
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &auth, nil
+}
+
+// Атомарно забираем подтверждённый запрос, выдать по нему токены можно один раз
+func (r *MemoryDeviceAuthorizationRepository) Consume(ctx context.Context, deviceCodeHash string) (*model.DeviceAuthorization, error) {
+	var auth model.DeviceAuthorization
+	err := r.db.write(ctx, func() (func(), error) {
+		prev, ok := r.db.devices[deviceCodeHash]
+		if !ok || prev.Status != model.DeviceAuthorizationApproved {
+			return nil, ErrDeviceAuthorizationNotFound
+		}
+
+		auth = prev
+		delete(r.db.devices, deviceCodeHash)
+		return func() {
+			r.db.devices[deviceCodeHash] = prev
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &auth, nil
+}
+
+// Удаляем просроченные запросы авторизации устройств
+func (r *MemoryDeviceAuthorizationRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	var n int
+	err := r.db.write(ctx, func() (func(), error) {
+		deleted := make(map[string]model.DeviceAuthorization)
+		for k, v := range r.db.devices {
+			if !v.ExpiresAt.After(now) {
+				deleted[k] = v
+				delete(r.db.devices, k)
+			}
+		}
+		n = len(deleted)
+		return func() {
+			for k, v := range deleted {
+				r.db.devices[k] = v
+			}
+		}, nil
+	})
+	return n, err
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+const deviceAuthorizationColumns = `device_code_hash, user_code, client_id, scope, status, user_id, auth_time, next_poll_at, expires_at`
+
+type SQLDeviceAuthorizationRepository struct {
+	conn sqlConn
+}
+
+// Сохраняем запрос авторизации устройства и попутно чистим просроченные
+func (r *SQLDeviceAuthorizationRepository) Create(ctx context.Context, auth model.DeviceAuthorization) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	db := executor(ctx, r.conn.db)
+	if _, err := db.ExecContext(ctx, `DELETE FROM device_authorizations WHERE expires_at <= $1`, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO device_authorizations (`+deviceAuthorizationColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		auth.DeviceCodeHash, auth.UserCode, auth.ClientID, auth.Scope, auth.Status,
+		nullUUID(auth.UserID), auth.AuthTime.UTC(), auth.NextPollAt.UTC(), auth.ExpiresAt.UTC(),
+	)
+	if r.conn.isUniqueViolation(err) {
+		return ErrDeviceUserCodeExists
+	}
+	return err
+}
+
+// Возвращаем запрос по коду, который ввёл пользователь
+func (r *SQLDeviceAuthorizationRepository) GetByUserCode(ctx context.Context, userCode string) (*model.DeviceAuthorization, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	row := executor(ctx, r.conn.db).QueryRowContext(ctx,
+		`SELECT `+deviceAuthorizationColumns+` FROM device_authorizations WHERE user_code = $1`,
+		userCode,
+	)
+	return scanDeviceAuthorization(row)
+}
+
+// Фиксируем решение пользователя, только пока запрос ожидает и не истёк
+func (r *SQLDeviceAuthorizationRepository) Decide(ctx context.Context, userCode string, userID uuid.UUID, status string, authTime time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`UPDATE device_authorizations SET status = $2, user_id = $3, auth_time = $4
+		WHERE user_code = $1 AND status = $5 AND expires_at > $6`,
+		userCode, status, userID, authTime.UTC(), model.DeviceAuthorizationPending, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDeviceAuthorizationNotFound
+	}
+	return nil
+}
+
+/*
+Отмечаем опрос устройства и сдвигаем время следующего.
+Если устройство пришло раньше next_poll_at, возвращаем ErrDevicePollTooFrequent
+*/
+func (r *SQLDeviceAuthorizationRepository) Poll(ctx context.Context, deviceCodeHash string, now, nextPollAt time.Time) (*model.DeviceAuthorization, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	db := executor(ctx, r.conn.db)
+	auth, err := scanDeviceAuthorization(db.QueryRowContext(ctx,
+		`UPDATE device_authorizations SET next_poll_at = $3
+		WHERE device_code_hash = $1 AND next_poll_at <= $2
+		RETURNING `+deviceAuthorizationColumns,
+		deviceCodeHash, now.UTC(), nextPollAt.UTC(),
+	))
+	if !errors.Is(err, ErrDeviceAuthorizationNotFound) {
+		return auth, err
+	}
+
+	var exists int
+	err = db.QueryRowContext(ctx,
+		`SELECT 1 FROM device_authorizations WHERE device_code_hash = $1`,
+		deviceCodeHash,
+	).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeviceAuthorizationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, ErrDevicePollTooFrequent
+}
+
+// Атомарно забираем подтверждённый запрос, выдать по нему токены можно один раз
+func (r *SQLDeviceAuthorizationRepository) Consume(ctx context.Context, deviceCodeHash string) (*model.DeviceAuthorization, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	row := executor(ctx, r.conn.db).QueryRowContext(ctx,
+		`DELETE FROM device_authorizations WHERE device_code_hash = $1 AND status = $2
+		RETURNING `+deviceAuthorizationColumns,
+		deviceCodeHash, model.DeviceAuthorizationApproved,
+	)
+	return scanDeviceAuthorization(row)
+}
+
+func scanDeviceAuthorization(row *sql.Row) (*model.DeviceAuthorization, error) {
+	var (
+		auth   model.DeviceAuthorization
+		userID uuid.NullUUID
+	)
+	err := row.Scan(&auth.DeviceCodeHash, &auth.UserCode, &auth.ClientID, &auth.Scope, &auth.Status,
+		&userID, &auth.AuthTime, &auth.NextPollAt, &auth.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeviceAuthorizationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	auth.UserID = userID.UUID
+	return &auth, nil
+}
+
+// Пока пользователь не подтвердил запрос, user_id пустой и не ссылается на users
+func nullUUID(id uuid.UUID) uuid.NullUUID {
+	return uuid.NullUUID{UUID: id, Valid: id != uuid.Nil}
+}
+
+// Удаляем просроченные запросы авторизации устройств
+func (r *SQLDeviceAuthorizationRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx, `DELETE FROM device_authorizations WHERE expires_at <= $1`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/pkg/database/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrKnownDeviceNotFound = errors.New("known device not found")
+	ErrKnownDeviceExists   = errors.New("known device already exists")
+)
+
+type KnownDeviceRepository struct {
+	provider *mongodb.Provider
+}
+
+func NewKnownDeviceRepository(provider *mongodb.Provider) *KnownDeviceRepository {
+	return &KnownDeviceRepository{
+		provider: provider,
+	}
+}
+
+// Запоминаем устройство, уникальный индекс не даёт записать его дважды
+func (r *KnownDeviceRepository) Create(ctx context.Context, device model.KnownDevice) error {
+	collection := r.provider.GetCollection("known_devices")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, device)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrKnownDeviceExists
+	}
+	return err
+}
+
+func (r *KnownDeviceRepository) GetByID(ctx context.Context, userID, id uuid.UUID) (*model.KnownDevice, error) {
+	return r.get(ctx, bson.M{"_id": id, "user_id": userID})
+}
+
+func (r *KnownDeviceRepository) GetByDevice(ctx context.Context, userID uuid.UUID, device model.Device) (*model.KnownDevice, error) {
+	return r.get(ctx, bson.M{"user_id": userID, "user_agent": device.UserAgent, "network": device.Network})
+}
+
+func (r *KnownDeviceRepository) get(ctx context.Context, filter bson.M) (*model.KnownDevice, error) {
+	collection := r.provider.GetCollection("known_devices")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	var device model.KnownDevice
+	err := collection.FindOne(ctx, filter).Decode(&device)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrKnownDeviceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// Устройства пользователя, от последних использованных к давним
+func (r *KnownDeviceRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]model.KnownDevice, error) {
+	collection := r.provider.GetCollection("known_devices")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}})
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []model.KnownDevice
+	if err := cursor.All(ctx, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (r *KnownDeviceRepository) UpdateLastSeen(ctx context.Context, id uuid.UUID, lastSeenAt time.Time) error {
+	collection := r.provider.GetCollection("known_devices")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_seen_at": lastSeenAt}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrKnownDeviceNotFound
+	}
+	return nil
+}
+
+func (r *KnownDeviceRepository) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	collection := r.provider.GetCollection("known_devices")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrKnownDeviceNotFound
+	}
+	return nil
+}
+
+func (r *KnownDeviceRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	collection := r.provider.GetCollection("known_devices")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	_, err := collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
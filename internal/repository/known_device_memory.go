@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+type MemoryKnownDeviceRepository struct {
+	db *memoryDB
+}
+
+// Запоминаем устройство, одно устройство пользователя хранится один раз
+func (r *MemoryKnownDeviceRepository) Create(ctx context.Context, device model.KnownDevice) error {
+	return r.db.write(ctx, func() (func(), error) {
+		for _, known := range r.db.knownDevices {
+			if known.UserID == device.UserID && known.Device == device.Device {
+				return nil, ErrKnownDeviceExists
+			}
+		}
+		r.db.knownDevices[device.ID] = device
+		return func() {
+			delete(r.db.knownDevices, device.ID)
+		}, nil
+	})
+}
+
+func (r *MemoryKnownDeviceRepository) GetByID(ctx context.Context, userID, id uuid.UUID) (*model.KnownDevice, error) {
+	return r.get(func(device model.KnownDevice) bool {
+		return device.ID == id && device.UserID == userID
+	})
+}
+
+func (r *MemoryKnownDeviceRepository) GetByDevice(ctx context.Context, userID uuid.UUID, device model.Device) (*model.KnownDevice, error) {
+	return r.get(func(known model.KnownDevice) bool {
+		return known.UserID == userID && known.Device == device
+	})
+}
+
+func (r *MemoryKnownDeviceRepository) get(match func(model.KnownDevice) bool) (*model.KnownDevice, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	for _, device := range r.db.knownDevices {
+		if match(device) {
+			return &device, nil
+		}
+	}
+	return nil, ErrKnownDeviceNotFound
+}
+
+// Устройства пользователя, от последних использованных к давним
+func (r *MemoryKnownDeviceRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]model.KnownDevice, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var devices []model.KnownDevice
+	for _, device := range r.db.knownDevices {
+		if device.UserID == userID {
+			devices = append(devices, device)
+		}
+	}
+	slices.SortFunc(devices, func(a, b model.KnownDevice) int {
+		return b.LastSeenAt.Compare(a.LastSeenAt)
+	})
+	return devices, nil
+}
+
+func (r *MemoryKnownDeviceRepository) UpdateLastSeen(ctx context.Context, id uuid.UUID, lastSeenAt time.Time) error {
+	return r.db.write(ctx, func() (func(), error) {
+		prev, ok := r.db.knownDevices[id]
+		if !ok {
+			return nil, ErrKnownDeviceNotFound
+		}
+		updated := prev
+		updated.LastSeenAt = lastSeenAt
+		r.db.knownDevices[id] = updated
+		return func() {
+			r.db.knownDevices[id] = prev
+		}, nil
+	})
+}
+
+func (r *MemoryKnownDeviceRepository) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	return r.db.write(ctx, func() (func(), error) {
+		prev, ok := r.db.knownDevices[id]
+		if !ok || prev.UserID != userID {
+			return nil, ErrKnownDeviceNotFound
+		}
+		delete(r.db.knownDevices, id)
+		return func() {
+			r.db.knownDevices[id] = prev
+		}, nil
+	})
+}
+
+func (r *MemoryKnownDeviceRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	return r.db.write(ctx, func() (func(), error) {
+		deleted := make(map[uuid.UUID]model.KnownDevice)
+		for id, device := range r.db.knownDevices {
+			if device.UserID == userID {
+				deleted[id] = device
+				delete(r.db.knownDevices, id)
+			}
+		}
+		return func() {
+			for id, device := range deleted {
+				r.db.knownDevices[id] = device
+			}
+		}, nil
+	})
+}
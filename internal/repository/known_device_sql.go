@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+const knownDeviceColumns = `id, user_id, user_agent, network, first_seen_at, last_seen_at`
+
+type SQLKnownDeviceRepository struct {
+	conn sqlConn
+}
+
+// Запоминаем устройство, уникальный индекс не даёт записать его дважды
+func (r *SQLKnownDeviceRepository) Create(ctx context.Context, device model.KnownDevice) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	_, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`INSERT INTO known_devices (`+knownDeviceColumns+`) VALUES ($1, $2, $3, $4, $5, $6)`,
+		device.ID, device.UserID, device.UserAgent, device.Network, device.FirstSeenAt.UTC(), device.LastSeenAt.UTC(),
+	)
+	if r.conn.isUniqueViolation(err) {
+		return ErrKnownDeviceExists
+	}
+	return err
+}
+
+func (r *SQLKnownDeviceRepository) GetByID(ctx context.Context, userID, id uuid.UUID) (*model.KnownDevice, error) {
+	return r.get(ctx, `WHERE id = $1 AND user_id = $2`, id, userID)
+}
+
+func (r *SQLKnownDeviceRepository) GetByDevice(ctx context.Context, userID uuid.UUID, device model.Device) (*model.KnownDevice, error) {
+	return r.get(ctx, `WHERE user_id = $1 AND user_agent = $2 AND network = $3`, userID, device.UserAgent, device.Network)
+}
+
+func (r *SQLKnownDeviceRepository) get(ctx context.Context, where string, args ...any) (*model.KnownDevice, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	var device model.KnownDevice
+	err := executor(ctx, r.conn.db).QueryRowContext(ctx, `SELECT `+knownDeviceColumns+` FROM known_devices `+where, args...).
+		Scan(&device.ID, &device.UserID, &device.UserAgent, &device.Network, &device.FirstSeenAt, &device.LastSeenAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrKnownDeviceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// Устройства пользователя, от последних использованных к давним
+func (r *SQLKnownDeviceRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]model.KnownDevice, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	rows, err := executor(ctx, r.conn.db).QueryContext(ctx,
+		`SELECT `+knownDeviceColumns+` FROM known_devices WHERE user_id = $1 ORDER BY last_seen_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []model.KnownDevice
+	for rows.Next() {
+		var device model.KnownDevice
+		if err := rows.Scan(&device.ID, &device.UserID, &device.UserAgent, &device.Network, &device.FirstSeenAt, &device.LastSeenAt); err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+func (r *SQLKnownDeviceRepository) UpdateLastSeen(ctx context.Context, id uuid.UUID, lastSeenAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`UPDATE known_devices SET last_seen_at = $2 WHERE id = $1`,
+		id, lastSeenAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrKnownDeviceNotFound)
+}
+
+func (r *SQLKnownDeviceRepository) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx, `DELETE FROM known_devices WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrKnownDeviceNotFound)
+}
+
+func (r *SQLKnownDeviceRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	_, err := executor(ctx, r.conn.db).ExecContext(ctx, `DELETE FROM known_devices WHERE user_id = $1`, userID)
+	return err
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/pkg/database/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MailQueueRepository struct {
+	provider *mongodb.Provider
+}
+
+func NewMailQueueRepository(provider *mongodb.Provider) *MailQueueRepository {
+	return &MailQueueRepository{
+		provider: provider,
+	}
+}
+
+// Ставим письмо в очередь, в транзакции вызывающего, если она есть в ctx
+func (r *MailQueueRepository) Create(ctx context.Context, message model.MailMessage) error {
+	collection := r.provider.GetCollection("mail_queue")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, message)
+	return err
+}
+
+/*
+Берём в работу письма, срок которых наступил. Каждое захватываем условным
+обновлением по числу попыток: если его уже взяла другая реплика, обновление не пройдёт
+*/
+func (r *MailQueueRepository) Claim(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.MailMessage, error) {
+	collection := r.provider.GetCollection("mail_queue")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	query := bson.M{"status": model.MailPending, "next_attempt_at": bson.M{"$lte": now}}
+	opts := options.Find().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var due []model.MailMessage
+	if err := cursor.All(ctx, &due); err != nil {
+		return nil, err
+	}
+
+	var claimed []model.MailMessage
+	for _, message := range due {
+		filter := bson.M{"_id": message.ID, "attempts": message.Attempts, "status": model.MailPending}
+		update := bson.M{
+			"$set": bson.M{"next_attempt_at": leaseUntil},
+			"$inc": bson.M{"attempts": 1},
+		}
+		result, err := collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return nil, err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		message.Attempts++
+		message.NextAttemptAt = leaseUntil
+		claimed = append(claimed, message)
+	}
+	return claimed, nil
+}
+
+// Сохраняем итог попытки отправки, если письмо не взяли заново: каждый Claim увеличивает attempts
+func (r *MailQueueRepository) Update(ctx context.Context, message model.MailMessage) error {
+	collection := r.provider.GetCollection("mail_queue")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	filter := bson.M{"_id": message.ID, "attempts": message.Attempts}
+	update := bson.M{"$set": bson.M{
+		"status":          message.Status,
+		"next_attempt_at": message.NextAttemptAt,
+		"error":           message.Error,
+		"sent_at":         message.SentAt,
+	}}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Удаляем отправленные и dead письма, созданные до before
+func (r *MailQueueRepository) DeleteFinished(ctx context.Context, before time.Time) (int, error) {
+	collection := r.provider.GetCollection("mail_queue")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	filter := bson.M{"status": bson.M{"$ne": model.MailPending}, "created_at": bson.M{"$lt": before}}
+	result, err := collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+type MemoryMailQueueRepository struct {
+	db *memoryDB
+}
+
+// Ставим письмо в очередь, в транзакции вызывающего, если она есть в ctx
+func (r *MemoryMailQueueRepository) Create(ctx context.Context, message model.MailMessage) error {
+	return r.db.write(ctx, func() (func(), error) {
+		r.db.mailQueue[message.ID] = message
+		return func() {
+			delete(r.db.mailQueue, message.ID)
+		}, nil
+	})
+}
+
+// Берём в работу письма, срок которых наступил
+func (r *MemoryMailQueueRepository) Claim(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.MailMessage, error) {
+	var claimed []model.MailMessage
+	err := r.db.write(ctx, func() (func(), error) {
+		var due []model.MailMessage
+		for _, message := range r.db.mailQueue {
+			if message.Status == model.MailPending && !message.NextAttemptAt.After(now) {
+				due = append(due, message)
+			}
+		}
+		slices.SortFunc(due, func(a, b model.MailMessage) int {
+			return a.NextAttemptAt.Compare(b.NextAttemptAt)
+		})
+		due = due[:min(limit, len(due))]
+
+		for _, message := range due {
+			message.Attempts++
+			message.NextAttemptAt = leaseUntil
+			r.db.mailQueue[message.ID] = message
+			claimed = append(claimed, message)
+		}
+		return func() {
+			for _, message := range due {
+				r.db.mailQueue[message.ID] = message
+			}
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// Сохраняем итог попытки отправки, если письмо не взяли заново: каждый Claim увеличивает attempts
+func (r *MemoryMailQueueRepository) Update(ctx context.Context, message model.MailMessage) error {
+	return r.db.write(ctx, func() (func(), error) {
+		prev, ok := r.db.mailQueue[message.ID]
+		if !ok || prev.Attempts != message.Attempts {
+			return nil, ErrLeaseLost
+		}
+
+		updated := prev
+		updated.Status = message.Status
+		updated.NextAttemptAt = message.NextAttemptAt
+		updated.Error = message.Error
+		updated.SentAt = message.SentAt
+		r.db.mailQueue[message.ID] = updated
+		return func() {
+			r.db.mailQueue[message.ID] = prev
+		}, nil
+	})
+}
+
+// Удаляем отправленные и dead письма, созданные до before
+func (r *MemoryMailQueueRepository) DeleteFinished(ctx context.Context, before time.Time) (int, error) {
+	var n int
+	err := r.db.write(ctx, func() (func(), error) {
+		deleted := make(map[uuid.UUID]model.MailMessage)
+		for id, message := range r.db.mailQueue {
+			if message.Status != model.MailPending && message.CreatedAt.Before(before) {
+				deleted[id] = message
+				delete(r.db.mailQueue, id)
+			}
+		}
+		n = len(deleted)
+		return func() {
+			for id, message := range deleted {
+				r.db.mailQueue[id] = message
+			}
+		}, nil
+	})
+	return n, err
+}
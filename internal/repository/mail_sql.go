@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/v7ktory/test/internal/model"
+)
+
+const mailColumns = `id, recipient, template, subject, text_body, html_body, status, attempts, next_attempt_at, error, created_at, sent_at`
+
+type SQLMailQueueRepository struct {
+	conn sqlConn
+}
+
+// Ставим письмо в очередь, в транзакции вызывающего, если она есть в ctx
+func (r *SQLMailQueueRepository) Create(ctx context.Context, message model.MailMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	_, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`INSERT INTO mail_queue (`+mailColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		message.ID, message.To, message.Template, message.Subject, message.Text, message.HTML, message.Status,
+		message.Attempts, message.NextAttemptAt.UTC(), message.Error, message.CreatedAt.UTC(), nullTimePtr(message.SentAt),
+	)
+	return err
+}
+
+/*
+Берём в работу письма, срок которых наступил. Каждое захватываем условным
+обновлением по числу попыток: если его уже взяла другая реплика, обновление не пройдёт
+*/
+func (r *SQLMailQueueRepository) Claim(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.MailMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	due, err := r.query(ctx,
+		`WHERE status = $1 AND next_attempt_at <= $2 ORDER BY next_attempt_at LIMIT $3`,
+		model.MailPending, now.UTC(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []model.MailMessage
+	for _, message := range due {
+		result, err := executor(ctx, r.conn.db).ExecContext(ctx,
+			`UPDATE mail_queue SET attempts = attempts + 1, next_attempt_at = $3
+			WHERE id = $1 AND attempts = $2 AND status = $4`,
+			message.ID, message.Attempts, leaseUntil.UTC(), model.MailPending,
+		)
+		if err != nil {
+			return nil, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			continue
+		}
+		message.Attempts++
+		message.NextAttemptAt = leaseUntil
+		claimed = append(claimed, message)
+	}
+	return claimed, nil
+}
+
+// Сохраняем итог попытки отправки, если письмо не взяли заново: каждый Claim увеличивает attempts
+func (r *SQLMailQueueRepository) Update(ctx context.Context, message model.MailMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`UPDATE mail_queue SET status = $3, next_attempt_at = $4, error = $5, sent_at = $6 WHERE id = $1 AND attempts = $2`,
+		message.ID, message.Attempts, message.Status, message.NextAttemptAt.UTC(), message.Error, nullTimePtr(message.SentAt),
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrLeaseLost)
+}
+
+// Удаляем отправленные и dead письма, созданные до before
+func (r *SQLMailQueueRepository) DeleteFinished(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`DELETE FROM mail_queue WHERE status <> $1 AND created_at < $2`,
+		model.MailPending, before.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (r *SQLMailQueueRepository) query(ctx context.Context, where string, args ...any) ([]model.MailMessage, error) {
+	rows, err := executor(ctx, r.conn.db).QueryContext(ctx, `SELECT `+mailColumns+` FROM mail_queue `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []model.MailMessage
+	for rows.Next() {
+		var (
+			message model.MailMessage
+			sentAt  sql.NullTime
+		)
+		err := rows.Scan(&message.ID, &message.To, &message.Template, &message.Subject, &message.Text, &message.HTML, &message.Status,
+			&message.Attempts, &message.NextAttemptAt, &message.Error, &message.CreatedAt, &sentAt)
+		if err != nil {
+			return nil, err
+		}
+		message.SentAt = timePtr(sentAt)
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
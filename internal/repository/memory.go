@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+// Данные in-memory хранилища, общие для всех in-memory репозиториев
+type memoryDB struct {
+	mu       sync.RWMutex
+	users    map[uuid.UUID]model.User
+	emails   map[string]uuid.UUID
+	sessions map[uuid.UUID]model.Session
+
+	revocations map[uuid.UUID]model.Revocation
+	clients     map[string]model.Client
+	codes       map[string]model.AuthorizationCode
+	consents    map[consentKey]model.Consent
+	devices     map[string]model.DeviceAuthorization
+	roles       map[string]model.Role
+	userRoles   map[uuid.UUID][]string
+	// Журнал аудита в порядке добавления
+	audit            []model.AuditEvent
+	auditCheckpoints []model.AuditCheckpoint
+
+	webhooks          map[uuid.UUID]model.Webhook
+	webhookDeliveries map[uuid.UUID]model.WebhookDelivery
+	outbox            map[uuid.UUID]model.OutboxMessage
+	mailQueue         map[uuid.UUID]model.MailMessage
+	knownDevices      map[uuid.UUID]model.KnownDevice
+}
+
+func newMemoryDB() *memoryDB {
+	return &memoryDB{
+		users:    make(map[uuid.UUID]model.User),
+		emails:   make(map[string]uuid.UUID),
+		sessions: make(map[uuid.UUID]model.Session),
+
+		revocations: make(map[uuid.UUID]model.Revocation),
+		clients:     make(map[string]model.Client),
+		codes:       make(map[string]model.AuthorizationCode),
+		consents:    make(map[consentKey]model.Consent),
+		devices:     make(map[string]model.DeviceAuthorization),
+		roles:       make(map[string]model.Role),
+		userRoles:   make(map[uuid.UUID][]string),
+
+		webhooks:          make(map[uuid.UUID]model.Webhook),
+		webhookDeliveries: make(map[uuid.UUID]model.WebhookDelivery),
+		outbox:            make(map[uuid.UUID]model.OutboxMessage),
+		mailQueue:         make(map[uuid.UUID]model.MailMessage),
+		knownDevices:      make(map[uuid.UUID]model.KnownDevice),
+	}
+}
+
+type memoryTxKey struct{}
+
+// Журнал отмены изменений, сделанных внутри транзакции
+type memoryTx struct {
+	undo []func()
+}
+
+/*
+Выполняем изменение под блокировкой.
+Если контекст несёт транзакцию, запоминаем обратную операцию для отката
+*/
+func (db *memoryDB) write(ctx context.Context, fn func() (undo func(), err error)) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	undo, err := fn()
+	if err != nil {
+		return err
+	}
+	if tx, ok := ctx.Value(memoryTxKey{}).(*memoryTx); ok && undo != nil {
+		tx.undo = append(tx.undo, undo)
+	}
+	return nil
+}
+
+type MemoryTransactor struct {
+	db *memoryDB
+	mu sync.Mutex
+}
+
+/*
+Транзакции выполняются последовательно.
+При ошибке изменения откатываются в обратном порядке
+*/
+func (t *MemoryTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(memoryTxKey{}).(*memoryTx); ok {
+		return fn(ctx)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tx := &memoryTx{}
+	if err := fn(context.WithValue(ctx, memoryTxKey{}, tx)); err != nil {
+		t.db.mu.Lock()
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+		t.db.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/pkg/database/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrAuthorizationCodeNotFound = errors.New("authorization code not found")
+	ErrConsentNotFound           = errors.New("consent not found")
+)
+
+type AuthorizationCodeRepository struct {
+	provider *mongodb.Provider
+}
+
+func NewAuthorizationCodeRepository(provider *mongodb.Provider) *AuthorizationCodeRepository {
+	return &AuthorizationCodeRepository{
+		provider: provider,
+	}
+}
+
+// Сохраняем код авторизации, просроченные коды удаляет TTL индекс
+func (r *AuthorizationCodeRepository) Create(ctx context.Context, code model.AuthorizationCode) error {
+	collection := r.provider.GetCollection("authorization_codes")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, code)
+	return err
+}
+
+// Атомарно забираем код, повторно использовать его нельзя
+func (r *AuthorizationCodeRepository) Consume(ctx context.Context, codeHash string) (*model.AuthorizationCode, error) {
+	collection := r.provider.GetCollection("authorization_codes")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	var code model.AuthorizationCode
+	err := collection.FindOneAndDelete(ctx, bson.M{"_id": codeHash}).Decode(&code)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAuthorizationCodeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+type ConsentRepository struct {
+	provider *mongodb.Provider
+}
+
+func NewConsentRepository(provider *mongodb.Provider) *ConsentRepository {
+	return &ConsentRepository{
+		provider: provider,
+	}
+}
+
+// Возвращаем согласие пользователя для клиента
+func (r *ConsentRepository) Get(ctx context.Context, userID uuid.UUID, clientID string) (*model.Consent, error) {
+	collection := r.provider.GetCollection("consents")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	var consent model.Consent
+	err := collection.FindOne(ctx, bson.M{"user_id": userID, "client_id": clientID}).Decode(&consent)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrConsentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+// Сохраняем согласие, заменяя предыдущее
+func (r *ConsentRepository) Save(ctx context.Context, consent model.Consent) error {
+	collection := r.provider.GetCollection("consents")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	filter := bson.M{"user_id": consent.UserID, "client_id": consent.ClientID}
+	_, err := collection.ReplaceOne(ctx, filter, consent, options.Replace().SetUpsert(true))
+	return err
+}
+
+// Удаляем просроченные коды авторизации, не дожидаясь TTL индекса
+func (r *AuthorizationCodeRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	collection := r.provider.GetCollection("authorization_codes")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	result, err := collection.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lte": now}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
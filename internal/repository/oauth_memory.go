@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+type MemoryAuthorizationCodeRepository struct {
+	db *memoryDB
+}
+
+// Сохраняем код авторизации и попутно чистим просроченные
+func (r *MemoryAuthorizationCodeRepository) Create(ctx context.Context, code model.AuthorizationCode) error {
+	return r.db.write(ctx, func() (func(), error) {
+		now := time.Now()
+		for hash, c := range r.db.codes {
+			if !c.ExpiresAt.After(now) {
+				delete(r.db.codes, hash)
+			}
+		}
+
+		r.db.codes[code.CodeHash] = code
+		return func() {
+			delete(r.db.codes, code.CodeHash)
+		}, nil
+	})
+}
+
+// Атомарно забираем код, повторно использовать его нельзя
+func (r *MemoryAuthorizationCodeRepository) Consume(ctx context.Context, codeHash string) (*model.AuthorizationCode, error) {
+	var code model.AuthorizationCode
+	err := r.db.write(ctx, func() (func(), error) {
+		c, ok := r.db.codes[codeHash]
+		if !ok {
+			return nil, ErrAuthorizationCodeNotFound
+		}
+
+		code = c
+		delete(r.db.codes, codeHash)
+		return func() {
+			r.db.codes[codeHash] = c
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+type MemoryConsentRepository struct {
+	db *memoryDB
+}
+
+type consentKey struct {
+	userID   uuid.UUID
+	clientID string
+}
+
+// Возвращаем согласие пользователя для клиента
+func (r *MemoryConsentRepository) Get(ctx context.Context, userID uuid.UUID, clientID string) (*model.Consent, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	consent, ok := r.db.consents[consentKey{userID, clientID}]
+	if !ok {
+		return nil, ErrConsentNotFound
+	}
+	return &consent, nil
+}
+
+// Сохраняем согласие, заменяя предыдущее
+func (r *MemoryConsentRepository) Save(ctx context.Context, consent model.Consent) error {
+	return r.db.write(ctx, func() (func(), error) {
+		key := consentKey{consent.UserID, consent.ClientID}
+		prev, existed := r.db.consents[key]
+
+		r.db.consents[key] = consent
+		return func() {
+			if existed {
+				r.db.consents[key] = prev
+			} else {
+				delete(r.db.consents, key)
+			}
+		}, nil
+	})
+}
+
+// Удаляем просроченные коды авторизации
+func (r *MemoryAuthorizationCodeRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	var n int
+	err := r.db.write(ctx, func() (func(), error) {
+		deleted := make(map[string]model.AuthorizationCode)
+		for k, v := range r.db.codes {
+			if !v.ExpiresAt.After(now) {
+				deleted[k] = v
+				delete(r.db.codes, k)
+			}
+		}
+		n = len(deleted)
+		return func() {
+			for k, v := range deleted {
+				r.db.codes[k] = v
+			}
+		}, nil
+	})
+	return n, err
+}
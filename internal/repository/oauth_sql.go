@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+type SQLAuthorizationCodeRepository struct {
+	conn sqlConn
+}
+
+// Сохраняем код авторизации и попутно чистим просроченные
+func (r *SQLAuthorizationCodeRepository) Create(ctx context.Context, code model.AuthorizationCode) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	db := executor(ctx, r.conn.db)
+	if _, err := db.ExecContext(ctx, `DELETE FROM authorization_codes WHERE expires_at <= $1`, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO authorization_codes
+		(code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, code_challenge_method, auth_time, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		code.CodeHash, code.ClientID, code.UserID, code.RedirectURI, code.Scope, code.Nonce,
+		code.CodeChallenge, code.CodeChallengeMethod, code.AuthTime.UTC(), code.ExpiresAt.UTC(),
+	)
+	return err
+}
+
+// Атомарно забираем код, повторно использовать его нельзя
+func (r *SQLAuthorizationCodeRepository) Consume(ctx context.Context, codeHash string) (*model.AuthorizationCode, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	var code model.AuthorizationCode
+	err := executor(ctx, r.conn.db).QueryRowContext(ctx,
+		`DELETE FROM authorization_codes WHERE code_hash = $1
+		RETURNING code_hash, client_id, user_id, redirect_uri, scope, nonce,
+		code_challenge, code_challenge_method, auth_time, expires_at`,
+		codeHash,
+	).Scan(&code.CodeHash, &code.ClientID, &code.UserID, &code.RedirectURI, &code.Scope, &code.Nonce,
+		&code.CodeChallenge, &code.CodeChallengeMethod, &code.AuthTime, &code.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAuthorizationCodeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+type SQLConsentRepository struct {
+	conn sqlConn
+}
+
+// Возвращаем согласие пользователя для клиента
+func (r *SQLConsentRepository) Get(ctx context.Context, userID uuid.UUID, clientID string) (*model.Consent, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	var (
+		consent model.Consent
+		scopes  string
+	)
+	err := executor(ctx, r.conn.db).QueryRowContext(ctx,
+		`SELECT user_id, client_id, scopes, granted_at FROM consents WHERE user_id = $1 AND client_id = $2`,
+		userID, clientID,
+	).Scan(&consent.UserID, &consent.ClientID, &scopes, &consent.GrantedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrConsentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(scopes), &consent.Scopes); err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+// Сохраняем согласие, заменяя предыдущее
+func (r *SQLConsentRepository) Save(ctx context.Context, consent model.Consent) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	scopes, err := json.Marshal(consent.Scopes)
+	if err != nil {
+		return err
+	}
+
+	_, err = executor(ctx, r.conn.db).ExecContext(ctx,
+		`INSERT INTO consents (user_id, client_id, scopes, granted_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, client_id) DO UPDATE SET scopes = excluded.scopes, granted_at = excluded.granted_at`,
+		consent.UserID, consent.ClientID, string(scopes), consent.GrantedAt.UTC(),
+	)
+	return err
+}
+
+// Удаляем просроченные коды авторизации
+func (r *SQLAuthorizationCodeRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx, `DELETE FROM authorization_codes WHERE expires_at <= $1`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/pkg/database/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type OutboxRepository struct {
+	provider *mongodb.Provider
+}
+
+func NewOutboxRepository(provider *mongodb.Provider) *OutboxRepository {
+	return &OutboxRepository{
+		provider: provider,
+	}
+}
+
+// Добавляем сообщение, в транзакции вызывающего, если она есть в ctx
+func (r *OutboxRepository) Create(ctx context.Context, message model.OutboxMessage) error {
+	collection := r.provider.GetCollection("outbox")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, message)
+	return err
+}
+
+/*
+Берём в работу сообщения, срок которых наступил. Каждое захватываем условным
+обновлением по числу попыток: если его уже взяла другая реплика, обновление не пройдёт
+*/
+func (r *OutboxRepository) Claim(ctx context.Context, owner string, now, leaseUntil time.Time, limit int) ([]model.OutboxMessage, error) {
+	collection := r.provider.GetCollection("outbox")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	query := bson.M{"published_at": nil, "next_attempt_at": bson.M{"$lte": now}}
+	opts := options.Find().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}, {Key: "created_at", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var due []model.OutboxMessage
+	if err := cursor.All(ctx, &due); err != nil {
+		return nil, err
+	}
+
+	var claimed []model.OutboxMessage
+	for _, message := range due {
+		filter := bson.M{"_id": message.ID, "published_at": nil, "attempts": message.Attempts}
+		update := bson.M{
+			"$set": bson.M{"locked_by": owner, "next_attempt_at": leaseUntil},
+			"$inc": bson.M{"attempts": 1},
+		}
+		result, err := collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return nil, err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		message.Attempts++
+		message.LockedBy = owner
+		message.NextAttemptAt = leaseUntil
+		claimed = append(claimed, message)
+	}
+	return claimed, nil
+}
+
+// Сохраняем итог попытки, если аренда всё ещё наша
+func (r *OutboxRepository) Update(ctx context.Context, message model.OutboxMessage) error {
+	collection := r.provider.GetCollection("outbox")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	filter := bson.M{"_id": message.ID, "locked_by": message.LockedBy, "attempts": message.Attempts}
+	update := bson.M{"$set": bson.M{
+		"next_attempt_at": message.NextAttemptAt,
+		"published_at":    message.PublishedAt,
+		"error":           message.Error,
+	}}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Удаляем сообщения, опубликованные до before
+func (r *OutboxRepository) DeletePublished(ctx context.Context, before time.Time) (int, error) {
+	collection := r.provider.GetCollection("outbox")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	result, err := collection.DeleteMany(ctx, bson.M{"published_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
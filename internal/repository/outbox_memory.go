@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+type MemoryOutboxRepository struct {
+	db *memoryDB
+}
+
+// Добавляем сообщение, в транзакции вызывающего, если она есть в ctx
+func (r *MemoryOutboxRepository) Create(ctx context.Context, message model.OutboxMessage) error {
+	return r.db.write(ctx, func() (func(), error) {
+		r.db.outbox[message.ID] = message
+		return func() {
+			delete(r.db.outbox, message.ID)
+		}, nil
+	})
+}
+
+// Берём в работу сообщения, срок которых наступил
+func (r *MemoryOutboxRepository) Claim(ctx context.Context, owner string, now, leaseUntil time.Time, limit int) ([]model.OutboxMessage, error) {
+	var claimed []model.OutboxMessage
+	err := r.db.write(ctx, func() (func(), error) {
+		var due []model.OutboxMessage
+		for _, message := range r.db.outbox {
+			if message.PublishedAt == nil && !message.NextAttemptAt.After(now) {
+				due = append(due, message)
+			}
+		}
+		slices.SortFunc(due, func(a, b model.OutboxMessage) int {
+			if c := a.NextAttemptAt.Compare(b.NextAttemptAt); c != 0 {
+				return c
+			}
+			return a.CreatedAt.Compare(b.CreatedAt)
+		})
+		due = due[:min(limit, len(due))]
+
+		for _, message := range due {
+			message.Attempts++
+			message.LockedBy = owner
+			message.NextAttemptAt = leaseUntil
+			r.db.outbox[message.ID] = message
+			claimed = append(claimed, message)
+		}
+		return func() {
+			for _, message := range due {
+				r.db.outbox[message.ID] = message
+			}
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// Сохраняем итог попытки, если аренда всё ещё наша
+func (r *MemoryOutboxRepository) Update(ctx context.Context, message model.OutboxMessage) error {
+	return r.db.write(ctx, func() (func(), error) {
+		prev, ok := r.db.outbox[message.ID]
+		if !ok || prev.LockedBy != message.LockedBy || prev.Attempts != message.Attempts {
+			return nil, ErrLeaseLost
+		}
+
+		updated := prev
+		updated.NextAttemptAt = message.NextAttemptAt
+		updated.PublishedAt = message.PublishedAt
+		updated.Error = message.Error
+		r.db.outbox[message.ID] = updated
+		return func() {
+			r.db.outbox[message.ID] = prev
+		}, nil
+	})
+}
+
+// Удаляем сообщения, опубликованные до before
+func (r *MemoryOutboxRepository) DeletePublished(ctx context.Context, before time.Time) (int, error) {
+	var n int
+	err := r.db.write(ctx, func() (func(), error) {
+		deleted := make(map[uuid.UUID]model.OutboxMessage)
+		for id, message := range r.db.outbox {
+			if message.PublishedAt != nil && message.PublishedAt.Before(before) {
+				deleted[id] = message
+				delete(r.db.outbox, id)
+			}
+		}
+		n = len(deleted)
+		return func() {
+			for id, message := range deleted {
+				r.db.outbox[id] = message
+			}
+		}, nil
+	})
+	return n, err
+}
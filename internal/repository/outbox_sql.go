@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/v7ktory/test/internal/model"
+)
+
+const outboxColumns = `id, event_type, partition_key, payload, created_at, attempts, next_attempt_at, locked_by, published_at, error`
+
+type SQLOutboxRepository struct {
+	conn sqlConn
+}
+
+// Добавляем сообщение, в транзакции вызывающего, если она есть в ctx
+func (r *SQLOutboxRepository) Create(ctx context.Context, message model.OutboxMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	_, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`INSERT INTO outbox (`+outboxColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		message.ID, message.Type, message.Key, message.Payload, message.CreatedAt.UTC(), message.Attempts,
+		message.NextAttemptAt.UTC(), message.LockedBy, nullTimePtr(message.PublishedAt), message.Error,
+	)
+	return err
+}
+
+/*
+Берём в работу сообщения, срок которых наступил. Каждое захватываем условным
+обновлением по числу попыток: если его уже взяла другая реплика, обновление не пройдёт
+*/
+func (r *SQLOutboxRepository) Claim(ctx context.Context, owner string, now, leaseUntil time.Time, limit int) ([]model.OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	due, err := r.query(ctx,
+		`WHERE published_at IS NULL AND next_attempt_at <= $1 ORDER BY next_attempt_at, created_at LIMIT $2`,
+		now.UTC(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []model.OutboxMessage
+	for _, message := range due {
+		result, err := executor(ctx, r.conn.db).ExecContext(ctx,
+			`UPDATE outbox SET attempts = attempts + 1, locked_by = $3, next_attempt_at = $4
+			WHERE id = $1 AND attempts = $2 AND published_at IS NULL`,
+			message.ID, message.Attempts, owner, leaseUntil.UTC(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			continue
+		}
+		message.Attempts++
+		message.LockedBy = owner
+		message.NextAttemptAt = leaseUntil
+		claimed = append(claimed, message)
+	}
+	return claimed, nil
+}
+
+// Сохраняем итог попытки, если аренда всё ещё наша
+func (r *SQLOutboxRepository) Update(ctx context.Context, message model.OutboxMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`UPDATE outbox SET next_attempt_at = $4, published_at = $5, error = $6
+		WHERE id = $1 AND locked_by = $2 AND attempts = $3`,
+		message.ID, message.LockedBy, message.Attempts, message.NextAttemptAt.UTC(), nullTimePtr(message.PublishedAt), message.Error,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrLeaseLost)
+}
+
+// Удаляем сообщения, опубликованные до before
+func (r *SQLOutboxRepository) DeletePublished(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx, `DELETE FROM outbox WHERE published_at < $1`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (r *SQLOutboxRepository) query(ctx context.Context, where string, args ...any) ([]model.OutboxMessage, error) {
+	rows, err := executor(ctx, r.conn.db).QueryContext(ctx, `SELECT `+outboxColumns+` FROM outbox `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []model.OutboxMessage
+	for rows.Next() {
+		var (
+			message     model.OutboxMessage
+			publishedAt sql.NullTime
+		)
+		err := rows.Scan(&message.ID, &message.Type, &message.Key, &message.Payload, &message.CreatedAt, &message.Attempts,
+			&message.NextAttemptAt, &message.LockedBy, &publishedAt, &message.Error)
+		if err != nil {
+			return nil, err
+		}
+		message.PublishedAt = timePtr(publishedAt)
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
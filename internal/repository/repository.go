@@ -2,30 +2,268 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/v7ktory/test/internal/model"
 	"github.com/v7ktory/test/pkg/database/mongodb"
+	"github.com/v7ktory/test/pkg/database/postgres"
+	"github.com/v7ktory/test/pkg/database/sqlite"
 )
 
+/*
+Запись очереди (outbox, письма, доставки webhooks) взяли в работу заново после
+окончания аренды или удалили, пока её обрабатывали, итог попытки не сохранён
+*/
+var ErrLeaseLost = errors.New("lease lost")
+
+// Unit of work: все операции внутри fn выполняются атомарно
+type Transactor interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
 type Auth interface {
 	Create(ctx context.Context, user *model.User) (uuid.UUID, error)
 	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*model.User, error)
+	// Пользователи по фильтру, отсортированные по email
+	List(ctx context.Context, filter model.UserFilter) ([]model.User, error)
+	// Число пользователей по фильтру без учёта Offset и Limit
+	Count(ctx context.Context, filter model.UserFilter) (int, error)
+	// Обновляет всё, кроме ID и email
+	Update(ctx context.Context, user model.User) error
+	Delete(ctx context.Context, id uuid.UUID) error
 }
 type Session interface {
 	Create(ctx context.Context, session model.Session) error
+	GetByID(ctx context.Context, id uuid.UUID) (*model.Session, error)
 	GetByUserID(ctx context.Context, userID uuid.UUID) (*model.Session, error)
+	// Все сессии пользователя, включая выданные OAuth клиентам
+	ListByUserID(ctx context.Context, userID uuid.UUID) ([]model.Session, error)
+	// Меняет refresh токен, устройство и оценку риска, клиент и scope сессии остаются прежними
 	Update(ctx context.Context, session model.Session) error
+	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+	// Удаляет сессии OAuth клиентов с истёкшим refresh токеном, first-party сессии остаются
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+type Revocation interface {
+	Create(ctx context.Context, revocation model.Revocation) error
+	ListSince(ctx context.Context, since time.Time) ([]model.Revocation, error)
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+type Client interface {
+	Create(ctx context.Context, client *model.Client) error
+	GetByID(ctx context.Context, id string) (*model.Client, error)
+	UpdateSecret(ctx context.Context, id, secretHash string) error
+}
+
+type AuthorizationCode interface {
+	Create(ctx context.Context, code model.AuthorizationCode) error
+	Consume(ctx context.Context, codeHash string) (*model.AuthorizationCode, error)
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+type Consent interface {
+	Get(ctx context.Context, userID uuid.UUID, clientID string) (*model.Consent, error)
+	Save(ctx context.Context, consent model.Consent) error
+}
+type DeviceAuthorization interface {
+	Create(ctx context.Context, auth model.DeviceAuthorization) error
+	GetByUserCode(ctx context.Context, userCode string) (*model.DeviceAuthorization, error)
+	Decide(ctx context.Context, userCode string, userID uuid.UUID, status string, authTime time.Time) error
+	Poll(ctx context.Context, deviceCodeHash string, now, nextPollAt time.Time) (*model.DeviceAuthorization, error)
+	Consume(ctx context.Context, deviceCodeHash string) (*model.DeviceAuthorization, error)
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+// Роли и их назначение пользователям
+type Role interface {
+	Create(ctx context.Context, role model.Role) error
+	GetByName(ctx context.Context, name string) (*model.Role, error)
+	// Неизвестные имена пропускаются
+	GetByNames(ctx context.Context, names []string) ([]model.Role, error)
+	List(ctx context.Context) ([]model.Role, error)
+	Update(ctx context.Context, role model.Role) error
+	// Удаляет роль вместе с её назначениями
+	Delete(ctx context.Context, name string) error
+	Assign(ctx context.Context, userID uuid.UUID, name string) error
+	Unassign(ctx context.Context, userID uuid.UUID, name string) error
+	ListUserRoles(ctx context.Context, userID uuid.UUID) ([]string, error)
+}
+
+// Журнал аудита только пополняется, изменить или удалить события нельзя
+type Audit interface {
+	// ErrAuditEventConflict, если событие с таким номером в потоке уже есть
+	Create(ctx context.Context, event model.AuditEvent) error
+	// События по фильтру, от новых к старым
+	List(ctx context.Context, filter model.AuditFilter) ([]model.AuditEvent, error)
+	// Событие потока с наибольшим номером или ErrAuditEventNotFound
+	Last(ctx context.Context, stream string) (*model.AuditEvent, error)
+	// События потока с номерами больше after, по возрастанию номера
+	ListStream(ctx context.Context, stream string, after int64, limit int) ([]model.AuditEvent, error)
+	Streams(ctx context.Context) ([]string, error)
+	// ErrAuditCheckpointExists, если точка на этот номер события уже есть
+	CreateCheckpoint(ctx context.Context, checkpoint model.AuditCheckpoint) error
+	ListCheckpoints(ctx context.Context, stream string) ([]model.AuditCheckpoint, error)
+}
+
+// Подписки на события и журнал их доставок
+type Webhook interface {
+	Create(ctx context.Context, webhook model.Webhook) error
+	Get(ctx context.Context, id uuid.UUID) (*model.Webhook, error)
+	// Подписки в порядке создания
+	List(ctx context.Context) ([]model.Webhook, error)
+	Update(ctx context.Context, webhook model.Webhook) error
+	// Удаляет подписку вместе с её доставками
+	Delete(ctx context.Context, id uuid.UUID) error
+	// ErrWebhookDeliveryExists, если доставка события этой подписке уже есть
+	CreateDelivery(ctx context.Context, delivery model.WebhookDelivery) error
+	GetDelivery(ctx context.Context, id uuid.UUID) (*model.WebhookDelivery, error)
+	// Доставки подписки по фильтру, от новых к старым
+	ListDeliveries(ctx context.Context, filter model.WebhookDeliveryFilter) ([]model.WebhookDelivery, error)
+	// Берёт в работу до limit доставок, срок которых наступил к now: Attempts увеличивается,
+	// NextAttemptAt сдвигается на leaseUntil. Одну доставку получает только одна реплика
+	ClaimDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.WebhookDelivery, error)
+	// Сохраняет итог попытки, только пока доставку не взяли в работу заново (ErrLeaseLost)
+	UpdateDelivery(ctx context.Context, delivery model.WebhookDelivery) error
+	// Возвращает dead доставку в очередь с нуля попыток, ErrWebhookDeliveryNotFound, если такой нет
+	RetryDelivery(ctx context.Context, id uuid.UUID, now time.Time) error
+}
+
+// Outbox событий, сообщения пишутся в транзакции изменения, которое их породило
+type Outbox interface {
+	Create(ctx context.Context, message model.OutboxMessage) error
+	// Берёт в работу до limit неопубликованных сообщений, срок которых наступил к now:
+	// Attempts увеличивается, LockedBy = owner, NextAttemptAt = leaseUntil
+	Claim(ctx context.Context, owner string, now, leaseUntil time.Time, limit int) ([]model.OutboxMessage, error)
+	// Сохраняет итог попытки, только пока аренда сообщения не перешла к другому (ErrLeaseLost)
+	Update(ctx context.Context, message model.OutboxMessage) error
+	// Удаляет сообщения, опубликованные до before
+	DeletePublished(ctx context.Context, before time.Time) (int, error)
+}
+
+// Устройства, с которых пользователи уже входили
+type KnownDevice interface {
+	// ErrKnownDeviceExists, если такое устройство у пользователя уже есть
+	Create(ctx context.Context, device model.KnownDevice) error
+	GetByID(ctx context.Context, userID, id uuid.UUID) (*model.KnownDevice, error)
+	GetByDevice(ctx context.Context, userID uuid.UUID, device model.Device) (*model.KnownDevice, error)
+	// Устройства пользователя, от последних использованных к давним
+	ListByUserID(ctx context.Context, userID uuid.UUID) ([]model.KnownDevice, error)
+	UpdateLastSeen(ctx context.Context, id uuid.UUID, lastSeenAt time.Time) error
+	Delete(ctx context.Context, userID, id uuid.UUID) error
+	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+}
+
+// Очередь отправки писем, письмо может ставиться в очередь в транзакции изменения
+type MailQueue interface {
+	Create(ctx context.Context, message model.MailMessage) error
+	// Берёт в работу до limit ожидающих писем, срок которых наступил к now: Attempts увеличивается,
+	// NextAttemptAt сдвигается на leaseUntil. Одно письмо получает только одна реплика
+	Claim(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.MailMessage, error)
+	// Сохраняет итог попытки, только пока письмо не взяли в работу заново (ErrLeaseLost)
+	Update(ctx context.Context, message model.MailMessage) error
+	// Удаляет отправленные и dead письма, созданные до before
+	DeleteFinished(ctx context.Context, before time.Time) (int, error)
 }
 
 type Repository struct {
+	Transactor
 	Auth
 	Session
+	Revocation
+	Client
+	AuthorizationCode
+	Consent
+	DeviceAuthorization
+	Role
+	Audit
+	Webhook
+	Outbox
+	MailQueue
+	KnownDevice
 }
 
 func NewRepository(provider *mongodb.Provider) *Repository {
 	return &Repository{
-		Auth:    NewAuthRepository(provider),
-		Session: NewSessionRepository(provider),
+		Transactor: NewMongoTransactor(provider),
+		Auth:       NewAuthRepository(provider),
+		Session:    NewSessionRepository(provider),
+		Revocation: NewRevocationRepository(provider),
+		Client:     NewClientRepository(provider),
+
+		AuthorizationCode: NewAuthorizationCodeRepository(provider),
+		Consent:           NewConsentRepository(provider),
+
+		DeviceAuthorization: NewDeviceAuthorizationRepository(provider),
+		Role:                NewRoleRepository(provider),
+		Audit:               NewAuditRepository(provider),
+		Webhook:             NewWebhookRepository(provider),
+		Outbox:              NewOutboxRepository(provider),
+		MailQueue:           NewMailQueueRepository(provider),
+		KnownDevice:         NewKnownDeviceRepository(provider),
+	}
+}
+
+func NewPostgresRepository(provider *postgres.Provider) *Repository {
+	return newSQLRepository(sqlConn{
+		db:                provider.DB,
+		queryTimeout:      provider.QueryTimeout,
+		isUniqueViolation: postgres.IsUniqueViolation,
+	})
+}
+
+func NewSQLiteRepository(provider *sqlite.Provider) *Repository {
+	return newSQLRepository(sqlConn{
+		db:                provider.DB,
+		queryTimeout:      provider.QueryTimeout,
+		isUniqueViolation: sqlite.IsUniqueViolation,
+	})
+}
+
+func newSQLRepository(conn sqlConn) *Repository {
+	return &Repository{
+		Transactor: NewSQLTransactor(conn.db),
+		Auth:       &SQLAuthRepository{conn: conn},
+		Session:    &SQLSessionRepository{conn: conn},
+		Revocation: &SQLRevocationRepository{conn: conn},
+		Client:     &SQLClientRepository{conn: conn},
+
+		AuthorizationCode: &SQLAuthorizationCodeRepository{conn: conn},
+		Consent:           &SQLConsentRepository{conn: conn},
+
+		DeviceAuthorization: &SQLDeviceAuthorizationRepository{conn: conn},
+		Role:                &SQLRoleRepository{conn: conn},
+		Audit:               &SQLAuditRepository{conn: conn},
+		Webhook:             &SQLWebhookRepository{conn: conn},
+		Outbox:              &SQLOutboxRepository{conn: conn},
+		MailQueue:           &SQLMailQueueRepository{conn: conn},
+		KnownDevice:         &SQLKnownDeviceRepository{conn: conn},
+	}
+}
+
+// In-memory хранилище для тестов и локальной разработки, данные живут до остановки процесса
+func NewMemoryRepository() *Repository {
+	db := newMemoryDB()
+	return &Repository{
+		Transactor: &MemoryTransactor{db: db},
+		Auth:       &MemoryAuthRepository{db: db},
+		Session:    &MemorySessionRepository{db: db},
+		Revocation: &MemoryRevocationRepository{db: db},
+		Client:     &MemoryClientRepository{db: db},
+
+		AuthorizationCode: &MemoryAuthorizationCodeRepository{db: db},
+		Consent:           &MemoryConsentRepository{db: db},
+
+		DeviceAuthorization: &MemoryDeviceAuthorizationRepository{db: db},
+		Role:                &MemoryRoleRepository{db: db},
+		Audit:               &MemoryAuditRepository{db: db},
+		Webhook:             &MemoryWebhookRepository{db: db},
+		Outbox:              &MemoryOutboxRepository{db: db},
+		MailQueue:           &MemoryMailQueueRepository{db: db},
+		KnownDevice:         &MemoryKnownDeviceRepository{db: db},
 	}
 }
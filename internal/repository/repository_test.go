@@ -0,0 +1,179 @@
+package repository_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/v7ktory/test/internal/config"
+	"github.com/v7ktory/test/internal/migration"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/internal/repository/repotest"
+	"github.com/v7ktory/test/pkg/database/mongodb"
+	"github.com/v7ktory/test/pkg/database/postgres"
+	"github.com/v7ktory/test/pkg/database/sqlite"
+	"github.com/v7ktory/test/pkg/migrate"
+)
+
+const testQueryTimeout = 5 * time.Second
+
+func TestMemoryRepository(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) *repository.Repository {
+		return repository.NewMemoryRepository()
+	})
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) *repository.Repository {
+		return repository.NewSQLiteRepository(newSQLite(t))
+	})
+}
+
+// Все down миграции должны откатывать схему так, чтобы up применялись снова
+func TestSQLiteMigrationsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	provider := newSQLite(t)
+
+	migrator, err := migration.NewSQLiteMigrator(provider)
+	if err != nil {
+		t.Fatalf("NewSQLiteMigrator: %v", err)
+	}
+	for {
+		_, err := migrator.Down(ctx)
+		if err == migrate.ErrNoApplied {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Down: %v", err)
+		}
+	}
+	migrateUp(t, migrator)
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for _, st := range statuses {
+		if !st.Applied {
+			t.Fatalf("migration %d (%s) is not applied", st.Version, st.Name)
+		}
+	}
+}
+
+// Каждая проверка получает свою схему в базе TEST_POSTGRES_DSN
+func TestPostgresRepository(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	ctx := context.Background()
+
+	repotest.Run(t, func(t *testing.T) *repository.Repository {
+		admin, err := postgres.NewPostgres(ctx, config.PostgresCfg{DSN: dsn, QueryTimeout: testQueryTimeout})
+		if err != nil {
+			t.Fatalf("NewPostgres: %v", err)
+		}
+		t.Cleanup(func() { admin.Close() })
+
+		schema := "repotest_" + randomSuffix(t)
+		if _, err := admin.DB.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+			t.Fatalf("create schema: %v", err)
+		}
+		t.Cleanup(func() { admin.DB.ExecContext(ctx, "DROP SCHEMA "+schema+" CASCADE") })
+
+		provider, err := postgres.NewPostgres(ctx, config.PostgresCfg{
+			DSN:          withSearchPath(dsn, schema),
+			QueryTimeout: testQueryTimeout,
+		})
+		if err != nil {
+			t.Fatalf("NewPostgres: %v", err)
+		}
+		t.Cleanup(func() { provider.Close() })
+
+		migrator, err := migration.NewPostgresMigrator(provider)
+		if err != nil {
+			t.Fatalf("NewPostgresMigrator: %v", err)
+		}
+		migrateUp(t, migrator)
+		return repository.NewPostgresRepository(provider)
+	})
+}
+
+// Каждая проверка получает свою базу. Транзакциям MongoDB нужен replica set
+func TestMongoRepository(t *testing.T) {
+	hosts := os.Getenv("TEST_MONGO_HOSTS")
+	if hosts == "" {
+		t.Skip("TEST_MONGO_HOSTS is not set")
+	}
+	ctx := context.Background()
+
+	repotest.Run(t, func(t *testing.T) *repository.Repository {
+		provider, err := mongodb.NewMongoDB(ctx, config.MongoCfg{
+			Hosts:        strings.Split(hosts, ","),
+			DB:           "repotest_" + randomSuffix(t),
+			QueryTimeout: testQueryTimeout,
+		})
+		if err != nil {
+			t.Fatalf("NewMongoDB: %v", err)
+		}
+		t.Cleanup(func() {
+			provider.DB.Drop(ctx)
+			provider.GetClient().Disconnect(ctx)
+		})
+
+		migrator, err := migration.NewMongoMigrator(provider)
+		if err != nil {
+			t.Fatalf("NewMongoMigrator: %v", err)
+		}
+		migrateUp(t, migrator)
+		return repository.NewRepository(provider)
+	})
+}
+
+func newSQLite(t *testing.T) *sqlite.Provider {
+	provider, err := sqlite.NewSQLite(context.Background(), config.SQLiteCfg{
+		Path:         filepath.Join(t.TempDir(), "test.db"),
+		QueryTimeout: testQueryTimeout,
+	})
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	t.Cleanup(func() { provider.Close() })
+
+	migrator, err := migration.NewSQLiteMigrator(provider)
+	if err != nil {
+		t.Fatalf("NewSQLiteMigrator: %v", err)
+	}
+	migrateUp(t, migrator)
+	return provider
+}
+
+func migrateUp(t *testing.T, migrator *migrate.Migrator) {
+	t.Helper()
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+}
+
+func withSearchPath(dsn, schema string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&search_path=" + schema
+	}
+	return dsn + "?search_path=" + schema
+}
+
+func randomSuffix(t *testing.T) string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
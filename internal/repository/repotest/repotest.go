@@ -0,0 +1,1382 @@
+/*
+Пакет repotest содержит общий набор проверок, который должна проходить
+любая реализация repository.Repository
+*/
+package repotest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+)
+
+// Фабрика возвращает репозиторий поверх чистого хранилища с применёнными миграциями
+type Factory func(t *testing.T) *repository.Repository
+
+var errRollback = errors.New("rollback")
+
+func Run(t *testing.T, newRepo Factory) {
+	t.Run("Auth", func(t *testing.T) { RunAuth(t, newRepo) })
+	t.Run("Session", func(t *testing.T) { RunSession(t, newRepo) })
+	t.Run("Transactor", func(t *testing.T) { RunTransactor(t, newRepo) })
+	t.Run("Client", func(t *testing.T) { RunClient(t, newRepo) })
+	t.Run("DeviceAuthorization", func(t *testing.T) { RunDeviceAuthorization(t, newRepo) })
+	t.Run("Role", func(t *testing.T) { RunRole(t, newRepo) })
+	t.Run("Audit", func(t *testing.T) { RunAudit(t, newRepo) })
+	t.Run("Webhook", func(t *testing.T) { RunWebhook(t, newRepo) })
+	t.Run("Outbox", func(t *testing.T) { RunOutbox(t, newRepo) })
+	t.Run("MailQueue", func(t *testing.T) { RunMailQueue(t, newRepo) })
+	t.Run("KnownDevice", func(t *testing.T) { RunKnownDevice(t, newRepo) })
+}
+
+func RunAuth(t *testing.T, newRepo Factory) {
+	ctx := context.Background()
+
+	t.Run("CreateAndGetByEmail", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser()
+
+		id, err := repo.Auth.Create(ctx, user)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if id != user.UUID {
+			t.Fatalf("Create returned %s, want %s", id, user.UUID)
+		}
+
+		got, err := repo.Auth.GetByEmail(ctx, user.Email)
+		if err != nil {
+			t.Fatalf("GetByEmail: %v", err)
+		}
+		if *got != *user {
+			t.Fatalf("GetByEmail returned %+v, want %+v", got, user)
+		}
+
+		got, err = repo.Auth.GetByID(ctx, user.UUID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if *got != *user {
+			t.Fatalf("GetByID returned %+v, want %+v", got, user)
+		}
+	})
+
+	t.Run("DuplicateEmail", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser()
+		if _, err := repo.Auth.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		dup := newUser()
+		dup.Email = user.Email
+		if _, err := repo.Auth.Create(ctx, dup); !errors.Is(err, repository.ErrUserExists) {
+			t.Fatalf("Create duplicate returned %v, want %v", err, repository.ErrUserExists)
+		}
+	})
+
+	t.Run("ConcurrentDuplicateEmail", func(t *testing.T) {
+		repo := newRepo(t)
+		email := newUser().Email
+
+		const workers = 8
+		var (
+			wg      sync.WaitGroup
+			created atomic.Int32
+		)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				user := newUser()
+				user.Email = email
+				_, err := repo.Auth.Create(ctx, user)
+				switch {
+				case err == nil:
+					created.Add(1)
+				case !errors.Is(err, repository.ErrUserExists):
+					t.Errorf("Create returned %v, want nil or %v", err, repository.ErrUserExists)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if n := created.Load(); n != 1 {
+			t.Fatalf("%d users created with the same email, want 1", n)
+		}
+	})
+
+	t.Run("GetByEmailNotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.Auth.GetByEmail(ctx, "missing@example.com"); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("GetByEmail returned %v, want %v", err, repository.ErrUserNotFound)
+		}
+	})
+
+	t.Run("UpdateAndDelete", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser()
+		if _, err := repo.Auth.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		user.Password = "new-hashed-password"
+		user.Disabled = true
+		user.PasswordResetRequired = true
+		user.FailedLogins = 3
+		user.LockedUntil = time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+		if err := repo.Auth.Update(ctx, *user); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		got, err := repo.Auth.GetByID(ctx, user.UUID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if got.Password != user.Password || !got.Disabled || !got.PasswordResetRequired ||
+			got.FailedLogins != user.FailedLogins || !got.LockedUntil.Equal(user.LockedUntil) {
+			t.Fatalf("GetByID returned %+v, want %+v", got, user)
+		}
+
+		user.LockedUntil = time.Time{}
+		if err := repo.Auth.Update(ctx, *user); err != nil {
+			t.Fatalf("Update unlock: %v", err)
+		}
+		if got, err = repo.Auth.GetByID(ctx, user.UUID); err != nil || !got.LockedUntil.IsZero() {
+			t.Fatalf("GetByID after unlock returned %+v, %v, want zero LockedUntil", got, err)
+		}
+
+		if err := repo.Auth.Delete(ctx, user.UUID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := repo.Auth.GetByID(ctx, user.UUID); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("GetByID after delete returned %v, want %v", err, repository.ErrUserNotFound)
+		}
+		if err := repo.Auth.Delete(ctx, user.UUID); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("Delete missing returned %v, want %v", err, repository.ErrUserNotFound)
+		}
+		if err := repo.Auth.Update(ctx, *user); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("Update missing returned %v, want %v", err, repository.ErrUserNotFound)
+		}
+	})
+
+	t.Run("ListAndCount", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, email := range []string{"carol@example.com", "alice@example.com", "bob@Example.org", "al_ice@example.com"} {
+			user := newUser()
+			user.Email = email
+			user.Disabled = email == "bob@Example.org"
+			if _, err := repo.Auth.Create(ctx, user); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		disabled, enabled := true, false
+		tests := []struct {
+			filter model.UserFilter
+			want   []string
+			total  int
+		}{
+			{model.UserFilter{Limit: 10}, []string{"al_ice@example.com", "alice@example.com", "bob@Example.org", "carol@example.com"}, 4},
+			{model.UserFilter{Offset: 1, Limit: 2}, []string{"alice@example.com", "bob@Example.org"}, 4},
+			{model.UserFilter{Offset: 10, Limit: 2}, nil, 4},
+			{model.UserFilter{Email: "EXAMPLE.ORG", Limit: 10}, []string{"bob@Example.org"}, 1},
+			{model.UserFilter{Email: "l_i", Limit: 10}, []string{"al_ice@example.com"}, 1},
+			{model.UserFilter{Disabled: &disabled, Limit: 10}, []string{"bob@Example.org"}, 1},
+			{model.UserFilter{Email: "example.com", Disabled: &enabled, Limit: 1}, []string{"al_ice@example.com"}, 3},
+		}
+		for _, tt := range tests {
+			users, err := repo.Auth.List(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("List(%+v): %v", tt.filter, err)
+			}
+			var emails []string
+			for _, user := range users {
+				emails = append(emails, user.Email)
+			}
+			if !slices.Equal(emails, tt.want) {
+				t.Fatalf("List(%+v) returned %v, want %v", tt.filter, emails, tt.want)
+			}
+
+			total, err := repo.Auth.Count(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("Count(%+v): %v", tt.filter, err)
+			}
+			if total != tt.total {
+				t.Fatalf("Count(%+v) returned %d, want %d", tt.filter, total, tt.total)
+			}
+		}
+	})
+}
+
+func RunSession(t *testing.T, newRepo Factory) {
+	ctx := context.Background()
+
+	t.Run("CreateGetUpdate", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser()
+		if _, err := repo.Auth.Create(ctx, user); err != nil {
+			t.Fatalf("Create user: %v", err)
+		}
+
+		session := model.Session{
+			ID:           uuid.New(),
+			RefreshToken: model.RefreshToken{UserID: user.UUID},
+		}
+		if err := repo.Session.Create(ctx, session); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		got, err := repo.Session.GetByUserID(ctx, user.UUID)
+		if err != nil {
+			t.Fatalf("GetByUserID: %v", err)
+		}
+		if got.ID != session.ID {
+			t.Fatalf("GetByUserID returned session %s, want %s", got.ID, session.ID)
+		}
+
+		got, err = repo.Session.GetByID(ctx, session.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if got.RefreshToken.UserID != user.UUID || !got.AuthTime.IsZero() {
+			t.Fatalf("GetByID returned user %s, auth time %s, want %s and zero", got.RefreshToken.UserID, got.AuthTime, user.UUID)
+		}
+
+		updated := model.Session{
+			ID: session.ID,
+			RefreshToken: model.RefreshToken{
+				ID:            uuid.New(),
+				UserID:        user.UUID,
+				AccessTokenID: uuid.New(),
+				Token:         "hashed-refresh",
+				ExpiresAt:     time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond),
+			},
+			Device: &model.Device{UserAgent: "Firefox on Linux", Network: "network-hash"},
+			Risk: &model.Risk{
+				Score:      40,
+				Signals:    []string{model.RiskNewDevice, model.RiskUnusualHour},
+				Decision:   model.RiskStepUp,
+				ACR:        model.ACREmailCode,
+				AssessedAt: time.Now().UTC().Truncate(time.Millisecond),
+			},
+		}
+		if err := repo.Session.Update(ctx, updated); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		got, err = repo.Session.GetByUserID(ctx, user.UUID)
+		if err != nil {
+			t.Fatalf("GetByUserID after update: %v", err)
+		}
+		if !sameRefreshToken(got.RefreshToken, updated.RefreshToken) {
+			t.Fatalf("GetByUserID returned %+v, want %+v", got.RefreshToken, updated.RefreshToken)
+		}
+		if got.Device == nil || *got.Device != *updated.Device {
+			t.Fatalf("GetByUserID returned device %+v, want %+v", got.Device, updated.Device)
+		}
+		if !sameRisk(got.Risk, updated.Risk) {
+			t.Fatalf("GetByUserID returned risk %+v, want %+v", got.Risk, updated.Risk)
+		}
+
+		// Сброс сессии без устройства и оценки риска их стирает
+		updated.Device = nil
+		updated.Risk = nil
+		if err := repo.Session.Update(ctx, updated); err != nil {
+			t.Fatalf("Update without device: %v", err)
+		}
+		if got, err := repo.Session.GetByID(ctx, session.ID); err != nil || got.Device != nil || got.Risk != nil {
+			t.Fatalf("GetByID returned %+v, %v, want no device and risk", got, err)
+		}
+	})
+
+	t.Run("UpdateKeepsClient", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser()
+		if _, err := repo.Auth.Create(ctx, user); err != nil {
+			t.Fatalf("Create user: %v", err)
+		}
+
+		session := model.Session{
+			ID:       uuid.New(),
+			ClientID: "client",
+			Scope:    "openid profile",
+			AuthTime: time.Now().Add(-time.Minute).UTC().Truncate(time.Second),
+			RefreshToken: model.RefreshToken{
+				ID:        uuid.New(),
+				UserID:    user.UUID,
+				Token:     "hashed-refresh",
+				ExpiresAt: time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond),
+			},
+		}
+		if err := repo.Session.Create(ctx, session); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		// Сброс refresh токена передаёт только его, клиент и scope сессии остаются
+		if err := repo.Session.Update(ctx, model.Session{ID: session.ID, RefreshToken: model.RefreshToken{UserID: user.UUID}}); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		got, err := repo.Session.GetByID(ctx, session.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if got.ClientID != session.ClientID || got.Scope != session.Scope || !got.AuthTime.Equal(session.AuthTime) || got.RefreshToken.Token != "" {
+			t.Fatalf("GetByID returned %+v, want client session with reset refresh token", got)
+		}
+		if _, err := repo.Session.GetByUserID(ctx, user.UUID); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("GetByUserID returned %v, want %v", err, repository.ErrSessionNotFound)
+		}
+	})
+
+	t.Run("GetByUserIDNotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.Session.GetByUserID(ctx, uuid.New()); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("GetByUserID returned %v, want %v", err, repository.ErrSessionNotFound)
+		}
+		if _, err := repo.Session.GetByID(ctx, uuid.New()); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("GetByID returned %v, want %v", err, repository.ErrSessionNotFound)
+		}
+	})
+
+	t.Run("UpdateNotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser()
+		if _, err := repo.Auth.Create(ctx, user); err != nil {
+			t.Fatalf("Create user: %v", err)
+		}
+
+		// Сессию уже удалили: обновление не должно молча её потерять или создать заново
+		session := model.Session{ID: uuid.New(), RefreshToken: model.RefreshToken{UserID: user.UUID, Token: "hashed-refresh"}}
+		if err := repo.Session.Update(ctx, session); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("Update returned %v, want %v", err, repository.ErrSessionNotFound)
+		}
+		if _, err := repo.Session.GetByID(ctx, session.ID); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("GetByID returned %v, want %v", err, repository.ErrSessionNotFound)
+		}
+	})
+
+	t.Run("ListAndDeleteByUserID", func(t *testing.T) {
+		repo := newRepo(t)
+		user, other := newUser(), newUser()
+		for _, u := range []*model.User{user, other} {
+			if _, err := repo.Auth.Create(ctx, u); err != nil {
+				t.Fatalf("Create user: %v", err)
+			}
+		}
+
+		sessions := []model.Session{
+			{ID: uuid.New(), RefreshToken: model.RefreshToken{UserID: user.UUID}},
+			{ID: uuid.New(), ClientID: "client", Scope: "openid", RefreshToken: model.RefreshToken{UserID: user.UUID}},
+			{ID: uuid.New(), RefreshToken: model.RefreshToken{UserID: other.UUID}},
+		}
+		for _, session := range sessions {
+			if err := repo.Session.Create(ctx, session); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		got, err := repo.Session.ListByUserID(ctx, user.UUID)
+		if err != nil {
+			t.Fatalf("ListByUserID: %v", err)
+		}
+		if len(got) != 2 {
+			t.Fatalf("ListByUserID returned %d sessions, want 2", len(got))
+		}
+		for _, session := range got {
+			if session.ID == sessions[1].ID && (session.ClientID != "client" || session.Scope != "openid") {
+				t.Fatalf("ListByUserID returned %+v, want client session %+v", session, sessions[1])
+			}
+		}
+
+		if err := repo.Session.DeleteByUserID(ctx, user.UUID); err != nil {
+			t.Fatalf("DeleteByUserID: %v", err)
+		}
+		if got, err = repo.Session.ListByUserID(ctx, user.UUID); err != nil || len(got) != 0 {
+			t.Fatalf("ListByUserID after delete returned %d sessions, %v, want none", len(got), err)
+		}
+		if _, err := repo.Session.GetByUserID(ctx, other.UUID); err != nil {
+			t.Fatalf("GetByUserID of another user: %v", err)
+		}
+	})
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser()
+		if _, err := repo.Auth.Create(ctx, user); err != nil {
+			t.Fatalf("Create user: %v", err)
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		expired := model.RefreshToken{UserID: user.UUID, Token: "expired", ExpiresAt: now.Add(-time.Minute)}
+		valid := model.RefreshToken{UserID: user.UUID, Token: "valid", ExpiresAt: now.Add(time.Minute)}
+		sessions := []model.Session{
+			{ID: uuid.New(), RefreshToken: expired},
+			{ID: uuid.New(), ClientID: "client", RefreshToken: expired},
+			{ID: uuid.New(), ClientID: "client", RefreshToken: valid},
+		}
+		for _, session := range sessions {
+			if err := repo.Session.Create(ctx, session); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		// First-party сессия остаётся, даже если её refresh токен истёк
+		deleted, err := repo.Session.DeleteExpired(ctx, now)
+		if err != nil {
+			t.Fatalf("DeleteExpired: %v", err)
+		}
+		if deleted != 1 {
+			t.Fatalf("DeleteExpired removed %d sessions, want 1", deleted)
+		}
+		got, err := repo.Session.ListByUserID(ctx, user.UUID)
+		if err != nil {
+			t.Fatalf("ListByUserID: %v", err)
+		}
+		if len(got) != 2 || slices.ContainsFunc(got, func(s model.Session) bool { return s.ID == sessions[1].ID }) {
+			t.Fatalf("ListByUserID after DeleteExpired returned %+v", got)
+		}
+	})
+}
+
+func RunTransactor(t *testing.T, newRepo Factory) {
+	ctx := context.Background()
+
+	t.Run("Commit", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser()
+
+		err := repo.WithinTransaction(ctx, func(ctx context.Context) error {
+			_, err := repo.Auth.Create(ctx, user)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("WithinTransaction: %v", err)
+		}
+		if _, err := repo.Auth.GetByEmail(ctx, user.Email); err != nil {
+			t.Fatalf("GetByEmail after commit: %v", err)
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser()
+
+		err := repo.WithinTransaction(ctx, func(ctx context.Context) error {
+			if _, err := repo.Auth.Create(ctx, user); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("WithinTransaction returned %v, want %v", err, errRollback)
+		}
+		if _, err := repo.Auth.GetByEmail(ctx, user.Email); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("GetByEmail after rollback returned %v, want %v", err, repository.ErrUserNotFound)
+		}
+	})
+}
+
+func RunClient(t *testing.T, newRepo Factory) {
+	ctx := context.Background()
+
+	t.Run("CreateAndGetByID", func(t *testing.T) {
+		repo := newRepo(t)
+		client := newClient()
+
+		if err := repo.Client.Create(ctx, client); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		got, err := repo.Client.GetByID(ctx, client.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if got.Name != client.Name || got.SecretHash != client.SecretHash || !slices.Equal(got.Audiences, client.Audiences) {
+			t.Fatalf("GetByID returned %+v, want %+v", got, client)
+		}
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		repo := newRepo(t)
+		client := newClient()
+		if err := repo.Client.Create(ctx, client); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := repo.Client.Create(ctx, client); !errors.Is(err, repository.ErrClientExists) {
+			t.Fatalf("Create duplicate returned %v, want %v", err, repository.ErrClientExists)
+		}
+	})
+
+	t.Run("GetByIDNotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.Client.GetByID(ctx, "missing"); !errors.Is(err, repository.ErrClientNotFound) {
+			t.Fatalf("GetByID returned %v, want %v", err, repository.ErrClientNotFound)
+		}
+	})
+
+	t.Run("UpdateSecret", func(t *testing.T) {
+		repo := newRepo(t)
+		client := newClient()
+		if err := repo.Client.Create(ctx, client); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		if err := repo.Client.UpdateSecret(ctx, client.ID, "rotated-secret"); err != nil {
+			t.Fatalf("UpdateSecret: %v", err)
+		}
+		got, err := repo.Client.GetByID(ctx, client.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if got.SecretHash != "rotated-secret" || got.Name != client.Name {
+			t.Fatalf("GetByID after UpdateSecret returned %+v", got)
+		}
+
+		if err := repo.Client.UpdateSecret(ctx, "missing", "x"); !errors.Is(err, repository.ErrClientNotFound) {
+			t.Fatalf("UpdateSecret returned %v, want %v", err, repository.ErrClientNotFound)
+		}
+	})
+}
+
+func RunDeviceAuthorization(t *testing.T, newRepo Factory) {
+	ctx := context.Background()
+
+	t.Run("Lifecycle", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser()
+		if _, err := repo.Auth.Create(ctx, user); err != nil {
+			t.Fatalf("Create user: %v", err)
+		}
+
+		auth := newDeviceAuthorization()
+		if err := repo.DeviceAuthorization.Create(ctx, auth); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		got, err := repo.DeviceAuthorization.GetByUserCode(ctx, auth.UserCode)
+		if err != nil {
+			t.Fatalf("GetByUserCode: %v", err)
+		}
+		if got.DeviceCodeHash != auth.DeviceCodeHash || got.Status != model.DeviceAuthorizationPending {
+			t.Fatalf("GetByUserCode returned %+v, want %+v", got, auth)
+		}
+
+		now := time.Now()
+		if _, err := repo.DeviceAuthorization.Poll(ctx, auth.DeviceCodeHash, now, now.Add(time.Minute)); err != nil {
+			t.Fatalf("Poll: %v", err)
+		}
+		_, err = repo.DeviceAuthorization.Poll(ctx, auth.DeviceCodeHash, now.Add(time.Second), now.Add(time.Minute))
+		if !errors.Is(err, repository.ErrDevicePollTooFrequent) {
+			t.Fatalf("second Poll returned %v, want %v", err, repository.ErrDevicePollTooFrequent)
+		}
+
+		// Забрать можно только подтверждённый запрос
+		if _, err := repo.DeviceAuthorization.Consume(ctx, auth.DeviceCodeHash); !errors.Is(err, repository.ErrDeviceAuthorizationNotFound) {
+			t.Fatalf("Consume pending returned %v, want %v", err, repository.ErrDeviceAuthorizationNotFound)
+		}
+
+		authTime := time.Now().UTC().Truncate(time.Second)
+		err = repo.DeviceAuthorization.Decide(ctx, auth.UserCode, user.UUID, model.DeviceAuthorizationApproved, authTime)
+		if err != nil {
+			t.Fatalf("Decide: %v", err)
+		}
+		err = repo.DeviceAuthorization.Decide(ctx, auth.UserCode, user.UUID, model.DeviceAuthorizationDenied, authTime)
+		if !errors.Is(err, repository.ErrDeviceAuthorizationNotFound) {
+			t.Fatalf("second Decide returned %v, want %v", err, repository.ErrDeviceAuthorizationNotFound)
+		}
+
+		got, err = repo.DeviceAuthorization.Consume(ctx, auth.DeviceCodeHash)
+		if err != nil {
+			t.Fatalf("Consume: %v", err)
+		}
+		if got.UserID != user.UUID || !got.AuthTime.Equal(authTime) {
+			t.Fatalf("Consume returned %+v", got)
+		}
+		if _, err := repo.DeviceAuthorization.Consume(ctx, auth.DeviceCodeHash); !errors.Is(err, repository.ErrDeviceAuthorizationNotFound) {
+			t.Fatalf("second Consume returned %v, want %v", err, repository.ErrDeviceAuthorizationNotFound)
+		}
+	})
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		repo := newRepo(t)
+		expired, valid := newDeviceAuthorization(), newDeviceAuthorization()
+		expired.ExpiresAt = time.Now().UTC().Add(-time.Minute)
+		// Create попутно чистит просроченные, поэтому истёкший запрос сохраняем последним
+		for _, auth := range []model.DeviceAuthorization{valid, expired} {
+			if err := repo.DeviceAuthorization.Create(ctx, auth); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		deleted, err := repo.DeviceAuthorization.DeleteExpired(ctx, time.Now())
+		if err != nil {
+			t.Fatalf("DeleteExpired: %v", err)
+		}
+		if deleted != 1 {
+			t.Fatalf("DeleteExpired removed %d authorizations, want 1", deleted)
+		}
+		if _, err := repo.DeviceAuthorization.GetByUserCode(ctx, expired.UserCode); !errors.Is(err, repository.ErrDeviceAuthorizationNotFound) {
+			t.Fatalf("GetByUserCode of expired returned %v, want %v", err, repository.ErrDeviceAuthorizationNotFound)
+		}
+		if _, err := repo.DeviceAuthorization.GetByUserCode(ctx, valid.UserCode); err != nil {
+			t.Fatalf("GetByUserCode of valid: %v", err)
+		}
+	})
+
+	t.Run("DuplicateUserCode", func(t *testing.T) {
+		repo := newRepo(t)
+		auth := newDeviceAuthorization()
+		if err := repo.DeviceAuthorization.Create(ctx, auth); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		other := newDeviceAuthorization()
+		other.UserCode = auth.UserCode
+		if err := repo.DeviceAuthorization.Create(ctx, other); !errors.Is(err, repository.ErrDeviceUserCodeExists) {
+			t.Fatalf("Create duplicate returned %v, want %v", err, repository.ErrDeviceUserCodeExists)
+		}
+	})
+
+	t.Run("PollNotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		now := time.Now()
+		if _, err := repo.DeviceAuthorization.Poll(ctx, "missing", now, now); !errors.Is(err, repository.ErrDeviceAuthorizationNotFound) {
+			t.Fatalf("Poll returned %v, want %v", err, repository.ErrDeviceAuthorizationNotFound)
+		}
+	})
+}
+
+func RunRole(t *testing.T, newRepo Factory) {
+	ctx := context.Background()
+
+	t.Run("CreateGetUpdate", func(t *testing.T) {
+		repo := newRepo(t)
+		role := newRole("support")
+		if err := repo.Role.Create(ctx, role); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := repo.Role.Create(ctx, role); !errors.Is(err, repository.ErrRoleExists) {
+			t.Fatalf("Create duplicate returned %v, want %v", err, repository.ErrRoleExists)
+		}
+
+		role.Description = "updated"
+		role.Permissions = []string{"users:read", "sessions:revoke"}
+		if err := repo.Role.Update(ctx, role); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		got, err := repo.Role.GetByName(ctx, role.Name)
+		if err != nil {
+			t.Fatalf("GetByName: %v", err)
+		}
+		if got.Description != role.Description || !slices.Equal(got.Permissions, role.Permissions) {
+			t.Fatalf("GetByName returned %+v, want %+v", got, role)
+		}
+
+		if err := repo.Role.Update(ctx, newRole("missing")); !errors.Is(err, repository.ErrRoleNotFound) {
+			t.Fatalf("Update missing returned %v, want %v", err, repository.ErrRoleNotFound)
+		}
+		if _, err := repo.Role.GetByName(ctx, "missing"); !errors.Is(err, repository.ErrRoleNotFound) {
+			t.Fatalf("GetByName missing returned %v, want %v", err, repository.ErrRoleNotFound)
+		}
+	})
+
+	t.Run("ListAndGetByNames", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, name := range []string{"viewer", "admin", "support"} {
+			if err := repo.Role.Create(ctx, newRole(name)); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		roles, err := repo.Role.List(ctx)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if names := roleNames(roles); !slices.Equal(names, []string{"admin", "support", "viewer"}) {
+			t.Fatalf("List returned %v", names)
+		}
+
+		roles, err = repo.Role.GetByNames(ctx, []string{"viewer", "missing", "admin"})
+		if err != nil {
+			t.Fatalf("GetByNames: %v", err)
+		}
+		if names := roleNames(roles); !slices.Equal(names, []string{"admin", "viewer"}) {
+			t.Fatalf("GetByNames returned %v", names)
+		}
+	})
+
+	t.Run("AssignAndDelete", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser()
+		if _, err := repo.Auth.Create(ctx, user); err != nil {
+			t.Fatalf("Create user: %v", err)
+		}
+		for _, name := range []string{"viewer", "admin"} {
+			if err := repo.Role.Create(ctx, newRole(name)); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			// Повторное назначение не должно быть ошибкой
+			for i := 0; i < 2; i++ {
+				if err := repo.Role.Assign(ctx, user.UUID, name); err != nil {
+					t.Fatalf("Assign: %v", err)
+				}
+			}
+		}
+
+		names, err := repo.Role.ListUserRoles(ctx, user.UUID)
+		if err != nil {
+			t.Fatalf("ListUserRoles: %v", err)
+		}
+		if !slices.Equal(names, []string{"admin", "viewer"}) {
+			t.Fatalf("ListUserRoles returned %v", names)
+		}
+
+		if err := repo.Role.Unassign(ctx, user.UUID, "viewer"); err != nil {
+			t.Fatalf("Unassign: %v", err)
+		}
+		if err := repo.Role.Delete(ctx, "admin"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if err := repo.Role.Delete(ctx, "admin"); !errors.Is(err, repository.ErrRoleNotFound) {
+			t.Fatalf("Delete missing returned %v, want %v", err, repository.ErrRoleNotFound)
+		}
+
+		names, err = repo.Role.ListUserRoles(ctx, user.UUID)
+		if err != nil {
+			t.Fatalf("ListUserRoles: %v", err)
+		}
+		if len(names) != 0 {
+			t.Fatalf("ListUserRoles after delete returned %v, want none", names)
+		}
+	})
+}
+
+func RunAudit(t *testing.T, newRepo Factory) {
+	ctx := context.Background()
+
+	t.Run("CreateAndList", func(t *testing.T) {
+		repo := newRepo(t)
+		user, other := uuid.New(), uuid.New()
+		start := time.Now().UTC().Truncate(time.Second)
+
+		events := []model.AuditEvent{
+			newAuditEvent(model.AuditLogin, start, model.AuditActor{Type: model.AuditActorUser, ID: user.String()}, user),
+			newAuditEvent(model.AuditLogin, start.Add(time.Second), model.AuditActor{Type: model.AuditActorAnonymous}, other),
+			newAuditEvent(model.AuditUserDisable, start.Add(2*time.Second), model.AuditActor{Type: model.AuditActorAdminToken}, user),
+		}
+		events[1].Outcome = model.AuditFailure
+		events[1].Reason = "invalid password"
+		for _, event := range events {
+			if err := repo.Audit.Create(ctx, event); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		got, err := repo.Audit.List(ctx, model.AuditFilter{Limit: 10})
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(got) != 3 || got[0].ID != events[2].ID || got[2].ID != events[0].ID {
+			t.Fatalf("List returned %+v, want events newest first", got)
+		}
+		if got[1].Reason != "invalid password" || got[1].Details["email"] != "a@b.com" || !got[1].Time.Equal(events[1].Time) {
+			t.Fatalf("List returned %+v, want %+v", got[1], events[1])
+		}
+
+		got, err = repo.Audit.List(ctx, model.AuditFilter{UserID: user, Limit: 10})
+		if err != nil || len(got) != 2 {
+			t.Fatalf("List by user returned %d events, %v, want 2", len(got), err)
+		}
+
+		got, err = repo.Audit.List(ctx, model.AuditFilter{Action: model.AuditLogin, From: start.Add(time.Second), Limit: 10})
+		if err != nil || len(got) != 1 || got[0].ID != events[1].ID {
+			t.Fatalf("List by action and time returned %+v, %v", got, err)
+		}
+
+		got, err = repo.Audit.List(ctx, model.AuditFilter{To: start.Add(2 * time.Second), Offset: 1, Limit: 1})
+		if err != nil || len(got) != 1 || got[0].ID != events[0].ID {
+			t.Fatalf("List page returned %+v, %v", got, err)
+		}
+	})
+
+	t.Run("Chain", func(t *testing.T) {
+		repo := newRepo(t)
+		start := time.Now().UTC().Truncate(time.Millisecond)
+
+		if _, err := repo.Audit.Last(ctx, "node-1"); !errors.Is(err, repository.ErrAuditEventNotFound) {
+			t.Fatalf("Last on empty stream returned %v, want ErrAuditEventNotFound", err)
+		}
+
+		var prev string
+		for i := int64(1); i <= 3; i++ {
+			event := newAuditEvent(model.AuditLogin, start.Add(time.Duration(i)*time.Millisecond), model.AuditActor{Type: model.AuditActorAnonymous}, uuid.New())
+			event.Stream, event.Sequence, event.PrevHash = "node-1", i, prev
+			event.Hash = event.ComputeHash()
+			if err := repo.Audit.Create(ctx, event); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			prev = event.Hash
+		}
+		// Другой поток и событие без цепочки на номера node-1 не влияют
+		other := newAuditEvent(model.AuditLogin, start, model.AuditActor{Type: model.AuditActorAnonymous}, uuid.New())
+		other.Stream, other.Sequence = "node-2", 1
+		if err := repo.Audit.Create(ctx, other); err != nil {
+			t.Fatalf("Create in other stream: %v", err)
+		}
+		if err := repo.Audit.Create(ctx, newAuditEvent(model.AuditLogin, start, model.AuditActor{Type: model.AuditActorAnonymous}, uuid.New())); err != nil {
+			t.Fatalf("Create without chain: %v", err)
+		}
+
+		duplicate := newAuditEvent(model.AuditLogin, start, model.AuditActor{Type: model.AuditActorAnonymous}, uuid.New())
+		duplicate.Stream, duplicate.Sequence = "node-1", 2
+		if err := repo.Audit.Create(ctx, duplicate); !errors.Is(err, repository.ErrAuditEventConflict) {
+			t.Fatalf("Create with taken sequence returned %v, want ErrAuditEventConflict", err)
+		}
+
+		last, err := repo.Audit.Last(ctx, "node-1")
+		if err != nil || last.Sequence != 3 || last.Hash != prev {
+			t.Fatalf("Last returned %+v, %v, want sequence 3", last, err)
+		}
+		if last.ComputeHash() != last.Hash {
+			t.Fatal("event hash changed after roundtrip through the repository")
+		}
+
+		got, err := repo.Audit.ListStream(ctx, "node-1", 1, 10)
+		if err != nil || len(got) != 2 || got[0].Sequence != 2 || got[1].Sequence != 3 {
+			t.Fatalf("ListStream returned %+v, %v, want sequences 2, 3", got, err)
+		}
+
+		checkpoint := model.AuditCheckpoint{
+			ID: uuid.New(), Stream: "node-3", Sequence: 3, Hash: prev, CreatedAt: start, KeyID: "kid", Signature: "signature",
+		}
+		if err := repo.Audit.CreateCheckpoint(ctx, checkpoint); err != nil {
+			t.Fatalf("CreateCheckpoint: %v", err)
+		}
+		checkpoint.ID = uuid.New()
+		if err := repo.Audit.CreateCheckpoint(ctx, checkpoint); !errors.Is(err, repository.ErrAuditCheckpointExists) {
+			t.Fatalf("CreateCheckpoint twice returned %v, want ErrAuditCheckpointExists", err)
+		}
+		checkpoints, err := repo.Audit.ListCheckpoints(ctx, "node-3")
+		if err != nil || len(checkpoints) != 1 || checkpoints[0].Hash != prev || !checkpoints[0].CreatedAt.Equal(start) || checkpoints[0].KeyID != "kid" {
+			t.Fatalf("ListCheckpoints returned %+v, %v", checkpoints, err)
+		}
+
+		streams, err := repo.Audit.Streams(ctx)
+		if err != nil || !slices.Equal(streams, []string{"node-1", "node-2", "node-3"}) {
+			t.Fatalf("Streams returned %v, %v, want node-1, node-2, node-3", streams, err)
+		}
+	})
+}
+
+func RunWebhook(t *testing.T, newRepo Factory) {
+	ctx := context.Background()
+
+	t.Run("CRUD", func(t *testing.T) {
+		repo := newRepo(t)
+		webhook := newWebhook()
+
+		if err := repo.Webhook.Create(ctx, webhook); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		got, err := repo.Webhook.Get(ctx, webhook.ID)
+		if err != nil || got.URL != webhook.URL || got.Secret != webhook.Secret || !slices.Equal(got.Events, webhook.Events) || !got.Active {
+			t.Fatalf("Get returned %+v, %v, want %+v", got, err, webhook)
+		}
+
+		webhook.Events = []string{model.EventUserLogin}
+		webhook.Active = false
+		webhook.Secret = "rotated"
+		if err := repo.Webhook.Update(ctx, webhook); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		list, err := repo.Webhook.List(ctx)
+		if err != nil || len(list) != 1 || list[0].Active || list[0].Secret != "rotated" || !slices.Equal(list[0].Events, webhook.Events) {
+			t.Fatalf("List returned %+v, %v", list, err)
+		}
+
+		if err := repo.Webhook.Update(ctx, newWebhook()); !errors.Is(err, repository.ErrWebhookNotFound) {
+			t.Fatalf("Update unknown webhook returned %v, want ErrWebhookNotFound", err)
+		}
+		if _, err := repo.Webhook.Get(ctx, uuid.New()); !errors.Is(err, repository.ErrWebhookNotFound) {
+			t.Fatalf("Get unknown webhook returned %v, want ErrWebhookNotFound", err)
+		}
+	})
+
+	t.Run("Deliveries", func(t *testing.T) {
+		repo := newRepo(t)
+		webhook := newWebhook()
+		if err := repo.Webhook.Create(ctx, webhook); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		due := newWebhookDelivery(webhook.ID, now.Add(-time.Minute))
+		later := newWebhookDelivery(webhook.ID, now.Add(time.Hour))
+		for _, delivery := range []model.WebhookDelivery{due, later} {
+			if err := repo.Webhook.CreateDelivery(ctx, delivery); err != nil {
+				t.Fatalf("CreateDelivery: %v", err)
+			}
+		}
+		// Одно событие доставляется подписке один раз, даже если пришло повторно
+		duplicate := newWebhookDelivery(webhook.ID, now)
+		duplicate.EventID = due.EventID
+		if err := repo.Webhook.CreateDelivery(ctx, duplicate); !errors.Is(err, repository.ErrWebhookDeliveryExists) {
+			t.Fatalf("CreateDelivery for the same event returned %v, want ErrWebhookDeliveryExists", err)
+		}
+
+		lease := now.Add(time.Minute)
+		claimed, err := repo.Webhook.ClaimDeliveries(ctx, now, lease, 10)
+		if err != nil || len(claimed) != 1 || claimed[0].ID != due.ID || claimed[0].Attempts != 1 {
+			t.Fatalf("ClaimDeliveries returned %+v, %v, want the due delivery", claimed, err)
+		}
+		// Взятая доставка не достаётся повторно до окончания аренды
+		if claimed, err := repo.Webhook.ClaimDeliveries(ctx, now, lease, 10); err != nil || len(claimed) != 0 {
+			t.Fatalf("second ClaimDeliveries returned %+v, %v, want none", claimed, err)
+		}
+
+		// После окончания аренды доставку берут заново, и итог первой попытки уже не сохраняется
+		taken, err := repo.Webhook.ClaimDeliveries(ctx, lease, lease.Add(time.Minute), 10)
+		if err != nil || len(taken) != 1 || taken[0].ID != due.ID || taken[0].Attempts != 2 {
+			t.Fatalf("ClaimDeliveries after lease returned %+v, %v", taken, err)
+		}
+		stale := claimed[0]
+		stale.Status = model.WebhookDeliveryDead
+		if err := repo.Webhook.UpdateDelivery(ctx, stale); !errors.Is(err, repository.ErrLeaseLost) {
+			t.Fatalf("UpdateDelivery with lost lease returned %v, want ErrLeaseLost", err)
+		}
+
+		dead := taken[0]
+		dead.Status = model.WebhookDeliveryDead
+		dead.LastAttemptAt = &lease
+		if err := repo.Webhook.UpdateDelivery(ctx, dead); err != nil {
+			t.Fatalf("UpdateDelivery: %v", err)
+		}
+		// Вернуть в очередь можно только dead доставку и только один раз
+		if err := repo.Webhook.RetryDelivery(ctx, due.ID, now); err != nil {
+			t.Fatalf("RetryDelivery: %v", err)
+		}
+		if err := repo.Webhook.RetryDelivery(ctx, due.ID, now); !errors.Is(err, repository.ErrWebhookDeliveryNotFound) {
+			t.Fatalf("second RetryDelivery returned %v, want ErrWebhookDeliveryNotFound", err)
+		}
+		retried, err := repo.Webhook.ClaimDeliveries(ctx, now, lease, 10)
+		if err != nil || len(retried) != 1 || retried[0].ID != due.ID || retried[0].Attempts != 1 {
+			t.Fatalf("ClaimDeliveries after retry returned %+v, %v", retried, err)
+		}
+
+		delivery := retried[0]
+		delivery.Status = model.WebhookDeliveryDelivered
+		delivery.LastAttemptAt = &now
+		delivery.DeliveredAt = &now
+		delivery.ResponseStatus = 204
+		if err := repo.Webhook.UpdateDelivery(ctx, delivery); err != nil {
+			t.Fatalf("UpdateDelivery: %v", err)
+		}
+		got, err := repo.Webhook.GetDelivery(ctx, due.ID)
+		if err != nil || got.Status != model.WebhookDeliveryDelivered || got.DeliveredAt == nil || !got.DeliveredAt.Equal(now) || got.ResponseStatus != 204 {
+			t.Fatalf("GetDelivery returned %+v, %v", got, err)
+		}
+
+		page, err := repo.Webhook.ListDeliveries(ctx, model.WebhookDeliveryFilter{WebhookID: webhook.ID, Limit: 10})
+		if err != nil || len(page) != 2 || page[0].ID != later.ID {
+			t.Fatalf("ListDeliveries returned %+v, %v, want newest first", page, err)
+		}
+		page, err = repo.Webhook.ListDeliveries(ctx, model.WebhookDeliveryFilter{WebhookID: webhook.ID, Status: model.WebhookDeliveryPending, Limit: 10})
+		if err != nil || len(page) != 1 || page[0].ID != later.ID || page[0].LastAttemptAt != nil {
+			t.Fatalf("ListDeliveries by status returned %+v, %v", page, err)
+		}
+
+		if err := repo.Webhook.Delete(ctx, webhook.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := repo.Webhook.GetDelivery(ctx, later.ID); !errors.Is(err, repository.ErrWebhookDeliveryNotFound) {
+			t.Fatalf("GetDelivery after Delete returned %v, want ErrWebhookDeliveryNotFound", err)
+		}
+		if err := repo.Webhook.Delete(ctx, webhook.ID); !errors.Is(err, repository.ErrWebhookNotFound) {
+			t.Fatalf("second Delete returned %v, want ErrWebhookNotFound", err)
+		}
+	})
+}
+
+func RunOutbox(t *testing.T, newRepo Factory) {
+	ctx := context.Background()
+
+	t.Run("CreateWithinTransaction", func(t *testing.T) {
+		repo := newRepo(t)
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		committed := newOutboxMessage(now.Add(-time.Minute))
+		rolledBack := newOutboxMessage(now.Add(-time.Minute))
+
+		if err := repo.WithinTransaction(ctx, func(ctx context.Context) error {
+			return repo.Outbox.Create(ctx, committed)
+		}); err != nil {
+			t.Fatalf("WithinTransaction: %v", err)
+		}
+		err := repo.WithinTransaction(ctx, func(ctx context.Context) error {
+			if err := repo.Outbox.Create(ctx, rolledBack); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("WithinTransaction returned %v, want %v", err, errRollback)
+		}
+
+		claimed, err := repo.Outbox.Claim(ctx, "replica-a", now, now.Add(time.Minute), 10)
+		if err != nil || len(claimed) != 1 || claimed[0].ID != committed.ID {
+			t.Fatalf("Claim returned %+v, %v, want only the committed message", claimed, err)
+		}
+		if claimed[0].Type != committed.Type || claimed[0].Key != committed.Key || claimed[0].Payload != committed.Payload {
+			t.Fatalf("Claim returned %+v, want %+v", claimed[0], committed)
+		}
+	})
+
+	t.Run("ClaimAndUpdate", func(t *testing.T) {
+		repo := newRepo(t)
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		due := newOutboxMessage(now.Add(-time.Minute))
+		later := newOutboxMessage(now.Add(time.Hour))
+		for _, message := range []model.OutboxMessage{due, later} {
+			if err := repo.Outbox.Create(ctx, message); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		lease := now.Add(time.Minute)
+		claimed, err := repo.Outbox.Claim(ctx, "replica-a", now, lease, 10)
+		if err != nil || len(claimed) != 1 || claimed[0].ID != due.ID || claimed[0].Attempts != 1 || claimed[0].LockedBy != "replica-a" {
+			t.Fatalf("Claim returned %+v, %v, want the due message", claimed, err)
+		}
+		// Пока аренда не истекла, другая реплика сообщение не получает
+		if other, err := repo.Outbox.Claim(ctx, "replica-b", now, lease, 10); err != nil || len(other) != 0 {
+			t.Fatalf("Claim by another owner returned %+v, %v, want none", other, err)
+		}
+
+		// После окончания аренды сообщение забирает другая реплика, и итог первой уже не сохраняется
+		taken, err := repo.Outbox.Claim(ctx, "replica-b", lease, lease.Add(time.Minute), 10)
+		if err != nil || len(taken) != 1 || taken[0].ID != due.ID || taken[0].Attempts != 2 {
+			t.Fatalf("Claim after lease returned %+v, %v", taken, err)
+		}
+		stale := claimed[0]
+		stale.PublishedAt = &now
+		if err := repo.Outbox.Update(ctx, stale); !errors.Is(err, repository.ErrLeaseLost) {
+			t.Fatalf("Update with lost lease returned %v, want ErrLeaseLost", err)
+		}
+
+		published := taken[0]
+		published.PublishedAt = &lease
+		if err := repo.Outbox.Update(ctx, published); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if claimed, err := repo.Outbox.Claim(ctx, "replica-a", lease.Add(time.Hour), lease.Add(2*time.Hour), 10); err != nil || len(claimed) != 1 || claimed[0].ID != later.ID {
+			t.Fatalf("Claim after publish returned %+v, %v, want only the later message", claimed, err)
+		}
+
+		n, err := repo.Outbox.DeletePublished(ctx, lease.Add(time.Second))
+		if err != nil || n != 1 {
+			t.Fatalf("DeletePublished returned %d, %v, want 1", n, err)
+		}
+		if n, err := repo.Outbox.DeletePublished(ctx, lease.Add(time.Second)); err != nil || n != 0 {
+			t.Fatalf("second DeletePublished returned %d, %v, want 0", n, err)
+		}
+	})
+}
+
+func RunMailQueue(t *testing.T, newRepo Factory) {
+	ctx := context.Background()
+
+	t.Run("ClaimAndUpdate", func(t *testing.T) {
+		repo := newRepo(t)
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		due := newMailMessage(now.Add(-time.Minute))
+		later := newMailMessage(now.Add(time.Hour))
+		for _, message := range []model.MailMessage{due, later} {
+			if err := repo.MailQueue.Create(ctx, message); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		lease := now.Add(time.Minute)
+		claimed, err := repo.MailQueue.Claim(ctx, now, lease, 10)
+		if err != nil || len(claimed) != 1 || claimed[0].ID != due.ID || claimed[0].Attempts != 1 || !claimed[0].NextAttemptAt.Equal(lease) {
+			t.Fatalf("Claim returned %+v, %v, want the due message", claimed, err)
+		}
+		if claimed[0].To != due.To || claimed[0].Subject != due.Subject || claimed[0].Text != due.Text || claimed[0].HTML != due.HTML {
+			t.Fatalf("Claim returned %+v, want %+v", claimed[0], due)
+		}
+		// Взятое письмо не достаётся повторно до окончания аренды
+		if claimed, err := repo.MailQueue.Claim(ctx, now, lease, 10); err != nil || len(claimed) != 0 {
+			t.Fatalf("second Claim returned %+v, %v, want none", claimed, err)
+		}
+
+		// После окончания аренды письмо берут заново, и итог первой попытки уже не сохраняется
+		taken, err := repo.MailQueue.Claim(ctx, lease, lease.Add(time.Minute), 10)
+		if err != nil || len(taken) != 1 || taken[0].ID != due.ID || taken[0].Attempts != 2 {
+			t.Fatalf("Claim after lease returned %+v, %v", taken, err)
+		}
+		stale := claimed[0]
+		stale.Status = model.MailSent
+		stale.SentAt = &now
+		if err := repo.MailQueue.Update(ctx, stale); !errors.Is(err, repository.ErrLeaseLost) {
+			t.Fatalf("Update with lost lease returned %v, want ErrLeaseLost", err)
+		}
+
+		message := taken[0]
+		message.Status = model.MailSent
+		message.SentAt = &now
+		if err := repo.MailQueue.Update(ctx, message); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if claimed, err := repo.MailQueue.Claim(ctx, lease.Add(time.Hour), lease.Add(2*time.Hour), 10); err != nil || len(claimed) != 1 || claimed[0].ID != later.ID {
+			t.Fatalf("Claim after send returned %+v, %v, want only the later message", claimed, err)
+		}
+
+		missing := newMailMessage(now)
+		if err := repo.MailQueue.Update(ctx, missing); !errors.Is(err, repository.ErrLeaseLost) {
+			t.Fatalf("Update of missing message returned %v, want ErrLeaseLost", err)
+		}
+
+		// Ожидающие письма не удаляются, даже если созданы давно
+		n, err := repo.MailQueue.DeleteFinished(ctx, now.Add(2*time.Hour))
+		if err != nil || n != 1 {
+			t.Fatalf("DeleteFinished returned %d, %v, want 1", n, err)
+		}
+		if n, err := repo.MailQueue.DeleteFinished(ctx, now.Add(2*time.Hour)); err != nil || n != 0 {
+			t.Fatalf("second DeleteFinished returned %d, %v, want 0", n, err)
+		}
+	})
+
+	t.Run("CreateWithinTransaction", func(t *testing.T) {
+		repo := newRepo(t)
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		err := repo.WithinTransaction(ctx, func(ctx context.Context) error {
+			if err := repo.MailQueue.Create(ctx, newMailMessage(now)); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("WithinTransaction returned %v, want %v", err, errRollback)
+		}
+		if claimed, err := repo.MailQueue.Claim(ctx, now, now.Add(time.Minute), 10); err != nil || len(claimed) != 0 {
+			t.Fatalf("Claim after rollback returned %+v, %v, want none", claimed, err)
+		}
+	})
+}
+
+func RunKnownDevice(t *testing.T, newRepo Factory) {
+	ctx := context.Background()
+
+	t.Run("Lifecycle", func(t *testing.T) {
+		repo := newRepo(t)
+		user, other := newUser(), newUser()
+		for _, u := range []*model.User{user, other} {
+			if _, err := repo.Auth.Create(ctx, u); err != nil {
+				t.Fatalf("Create user: %v", err)
+			}
+		}
+
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		old := newKnownDevice(user.UUID, "Firefox on Linux", now.Add(-time.Hour))
+		recent := newKnownDevice(user.UUID, "Chrome on Windows", now)
+		foreign := newKnownDevice(other.UUID, "Firefox on Linux", now)
+		for _, device := range []model.KnownDevice{old, recent, foreign} {
+			if err := repo.KnownDevice.Create(ctx, device); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+		duplicate := newKnownDevice(user.UUID, old.UserAgent, now)
+		if err := repo.KnownDevice.Create(ctx, duplicate); !errors.Is(err, repository.ErrKnownDeviceExists) {
+			t.Fatalf("Create of duplicate device returned %v, want ErrKnownDeviceExists", err)
+		}
+
+		got, err := repo.KnownDevice.GetByDevice(ctx, user.UUID, old.Device)
+		if err != nil || got.ID != old.ID || !got.FirstSeenAt.Equal(old.FirstSeenAt) {
+			t.Fatalf("GetByDevice returned %+v, %v, want %+v", got, err, old)
+		}
+		if _, err := repo.KnownDevice.GetByID(ctx, other.UUID, old.ID); !errors.Is(err, repository.ErrKnownDeviceNotFound) {
+			t.Fatalf("GetByID of another user's device returned %v, want ErrKnownDeviceNotFound", err)
+		}
+
+		if err := repo.KnownDevice.UpdateLastSeen(ctx, old.ID, now.Add(time.Minute)); err != nil {
+			t.Fatalf("UpdateLastSeen: %v", err)
+		}
+		devices, err := repo.KnownDevice.ListByUserID(ctx, user.UUID)
+		if err != nil || len(devices) != 2 || devices[0].ID != old.ID || devices[1].ID != recent.ID {
+			t.Fatalf("ListByUserID returned %+v, %v, want old device first", devices, err)
+		}
+		if !devices[0].LastSeenAt.Equal(now.Add(time.Minute)) {
+			t.Fatalf("ListByUserID returned last seen %v, want %v", devices[0].LastSeenAt, now.Add(time.Minute))
+		}
+
+		if err := repo.KnownDevice.Delete(ctx, other.UUID, recent.ID); !errors.Is(err, repository.ErrKnownDeviceNotFound) {
+			t.Fatalf("Delete of another user's device returned %v, want ErrKnownDeviceNotFound", err)
+		}
+		if err := repo.KnownDevice.Delete(ctx, user.UUID, recent.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if err := repo.KnownDevice.DeleteByUserID(ctx, user.UUID); err != nil {
+			t.Fatalf("DeleteByUserID: %v", err)
+		}
+		if devices, err := repo.KnownDevice.ListByUserID(ctx, user.UUID); err != nil || len(devices) != 0 {
+			t.Fatalf("ListByUserID after delete returned %+v, %v, want none", devices, err)
+		}
+		if devices, err := repo.KnownDevice.ListByUserID(ctx, other.UUID); err != nil || len(devices) != 1 {
+			t.Fatalf("ListByUserID of other user returned %+v, %v, want 1", devices, err)
+		}
+	})
+}
+
+func newKnownDevice(userID uuid.UUID, userAgent string, seenAt time.Time) model.KnownDevice {
+	return model.KnownDevice{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Device:      model.Device{UserAgent: userAgent, Network: "network-hash"},
+		FirstSeenAt: seenAt,
+		LastSeenAt:  seenAt,
+	}
+}
+
+func newMailMessage(createdAt time.Time) model.MailMessage {
+	return model.MailMessage{
+		ID:            uuid.New(),
+		To:            "user@example.com",
+		Template:      "password_changed",
+		Subject:       "Your password was changed",
+		Text:          "Hello\n",
+		HTML:          "<p>Hello</p>",
+		Status:        model.MailPending,
+		NextAttemptAt: createdAt,
+		CreatedAt:     createdAt,
+	}
+}
+
+func newOutboxMessage(createdAt time.Time) model.OutboxMessage {
+	return model.OutboxMessage{
+		ID:            uuid.New(),
+		Type:          model.EventUserLogin,
+		Key:           uuid.NewString(),
+		Payload:       `{"type":"user.login"}`,
+		CreatedAt:     createdAt,
+		NextAttemptAt: createdAt,
+	}
+}
+
+func newWebhook() model.Webhook {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return model.Webhook{
+		ID:          uuid.New(),
+		URL:         "https://example.com/hooks",
+		Events:      []string{model.EventUserSignUp, model.EventUserLogin},
+		Description: "repotest",
+		Active:      true,
+		Secret:      uuid.NewString(),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+func newWebhookDelivery(webhookID uuid.UUID, createdAt time.Time) model.WebhookDelivery {
+	return model.WebhookDelivery{
+		ID:            uuid.New(),
+		WebhookID:     webhookID,
+		EventID:       uuid.New(),
+		EventType:     model.EventUserLogin,
+		Payload:       `{"type":"user.login"}`,
+		Status:        model.WebhookDeliveryPending,
+		NextAttemptAt: createdAt,
+		CreatedAt:     createdAt,
+	}
+}
+
+func newAuditEvent(action string, at time.Time, actor model.AuditActor, subject uuid.UUID) model.AuditEvent {
+	return model.AuditEvent{
+		ID:        uuid.New(),
+		Time:      at,
+		Action:    action,
+		Outcome:   model.AuditSuccess,
+		Actor:     actor,
+		Subject:   model.AuditSubject{Type: model.AuditSubjectUser, ID: subject.String()},
+		IP:        "127.0.0.1",
+		UserAgent: "repotest",
+		RequestID: uuid.NewString(),
+		Details:   map[string]string{"email": "a@b.com"},
+	}
+}
+
+func newDeviceAuthorization() model.DeviceAuthorization {
+	now := time.Now().UTC()
+	return model.DeviceAuthorization{
+		DeviceCodeHash: uuid.NewString(),
+		UserCode:       uuid.NewString()[:8],
+		ClientID:       "device-client",
+		Scope:          "openid",
+		Status:         model.DeviceAuthorizationPending,
+		NextPollAt:     now.Add(-time.Second),
+		ExpiresAt:      now.Add(time.Minute),
+	}
+}
+
+func newClient() *model.Client {
+	return &model.Client{
+		ID:         uuid.NewString(),
+		Name:       "test client",
+		SecretHash: "hashed-secret",
+		Audiences:  []string{"billing"},
+		CreatedAt:  time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+func newRole(name string) model.Role {
+	return model.Role{
+		Name:        name,
+		Description: name + " role",
+		Permissions: []string{"users:read"},
+		CreatedAt:   time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+func roleNames(roles []model.Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
+
+func newUser() *model.User {
+	id := uuid.New()
+	return &model.User{
+		UUID:     id,
+		Email:    id.String() + "@example.com",
+		Password: "hashed-password",
+	}
+}
+
+func sameRefreshToken(a, b model.RefreshToken) bool {
+	return a.ID == b.ID &&
+		a.UserID == b.UserID &&
+		a.AccessTokenID == b.AccessTokenID &&
+		a.Token == b.Token &&
+		a.ExpiresAt.Equal(b.ExpiresAt)
+}
+
+func sameRisk(a, b *model.Risk) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Score == b.Score &&
+		slices.Equal(a.Signals, b.Signals) &&
+		a.Decision == b.Decision &&
+		a.ACR == b.ACR &&
+		a.AssessedAt.Equal(b.AssessedAt)
+}
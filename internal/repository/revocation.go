@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/pkg/database/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type RevocationRepository struct {
+	provider *mongodb.Provider
+}
+
+func NewRevocationRepository(provider *mongodb.Provider) *RevocationRepository {
+	return &RevocationRepository{
+		provider: provider,
+	}
+}
+
+// Сохраняем отзыв, просроченные записи удаляет TTL индекс
+func (r *RevocationRepository) Create(ctx context.Context, revocation model.Revocation) error {
+	collection := r.provider.GetCollection("revocations")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, revocation)
+	return err
+}
+
+// Возвращаем действующие отзывы, сделанные начиная с since
+func (r *RevocationRepository) ListSince(ctx context.Context, since time.Time) ([]model.Revocation, error) {
+	collection := r.provider.GetCollection("revocations")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{
+		"revoked_at": bson.M{"$gte": since},
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var revocations []model.Revocation
+	if err := cursor.All(ctx, &revocations); err != nil {
+		return nil, err
+	}
+	return revocations, nil
+}
+
+// Удаляем просроченные отзывы, не дожидаясь TTL индекса
+func (r *RevocationRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	collection := r.provider.GetCollection("revocations")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	result, err := collection.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lte": now}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+type MemoryRevocationRepository struct {
+	db *memoryDB
+}
+
+// Сохраняем отзыв и попутно чистим просроченные записи
+func (r *MemoryRevocationRepository) Create(ctx context.Context, revocation model.Revocation) error {
+	return r.db.write(ctx, func() (func(), error) {
+		now := time.Now()
+		for id, rv := range r.db.revocations {
+			if !rv.ExpiresAt.After(now) {
+				delete(r.db.revocations, id)
+			}
+		}
+
+		r.db.revocations[revocation.ID] = revocation
+		return func() {
+			delete(r.db.revocations, revocation.ID)
+		}, nil
+	})
+}
+
+// Возвращаем действующие отзывы, сделанные начиная с since
+func (r *MemoryRevocationRepository) ListSince(ctx context.Context, since time.Time) ([]model.Revocation, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	now := time.Now()
+	var revocations []model.Revocation
+	for _, rv := range r.db.revocations {
+		if !rv.RevokedAt.Before(since) && rv.ExpiresAt.After(now) {
+			revocations = append(revocations, rv)
+		}
+	}
+	return revocations, nil
+}
+
+// Удаляем просроченные отзывы
+func (r *MemoryRevocationRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	var n int
+	err := r.db.write(ctx, func() (func(), error) {
+		deleted := make(map[uuid.UUID]model.Revocation)
+		for k, v := range r.db.revocations {
+			if !v.ExpiresAt.After(now) {
+				deleted[k] = v
+				delete(r.db.revocations, k)
+			}
+		}
+		n = len(deleted)
+		return func() {
+			for k, v := range deleted {
+				r.db.revocations[k] = v
+			}
+		}, nil
+	})
+	return n, err
+}
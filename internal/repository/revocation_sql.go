@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/v7ktory/test/internal/model"
+)
+
+// Время храним в UTC, чтобы сравнение работало и в SQLite, где оно хранится строкой
+type SQLRevocationRepository struct {
+	conn sqlConn
+}
+
+// Сохраняем отзыв и попутно чистим просроченные записи
+func (r *SQLRevocationRepository) Create(ctx context.Context, revocation model.Revocation) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	db := executor(ctx, r.conn.db)
+	if _, err := db.ExecContext(ctx, `DELETE FROM revocations WHERE expires_at <= $1`, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO revocations (id, kind, subject, revoked_at, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		revocation.ID, revocation.Kind, revocation.Subject, revocation.RevokedAt.UTC(), revocation.ExpiresAt.UTC(),
+	)
+	return err
+}
+
+// Возвращаем действующие отзывы, сделанные начиная с since
+func (r *SQLRevocationRepository) ListSince(ctx context.Context, since time.Time) ([]model.Revocation, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	rows, err := executor(ctx, r.conn.db).QueryContext(ctx,
+		`SELECT id, kind, subject, revoked_at, expires_at FROM revocations
+		WHERE revoked_at >= $1 AND expires_at > $2`,
+		since.UTC(), time.Now().UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revocations []model.Revocation
+	for rows.Next() {
+		var rv model.Revocation
+		if err := rows.Scan(&rv.ID, &rv.Kind, &rv.Subject, &rv.RevokedAt, &rv.ExpiresAt); err != nil {
+			return nil, err
+		}
+		revocations = append(revocations, rv)
+	}
+	return revocations, rows.Err()
+}
+
+// Удаляем просроченные отзывы
+func (r *SQLRevocationRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx, `DELETE FROM revocations WHERE expires_at <= $1`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/pkg/database/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrRoleExists   = errors.New("role already exists")
+	ErrRoleNotFound = errors.New("role not found")
+)
+
+type RoleRepository struct {
+	provider *mongodb.Provider
+}
+
+func NewRoleRepository(provider *mongodb.Provider) *RoleRepository {
+	return &RoleRepository{
+		provider: provider,
+	}
+}
+
+// Назначение роли пользователю, документ коллекции user_roles
+type userRole struct {
+	UserID uuid.UUID `bson:"user_id"`
+	Role   string    `bson:"role"`
+}
+
+// Создаём роль
+func (r *RoleRepository) Create(ctx context.Context, role model.Role) error {
+	collection := r.provider.GetCollection("roles")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, role)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrRoleExists
+	}
+	return err
+}
+
+// Возвращаем роль по имени
+func (r *RoleRepository) GetByName(ctx context.Context, name string) (*model.Role, error) {
+	collection := r.provider.GetCollection("roles")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	var role model.Role
+	err := collection.FindOne(ctx, bson.M{"_id": name}).Decode(&role)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// Возвращаем роли с переданными именами
+func (r *RoleRepository) GetByNames(ctx context.Context, names []string) ([]model.Role, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return r.find(ctx, bson.M{"_id": bson.M{"$in": names}})
+}
+
+// Возвращаем все роли, отсортированные по имени
+func (r *RoleRepository) List(ctx context.Context) ([]model.Role, error) {
+	return r.find(ctx, bson.M{})
+}
+
+func (r *RoleRepository) find(ctx context.Context, filter bson.M) ([]model.Role, error) {
+	collection := r.provider.GetCollection("roles")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []model.Role
+	if err := cursor.All(ctx, &roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// Обновляем описание и разрешения роли
+func (r *RoleRepository) Update(ctx context.Context, role model.Role) error {
+	collection := r.provider.GetCollection("roles")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"description": role.Description,
+		"permissions": role.Permissions,
+	}}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": role.Name}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+// Удаляем роль и её назначения, атомарность обеспечивает вызывающий через транзакцию
+func (r *RoleRepository) Delete(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	result, err := r.provider.GetCollection("roles").DeleteOne(ctx, bson.M{"_id": name})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrRoleNotFound
+	}
+
+	_, err = r.provider.GetCollection("user_roles").DeleteMany(ctx, bson.M{"role": name})
+	return err
+}
+
+// Назначаем роль пользователю, повторное назначение ничего не меняет
+func (r *RoleRepository) Assign(ctx context.Context, userID uuid.UUID, name string) error {
+	collection := r.provider.GetCollection("user_roles")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	assignment := userRole{UserID: userID, Role: name}
+	filter := bson.M{"user_id": userID, "role": name}
+	_, err := collection.ReplaceOne(ctx, filter, assignment, options.Replace().SetUpsert(true))
+	return err
+}
+
+// Снимаем роль с пользователя
+func (r *RoleRepository) Unassign(ctx context.Context, userID uuid.UUID, name string) error {
+	collection := r.provider.GetCollection("user_roles")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	_, err := collection.DeleteOne(ctx, bson.M{"user_id": userID, "role": name})
+	return err
+}
+
+// Возвращаем имена ролей пользователя по алфавиту
+func (r *RoleRepository) ListUserRoles(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	collection := r.provider.GetCollection("user_roles")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "role", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var assignments []userRole
+	if err := cursor.All(ctx, &assignments); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(assignments))
+	for _, assignment := range assignments {
+		names = append(names, assignment.Role)
+	}
+	return names, nil
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+type MemoryRoleRepository struct {
+	db *memoryDB
+}
+
+// Создаём роль
+func (r *MemoryRoleRepository) Create(ctx context.Context, role model.Role) error {
+	return r.db.write(ctx, func() (func(), error) {
+		if _, ok := r.db.roles[role.Name]; ok {
+			return nil, ErrRoleExists
+		}
+
+		r.db.roles[role.Name] = role
+		return func() {
+			delete(r.db.roles, role.Name)
+		}, nil
+	})
+}
+
+// Возвращаем роль по имени
+func (r *MemoryRoleRepository) GetByName(ctx context.Context, name string) (*model.Role, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	role, ok := r.db.roles[name]
+	if !ok {
+		return nil, ErrRoleNotFound
+	}
+	return &role, nil
+}
+
+// Возвращаем роли с переданными именами
+func (r *MemoryRoleRepository) GetByNames(ctx context.Context, names []string) ([]model.Role, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var roles []model.Role
+	for _, role := range r.db.roles {
+		if slices.Contains(names, role.Name) {
+			roles = append(roles, role)
+		}
+	}
+	sortRoles(roles)
+	return roles, nil
+}
+
+// Возвращаем все роли, отсортированные по имени
+func (r *MemoryRoleRepository) List(ctx context.Context) ([]model.Role, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	roles := make([]model.Role, 0, len(r.db.roles))
+	for _, role := range r.db.roles {
+		roles = append(roles, role)
+	}
+	sortRoles(roles)
+	return roles, nil
+}
+
+// Обновляем описание и разрешения роли
+func (r *MemoryRoleRepository) Update(ctx context.Context, role model.Role) error {
+	return r.db.write(ctx, func() (func(), error) {
+		prev, ok := r.db.roles[role.Name]
+		if !ok {
+			return nil, ErrRoleNotFound
+		}
+
+		updated := prev
+		updated.Description = role.Description
+		updated.Permissions = role.Permissions
+		r.db.roles[role.Name] = updated
+		return func() {
+			r.db.roles[role.Name] = prev
+		}, nil
+	})
+}
+
+// Удаляем роль и её назначения
+func (r *MemoryRoleRepository) Delete(ctx context.Context, name string) error {
+	return r.db.write(ctx, func() (func(), error) {
+		role, ok := r.db.roles[name]
+		if !ok {
+			return nil, ErrRoleNotFound
+		}
+
+		prevAssignments := make(map[uuid.UUID][]string)
+		for userID, names := range r.db.userRoles {
+			if slices.Contains(names, name) {
+				prevAssignments[userID] = names
+				r.db.userRoles[userID] = slices.DeleteFunc(slices.Clone(names), func(n string) bool { return n == name })
+			}
+		}
+		delete(r.db.roles, name)
+		return func() {
+			r.db.roles[name] = role
+			for userID, names := range prevAssignments {
+				r.db.userRoles[userID] = names
+			}
+		}, nil
+	})
+}
+
+// Назначаем роль пользователю, повторное назначение ничего не меняет
+func (r *MemoryRoleRepository) Assign(ctx context.Context, userID uuid.UUID, name string) error {
+	return r.db.write(ctx, func() (func(), error) {
+		prev := r.db.userRoles[userID]
+		if slices.Contains(prev, name) {
+			return nil, nil
+		}
+
+		r.db.userRoles[userID] = append(slices.Clone(prev), name)
+		return func() {
+			r.db.userRoles[userID] = prev
+		}, nil
+	})
+}
+
+// Снимаем роль с пользователя
+func (r *MemoryRoleRepository) Unassign(ctx context.Context, userID uuid.UUID, name string) error {
+	return r.db.write(ctx, func() (func(), error) {
+		prev := r.db.userRoles[userID]
+		if !slices.Contains(prev, name) {
+			return nil, nil
+		}
+
+		r.db.userRoles[userID] = slices.DeleteFunc(slices.Clone(prev), func(n string) bool { return n == name })
+		return func() {
+			r.db.userRoles[userID] = prev
+		}, nil
+	})
+}
+
+// Возвращаем имена ролей пользователя по алфавиту
+func (r *MemoryRoleRepository) ListUserRoles(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	names := slices.Clone(r.db.userRoles[userID])
+	slices.Sort(names)
+	if names == nil {
+		names = []string{}
+	}
+	return names, nil
+}
+
+func sortRoles(roles []model.Role) {
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+}
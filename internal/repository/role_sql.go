@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+type SQLRoleRepository struct {
+	conn sqlConn
+}
+
+// Создаём роль
+func (r *SQLRoleRepository) Create(ctx context.Context, role model.Role) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	permissions, err := json.Marshal(role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	_, err = executor(ctx, r.conn.db).ExecContext(ctx,
+		`INSERT INTO roles (name, description, permissions, created_at) VALUES ($1, $2, $3, $4)`,
+		role.Name, role.Description, string(permissions), role.CreatedAt.UTC(),
+	)
+	if r.conn.isUniqueViolation(err) {
+		return ErrRoleExists
+	}
+	return err
+}
+
+// Возвращаем роль по имени
+func (r *SQLRoleRepository) GetByName(ctx context.Context, name string) (*model.Role, error) {
+	roles, err := r.query(ctx, `WHERE name = $1`, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, ErrRoleNotFound
+	}
+	return &roles[0], nil
+}
+
+// Возвращаем роли с переданными именами
+func (r *SQLRoleRepository) GetByNames(ctx context.Context, names []string) ([]model.Role, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, len(names))
+	args := make([]any, len(names))
+	for i, name := range names {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = name
+	}
+	return r.query(ctx, `WHERE name IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+}
+
+// Возвращаем все роли, отсортированные по имени
+func (r *SQLRoleRepository) List(ctx context.Context) ([]model.Role, error) {
+	return r.query(ctx, ``)
+}
+
+func (r *SQLRoleRepository) query(ctx context.Context, where string, args ...any) ([]model.Role, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	rows, err := executor(ctx, r.conn.db).QueryContext(ctx,
+		`SELECT name, description, permissions, created_at FROM roles `+where+` ORDER BY name`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []model.Role
+	for rows.Next() {
+		var (
+			role        model.Role
+			permissions string
+		)
+		if err := rows.Scan(&role.Name, &role.Description, &permissions, &role.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(permissions), &role.Permissions); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// Обновляем описание и разрешения роли
+func (r *SQLRoleRepository) Update(ctx context.Context, role model.Role) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	permissions, err := json.Marshal(role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`UPDATE roles SET description = $2, permissions = $3 WHERE name = $1`,
+		role.Name, role.Description, string(permissions),
+	)
+	if err != nil {
+		return err
+	}
+	return roleAffected(result)
+}
+
+// Удаляем роль, назначения удаляются каскадно
+func (r *SQLRoleRepository) Delete(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx, `DELETE FROM roles WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+	return roleAffected(result)
+}
+
+// Назначаем роль пользователю, повторное назначение ничего не меняет
+func (r *SQLRoleRepository) Assign(ctx context.Context, userID uuid.UUID, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	_, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`INSERT INTO user_roles (user_id, role) VALUES ($1, $2) ON CONFLICT (user_id, role) DO NOTHING`,
+		userID, name,
+	)
+	return err
+}
+
+// Снимаем роль с пользователя
+func (r *SQLRoleRepository) Unassign(ctx context.Context, userID uuid.UUID, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	_, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`DELETE FROM user_roles WHERE user_id = $1 AND role = $2`,
+		userID, name,
+	)
+	return err
+}
+
+// Возвращаем имена ролей пользователя по алфавиту
+func (r *SQLRoleRepository) ListUserRoles(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	rows, err := executor(ctx, r.conn.db).QueryContext(ctx,
+		`SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func roleAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
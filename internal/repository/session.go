@@ -9,11 +9,15 @@ import (
 	"github.com/v7ktory/test/internal/model"
 	"github.com/v7ktory/test/pkg/database/mongodb"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var (
+	ErrSessionNotFound      = errors.New("session not found")
 	ErrRefreshTokenNotFound = errors.New("refresh token not found")
 	ErrAccessTokenNotFound  = errors.New("access token not found")
+	// Сессию всё время меняли параллельно, и запись так и не удалось выполнить
+	ErrSessionConflict = errors.New("session was changed concurrently")
 )
 
 type SessionRepository struct {
@@ -40,7 +44,25 @@ func (r *SessionRepository) Create(ctx context.Context, session model.Session) e
 	return nil
 }
 
-// Возвращаем сессию по ID
+// Возвращаем сессию по её ID
+func (r *SessionRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Session, error) {
+	collection := r.provider.GetCollection("sessions")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	var session model.Session
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Возвращаем first-party сессию пользователя
 func (r *SessionRepository) GetByUserID(ctx context.Context, userID uuid.UUID) (*model.Session, error) {
 	collection := r.provider.GetCollection("sessions")
 
@@ -48,7 +70,14 @@ func (r *SessionRepository) GetByUserID(ctx context.Context, userID uuid.UUID) (
 	defer cancel()
 
 	var session model.Session
-	err := collection.FindOne(ctx, bson.M{"refresh_token.user_id": userID}).Decode(&session)
+	filter := bson.M{
+		"refresh_token.user_id": userID,
+		"client_id":             bson.M{"$in": bson.A{nil, ""}},
+	}
+	err := collection.FindOne(ctx, filter).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrSessionNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -71,11 +100,63 @@ func (r *SessionRepository) Update(ctx context.Context, session model.Session) e
 			"token":           session.RefreshToken.Token,
 			"expires_at":      session.RefreshToken.ExpiresAt,
 		},
+		"device": session.Device,
+		"risk":   session.Risk,
 	}}
 
-	_, err := collection.UpdateOne(ctx, filter, update)
+	result, err := collection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
+	if result.MatchedCount == 0 {
+		return ErrSessionNotFound
+	}
 	return nil
 }
+
+// Возвращаем все сессии пользователя
+func (r *SessionRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]model.Session, error) {
+	collection := r.provider.GetCollection("sessions")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{"refresh_token.user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []model.Session
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Удаляем все сессии пользователя
+func (r *SessionRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	collection := r.provider.GetCollection("sessions")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	_, err := collection.DeleteMany(ctx, bson.M{"refresh_token.user_id": userID})
+	return err
+}
+
+// Удаляем сессии OAuth клиентов с истёкшим refresh токеном, не дожидаясь TTL индекса
+func (r *SessionRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	collection := r.provider.GetCollection("sessions")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	result, err := collection.DeleteMany(ctx, bson.M{
+		"client_id":                bson.M{"$nin": bson.A{nil, ""}},
+		"refresh_token.expires_at": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+type MemorySessionRepository struct {
+	db *memoryDB
+}
+
+// Создаём сессию
+func (r *MemorySessionRepository) Create(ctx context.Context, session model.Session) error {
+	return r.db.write(ctx, func() (func(), error) {
+		r.db.sessions[session.ID] = session
+		return func() {
+			delete(r.db.sessions, session.ID)
+		}, nil
+	})
+}
+
+// Возвращаем сессию по её ID
+func (r *MemorySessionRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Session, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	session, ok := r.db.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return &session, nil
+}
+
+// Возвращаем first-party сессию пользователя
+func (r *MemorySessionRepository) GetByUserID(ctx context.Context, userID uuid.UUID) (*model.Session, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	for _, session := range r.db.sessions {
+		if session.RefreshToken.UserID == userID && session.ClientID == "" {
+			return &session, nil
+		}
+	}
+	return nil, ErrSessionNotFound
+}
+
+// Возвращаем все сессии пользователя
+func (r *MemorySessionRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]model.Session, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var sessions []model.Session
+	for _, session := range r.db.sessions {
+		if session.RefreshToken.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+// Обновляем сессию
+func (r *MemorySessionRepository) Update(ctx context.Context, session model.Session) error {
+	return r.db.write(ctx, func() (func(), error) {
+		prev, ok := r.db.sessions[session.ID]
+		if !ok {
+			return nil, ErrSessionNotFound
+		}
+
+		updated := prev
+		updated.RefreshToken = session.RefreshToken
+		updated.Device = session.Device
+		updated.Risk = session.Risk
+		r.db.sessions[session.ID] = updated
+		return func() {
+			r.db.sessions[session.ID] = prev
+		}, nil
+	})
+}
+
+// Удаляем все сессии пользователя
+func (r *MemorySessionRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	return r.db.write(ctx, func() (func(), error) {
+		deleted := make(map[uuid.UUID]model.Session)
+		for id, session := range r.db.sessions {
+			if session.RefreshToken.UserID == userID {
+				deleted[id] = session
+				delete(r.db.sessions, id)
+			}
+		}
+		return func() {
+			for id, session := range deleted {
+				r.db.sessions[id] = session
+			}
+		}, nil
+	})
+}
+
+// Удаляем сессии OAuth клиентов с истёкшим refresh токеном
+func (r *MemorySessionRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	var n int
+	err := r.db.write(ctx, func() (func(), error) {
+		deleted := make(map[uuid.UUID]model.Session)
+		for k, v := range r.db.sessions {
+			if v.ClientID != "" && !v.RefreshToken.ExpiresAt.After(now) {
+				deleted[k] = v
+				delete(r.db.sessions, k)
+			}
+		}
+		n = len(deleted)
+		return func() {
+			for k, v := range deleted {
+				r.db.sessions[k] = v
+			}
+		}, nil
+	})
+	return n, err
+}
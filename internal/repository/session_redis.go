@@ -0,0 +1,303 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/v7ktory/test/internal/model"
+	rdb "github.com/v7ktory/test/pkg/database/redis"
+)
+
+const (
+	sessionKeyPrefix      = "session:"
+	userSessionsKeyPrefix = "user_sessions:"
+	// Сессии OAuth клиентов с TTL по времени истечения, для DeleteExpired
+	sessionExpiryKey = "session_expiry"
+	// Сколько раз повторяем транзакцию, если отслеживаемый ключ изменили параллельно
+	sessionWatchAttempts = 5
+)
+
+/*
+Хранилище сессий в Redis. Сессии OAuth клиентов истекают по нативному TTL ключа,
+first-party сессия живёт без TTL: она у пользователя одна и создаётся при регистрации
+*/
+type RedisSessionRepository struct {
+	provider *rdb.Provider
+}
+
+func NewRedisSessionRepository(provider *rdb.Provider) *RedisSessionRepository {
+	return &RedisSessionRepository{
+		provider: provider,
+	}
+}
+
+// Создаём сессию
+func (r *RedisSessionRepository) Create(ctx context.Context, session model.Session) error {
+	ctx, cancel := context.WithTimeout(ctx, r.provider.QueryTimeout)
+	defer cancel()
+
+	payload, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.provider.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		setSession(ctx, pipe, session, payload)
+		return nil
+	})
+	return err
+}
+
+// Возвращаем сессию по её ID
+func (r *RedisSessionRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.provider.QueryTimeout)
+	defer cancel()
+
+	payload, err := r.provider.Client.Get(ctx, sessionKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session model.Session
+	if err := json.Unmarshal(payload, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+/*
+Возвращаем first-party сессию пользователя.
+Истёкшие по TTL сессии попутно удаляем из индекса пользователя
+*/
+func (r *RedisSessionRepository) GetByUserID(ctx context.Context, userID uuid.UUID) (*model.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.provider.QueryTimeout)
+	defer cancel()
+
+	indexKey := userSessionsKey(userID)
+	ids, err := r.provider.Client.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		payload, err := r.provider.Client.Get(ctx, sessionKeyPrefix+id).Bytes()
+		if errors.Is(err, redis.Nil) {
+			r.provider.Client.SRem(ctx, indexKey, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var session model.Session
+		if err := json.Unmarshal(payload, &session); err != nil {
+			return nil, err
+		}
+		if session.RefreshToken.UserID != userID {
+			r.provider.Client.SRem(ctx, indexKey, id)
+			continue
+		}
+		if session.ClientID != "" {
+			continue
+		}
+		return &session, nil
+	}
+	return nil, ErrSessionNotFound
+}
+
+/*
+Возвращаем все сессии пользователя.
+Истёкшие по TTL сессии попутно удаляем из индекса пользователя
+*/
+func (r *RedisSessionRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]model.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.provider.QueryTimeout)
+	defer cancel()
+
+	indexKey := userSessionsKey(userID)
+	ids, err := r.provider.Client.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []model.Session
+	for _, id := range ids {
+		payload, err := r.provider.Client.Get(ctx, sessionKeyPrefix+id).Bytes()
+		if errors.Is(err, redis.Nil) {
+			r.provider.Client.SRem(ctx, indexKey, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var session model.Session
+		if err := json.Unmarshal(payload, &session); err != nil {
+			return nil, err
+		}
+		if session.RefreshToken.UserID != userID {
+			r.provider.Client.SRem(ctx, indexKey, id)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+/*
+Обновляем сессию, удалённую или истёкшую не воскрешаем. Запись выполняется, только если
+ключ не изменился после чтения, иначе читаем заново
+*/
+func (r *RedisSessionRepository) Update(ctx context.Context, session model.Session) error {
+	ctx, cancel := context.WithTimeout(ctx, r.provider.QueryTimeout)
+	defer cancel()
+
+	key := sessionKey(session.ID)
+	return r.watch(ctx, func(tx *redis.Tx) error {
+		payload, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return ErrSessionNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var updated model.Session
+		if err := json.Unmarshal(payload, &updated); err != nil {
+			return err
+		}
+		updated.RefreshToken = session.RefreshToken
+		updated.Device = session.Device
+		updated.Risk = session.Risk
+
+		if payload, err = json.Marshal(updated); err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			setSession(ctx, pipe, updated, payload)
+			return nil
+		})
+		return err
+	}, key)
+}
+
+/*
+Удаляем все сессии пользователя вместе с его индексом. Если индекс изменился
+между чтением и удалением (параллельно создали сессию), читаем его заново
+*/
+func (r *RedisSessionRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.provider.QueryTimeout)
+	defer cancel()
+
+	indexKey := userSessionsKey(userID)
+	return r.watch(ctx, func(tx *redis.Tx) error {
+		ids, err := tx.SMembers(ctx, indexKey).Result()
+		if err != nil {
+			return err
+		}
+
+		keys := []string{indexKey}
+		members := make([]any, 0, len(ids))
+		for _, id := range ids {
+			keys = append(keys, sessionKeyPrefix+id)
+			members = append(members, id)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, keys...)
+			if len(members) > 0 {
+				pipe.ZRem(ctx, sessionExpiryKey, members...)
+			}
+			return nil
+		})
+		return err
+	}, indexKey)
+}
+
+// Выполняем транзакцию с WATCH keys, повторяя её, пока ключи меняют параллельно
+func (r *RedisSessionRepository) watch(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) error {
+	for range sessionWatchAttempts {
+		err := r.provider.Client.Watch(ctx, fn, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return ErrSessionConflict
+}
+
+// Записываем сессию с её TTL и добавляем в индексы пользователя и истечения
+func setSession(ctx context.Context, pipe redis.Pipeliner, session model.Session, payload []byte) {
+	ttl := sessionTTL(session)
+	pipe.Set(ctx, sessionKey(session.ID), payload, ttl)
+	pipe.SAdd(ctx, userSessionsKey(session.RefreshToken.UserID), session.ID.String())
+	if ttl > 0 {
+		pipe.ZAdd(ctx, sessionExpiryKey, redis.Z{
+			Score:  float64(session.RefreshToken.ExpiresAt.UnixMilli()),
+			Member: session.ID.String(),
+		})
+	} else {
+		pipe.ZRem(ctx, sessionExpiryKey, session.ID.String())
+	}
+}
+
+// First-party сессия и сессия без выданного refresh токена живут без TTL
+func sessionTTL(session model.Session) time.Duration {
+	if session.ClientID == "" || session.RefreshToken.ExpiresAt.IsZero() {
+		return 0
+	}
+	ttl := time.Until(session.RefreshToken.ExpiresAt)
+	if ttl <= 0 {
+		// Уже истекла: минимальный положительный TTL, чтобы ключ сразу удалился
+		return time.Millisecond
+	}
+	return ttl
+}
+
+func sessionKey(id uuid.UUID) string {
+	return sessionKeyPrefix + id.String()
+}
+
+func userSessionsKey(userID uuid.UUID) string {
+	return userSessionsKeyPrefix + userID.String()
+}
+
+/*
+Удаляем сессии OAuth клиентов с истёкшим refresh токеном. Обычно Redis уже удалил их
+по TTL, тогда чистим только индекс истечения
+*/
+func (r *RedisSessionRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.provider.QueryTimeout)
+	defer cancel()
+
+	ids, err := r.provider.Client.ZRangeByScore(ctx, sessionExpiryKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.UnixMilli(), 10),
+	}).Result()
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	keys := make([]string, 0, len(ids))
+	members := make([]any, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, sessionKeyPrefix+id)
+		members = append(members, id)
+	}
+
+	var deleted *redis.IntCmd
+	_, err = r.provider.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		deleted = pipe.Del(ctx, keys...)
+		pipe.ZRem(ctx, sessionExpiryKey, members...)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(deleted.Val()), nil
+}
@@ -0,0 +1,31 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/v7ktory/test/internal/config"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/internal/repository/repotest"
+	rdb "github.com/v7ktory/test/pkg/database/redis"
+)
+
+// Пользователи в памяти, сессии в Redis, как при SESSION_DRIVER=redis
+func TestRedisSessionRepository(t *testing.T) {
+	repotest.RunSession(t, func(t *testing.T) *repository.Repository {
+		server := miniredis.RunT(t)
+		provider, err := rdb.NewRedis(context.Background(), config.RedisCfg{
+			Addr:         server.Addr(),
+			QueryTimeout: testQueryTimeout,
+		})
+		if err != nil {
+			t.Fatalf("NewRedis: %v", err)
+		}
+		t.Cleanup(func() { provider.Close() })
+
+		repo := repository.NewMemoryRepository()
+		repo.Session = repository.NewRedisSessionRepository(provider)
+		return repo
+	})
+}
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+const sessionColumns = `id, client_id, scope, auth_time, user_id, refresh_token_id, access_token_id, token, expires_at, device_user_agent, device_network, risk`
+
+// Реализация поверх database/sql, используется для PostgreSQL и SQLite
+type SQLSessionRepository struct {
+	conn sqlConn
+}
+
+// Создаём сессию
+func (r *SQLSessionRepository) Create(ctx context.Context, session model.Session) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	rt := session.RefreshToken
+	extra, err := newSessionExtra(session)
+	if err != nil {
+		return err
+	}
+	_, err = executor(ctx, r.conn.db).ExecContext(ctx,
+		`INSERT INTO sessions (`+sessionColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		session.ID, session.ClientID, session.Scope, session.AuthTime.UTC(), rt.UserID, rt.ID, rt.AccessTokenID, rt.Token, rt.ExpiresAt,
+		extra.deviceUserAgent, extra.deviceNetwork, extra.risk,
+	)
+	return err
+}
+
+// Возвращаем сессию по её ID
+func (r *SQLSessionRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	var (
+		session model.Session
+		extra   sessionExtra
+	)
+	err := executor(ctx, r.conn.db).QueryRowContext(ctx,
+		`SELECT `+sessionColumns+`
+		FROM sessions WHERE id = $1`,
+		id,
+	).Scan(sessionFields(&session, &extra)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := extra.apply(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Возвращаем first-party сессию пользователя
+func (r *SQLSessionRepository) GetByUserID(ctx context.Context, userID uuid.UUID) (*model.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	var (
+		session model.Session
+		extra   sessionExtra
+	)
+	err := executor(ctx, r.conn.db).QueryRowContext(ctx,
+		`SELECT `+sessionColumns+`
+		FROM sessions WHERE user_id = $1 AND client_id = '' LIMIT 1`,
+		userID,
+	).Scan(sessionFields(&session, &extra)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := extra.apply(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Возвращаем все сессии пользователя
+func (r *SQLSessionRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]model.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	rows, err := executor(ctx, r.conn.db).QueryContext(ctx,
+		`SELECT `+sessionColumns+`
+		FROM sessions WHERE user_id = $1 ORDER BY client_id, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []model.Session
+	for rows.Next() {
+		var (
+			session model.Session
+			extra   sessionExtra
+		)
+		if err := rows.Scan(sessionFields(&session, &extra)...); err != nil {
+			return nil, err
+		}
+		if err := extra.apply(&session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// Обновляем сессию
+func (r *SQLSessionRepository) Update(ctx context.Context, session model.Session) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	rt := session.RefreshToken
+	extra, err := newSessionExtra(session)
+	if err != nil {
+		return err
+	}
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`UPDATE sessions
+		SET user_id = $2, refresh_token_id = $3, access_token_id = $4, token = $5, expires_at = $6,
+			device_user_agent = $7, device_network = $8, risk = $9
+		WHERE id = $1`,
+		session.ID, rt.UserID, rt.ID, rt.AccessTokenID, rt.Token, rt.ExpiresAt,
+		extra.deviceUserAgent, extra.deviceNetwork, extra.risk,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrSessionNotFound)
+}
+
+// Удаляем все сессии пользователя
+func (r *SQLSessionRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	_, err := executor(ctx, r.conn.db).ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1`, userID)
+	return err
+}
+
+// Удаляем сессии OAuth клиентов с истёкшим refresh токеном
+func (r *SQLSessionRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx, `DELETE FROM sessions WHERE client_id <> '' AND expires_at <= $1`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+/*
+Устройство сессии хранится в колонках device_*, оценка риска - JSON в колонке risk.
+Без устройства и оценки колонки пустые
+*/
+type sessionExtra struct {
+	deviceUserAgent string
+	deviceNetwork   string
+	risk            string
+}
+
+func newSessionExtra(session model.Session) (sessionExtra, error) {
+	var extra sessionExtra
+	if session.Device != nil {
+		extra.deviceUserAgent = session.Device.UserAgent
+		extra.deviceNetwork = session.Device.Network
+	}
+	if session.Risk != nil {
+		risk, err := json.Marshal(session.Risk)
+		if err != nil {
+			return extra, err
+		}
+		extra.risk = string(risk)
+	}
+	return extra, nil
+}
+
+func (e sessionExtra) apply(session *model.Session) error {
+	if e.deviceUserAgent != "" || e.deviceNetwork != "" {
+		session.Device = &model.Device{UserAgent: e.deviceUserAgent, Network: e.deviceNetwork}
+	}
+	if e.risk != "" {
+		session.Risk = &model.Risk{}
+		return json.Unmarshal([]byte(e.risk), session.Risk)
+	}
+	return nil
+}
+
+func sessionFields(session *model.Session, extra *sessionExtra) []any {
+	rt := &session.RefreshToken
+	return []any{
+		&session.ID, &session.ClientID, &session.Scope, &session.AuthTime, &rt.UserID, &rt.ID, &rt.AccessTokenID, &rt.Token, &rt.ExpiresAt,
+		&extra.deviceUserAgent, &extra.deviceNetwork, &extra.risk,
+	}
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/v7ktory/test/pkg/database/mongodb"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type MongoTransactor struct {
+	provider *mongodb.Provider
+}
+
+func NewMongoTransactor(provider *mongodb.Provider) *MongoTransactor {
+	return &MongoTransactor{
+		provider: provider,
+	}
+}
+
+/*
+Выполняем fn внутри транзакции MongoDB.
+Контекст, переданный в fn, несёт сессию, поэтому все операции репозиториев,
+вызванные с ним, попадают в одну транзакцию
+*/
+func (t *MongoTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return t.provider.GetClient().UseSession(ctx, func(sc mongo.SessionContext) error {
+		_, err := sc.WithTransaction(sc, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc)
+		})
+		return err
+	})
+}
+
+type txKey struct{}
+
+// Общий интерфейс *sql.DB и *sql.Tx
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Подключение к SQL базе и особенности её драйвера
+type sqlConn struct {
+	db                *sql.DB
+	queryTimeout      time.Duration
+	isUniqueViolation func(err error) bool
+}
+
+type SQLTransactor struct {
+	db *sql.DB
+}
+
+func NewSQLTransactor(db *sql.DB) *SQLTransactor {
+	return &SQLTransactor{
+		db: db,
+	}
+}
+
+/*
+Выполняем fn внутри SQL транзакции.
+Транзакция передаётся через контекст, вложенные вызовы переиспользуют её
+*/
+func (t *SQLTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Возвращаем транзакцию из контекста, если она есть, иначе само подключение
+func executor(ctx context.Context, db *sql.DB) sqlExecutor {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/pkg/database/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrWebhookNotFound         = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	// Доставка этого события этой подписке уже создана
+	ErrWebhookDeliveryExists = errors.New("webhook delivery already exists")
+)
+
+type WebhookRepository struct {
+	provider *mongodb.Provider
+}
+
+func NewWebhookRepository(provider *mongodb.Provider) *WebhookRepository {
+	return &WebhookRepository{
+		provider: provider,
+	}
+}
+
+// Создаём подписку
+func (r *WebhookRepository) Create(ctx context.Context, webhook model.Webhook) error {
+	collection := r.provider.GetCollection("webhooks")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, webhook)
+	return err
+}
+
+// Возвращаем подписку по id
+func (r *WebhookRepository) Get(ctx context.Context, id uuid.UUID) (*model.Webhook, error) {
+	collection := r.provider.GetCollection("webhooks")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	var webhook model.Webhook
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&webhook)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// Возвращаем все подписки в порядке создания
+func (r *WebhookRepository) List(ctx context.Context) ([]model.Webhook, error) {
+	collection := r.provider.GetCollection("webhooks")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var webhooks []model.Webhook
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// Обновляем адрес, события, описание, активность и секрет подписки
+func (r *WebhookRepository) Update(ctx context.Context, webhook model.Webhook) error {
+	collection := r.provider.GetCollection("webhooks")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"url":         webhook.URL,
+		"events":      webhook.Events,
+		"description": webhook.Description,
+		"active":      webhook.Active,
+		"secret":      webhook.Secret,
+		"updated_at":  webhook.UpdatedAt,
+	}}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": webhook.ID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// Удаляем подписку и её доставки, атомарность обеспечивает вызывающий через транзакцию
+func (r *WebhookRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	result, err := r.provider.GetCollection("webhooks").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrWebhookNotFound
+	}
+
+	_, err = r.provider.GetCollection("webhook_deliveries").DeleteMany(ctx, bson.M{"webhook_id": id})
+	return err
+}
+
+func (r *WebhookRepository) CreateDelivery(ctx context.Context, delivery model.WebhookDelivery) error {
+	collection := r.provider.GetCollection("webhook_deliveries")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, delivery)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrWebhookDeliveryExists
+	}
+	return err
+}
+
+func (r *WebhookRepository) GetDelivery(ctx context.Context, id uuid.UUID) (*model.WebhookDelivery, error) {
+	collection := r.provider.GetCollection("webhook_deliveries")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	var delivery model.WebhookDelivery
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// Возвращаем доставки подписки по фильтру, от новых к старым
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, filter model.WebhookDeliveryFilter) ([]model.WebhookDelivery, error) {
+	collection := r.provider.GetCollection("webhook_deliveries")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	query := bson.M{"webhook_id": filter.WebhookID}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(filter.Offset)).
+		SetLimit(int64(filter.Limit))
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []model.WebhookDelivery
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+/*
+Берём в работу доставки, срок которых наступил. Каждую захватываем условным
+обновлением по числу попыток: если её уже взяла другая реплика, обновление не пройдёт
+*/
+func (r *WebhookRepository) ClaimDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.WebhookDelivery, error) {
+	collection := r.provider.GetCollection("webhook_deliveries")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	query := bson.M{"status": model.WebhookDeliveryPending, "next_attempt_at": bson.M{"$lte": now}}
+	opts := options.Find().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var due []model.WebhookDelivery
+	if err := cursor.All(ctx, &due); err != nil {
+		return nil, err
+	}
+
+	var claimed []model.WebhookDelivery
+	for _, delivery := range due {
+		filter := bson.M{"_id": delivery.ID, "status": model.WebhookDeliveryPending, "attempts": delivery.Attempts}
+		update := bson.M{
+			"$set": bson.M{"next_attempt_at": leaseUntil},
+			"$inc": bson.M{"attempts": 1},
+		}
+		result, err := collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return nil, err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		delivery.Attempts++
+		delivery.NextAttemptAt = leaseUntil
+		claimed = append(claimed, delivery)
+	}
+	return claimed, nil
+}
+
+// Сохраняем итог попытки доставки, если её не взяли заново: каждый Claim увеличивает attempts
+func (r *WebhookRepository) UpdateDelivery(ctx context.Context, delivery model.WebhookDelivery) error {
+	collection := r.provider.GetCollection("webhook_deliveries")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	filter := bson.M{"_id": delivery.ID, "attempts": delivery.Attempts}
+	update := bson.M{"$set": bson.M{
+		"status":          delivery.Status,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"last_attempt_at": delivery.LastAttemptAt,
+		"response_status": delivery.ResponseStatus,
+		"error":           delivery.Error,
+		"delivered_at":    delivery.DeliveredAt,
+	}}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Возвращаем dead доставку в очередь, условие на статус не даёт вернуть её дважды
+func (r *WebhookRepository) RetryDelivery(ctx context.Context, id uuid.UUID, now time.Time) error {
+	collection := r.provider.GetCollection("webhook_deliveries")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.provider.QueryTimeout))
+	defer cancel()
+
+	filter := bson.M{"_id": id, "status": model.WebhookDeliveryDead}
+	update := bson.M{"$set": bson.M{
+		"status":          model.WebhookDeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+	}}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+	return nil
+}
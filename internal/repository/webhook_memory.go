@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+type MemoryWebhookRepository struct {
+	db *memoryDB
+}
+
+// Создаём подписку
+func (r *MemoryWebhookRepository) Create(ctx context.Context, webhook model.Webhook) error {
+	return r.db.write(ctx, func() (func(), error) {
+		webhook.Events = slices.Clone(webhook.Events)
+		r.db.webhooks[webhook.ID] = webhook
+		return func() {
+			delete(r.db.webhooks, webhook.ID)
+		}, nil
+	})
+}
+
+// Возвращаем подписку по id
+func (r *MemoryWebhookRepository) Get(ctx context.Context, id uuid.UUID) (*model.Webhook, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	webhook, ok := r.db.webhooks[id]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	webhook.Events = slices.Clone(webhook.Events)
+	return &webhook, nil
+}
+
+// Возвращаем все подписки в порядке создания
+func (r *MemoryWebhookRepository) List(ctx context.Context) ([]model.Webhook, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	webhooks := make([]model.Webhook, 0, len(r.db.webhooks))
+	for _, webhook := range r.db.webhooks {
+		webhook.Events = slices.Clone(webhook.Events)
+		webhooks = append(webhooks, webhook)
+	}
+	slices.SortFunc(webhooks, func(a, b model.Webhook) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID.String(), b.ID.String())
+	})
+	return webhooks, nil
+}
+
+// Обновляем адрес, события, описание, активность и секрет подписки
+func (r *MemoryWebhookRepository) Update(ctx context.Context, webhook model.Webhook) error {
+	return r.db.write(ctx, func() (func(), error) {
+		prev, ok := r.db.webhooks[webhook.ID]
+		if !ok {
+			return nil, ErrWebhookNotFound
+		}
+
+		updated := prev
+		updated.URL = webhook.URL
+		updated.Events = slices.Clone(webhook.Events)
+		updated.Description = webhook.Description
+		updated.Active = webhook.Active
+		updated.Secret = webhook.Secret
+		updated.UpdatedAt = webhook.UpdatedAt
+		r.db.webhooks[webhook.ID] = updated
+		return func() {
+			r.db.webhooks[webhook.ID] = prev
+		}, nil
+	})
+}
+
+// Удаляем подписку вместе с её доставками
+func (r *MemoryWebhookRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.db.write(ctx, func() (func(), error) {
+		webhook, ok := r.db.webhooks[id]
+		if !ok {
+			return nil, ErrWebhookNotFound
+		}
+
+		deliveries := make(map[uuid.UUID]model.WebhookDelivery)
+		for deliveryID, delivery := range r.db.webhookDeliveries {
+			if delivery.WebhookID == id {
+				deliveries[deliveryID] = delivery
+				delete(r.db.webhookDeliveries, deliveryID)
+			}
+		}
+		delete(r.db.webhooks, id)
+		return func() {
+			r.db.webhooks[id] = webhook
+			for deliveryID, delivery := range deliveries {
+				r.db.webhookDeliveries[deliveryID] = delivery
+			}
+		}, nil
+	})
+}
+
+func (r *MemoryWebhookRepository) CreateDelivery(ctx context.Context, delivery model.WebhookDelivery) error {
+	return r.db.write(ctx, func() (func(), error) {
+		for _, existing := range r.db.webhookDeliveries {
+			if existing.WebhookID == delivery.WebhookID && existing.EventID == delivery.EventID {
+				return nil, ErrWebhookDeliveryExists
+			}
+		}
+		r.db.webhookDeliveries[delivery.ID] = delivery
+		return func() {
+			delete(r.db.webhookDeliveries, delivery.ID)
+		}, nil
+	})
+}
+
+func (r *MemoryWebhookRepository) GetDelivery(ctx context.Context, id uuid.UUID) (*model.WebhookDelivery, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	delivery, ok := r.db.webhookDeliveries[id]
+	if !ok {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	return &delivery, nil
+}
+
+// Возвращаем доставки подписки по фильтру, от новых к старым
+func (r *MemoryWebhookRepository) ListDeliveries(ctx context.Context, filter model.WebhookDeliveryFilter) ([]model.WebhookDelivery, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var deliveries []model.WebhookDelivery
+	for _, delivery := range r.db.webhookDeliveries {
+		if delivery.WebhookID != filter.WebhookID || (filter.Status != "" && delivery.Status != filter.Status) {
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	slices.SortFunc(deliveries, func(a, b model.WebhookDelivery) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID.String(), a.ID.String())
+	})
+	if filter.Offset >= len(deliveries) {
+		return nil, nil
+	}
+	deliveries = deliveries[filter.Offset:]
+	return deliveries[:min(filter.Limit, len(deliveries))], nil
+}
+
+// Берём в работу доставки, срок которых наступил
+func (r *MemoryWebhookRepository) ClaimDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.WebhookDelivery, error) {
+	var claimed []model.WebhookDelivery
+	err := r.db.write(ctx, func() (func(), error) {
+		var due []model.WebhookDelivery
+		for _, delivery := range r.db.webhookDeliveries {
+			if delivery.Status == model.WebhookDeliveryPending && !delivery.NextAttemptAt.After(now) {
+				due = append(due, delivery)
+			}
+		}
+		slices.SortFunc(due, func(a, b model.WebhookDelivery) int {
+			return a.NextAttemptAt.Compare(b.NextAttemptAt)
+		})
+		due = due[:min(limit, len(due))]
+
+		for _, delivery := range due {
+			delivery.Attempts++
+			delivery.NextAttemptAt = leaseUntil
+			r.db.webhookDeliveries[delivery.ID] = delivery
+			claimed = append(claimed, delivery)
+		}
+		return func() {
+			for _, delivery := range due {
+				r.db.webhookDeliveries[delivery.ID] = delivery
+			}
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// Сохраняем итог попытки доставки, если её не взяли заново: каждый Claim увеличивает attempts
+func (r *MemoryWebhookRepository) UpdateDelivery(ctx context.Context, delivery model.WebhookDelivery) error {
+	return r.db.write(ctx, func() (func(), error) {
+		prev, ok := r.db.webhookDeliveries[delivery.ID]
+		if !ok || prev.Attempts != delivery.Attempts {
+			return nil, ErrLeaseLost
+		}
+
+		updated := prev
+		updated.Status = delivery.Status
+		updated.NextAttemptAt = delivery.NextAttemptAt
+		updated.LastAttemptAt = delivery.LastAttemptAt
+		updated.ResponseStatus = delivery.ResponseStatus
+		updated.Error = delivery.Error
+		updated.DeliveredAt = delivery.DeliveredAt
+		r.db.webhookDeliveries[delivery.ID] = updated
+		return func() {
+			r.db.webhookDeliveries[delivery.ID] = prev
+		}, nil
+	})
+}
+
+// Возвращаем dead доставку в очередь
+func (r *MemoryWebhookRepository) RetryDelivery(ctx context.Context, id uuid.UUID, now time.Time) error {
+	return r.db.write(ctx, func() (func(), error) {
+		prev, ok := r.db.webhookDeliveries[id]
+		if !ok || prev.Status != model.WebhookDeliveryDead {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+
+		updated := prev
+		updated.Status = model.WebhookDeliveryPending
+		updated.Attempts = 0
+		updated.NextAttemptAt = now
+		r.db.webhookDeliveries[id] = updated
+		return func() {
+			r.db.webhookDeliveries[id] = prev
+		}, nil
+	})
+}
@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+)
+
+const (
+	webhookColumns         = `id, url, events, description, active, secret, created_at, updated_at`
+	webhookDeliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	last_attempt_at, response_status, error, created_at, delivered_at`
+)
+
+// События подписки храним JSON массивом
+type SQLWebhookRepository struct {
+	conn sqlConn
+}
+
+// Создаём подписку
+func (r *SQLWebhookRepository) Create(ctx context.Context, webhook model.Webhook) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return err
+	}
+
+	_, err = executor(ctx, r.conn.db).ExecContext(ctx,
+		`INSERT INTO webhooks (`+webhookColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		webhook.ID, webhook.URL, string(events), webhook.Description, webhook.Active, webhook.Secret,
+		webhook.CreatedAt.UTC(), webhook.UpdatedAt.UTC(),
+	)
+	return err
+}
+
+// Возвращаем подписку по id
+func (r *SQLWebhookRepository) Get(ctx context.Context, id uuid.UUID) (*model.Webhook, error) {
+	webhooks, err := r.query(ctx, `WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, ErrWebhookNotFound
+	}
+	return &webhooks[0], nil
+}
+
+// Возвращаем все подписки в порядке создания
+func (r *SQLWebhookRepository) List(ctx context.Context) ([]model.Webhook, error) {
+	return r.query(ctx, ``)
+}
+
+func (r *SQLWebhookRepository) query(ctx context.Context, where string, args ...any) ([]model.Webhook, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	rows, err := executor(ctx, r.conn.db).QueryContext(ctx,
+		`SELECT `+webhookColumns+` FROM webhooks `+where+` ORDER BY created_at, id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []model.Webhook
+	for rows.Next() {
+		var (
+			webhook model.Webhook
+			events  string
+		)
+		err := rows.Scan(&webhook.ID, &webhook.URL, &events, &webhook.Description, &webhook.Active, &webhook.Secret,
+			&webhook.CreatedAt, &webhook.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(events), &webhook.Events); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// Обновляем адрес, события, описание, активность и секрет подписки
+func (r *SQLWebhookRepository) Update(ctx context.Context, webhook model.Webhook) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return err
+	}
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`UPDATE webhooks SET url = $2, events = $3, description = $4, active = $5, secret = $6, updated_at = $7 WHERE id = $1`,
+		webhook.ID, webhook.URL, string(events), webhook.Description, webhook.Active, webhook.Secret, webhook.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrWebhookNotFound)
+}
+
+// Удаляем подписку, доставки удаляются каскадно
+func (r *SQLWebhookRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrWebhookNotFound)
+}
+
+func (r *SQLWebhookRepository) CreateDelivery(ctx context.Context, delivery model.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	_, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`INSERT INTO webhook_deliveries (`+webhookDeliveryColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		delivery.ID, delivery.WebhookID, delivery.EventID, delivery.EventType, delivery.Payload, delivery.Status,
+		delivery.Attempts, delivery.NextAttemptAt.UTC(), nullTimePtr(delivery.LastAttemptAt), delivery.ResponseStatus,
+		delivery.Error, delivery.CreatedAt.UTC(), nullTimePtr(delivery.DeliveredAt),
+	)
+	if r.conn.isUniqueViolation(err) {
+		return ErrWebhookDeliveryExists
+	}
+	return err
+}
+
+func (r *SQLWebhookRepository) GetDelivery(ctx context.Context, id uuid.UUID) (*model.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	deliveries, err := r.queryDeliveries(ctx, `WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	return &deliveries[0], nil
+}
+
+// Возвращаем доставки подписки по фильтру, от новых к старым
+func (r *SQLWebhookRepository) ListDeliveries(ctx context.Context, filter model.WebhookDeliveryFilter) ([]model.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	where, args := `WHERE webhook_id = $1`, []any{filter.WebhookID}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where += fmt.Sprintf(` AND status = $%d`, len(args))
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	return r.queryDeliveries(ctx,
+		fmt.Sprintf(`%s ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args)),
+		args...,
+	)
+}
+
+/*
+Берём в работу доставки, срок которых наступил. Каждую захватываем условным
+обновлением по числу попыток: если её уже взяла другая реплика, обновление не пройдёт
+*/
+func (r *SQLWebhookRepository) ClaimDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	due, err := r.queryDeliveries(ctx,
+		`WHERE status = $1 AND next_attempt_at <= $2 ORDER BY next_attempt_at LIMIT $3`,
+		model.WebhookDeliveryPending, now.UTC(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []model.WebhookDelivery
+	for _, delivery := range due {
+		result, err := executor(ctx, r.conn.db).ExecContext(ctx,
+			`UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = $3
+			WHERE id = $1 AND attempts = $2 AND status = $4`,
+			delivery.ID, delivery.Attempts, leaseUntil.UTC(), model.WebhookDeliveryPending,
+		)
+		if err != nil {
+			return nil, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			continue
+		}
+		delivery.Attempts++
+		delivery.NextAttemptAt = leaseUntil
+		claimed = append(claimed, delivery)
+	}
+	return claimed, nil
+}
+
+// Сохраняем итог попытки доставки, если её не взяли заново: каждый Claim увеличивает attempts
+func (r *SQLWebhookRepository) UpdateDelivery(ctx context.Context, delivery model.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`UPDATE webhook_deliveries
+		SET status = $3, next_attempt_at = $4, last_attempt_at = $5, response_status = $6, error = $7, delivered_at = $8
+		WHERE id = $1 AND attempts = $2`,
+		delivery.ID, delivery.Attempts, delivery.Status, delivery.NextAttemptAt.UTC(), nullTimePtr(delivery.LastAttemptAt),
+		delivery.ResponseStatus, delivery.Error, nullTimePtr(delivery.DeliveredAt),
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrLeaseLost)
+}
+
+// Возвращаем dead доставку в очередь, условие на статус не даёт вернуть её дважды
+func (r *SQLWebhookRepository) RetryDelivery(ctx context.Context, id uuid.UUID, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conn.queryTimeout)
+	defer cancel()
+
+	result, err := executor(ctx, r.conn.db).ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status = $3, attempts = 0, next_attempt_at = $4 WHERE id = $1 AND status = $2`,
+		id, model.WebhookDeliveryDead, model.WebhookDeliveryPending, now.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrWebhookDeliveryNotFound)
+}
+
+func (r *SQLWebhookRepository) queryDeliveries(ctx context.Context, where string, args ...any) ([]model.WebhookDelivery, error) {
+	rows, err := executor(ctx, r.conn.db).QueryContext(ctx,
+		`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries `+where,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		var (
+			delivery      model.WebhookDelivery
+			lastAttemptAt sql.NullTime
+			deliveredAt   sql.NullTime
+		)
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.Payload,
+			&delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &lastAttemptAt, &delivery.ResponseStatus,
+			&delivery.Error, &delivery.CreatedAt, &deliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.LastAttemptAt = timePtr(lastAttemptAt)
+		delivery.DeliveredAt = timePtr(deliveredAt)
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func nullTimePtr(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return nullTime(*t)
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func expectAffected(result sql.Result, notFound error) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,372 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+
+	// Сколько раз перечитываем хвост потока, если номер события занял другой процесс
+	maxAuditChainRetries = 3
+	auditVerifyBatchSize = 500
+
+	auditCheckpointPurpose = "audit-checkpoint"
+)
+
+var ErrInvalidTimeRange = errors.New("invalid time range")
+
+type Audit interface {
+	ListAuditEvents(ctx context.Context, filter model.AuditFilter) (*model.AuditPage, error)
+}
+
+type auditMetaKey struct{}
+
+// Кто и откуда выполняет запрос, транспорт кладёт это в контекст
+type AuditMeta struct {
+	Actor     model.AuditActor
+	IP        string
+	UserAgent string
+	RequestID string
+}
+
+func WithAuditMeta(ctx context.Context, meta AuditMeta) context.Context {
+	return context.WithValue(ctx, auditMetaKey{}, meta)
+}
+
+// Уточняем, кто выполняет запрос, например после проверки токена
+func WithAuditActor(ctx context.Context, actor model.AuditActor) context.Context {
+	meta := auditMetaFrom(ctx)
+	meta.Actor = actor
+	return WithAuditMeta(ctx, meta)
+}
+
+func auditMetaFrom(ctx context.Context) AuditMeta {
+	meta, _ := ctx.Value(auditMetaKey{}).(AuditMeta)
+	return meta
+}
+
+/*
+Журнал аудита: запись событий безопасности и выборка для admin API.
+События пишутся в поток stream цепочкой хэшей, периодически хвост цепочки
+закрепляется контрольной точкой, подписанной RSA ключом ID токенов. Его, в отличие
+от секрета access токенов, ротируют с сохранением предыдущего ключа, так что
+точки, подписанные до ротации, продолжают проверяться
+*/
+type AuditService struct {
+	repo               repository.Audit
+	keys               *jwt.IDTokenSigner
+	log                *slog.Logger
+	stream             string
+	checkpointInterval time.Duration
+
+	// Записи потока выстраиваются в очередь, чтобы не занимать один номер
+	mu sync.Mutex
+	// Хвост цепочки: номер и хэш последнего записанного события
+	loaded   bool
+	sequence int64
+	hash     string
+	// Номер события, на которое уже есть контрольная точка
+	checkpointed int64
+}
+
+func NewAuditService(repo repository.Audit, keys *jwt.IDTokenSigner, log *slog.Logger, stream string, checkpointInterval time.Duration) *AuditService {
+	return &AuditService{
+		repo:               repo,
+		keys:               keys,
+		log:                log,
+		stream:             stream,
+		checkpointInterval: checkpointInterval,
+	}
+}
+
+/*
+Записываем событие, исход определяется по ошибке операции. Удобно вызывать через defer
+с указателями на событие и именованную ошибку, тогда событие можно дополнить
+по ходу операции. Ошибка записи только логируется и не ломает саму операцию
+*/
+func (s *AuditService) Record(ctx context.Context, event *model.AuditEvent, err *error) {
+	meta := auditMetaFrom(ctx)
+
+	e := *event
+	e.ID = uuid.New()
+	e.Time = time.Now().UTC()
+	e.Outcome = model.AuditSuccess
+	if *err != nil {
+		e.Outcome = model.AuditFailure
+		e.Reason = (*err).Error()
+	}
+	if e.Actor.Type == "" {
+		e.Actor = meta.Actor
+	}
+	if e.Actor.Type == "" {
+		e.Actor.Type = model.AuditActorAnonymous
+	}
+	e.IP = meta.IP
+	e.UserAgent = meta.UserAgent
+	e.RequestID = meta.RequestID
+
+	// Операция могла завершиться по отмене контекста, событие всё равно нужно записать
+	if writeErr := s.append(context.WithoutCancel(ctx), e); writeErr != nil {
+		s.log.Error("failed to write audit event", "action", e.Action, "error", writeErr)
+	}
+}
+
+/*
+Добавляем событие в конец цепочки потока. Если номер уже занят, значит в поток
+писал другой процесс (например authctl на той же машине): перечитываем хвост и пробуем снова
+*/
+func (s *AuditService) append(ctx context.Context, e model.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Хранилища держат время с точностью до миллисекунд, хэш должен пережить сохранение
+	e.Time = e.Time.Truncate(time.Millisecond)
+	e.Stream = s.stream
+
+	for attempt := 0; ; attempt++ {
+		if err := s.loadTail(ctx); err != nil {
+			return err
+		}
+		e.Sequence = s.sequence + 1
+		e.PrevHash = s.hash
+		e.Hash = e.ComputeHash()
+
+		err := s.repo.Create(ctx, e)
+		if err == nil {
+			s.sequence, s.hash = e.Sequence, e.Hash
+			return nil
+		}
+		// После ошибки неизвестно, что записалось, хвост перечитаем перед следующей записью
+		s.loaded = false
+		if !errors.Is(err, repository.ErrAuditEventConflict) || attempt == maxAuditChainRetries {
+			return err
+		}
+	}
+}
+
+func (s *AuditService) loadTail(ctx context.Context) error {
+	if s.loaded {
+		return nil
+	}
+	last, err := s.repo.Last(ctx, s.stream)
+	switch {
+	case errors.Is(err, repository.ErrAuditEventNotFound):
+		s.sequence, s.hash = 0, ""
+	case err != nil:
+		return err
+	default:
+		s.sequence, s.hash = last.Sequence, last.Hash
+	}
+	s.loaded = true
+	return nil
+}
+
+// Периодически закрепляем хвост цепочки контрольной точкой, пока не отменён ctx
+func (s *AuditService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.checkpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Checkpoint(ctx); err != nil {
+				s.log.Error("failed to create audit checkpoint", "error", err)
+			}
+		}
+	}
+}
+
+/*
+Подписываем хэш последнего события потока. Если с прошлой точки
+новых событий не было, ничего не делаем и возвращаем nil
+*/
+func (s *AuditService) Checkpoint(ctx context.Context) (*model.AuditCheckpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Хвост читаем заново: в поток мог писать и другой процесс
+	s.loaded = false
+	if err := s.loadTail(ctx); err != nil {
+		return nil, err
+	}
+	if s.sequence == 0 || s.sequence == s.checkpointed {
+		return nil, nil
+	}
+
+	checkpoint := model.AuditCheckpoint{
+		ID:        uuid.New(),
+		Stream:    s.stream,
+		Sequence:  s.sequence,
+		Hash:      s.hash,
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+	keyID, signature, err := s.keys.SignData(auditCheckpointPurpose, checkpoint.SignedData())
+	if err != nil {
+		return nil, err
+	}
+	checkpoint.KeyID, checkpoint.Signature = keyID, signature
+
+	err = s.repo.CreateCheckpoint(ctx, checkpoint)
+	if errors.Is(err, repository.ErrAuditCheckpointExists) {
+		s.checkpointed = s.sequence
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.checkpointed = s.sequence
+	return &checkpoint, nil
+}
+
+/*
+Проходим цепочку каждого потока (или только stream, если он задан) и ищем
+первое нарушенное звено: пропуск номера, несовпадение хэшей, контрольную точку
+с чужим хэшем или неверной подписью. Контрольная точка дальше последнего
+события значит, что хвост цепочки удалён.
+События, записанные до появления цепочки, в проверку не входят
+*/
+func (s *AuditService) Verify(ctx context.Context, stream string) ([]model.AuditVerification, error) {
+	streams := []string{stream}
+	if stream == "" {
+		var err error
+		if streams, err = s.repo.Streams(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	verifications := make([]model.AuditVerification, 0, len(streams))
+	for _, stream := range streams {
+		v, err := s.verifyStream(ctx, stream)
+		if err != nil {
+			return nil, err
+		}
+		verifications = append(verifications, *v)
+	}
+	return verifications, nil
+}
+
+func (s *AuditService) verifyStream(ctx context.Context, stream string) (*model.AuditVerification, error) {
+	checkpoints, err := s.repo.ListCheckpoints(ctx, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &model.AuditVerification{Stream: stream, Checkpoints: len(checkpoints), Valid: true}
+	broken := func(sequence int64, eventID uuid.UUID, reason string) (*model.AuditVerification, error) {
+		v.Valid = false
+		v.Broken = &model.AuditBreak{Sequence: sequence, EventID: eventID, Reason: reason}
+		return v, nil
+	}
+
+	var (
+		hash string
+		next int
+	)
+	for {
+		events, err := s.repo.ListStream(ctx, stream, v.LastSequence, auditVerifyBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range events {
+			switch {
+			case e.Sequence != v.LastSequence+1:
+				return broken(v.LastSequence+1, uuid.Nil, fmt.Sprintf("sequence gap: expected %d, got %d", v.LastSequence+1, e.Sequence))
+			case e.PrevHash != hash:
+				return broken(e.Sequence, e.ID, "previous hash does not match")
+			case e.ComputeHash() != e.Hash:
+				return broken(e.Sequence, e.ID, "event hash does not match its content")
+			}
+			for ; next < len(checkpoints) && checkpoints[next].Sequence == e.Sequence; next++ {
+				if reason := s.checkCheckpoint(checkpoints[next], e.Hash); reason != "" {
+					return broken(e.Sequence, e.ID, reason)
+				}
+			}
+			v.Events++
+			v.LastSequence, hash = e.Sequence, e.Hash
+		}
+		if len(events) < auditVerifyBatchSize {
+			break
+		}
+	}
+
+	if next < len(checkpoints) {
+		checkpoint := checkpoints[next]
+		if reason := s.checkCheckpoint(checkpoint, checkpoint.Hash); reason != "" {
+			return broken(checkpoint.Sequence, uuid.Nil, reason)
+		}
+		return broken(v.LastSequence+1, uuid.Nil, fmt.Sprintf("chain is truncated: checkpoint covers sequence %d", checkpoint.Sequence))
+	}
+	return v, nil
+}
+
+// Причина, по которой контрольная точка не подтверждает хэш события, или пустая строка
+func (s *AuditService) checkCheckpoint(checkpoint model.AuditCheckpoint, hash string) string {
+	if !s.keys.VerifyData(auditCheckpointPurpose, checkpoint.SignedData(), checkpoint.KeyID, checkpoint.Signature) {
+		return "checkpoint signature is invalid"
+	}
+	if checkpoint.Hash != hash {
+		return "event hash does not match checkpoint"
+	}
+	return ""
+}
+
+// Возвращаем страницу событий, по умолчанию по 50, не больше 200 за раз
+func (s *AuditService) ListAuditEvents(ctx context.Context, filter model.AuditFilter) (*model.AuditPage, error) {
+	if filter.Offset < 0 || filter.Limit < 0 {
+		return nil, ErrInvalidPagination
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, ErrInvalidTimeRange
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+	filter.Limit = min(filter.Limit, maxAuditPageSize)
+
+	events, err := s.repo.List(ctx, filter)
+	if err != nil {
+		s.log.Error("failed to list audit events", "error", err)
+		return nil, err
+	}
+	if events == nil {
+		events = []model.AuditEvent{}
+	}
+	return &model.AuditPage{Events: events, Offset: filter.Offset, Limit: filter.Limit}, nil
+}
+
+// Кто действует по access токену: пользователь или сервисный клиент
+func TokenActor(claims *jwt.Claims) model.AuditActor {
+	if claims.IsServiceToken() {
+		return model.AuditActor{Type: model.AuditActorClient, ID: claims.ClientID}
+	}
+	return userActor(claims.UserID)
+}
+
+func tokenSubject(claims *jwt.Claims) model.AuditSubject {
+	if claims.IsServiceToken() {
+		return model.AuditSubject{Type: model.AuditSubjectClient, ID: claims.ClientID}
+	}
+	return userSubject(claims.UserID)
+}
+
+func userActor(id uuid.UUID) model.AuditActor {
+	return model.AuditActor{Type: model.AuditActorUser, ID: id.String()}
+}
+
+func userSubject(id uuid.UUID) model.AuditSubject {
+	return model.AuditSubject{Type: model.AuditSubjectUser, ID: id.String()}
+}
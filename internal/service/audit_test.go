@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+func TestAuditVerifyStream(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	previousKey, err := jwt.GenerateRSAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentKey, err := jwt.GenerateRSAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := jwt.GenerateRSAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// До ротации подписывал previousKey, после неё он остаётся только для проверки
+	previous := jwt.NewIDTokenSigner("https://auth.example.com", previousKey)
+	current := jwt.NewIDTokenSigner("https://auth.example.com", currentKey, &previousKey.PublicKey)
+	unknown := jwt.NewIDTokenSigner("https://auth.example.com", otherKey)
+
+	// Цепочка из трёх событий с верными хэшами
+	chain := func() []model.AuditEvent {
+		events := make([]model.AuditEvent, 3)
+		var prev string
+		for i := range events {
+			events[i] = model.AuditEvent{
+				ID: uuid.New(), Time: time.Now().UTC().Truncate(time.Millisecond), Action: model.AuditLogin,
+				Outcome: model.AuditSuccess, Actor: model.AuditActor{Type: model.AuditActorAnonymous},
+				Stream: "node-1", Sequence: int64(i + 1), PrevHash: prev,
+			}
+			events[i].Hash = events[i].ComputeHash()
+			prev = events[i].Hash
+		}
+		return events
+	}
+	checkpoint := func(keys *jwt.IDTokenSigner, sequence int64, hash string) model.AuditCheckpoint {
+		c := model.AuditCheckpoint{
+			ID: uuid.New(), Stream: "node-1", Sequence: sequence, Hash: hash,
+			CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+		}
+		keyID, signature, err := keys.SignData(auditCheckpointPurpose, c.SignedData())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.KeyID, c.Signature = keyID, signature
+		return c
+	}
+
+	tests := []struct {
+		name string
+		// Портим цепочку и возвращаем события и контрольные точки для записи
+		tamper   func(events []model.AuditEvent) ([]model.AuditEvent, []model.AuditCheckpoint)
+		sequence int64
+		reason   string
+	}{
+		{
+			name: "valid",
+			tamper: func(events []model.AuditEvent) ([]model.AuditEvent, []model.AuditCheckpoint) {
+				return events, []model.AuditCheckpoint{checkpoint(current, 3, events[2].Hash)}
+			},
+		},
+		{
+			name: "signed with the previous key",
+			tamper: func(events []model.AuditEvent) ([]model.AuditEvent, []model.AuditCheckpoint) {
+				return events, []model.AuditCheckpoint{checkpoint(previous, 2, events[1].Hash)}
+			},
+		},
+		{
+			name: "sequence gap",
+			tamper: func(events []model.AuditEvent) ([]model.AuditEvent, []model.AuditCheckpoint) {
+				return []model.AuditEvent{events[0], events[2]}, nil
+			},
+			sequence: 2,
+			reason:   "sequence gap",
+		},
+		{
+			name: "modified event",
+			tamper: func(events []model.AuditEvent) ([]model.AuditEvent, []model.AuditCheckpoint) {
+				events[1].Outcome = model.AuditFailure
+				return events, nil
+			},
+			sequence: 2,
+			reason:   "event hash does not match its content",
+		},
+		{
+			name: "checkpoint mismatch after rehashing",
+			tamper: func(events []model.AuditEvent) ([]model.AuditEvent, []model.AuditCheckpoint) {
+				signed := checkpoint(current, 3, events[2].Hash)
+				events[1].Outcome = model.AuditFailure
+				events[1].Hash = events[1].ComputeHash()
+				events[2].PrevHash = events[1].Hash
+				events[2].Hash = events[2].ComputeHash()
+				return events, []model.AuditCheckpoint{signed}
+			},
+			sequence: 3,
+			reason:   "event hash does not match checkpoint",
+		},
+		{
+			name: "altered checkpoint",
+			tamper: func(events []model.AuditEvent) ([]model.AuditEvent, []model.AuditCheckpoint) {
+				c := checkpoint(current, 2, events[1].Hash)
+				c.Hash = events[2].Hash
+				return events, []model.AuditCheckpoint{c}
+			},
+			sequence: 2,
+			reason:   "checkpoint signature is invalid",
+		},
+		{
+			name: "signed with an unknown key",
+			tamper: func(events []model.AuditEvent) ([]model.AuditEvent, []model.AuditCheckpoint) {
+				return events, []model.AuditCheckpoint{checkpoint(unknown, 2, events[1].Hash)}
+			},
+			sequence: 2,
+			reason:   "checkpoint signature is invalid",
+		},
+		{
+			name: "truncated tail",
+			tamper: func(events []model.AuditEvent) ([]model.AuditEvent, []model.AuditCheckpoint) {
+				return events[:2], []model.AuditCheckpoint{checkpoint(current, 3, events[2].Hash)}
+			},
+			sequence: 3,
+			reason:   "chain is truncated",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := repository.NewMemoryRepository()
+			events, checkpoints := tt.tamper(chain())
+			for _, e := range events {
+				if err := repo.Audit.Create(ctx, e); err != nil {
+					t.Fatalf("Create: %v", err)
+				}
+			}
+			for _, c := range checkpoints {
+				if err := repo.Audit.CreateCheckpoint(ctx, c); err != nil {
+					t.Fatalf("CreateCheckpoint: %v", err)
+				}
+			}
+
+			v, err := NewAuditService(repo.Audit, current, log, "node-1", time.Hour).verifyStream(ctx, "node-1")
+			if err != nil {
+				t.Fatalf("verifyStream: %v", err)
+			}
+			if tt.reason == "" {
+				if !v.Valid || v.Broken != nil || v.Events != len(events) {
+					t.Fatalf("verifyStream = %+v, want a valid chain of %d events", v, len(events))
+				}
+				return
+			}
+			if v.Valid || v.Broken == nil || v.Broken.Sequence != tt.sequence || !strings.Contains(v.Broken.Reason, tt.reason) {
+				t.Fatalf("verifyStream = %+v, broken %+v, want a break at %d: %s", v, v.Broken, tt.sequence, tt.reason)
+			}
+		})
+	}
+}
@@ -4,13 +4,28 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/mail"
 	"github.com/v7ktory/test/internal/model"
 	"github.com/v7ktory/test/internal/repository"
 	"github.com/v7ktory/test/pkg/hash"
 	"github.com/v7ktory/test/pkg/jwt"
+	"github.com/v7ktory/test/pkg/mailer"
+)
+
+const (
+	// После maxFailedLogins неудачных входов подряд пользователь блокируется на lockoutDuration
+	maxFailedLogins = 5
+	lockoutDuration = 15 * time.Minute
+)
+
+var (
+	ErrUserDisabled          = errors.New("user is disabled")
+	ErrUserLocked            = errors.New("user is locked after failed logins")
+	ErrPasswordResetRequired = errors.New("password reset required")
 )
 
 type AuthService struct {
@@ -18,74 +33,117 @@ type AuthService struct {
 	hash            hash.Hasher
 	jwt             jwt.JWT
 	log             *slog.Logger
+	revocations     *RevocationService
+	audit           *AuditService
+	outbox          *OutboxService
+	mail            *MailService
+	devices         *KnownDeviceService
+	risk            *RiskService
 	accessTokenTTL  time.Duration
 	refreshTokenTTL time.Duration
+	policy          TokenPolicy
 }
 
-func NewAuthService(repo repository.Repository, hash hash.Hasher, jwt jwt.JWT, log *slog.Logger, accessTokenTTL, refreshTokenTTL time.Duration) *AuthService {
+func NewAuthService(repo repository.Repository, hash hash.Hasher, jwt jwt.JWT, log *slog.Logger, revocations *RevocationService, audit *AuditService, outbox *OutboxService, mail *MailService, devices *KnownDeviceService, risk *RiskService, accessTokenTTL, refreshTokenTTL time.Duration, policy TokenPolicy) *AuthService {
 	return &AuthService{
 		repo:            repo,
 		hash:            hash,
 		jwt:             jwt,
 		log:             log,
+		revocations:     revocations,
+		audit:           audit,
+		outbox:          outbox,
+		mail:            mail,
+		devices:         devices,
+		risk:            risk,
 		accessTokenTTL:  accessTokenTTL,
 		refreshTokenTTL: refreshTokenTTL,
+		policy:          policy,
 	}
 }
 
 /*
 Здесь хэшируем переданный пароль и записываем его в базу данных
-Так же создаем сессию и привязываем её к юзеру
+Так же создаем сессию и привязываем её к юзеру.
+Пользователь, сессия и событие в outbox создаются в одной транзакции
 */
-func (s *AuthService) SignUp(ctx context.Context, user *model.User) (uuid.UUID, error) {
-	hashedPassword, err := s.hash.Hash(user.Password)
+func (s *AuthService) SignUp(ctx context.Context, user *model.User) (userID uuid.UUID, err error) {
+	event := model.AuditEvent{Action: model.AuditSignUp, Details: map[string]string{"email": user.Email}}
+	defer s.audit.Record(ctx, &event, &err)
+
+	err = s.repo.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		userID, err = createUser(ctx, s.repo, s.hash, s.log, user.Email, user.Password)
+		if err != nil {
+			return err
+		}
+		return s.outbox.Enqueue(ctx, model.EventUserSignUp, userID.String(), userEventData(userID, user.Email))
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	event.Subject = userSubject(userID)
+	s.log.Info("user created successfully")
+
+	return userID, nil
+}
+
+// Создаём пользователя с хэшем пароля и его first-party сессию, вызывается внутри транзакции
+func createUser(ctx context.Context, repo repository.Repository, hash hash.Hasher, log *slog.Logger, email, password string) (uuid.UUID, error) {
+	hashedPassword, err := hash.Hash(password)
 	if err != nil {
-		s.log.Error("failed to hash password:", err)
+		log.Error("failed to hash password", "error", err)
 		return uuid.Nil, err
 	}
 
 	u := model.User{
 		UUID:     uuid.New(),
-		Email:    user.Email,
+		Email:    email,
 		Password: hashedPassword,
 	}
-
-	userID, err := s.repo.Auth.Create(ctx, &u)
-	if err != nil {
-		s.log.Error("failed to create user:", err)
+	if _, err := repo.Auth.Create(ctx, &u); err != nil {
+		log.Error("failed to create user", "error", err)
 		return uuid.Nil, err
 	}
+
 	session := model.Session{
 		ID: uuid.New(),
 		RefreshToken: model.RefreshToken{
-			UserID: userID,
+			UserID: u.UUID,
 		},
 	}
-
-	err = s.repo.Session.Create(ctx, session)
-	if err != nil {
-		s.log.Error("failed to create session:", err)
+	if err := repo.Session.Create(ctx, session); err != nil {
+		log.Error("failed to create session", "error", err)
 		return uuid.Nil, err
 	}
-	s.log.Info("user created successfully")
-
-	return userID, nil
+	return u.UUID, nil
 }
 
 /*
 Валидируем данные и если всё ок генерируем токены и хешируем refresh
-Так же обновляем сессию
+Так же обновляем сессию. В токен попадают только разрешённые пользователям
+scope и audience из запрошенных. Рискованный вход требует кода из письма
+(StepUpRequiredError) или отклоняется
 */
-func (s *AuthService) Login(ctx context.Context, userID uuid.UUID, email, password string) (*model.AccessToken, *model.RefreshToken, error) {
-	user, err := s.repo.GetByEmail(ctx, email)
+func (s *AuthService) Login(ctx context.Context, userID uuid.UUID, email, password string, req model.ScopeRequest) (*model.AccessToken, *model.RefreshToken, error) {
+	// До проверки пароля неизвестно, кто входит, поэтому неудачный вход анонимный
+	event := model.AuditEvent{Action: model.AuditLogin, Subject: userSubject(userID), Details: map[string]string{"email": email}}
+	access, refresh, err := s.login(ctx, &event, userID, email, password, req)
+	if err == nil {
+		event.Actor = userActor(userID)
+	}
+	s.audit.Record(ctx, &event, &err)
+	return access, refresh, err
+}
+
+func (s *AuthService) login(ctx context.Context, event *model.AuditEvent, userID uuid.UUID, email, password string, req model.ScopeRequest) (*model.AccessToken, *model.RefreshToken, error) {
+	user, failedLogins, err := s.checkCredentials(ctx, email, password)
 	if err != nil {
-		s.log.Error("failed to get user by credentials:", err)
 		return nil, nil, err
 	}
-
-	if !s.hash.CompareHash(password, user.Password) {
-		s.log.Error("invalid credentials")
-		return nil, nil, errors.New("invalid password")
+	if user.PasswordResetRequired {
+		s.log.Error("password reset required", "user_id", user.UUID)
+		return nil, nil, ErrPasswordResetRequired
 	}
 
 	if user.UUID != userID {
@@ -93,37 +151,83 @@ func (s *AuthService) Login(ctx context.Context, userID uuid.UUID, email, passwo
 		return nil, nil, errors.New("user not found")
 	}
 
-	access, refresh, err := s.jwt.GenerateTokenPair(userID, s.accessTokenTTL, s.refreshTokenTTL)
+	session, err := s.repo.Session.GetByUserID(ctx, userID)
 	if err != nil {
-		s.log.Error("failed to generate token pair:", err)
+		s.log.Error("failed to get session", "error", err)
 		return nil, nil, err
 	}
 
-	hashedRefresh, err := s.hash.Hash(refresh.Token)
+	device := s.devices.Identify(ctx)
+	risk, err := s.risk.AssessLogin(ctx, user, failedLogins, device)
 	if err != nil {
-		s.log.Error("failed to hash refresh token:", err)
+		s.log.Error("failed to assess login risk", "user_id", userID, "error", err)
 		return nil, nil, err
 	}
+	addRiskDetails(event, risk)
 
-	session, err := s.repo.Session.GetByUserID(ctx, userID)
+	switch risk.Decision {
+	case model.RiskDeny:
+		s.log.Warn("login denied by risk", "user_id", userID, "score", risk.Score, "signals", risk.Signals)
+		return nil, nil, ErrRiskDenied
+	case model.RiskStepUp:
+		s.log.Info("login requires step-up", "user_id", userID, "score", risk.Score, "signals", risk.Signals)
+		return nil, nil, s.startStepUp(ctx, user, session, device, *risk, req)
+	}
+
+	risk.ACR = model.ACRPassword
+	return s.completeLogin(ctx, user, session, device, risk, req)
+}
+
+/*
+Выпускаем токены входа и сохраняем сессию с устройством и оценкой риска.
+Событие о входе и письмо о новом устройстве пишутся вместе с сессией,
+иначе их можно потерять или отправить зря
+*/
+func (s *AuthService) completeLogin(ctx context.Context, user *model.User, session *model.Session, device model.Device, risk *model.Risk, req model.ScopeRequest) (*model.AccessToken, *model.RefreshToken, error) {
+	roles, err := s.tokenRoles(ctx, user.UUID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scope, audience := s.policy.grant(req)
+	subject := jwt.Subject{UserID: user.UUID, SessionID: session.ID, Scope: scope, Audience: audience, Roles: roles, AuthTime: time.Now(), ACR: risk.ACR}
+	access, refresh, err := s.jwt.GenerateTokenPair(subject, s.accessTokenTTL, s.refreshTokenTTL)
+	if err != nil {
+		s.log.Error("failed to generate token pair", "error", err)
+		return nil, nil, err
+	}
+
+	hashedRefresh, err := s.hash.Hash(refresh.Token)
 	if err != nil {
-		s.log.Error("failed to get session:", err)
+		s.log.Error("failed to hash refresh token", "error", err)
 		return nil, nil, err
 	}
+
 	ss := model.Session{
 		ID: session.ID,
 		RefreshToken: model.RefreshToken{
 			ID:            refresh.ID,
-			UserID:        userID,
+			UserID:        user.UUID,
 			AccessTokenID: access.ID,
 			Token:         hashedRefresh,
 			ExpiresAt:     time.Now().Add(s.refreshTokenTTL),
 		},
+		Device: &device,
+		Risk:   risk,
 	}
 
-	err = s.repo.Session.Update(ctx, ss)
+	err = s.repo.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Session.Update(ctx, ss); err != nil {
+			s.log.Error("failed to set session", "error", err)
+			return err
+		}
+		if err := s.devices.Seen(ctx, user, session.ID, device); err != nil {
+			s.log.Error("failed to record login device", "user_id", user.UUID, "error", err)
+			return err
+		}
+		return s.outbox.Enqueue(ctx, model.EventUserLogin, user.UUID.String(), userEventData(user.UUID, user.Email))
+	})
 	if err != nil {
-		s.log.Error("failed to set session:", err)
 		return nil, nil, err
 	}
 
@@ -133,12 +237,22 @@ func (s *AuthService) Login(ctx context.Context, userID uuid.UUID, email, passwo
 
 /*
 Проверяем переданные токены и если все ок генерируем новые
-и обновляем сессию
+и обновляем сессию. Без запрошенных scope и audience переносим их из старого токена
 */
-func (s *AuthService) Refresh(ctx context.Context, userID uuid.UUID, accessTokenBearer, refreshTokenCookie string) (*model.AccessToken, *model.RefreshToken, error) {
+func (s *AuthService) Refresh(ctx context.Context, userID uuid.UUID, accessTokenBearer, refreshTokenCookie string, req model.ScopeRequest) (*model.AccessToken, *model.RefreshToken, error) {
+	event := model.AuditEvent{Action: model.AuditRefresh, Subject: userSubject(userID)}
+	access, refresh, err := s.refresh(ctx, &event, userID, accessTokenBearer, refreshTokenCookie, req)
+	if err == nil {
+		event.Actor = userActor(userID)
+	}
+	s.audit.Record(ctx, &event, &err)
+	return access, refresh, err
+}
+
+func (s *AuthService) refresh(ctx context.Context, event *model.AuditEvent, userID uuid.UUID, accessTokenBearer, refreshTokenCookie string, req model.ScopeRequest) (*model.AccessToken, *model.RefreshToken, error) {
 	session, err := s.repo.Session.GetByUserID(ctx, userID)
 	if err != nil {
-		s.log.Error("failed to get session:", err)
+		s.log.Error("failed to get session", "error", err)
 		return nil, nil, err
 	}
 
@@ -147,26 +261,59 @@ func (s *AuthService) Refresh(ctx context.Context, userID uuid.UUID, accessToken
 		return nil, nil, errors.New("failed to compare hash")
 	}
 
-	id, err := s.jwt.ValidateToken(accessTokenBearer)
+	claims, err := s.ValidateAccessToken(ctx, accessTokenBearer)
 	if err != nil {
-		s.log.Error("failed to validate token:", err)
 		return nil, nil, err
 	}
 
-	if userID != *id {
+	if userID != claims.UserID {
 		s.log.Error("user not found")
 		return nil, nil, errors.New("user not found")
 	}
 
-	access, refresh, err := s.jwt.GenerateTokenPair(userID, s.accessTokenTTL, s.refreshTokenTTL)
+	// Уровень проверки входа не меняется, оценка риска сохраняется в сессии
+	risk, err := s.risk.AssessRefresh(ctx, session, s.devices.Identify(ctx))
 	if err != nil {
-		s.log.Error("failed to generate token pair:", err)
+		s.log.Error("failed to assess refresh risk", "user_id", userID, "error", err)
+		return nil, nil, err
+	}
+	addRiskDetails(event, risk)
+	switch risk.Decision {
+	case model.RiskDeny:
+		s.log.Warn("refresh denied by risk", "user_id", userID, "score", risk.Score, "signals", risk.Signals)
+		return nil, nil, ErrRiskDenied
+	case model.RiskStepUp:
+		s.log.Info("refresh requires new login", "user_id", userID, "score", risk.Score, "signals", risk.Signals)
+		return nil, nil, ErrReauthenticationRequired
+	}
+	risk.ACR = claims.ACR
+
+	if req.Scope == "" {
+		req.Scope = claims.Scope
+	}
+	if len(req.Audience) == 0 {
+		req.Audience = claims.Audience
+	}
+	// Роли перечитываем, чтобы обновлённый токен отражал текущие назначения
+	roles, err := s.tokenRoles(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Обновлённый токен не шире прежнего: запрос может только сузить scope и audience (RFC 6749, раздел 6)
+	scope, audience := s.policy.grant(req)
+	scope = strings.Join(intersectScopes(strings.Fields(scope), strings.Fields(claims.Scope)), " ")
+	audience = s.policy.audience(intersectScopes(audience, claims.Audience))
+	subject := jwt.Subject{UserID: userID, SessionID: session.ID, Scope: scope, Audience: audience, Roles: roles, AuthTime: claims.AuthTime, ACR: claims.ACR}
+	access, refresh, err := s.jwt.GenerateTokenPair(subject, s.accessTokenTTL, s.refreshTokenTTL)
+	if err != nil {
+		s.log.Error("failed to generate token pair", "error", err)
 		return nil, nil, err
 	}
 
 	hashedRefresh, err := s.hash.Hash(refresh.Token)
 	if err != nil {
-		s.log.Error("failed to hash new refresh token:", err)
+		s.log.Error("failed to hash new refresh token", "error", err)
 		return nil, nil, err
 	}
 
@@ -179,14 +326,225 @@ func (s *AuthService) Refresh(ctx context.Context, userID uuid.UUID, accessToken
 			Token:         hashedRefresh,
 			ExpiresAt:     time.Now().Add(s.refreshTokenTTL),
 		},
+		Device: session.Device,
+		Risk:   risk,
 	}
 
 	err = s.repo.Session.Update(ctx, newSession)
 	if err != nil {
-		s.log.Error("failed to update session:", err)
+		s.log.Error("failed to update session", "error", err)
 		return nil, nil, err
 	}
 
 	s.log.Info("token refreshed successfully")
 	return access, refresh, nil
 }
+
+/*
+Меняем пароль по текущему, так же снимается требование сменить пароль.
+Пароль, стёртый после сообщения о чужом входе, так не сменить, только по ссылке из письма
+*/
+func (s *AuthService) ChangePassword(ctx context.Context, email, password, newPassword string) (err error) {
+	event := model.AuditEvent{Action: model.AuditPasswordChange, Details: map[string]string{"email": email}}
+	defer s.audit.Record(ctx, &event, &err)
+
+	if newPassword == "" {
+		return model.ErrPasswordEmpty
+	}
+
+	user, _, err := s.checkCredentials(ctx, email, password)
+	if err != nil {
+		return err
+	}
+	event.Actor = userActor(user.UUID)
+	event.Subject = userSubject(user.UUID)
+
+	if err := s.setPassword(ctx, user, newPassword); err != nil {
+		return err
+	}
+
+	s.log.Info("password changed", "user_id", user.UUID)
+	return nil
+}
+
+/*
+Сохраняем новый пароль и снимаем требование его сменить. Все сессии пользователя
+завершаются, пользователю уходит уведомление на почту
+*/
+func (s *AuthService) setPassword(ctx context.Context, user *model.User, newPassword string) error {
+	hashedPassword, err := s.hash.Hash(newPassword)
+	if err != nil {
+		s.log.Error("failed to hash password", "error", err)
+		return err
+	}
+	user.Password = hashedPassword
+	user.PasswordResetRequired = false
+	err = s.repo.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Auth.Update(ctx, *user); err != nil {
+			s.log.Error("failed to update user", "error", err)
+			return err
+		}
+		if err := s.outbox.Enqueue(ctx, model.EventUserPasswordChange, user.UUID.String(), userEventData(user.UUID, user.Email)); err != nil {
+			return err
+		}
+		err := s.mail.Send(ctx, user.Email, mail.TemplatePasswordChanged, "", map[string]string{
+			"Email": user.Email,
+			"Time":  mailTime(time.Now()),
+		})
+		// Уведомление на адрес, куда письмо не отправить, не должно мешать смене пароля
+		if errors.Is(err, mailer.ErrInvalidAddress) {
+			s.log.Warn("password change notification skipped", "user_id", user.UUID, "error", err)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := endUserSessions(ctx, s.repo, s.revocations, user.UUID); err != nil {
+		s.log.Error("failed to end user sessions", "user_id", user.UUID, "error", err)
+		return err
+	}
+	return nil
+}
+
+/*
+Проверяем email и пароль. Заблокированному пользователю пароль не проверяем,
+неудачная попытка увеличивает счётчик, удачная его сбрасывает.
+Возвращаем и число неудачных попыток перед удачной, оно учитывается в оценке риска
+*/
+func (s *AuthService) checkCredentials(ctx context.Context, email, password string) (*model.User, int, error) {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if err != nil {
+		s.log.Error("failed to get user by credentials", "error", err)
+		return nil, 0, err
+	}
+
+	if user.IsLocked(time.Now()) {
+		s.log.Error("user is locked", "user_id", user.UUID)
+		return nil, 0, ErrUserLocked
+	}
+	// Пароль известен тому, кто вошёл вместо пользователя: ни вход, ни смена пароля им не проходят
+	if user.PasswordRevoked() {
+		s.log.Error("password revoked after a reported sign-in", "user_id", user.UUID)
+		return nil, 0, ErrPasswordResetRequired
+	}
+
+	if !s.hash.CompareHash(password, user.Password) {
+		s.log.Error("invalid credentials")
+		s.countFailedLogin(ctx, user)
+		return nil, 0, errors.New("invalid password")
+	}
+
+	if user.Disabled {
+		s.log.Error("user is disabled", "user_id", user.UUID)
+		return nil, 0, ErrUserDisabled
+	}
+
+	failedLogins := user.FailedLogins
+	if err := s.resetFailedLogins(ctx, user); err != nil {
+		return nil, 0, err
+	}
+	return user, failedLogins, nil
+}
+
+// Неудачная попытка входа, после maxFailedLogins подряд пользователь блокируется
+func (s *AuthService) countFailedLogin(ctx context.Context, user *model.User) {
+	user.FailedLogins++
+	if user.FailedLogins >= maxFailedLogins {
+		user.FailedLogins = 0
+		user.LockedUntil = time.Now().Add(lockoutDuration)
+		s.log.Warn("user locked after failed logins", "user_id", user.UUID)
+	}
+	if err := s.repo.Auth.Update(ctx, *user); err != nil {
+		s.log.Error("failed to count failed login", "error", err)
+	}
+}
+
+func (s *AuthService) resetFailedLogins(ctx context.Context, user *model.User) error {
+	if user.FailedLogins == 0 && user.LockedUntil.IsZero() {
+		return nil
+	}
+	user.FailedLogins = 0
+	user.LockedUntil = time.Time{}
+	if err := s.repo.Auth.Update(ctx, *user); err != nil {
+		s.log.Error("failed to reset failed logins", "error", err)
+		return err
+	}
+	return nil
+}
+
+// Проверяем подпись и срок access токена, что он не отозван и выпущен для этого сервиса
+func (s *AuthService) ValidateAccessToken(ctx context.Context, accessToken string) (*jwt.Claims, error) {
+	claims, err := s.jwt.ParseToken(accessToken)
+	if err != nil {
+		s.log.Error("failed to validate token", "error", err)
+		return nil, err
+	}
+
+	if s.revocations.IsRevoked(claims) {
+		s.log.Error("token revoked", "user_id", claims.UserID, "jti", claims.TokenID)
+		return nil, ErrTokenRevoked
+	}
+	if !s.policy.accepts(claims.Audience) {
+		s.log.Error("token issued for another audience", "audience", claims.Audience)
+		return nil, ErrInvalidAudience
+	}
+	return claims, nil
+}
+
+/*
+Отзываем текущий access токен и все токены его сессии,
+refresh токен сессии сбрасываем, чтобы его нельзя было обменять.
+Токен OAuth клиента завершает только сессию этого клиента
+*/
+func (s *AuthService) Logout(ctx context.Context, claims *jwt.Claims) (err error) {
+	event := model.AuditEvent{Action: model.AuditLogout, Actor: TokenActor(claims), Subject: tokenSubject(claims)}
+	defer s.audit.Record(ctx, &event, &err)
+
+	if err := s.revocations.RevokeToken(ctx, claims); err != nil {
+		s.log.Error("failed to revoke token", "error", err)
+		return err
+	}
+
+	// У сервисного токена нет сессии, а выход по обменянному токену
+	// не должен завершать сессию пользователя: отзываем только сам токен
+	if claims.IsServiceToken() || claims.Actor != nil {
+		s.log.Info("service token revoked", "client_id", claims.ClientID)
+		return nil
+	}
+
+	session, err := s.repo.Session.GetByID(ctx, claims.SessionID)
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		s.log.Info("token revoked, session already ended", "session_id", claims.SessionID)
+		return nil
+	}
+	if err != nil {
+		s.log.Error("failed to get session", "error", err)
+		return err
+	}
+	if session.RefreshToken.UserID != claims.UserID || session.ClientID != claims.ClientID {
+		s.log.Error("token does not belong to its session", "session_id", session.ID)
+		return ErrInvalidToken
+	}
+
+	if err := s.revocations.RevokeSession(ctx, session.ID); err != nil {
+		s.log.Error("failed to revoke session", "error", err)
+		return err
+	}
+
+	err = s.repo.Session.Update(ctx, model.Session{
+		ID: session.ID,
+		RefreshToken: model.RefreshToken{
+			UserID: claims.UserID,
+		},
+	})
+	if err != nil {
+		s.log.Error("failed to reset session", "error", err)
+		return err
+	}
+
+	s.log.Info("user logged out successfully")
+	return nil
+}
@@ -0,0 +1,499 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/hash"
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+const (
+	authorizationCodeTTL = 10 * time.Minute
+
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+
+	ConsentAllow = "allow"
+	ConsentDeny  = "deny"
+
+	pkceMethodS256 = "S256"
+)
+
+// Итог обработки запроса авторизации
+type AuthorizationResult struct {
+	// Куда перенаправить пользователя: с кодом или с ошибкой
+	RedirectURI string
+	// Пользователь ещё не дал согласие на запрошенные scope
+	ConsentRequired bool
+	Client          *model.Client
+	Scopes          []string
+}
+
+/*
+Обрабатываем запрос к /oauth/authorize от уже вошедшего пользователя.
+Ошибки клиента и redirect_uri возвращаются как error: перенаправлять на
+непроверенный адрес нельзя. Остальные ошибки уходят клиенту через redirect.
+decision пустой при первом запросе, allow или deny после экрана согласия
+*/
+func (s *OAuthService) Authorize(ctx context.Context, claims *jwt.Claims, req model.AuthorizationRequest, decision string) (*AuthorizationResult, error) {
+	userID := claims.UserID
+	client, err := s.repo.Client.GetByID(ctx, req.ClientID)
+	if errors.Is(err, repository.ErrClientNotFound) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		s.log.Error("failed to get client", "error", err)
+		return nil, err
+	}
+
+	redirectURI, ok := matchRedirectURI(client, req.RedirectURI)
+	if !ok {
+		return nil, invalidRequest("redirect_uri is not registered for the client")
+	}
+
+	// Согласие и код покрывают только scope, которые пользователь может доверить клиенту
+	result := &AuthorizationResult{Client: client, Scopes: strings.Fields(s.policy.delegate(req.Scope))}
+
+	switch {
+	case req.ResponseType != "code":
+		result.RedirectURI = redirectWithError(redirectURI, req.State, "unsupported_response_type", "")
+		return result, nil
+	case req.CodeChallenge == "" || req.CodeChallengeMethod != pkceMethodS256:
+		result.RedirectURI = redirectWithError(redirectURI, req.State, "invalid_request", "PKCE with S256 is required")
+		return result, nil
+	}
+
+	switch decision {
+	case ConsentDeny:
+		s.log.Info("consent denied", "user_id", userID, "client_id", client.ID)
+		result.RedirectURI = redirectWithError(redirectURI, req.State, "access_denied", "")
+		return result, nil
+	case ConsentAllow:
+		if err := s.grantConsent(ctx, userID, client.ID, result.Scopes); err != nil {
+			return nil, err
+		}
+	default:
+		granted, err := s.hasConsent(ctx, userID, client.ID, result.Scopes)
+		if err != nil {
+			return nil, err
+		}
+		if !granted {
+			result.ConsentRequired = true
+			return result, nil
+		}
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		s.log.Error("failed to generate authorization code", "error", err)
+		return nil, err
+	}
+
+	err = s.repo.AuthorizationCode.Create(ctx, model.AuthorizationCode{
+		CodeHash:            hash.HashSecret(code),
+		ClientID:            client.ID,
+		UserID:              userID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               strings.Join(result.Scopes, " "),
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		AuthTime:            authTime(claims),
+		ExpiresAt:           time.Now().Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		s.log.Error("failed to save authorization code", "error", err)
+		return nil, err
+	}
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	result.RedirectURI = appendQuery(redirectURI, params)
+
+	s.log.Info("authorization code issued", "user_id", userID, "client_id", client.ID)
+	return result, nil
+}
+
+/*
+Выдаём токены на /oauth/token. Запрошенные audience проверяем до обработки grant,
+чтобы отказ не расходовал одноразовый код
+*/
+func (s *OAuthService) Token(ctx context.Context, req model.TokenRequest) (*model.TokenResponse, error) {
+	client, err := s.authenticateTokenClient(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, audience := range req.Audience {
+		if !slices.Contains(client.Audiences, audience) {
+			s.log.Error("audience is not allowed for the client", "client_id", client.ID, "audience", audience)
+			return nil, ErrInvalidTarget
+		}
+	}
+
+	switch req.GrantType {
+	case GrantAuthorizationCode:
+		return s.exchangeCode(ctx, client, req)
+	case GrantRefreshToken:
+		return s.refreshGrant(ctx, client, req)
+	case GrantClientCredentials:
+		return s.clientCredentials(client, req)
+	case GrantDeviceCode:
+		return s.deviceCodeGrant(ctx, client, req)
+	case GrantTokenExchange:
+		return s.tokenExchange(ctx, client, req)
+	default:
+		return nil, ErrUnsupportedGrantType
+	}
+}
+
+func (s *OAuthService) exchangeCode(ctx context.Context, client *model.Client, req model.TokenRequest) (*model.TokenResponse, error) {
+	if req.Code == "" || req.CodeVerifier == "" {
+		return nil, invalidRequest("code and code_verifier are required")
+	}
+
+	code, err := s.repo.AuthorizationCode.Consume(ctx, hash.HashSecret(req.Code))
+	if errors.Is(err, repository.ErrAuthorizationCodeNotFound) {
+		return nil, ErrInvalidGrant
+	}
+	if err != nil {
+		s.log.Error("failed to consume authorization code", "error", err)
+		return nil, err
+	}
+
+	switch {
+	case !code.ExpiresAt.After(time.Now()):
+		return nil, ErrInvalidGrant
+	case code.ClientID != client.ID:
+		s.log.Error("authorization code issued to another client", "client_id", client.ID)
+		return nil, ErrInvalidGrant
+	// redirect_uri из запроса авторизации обязателен и здесь (RFC 6749, раздел 4.1.3)
+	case code.RedirectURI != "" && req.RedirectURI != code.RedirectURI:
+		s.log.Error("redirect_uri does not match the authorization request", "client_id", client.ID)
+		return nil, ErrInvalidGrant
+	case !verifyPKCE(req.CodeVerifier, code.CodeChallenge):
+		s.log.Error("pkce verification failed", "client_id", client.ID)
+		return nil, ErrInvalidGrant
+	}
+
+	response, err := s.issueUserTokens(ctx, client, userGrant{
+		userID:   code.UserID,
+		scope:    code.Scope,
+		audience: req.Audience,
+		nonce:    code.Nonce,
+		authTime: code.AuthTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("authorization code exchanged", "user_id", code.UserID, "client_id", client.ID)
+	return response, nil
+}
+
+// На что пользователь дал согласие клиенту: по коду авторизации или с устройства
+type userGrant struct {
+	userID   uuid.UUID
+	scope    string
+	audience []string
+	nonce    string
+	authTime time.Time
+}
+
+/*
+Создаём для клиента отдельную сессию пользователя и выдаём токены.
+OIDC: refresh токен выдаём только по offline_access, без него сессия не нужна
+*/
+func (s *OAuthService) issueUserTokens(ctx context.Context, client *model.Client, grant userGrant) (*model.TokenResponse, error) {
+	// Код или устройство могли подтвердить до того, как пользователя отключили или удалили,
+	// или тот, кто вошёл вместо пользователя, до того, как пользователь сообщил о входе
+	user, err := s.repo.Auth.GetByID(ctx, grant.userID)
+	if errors.Is(err, repository.ErrUserNotFound) || (err == nil && (user.Disabled || user.PasswordResetRequired)) {
+		return nil, ErrInvalidGrant
+	}
+	if err != nil {
+		s.log.Error("failed to get user", "error", err)
+		return nil, err
+	}
+
+	session := model.Session{ID: uuid.New(), ClientID: client.ID, Scope: grant.scope, AuthTime: grant.authTime}
+	subject := jwt.Subject{
+		UserID:    grant.userID,
+		SessionID: session.ID,
+		ClientID:  client.ID,
+		Scope:     grant.scope,
+		AuthTime:  grant.authTime,
+		Audience:  s.policy.audience(grant.audience),
+	}
+
+	access, refresh, err := s.jwt.GenerateTokenPair(subject, s.accessTokenTTL, s.refreshTokenTTL)
+	if err != nil {
+		s.log.Error("failed to generate token pair", "error", err)
+		return nil, err
+	}
+
+	offline := !hasScope(grant.scope, ScopeOpenID) || hasScope(grant.scope, ScopeOfflineAccess)
+	if offline {
+		hashedRefresh, err := s.hash.Hash(refresh.Token)
+		if err != nil {
+			s.log.Error("failed to hash refresh token", "error", err)
+			return nil, err
+		}
+
+		session.RefreshToken = model.RefreshToken{
+			ID:            refresh.ID,
+			UserID:        grant.userID,
+			AccessTokenID: access.ID,
+			Token:         hashedRefresh,
+			ExpiresAt:     refresh.ExpiresAt,
+		}
+		if err := s.repo.Session.Create(ctx, session); err != nil {
+			s.log.Error("failed to create session", "error", err)
+			return nil, err
+		}
+	}
+
+	response := s.tokenResponse(access, refresh, grant.scope)
+	if !offline {
+		response.RefreshToken = ""
+	}
+	if hasScope(grant.scope, ScopeOpenID) {
+		if response.IDToken, err = s.issueIDToken(ctx, client.ID, grant, access.Token); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+func (s *OAuthService) refreshGrant(ctx context.Context, client *model.Client, req model.TokenRequest) (*model.TokenResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, invalidRequest("refresh_token is required")
+	}
+
+	session, err := s.sessionByRefreshToken(ctx, req.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.ClientID != client.ID {
+		return nil, ErrInvalidGrant
+	}
+
+	// Можно запросить токен с частью выданных scope, сама сессия их сохраняет (RFC 6749, раздел 6)
+	scope := session.Scope
+	if req.Scope != "" {
+		if !containsScopes(session.Scope, req.Scope) {
+			return nil, ErrInvalidScope
+		}
+		scope = req.Scope
+	}
+
+	userID := session.RefreshToken.UserID
+	subject := jwt.Subject{
+		UserID:    userID,
+		SessionID: session.ID,
+		ClientID:  client.ID,
+		Scope:     scope,
+		AuthTime:  session.AuthTime,
+		Audience:  s.policy.audience(req.Audience),
+	}
+
+	access, refresh, err := s.jwt.GenerateTokenPair(subject, s.accessTokenTTL, s.refreshTokenTTL)
+	if err != nil {
+		s.log.Error("failed to generate token pair", "error", err)
+		return nil, err
+	}
+
+	hashedRefresh, err := s.hash.Hash(refresh.Token)
+	if err != nil {
+		s.log.Error("failed to hash refresh token", "error", err)
+		return nil, err
+	}
+
+	err = s.repo.Session.Update(ctx, model.Session{
+		ID:       session.ID,
+		ClientID: client.ID,
+		Scope:    session.Scope,
+		RefreshToken: model.RefreshToken{
+			ID:            refresh.ID,
+			UserID:        userID,
+			AccessTokenID: access.ID,
+			Token:         hashedRefresh,
+			ExpiresAt:     refresh.ExpiresAt,
+		},
+	})
+	if err != nil {
+		s.log.Error("failed to update session", "error", err)
+		return nil, err
+	}
+
+	s.log.Info("oauth token refreshed", "user_id", userID, "client_id", client.ID)
+	return s.tokenResponse(access, refresh, scope), nil
+}
+
+/*
+Публичные клиенты передают только client_id, конфиденциальные обязаны передать
+секрет или подписанный своим ключом client_assertion (private_key_jwt)
+*/
+func (s *OAuthService) authenticateTokenClient(ctx context.Context, req model.TokenRequest) (*model.Client, error) {
+	if req.ClientAssertion != "" {
+		return s.authenticateClientAssertion(ctx, req)
+	}
+
+	clientID, clientSecret := req.ClientID, req.ClientSecret
+	if clientID == "" {
+		return nil, ErrInvalidClient
+	}
+
+	client, err := s.repo.Client.GetByID(ctx, clientID)
+	if errors.Is(err, repository.ErrClientNotFound) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		s.log.Error("failed to get client", "error", err)
+		return nil, err
+	}
+
+	if client.Public {
+		return client, nil
+	}
+	if !hash.CompareSecret(clientSecret, client.SecretHash) {
+		s.log.Error("invalid client secret", "client_id", clientID)
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+func (s *OAuthService) hasConsent(ctx context.Context, userID uuid.UUID, clientID string, scopes []string) (bool, error) {
+	consent, err := s.repo.Consent.Get(ctx, userID, clientID)
+	if errors.Is(err, repository.ErrConsentNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		s.log.Error("failed to get consent", "error", err)
+		return false, err
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(consent.Scopes, scope) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Добавляем scope к уже выданному согласию
+func (s *OAuthService) grantConsent(ctx context.Context, userID uuid.UUID, clientID string, scopes []string) error {
+	granted := scopes
+	consent, err := s.repo.Consent.Get(ctx, userID, clientID)
+	switch {
+	case err == nil:
+		granted = slices.Clone(consent.Scopes)
+		for _, scope := range scopes {
+			if !slices.Contains(granted, scope) {
+				granted = append(granted, scope)
+			}
+		}
+	case !errors.Is(err, repository.ErrConsentNotFound):
+		s.log.Error("failed to get consent", "error", err)
+		return err
+	}
+
+	err = s.repo.Consent.Save(ctx, model.Consent{
+		UserID:    userID,
+		ClientID:  clientID,
+		Scopes:    granted,
+		GrantedAt: time.Now(),
+	})
+	if err != nil {
+		s.log.Error("failed to save consent", "error", err)
+		return err
+	}
+
+	s.log.Info("consent granted", "user_id", userID, "client_id", clientID)
+	return nil
+}
+
+func (s *OAuthService) tokenResponse(access *model.AccessToken, refresh *model.RefreshToken, scope string) *model.TokenResponse {
+	return &model.TokenResponse{
+		AccessToken:  access.Token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.accessTokenTTL.Seconds()),
+		RefreshToken: refresh.Token,
+		Scope:        scope,
+	}
+}
+
+// Токены, выпущенные до появления auth_time, его не содержат
+func authTime(claims *jwt.Claims) time.Time {
+	if claims.AuthTime.IsZero() {
+		return claims.IssuedAt
+	}
+	return claims.AuthTime
+}
+
+/*
+redirect_uri должен в точности совпадать с зарегистрированным.
+Если у клиента он один, параметр можно не передавать
+*/
+func matchRedirectURI(client *model.Client, requested string) (string, bool) {
+	if requested == "" {
+		if len(client.RedirectURIs) == 1 {
+			return client.RedirectURIs[0], true
+		}
+		return "", false
+	}
+	return requested, slices.Contains(client.RedirectURIs, requested)
+}
+
+func verifyPKCE(verifier, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:]) == challenge
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func redirectWithError(redirectURI, state, code, description string) string {
+	params := url.Values{"error": {code}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+	return appendQuery(redirectURI, params)
+}
+
+// Добавляем параметры к redirect_uri, сохраняя уже имеющиеся в нём
+func appendQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/jwt"
+	"github.com/v7ktory/test/pkg/policy"
+)
+
+// Scope, с которым сервисы могут запрашивать решения авторизации
+const ScopeAuthzCheck = "authz:check"
+
+var (
+	ErrInvalidAuthzRequest = errors.New("invalid authorization request")
+	ErrInvalidSubjectToken = errors.New("invalid subject token")
+)
+
+type Authz interface {
+	CheckAccess(ctx context.Context, caller *jwt.Claims, req model.AuthzCheckRequest) (*model.AuthzDecision, error)
+}
+
+// Решения авторизации по политике, каждое решение пишется в журнал
+type AuthzService struct {
+	repo        repository.Repository
+	jwt         jwt.JWT
+	log         *slog.Logger
+	revocations *RevocationService
+	policy      *policy.Policy
+}
+
+func NewAuthzService(repo repository.Repository, jwt jwt.JWT, log *slog.Logger, revocations *RevocationService, policy *policy.Policy) *AuthzService {
+	return &AuthzService{
+		repo:        repo,
+		jwt:         jwt,
+		log:         log,
+		revocations: revocations,
+		policy:      policy,
+	}
+}
+
+/*
+Вычисляем решение для вызывающего сервиса. Атрибуты субъекта из subject_token
+(id, client_id, scope, roles и разрешения этих ролей) переопределяют переданные вызывающим
+*/
+func (s *AuthzService) CheckAccess(ctx context.Context, caller *jwt.Claims, req model.AuthzCheckRequest) (*model.AuthzDecision, error) {
+	if req.Action == "" {
+		return nil, ErrInvalidAuthzRequest
+	}
+
+	subject := policy.Attributes{}
+	maps.Copy(subject, req.Subject)
+	if req.SubjectToken != "" {
+		trusted, err := s.subjectAttributes(ctx, req.SubjectToken)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(subject, trusted)
+	}
+
+	decision := s.policy.Evaluate(policy.Request{
+		Subject:  subject,
+		Action:   req.Action,
+		Resource: req.Resource,
+		Context:  req.Context,
+	})
+
+	result := &model.AuthzDecision{
+		DecisionID: uuid.NewString(),
+		Allowed:    decision.Allowed,
+		Rule:       decision.Rule,
+	}
+	s.log.Info("authorization decision",
+		"decision_id", result.DecisionID,
+		"caller", callerID(caller),
+		"subject", subject["id"],
+		"action", req.Action,
+		"resource_type", req.Resource["type"],
+		"resource_id", req.Resource["id"],
+		"allowed", result.Allowed,
+		"rule", result.Rule,
+	)
+	return result, nil
+}
+
+// Атрибуты субъекта из проверенного токена
+func (s *AuthzService) subjectAttributes(ctx context.Context, token string) (policy.Attributes, error) {
+	claims, err := s.jwt.ParseToken(token)
+	if err != nil || s.revocations.IsRevoked(claims) {
+		return nil, ErrInvalidSubjectToken
+	}
+
+	attrs := policy.Attributes{
+		"id":        claims.UserID.String(),
+		"client_id": claims.ClientID,
+		"scope":     strings.Fields(claims.Scope),
+		"roles":     claims.Roles,
+		"service":   claims.IsServiceToken(),
+	}
+	if claims.IsServiceToken() {
+		attrs["id"] = claims.ClientID
+	}
+
+	roles, err := s.repo.Role.GetByNames(ctx, claims.Roles)
+	if err != nil {
+		s.log.Error("failed to get roles", "error", err)
+		return nil, err
+	}
+	permissions := []string{}
+	for _, role := range roles {
+		permissions = append(permissions, role.Permissions...)
+	}
+	attrs["permissions"] = permissions
+	return attrs, nil
+}
+
+func callerID(claims *jwt.Claims) string {
+	if claims.ClientID != "" {
+		return claims.ClientID
+	}
+	return claims.UserID.String()
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/hash"
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+var (
+	ErrInvalidClientRegistration = errors.New("invalid client registration")
+	ErrClientHasNoSecret         = errors.New("public clients have no secret")
+)
+
+type Clients interface {
+	CreateClient(ctx context.Context, reg model.ClientRegistration) (*model.ClientCredentials, error)
+	RotateClientSecret(ctx context.Context, clientID string) (*model.ClientCredentials, error)
+}
+
+// Регистрация клиентов и ротация их секретов, доступно только администраторам
+type ClientService struct {
+	repo  repository.Repository
+	log   *slog.Logger
+	audit *AuditService
+}
+
+func NewClientService(repo repository.Repository, log *slog.Logger, audit *AuditService) *ClientService {
+	return &ClientService{
+		repo:  repo,
+		log:   log,
+		audit: audit,
+	}
+}
+
+/*
+Регистрируем клиента. Конфиденциальному клиенту без ключа для private_key_jwt
+генерируем секрет, он возвращается только в этом ответе
+*/
+func (s *ClientService) CreateClient(ctx context.Context, reg model.ClientRegistration) (_ *model.ClientCredentials, err error) {
+	event := model.AuditEvent{Action: model.AuditClientCreate, Subject: clientSubject(reg.ID), Details: map[string]string{"name": reg.Name}}
+	defer s.audit.Record(ctx, &event, &err)
+
+	if err := validateRegistration(reg); err != nil {
+		return nil, err
+	}
+
+	client := &model.Client{
+		ID:           reg.ID,
+		Name:         reg.Name,
+		Public:       reg.Public,
+		RedirectURIs: reg.RedirectURIs,
+		Scopes:       reg.Scopes,
+		PublicKey:    reg.PublicKey,
+		Audiences:    reg.Audiences,
+		CreatedAt:    time.Now(),
+	}
+	if client.ID == "" {
+		client.ID = uuid.NewString()
+	}
+	event.Subject = clientSubject(client.ID)
+
+	var secret string
+	if !client.Public && client.PublicKey == "" {
+		var err error
+		if secret, err = randomToken(); err != nil {
+			s.log.Error("failed to generate client secret", "error", err)
+			return nil, err
+		}
+		client.SecretHash = hash.HashSecret(secret)
+	}
+
+	if err := s.repo.Client.Create(ctx, client); err != nil {
+		s.log.Error("failed to create client", "error", err)
+		return nil, err
+	}
+
+	s.log.Info("client created", "client_id", client.ID)
+	return &model.ClientCredentials{Client: client, ClientSecret: secret}, nil
+}
+
+// Выдаём клиенту новый секрет, старый перестаёт действовать сразу
+func (s *ClientService) RotateClientSecret(ctx context.Context, clientID string) (_ *model.ClientCredentials, err error) {
+	event := model.AuditEvent{Action: model.AuditClientRotateSecret, Subject: clientSubject(clientID)}
+	defer s.audit.Record(ctx, &event, &err)
+
+	client, err := s.repo.Client.GetByID(ctx, clientID)
+	if err != nil {
+		s.log.Error("failed to get client", "error", err)
+		return nil, err
+	}
+	if client.Public {
+		return nil, ErrClientHasNoSecret
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		s.log.Error("failed to generate client secret", "error", err)
+		return nil, err
+	}
+	client.SecretHash = hash.HashSecret(secret)
+
+	if err := s.repo.Client.UpdateSecret(ctx, client.ID, client.SecretHash); err != nil {
+		s.log.Error("failed to update client secret", "error", err)
+		return nil, err
+	}
+
+	s.log.Info("client secret rotated", "client_id", client.ID)
+	return &model.ClientCredentials{Client: client, ClientSecret: secret}, nil
+}
+
+func clientSubject(id string) model.AuditSubject {
+	return model.AuditSubject{Type: model.AuditSubjectClient, ID: id}
+}
+
+func validateRegistration(reg model.ClientRegistration) error {
+	switch {
+	case strings.TrimSpace(reg.Name) == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidClientRegistration)
+	case reg.Public && len(reg.RedirectURIs) == 0:
+		return fmt.Errorf("%w: public clients need redirect_uris", ErrInvalidClientRegistration)
+	case reg.Public && (reg.PublicKey != "" || len(reg.Scopes) > 0):
+		return fmt.Errorf("%w: public clients cannot use client_credentials", ErrInvalidClientRegistration)
+	case reg.Public && len(reg.Audiences) > 0:
+		return fmt.Errorf("%w: public clients cannot exchange tokens", ErrInvalidClientRegistration)
+	case slices.Contains(reg.Scopes, ScopeOpenID) || slices.Contains(reg.Scopes, ScopeOfflineAccess):
+		return fmt.Errorf("%w: openid and offline_access are user scopes", ErrInvalidClientRegistration)
+	}
+	if reg.PublicKey != "" {
+		if err := jwt.ValidatePublicKey(reg.PublicKey); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidClientRegistration, err)
+		}
+	}
+	return nil
+}
+
+// Выдаём сервисный токен без пользователя, sub = client_id (RFC 6749, раздел 4.4)
+func (s *OAuthService) clientCredentials(client *model.Client, req model.TokenRequest) (*model.TokenResponse, error) {
+	if client.Public {
+		return nil, ErrUnauthorizedClient
+	}
+
+	scope := strings.Join(client.Scopes, " ")
+	if req.Scope != "" {
+		for _, requested := range strings.Fields(req.Scope) {
+			if !slices.Contains(client.Scopes, requested) {
+				return nil, ErrInvalidScope
+			}
+		}
+		scope = req.Scope
+	}
+
+	subject := jwt.Subject{ClientID: client.ID, Scope: scope, Audience: s.policy.audience(req.Audience)}
+	access, err := s.jwt.GenerateAccessToken(subject, s.accessTokenTTL)
+	if err != nil {
+		s.log.Error("failed to generate access token", "error", err)
+		return nil, err
+	}
+
+	s.log.Info("client credentials token issued", "client_id", client.ID)
+	return &model.TokenResponse{
+		AccessToken: access.Token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.accessTokenTTL.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// Аутентифицируем клиента по client_assertion, подписанному его ключом (RFC 7523)
+func (s *OAuthService) authenticateClientAssertion(ctx context.Context, req model.TokenRequest) (*model.Client, error) {
+	if req.ClientAssertionType != jwt.ClientAssertionType {
+		return nil, ErrInvalidClient
+	}
+
+	clientID, err := jwt.ClientAssertionIssuer(req.ClientAssertion)
+	if err != nil || (req.ClientID != "" && req.ClientID != clientID) {
+		return nil, ErrInvalidClient
+	}
+
+	client, err := s.repo.Client.GetByID(ctx, clientID)
+	if errors.Is(err, repository.ErrClientNotFound) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		s.log.Error("failed to get client", "error", err)
+		return nil, err
+	}
+	if client.PublicKey == "" {
+		return nil, ErrInvalidClient
+	}
+
+	issuer := s.idTokens.Issuer()
+	audiences := []string{issuer, issuer + "/oauth/token"}
+	if err := jwt.VerifyClientAssertion(req.ClientAssertion, client.ID, client.PublicKey, audiences); err != nil {
+		s.log.Error("invalid client assertion", "client_id", client.ID, "error", err)
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/hash"
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+const (
+	GrantDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+	deviceCodeTTL      = 10 * time.Minute
+	devicePollInterval = 5 * time.Second
+
+	// Без гласных, чтобы из кода не складывались слова (RFC 8628, раздел 6.1)
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+	// Сколько раз генерируем user_code заново при совпадении с действующим
+	userCodeAttempts = 3
+)
+
+var (
+	ErrAuthorizationPending = &OAuthError{Code: "authorization_pending"}
+	ErrSlowDown             = &OAuthError{Code: "slow_down"}
+	ErrAccessDenied         = &OAuthError{Code: "access_denied"}
+	ErrExpiredToken         = &OAuthError{Code: "expired_token"}
+	ErrInvalidUserCode      = invalidRequest("unknown or expired user_code")
+)
+
+// Что показать пользователю перед подтверждением устройства
+type DeviceVerification struct {
+	UserCode string
+	Client   *model.Client
+	Scopes   []string
+}
+
+/*
+Начинаем авторизацию устройства (RFC 8628).
+Клиент аутентифицируется так же, как на /oauth/token, scope из запроса
+ограничиваем тем, что пользователь может доверить клиенту
+*/
+func (s *OAuthService) DeviceAuthorization(ctx context.Context, req model.TokenRequest) (*model.DeviceAuthorizationResponse, error) {
+	client, err := s.authenticateTokenClient(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceCode, err := randomToken()
+	if err != nil {
+		s.log.Error("failed to generate device code", "error", err)
+		return nil, err
+	}
+
+	now := time.Now()
+	auth := model.DeviceAuthorization{
+		DeviceCodeHash: hash.HashSecret(deviceCode),
+		ClientID:       client.ID,
+		Scope:          s.policy.delegate(req.Scope),
+		Status:         model.DeviceAuthorizationPending,
+		NextPollAt:     now,
+		ExpiresAt:      now.Add(deviceCodeTTL),
+	}
+
+	for attempt := 0; ; attempt++ {
+		if auth.UserCode, err = generateUserCode(); err != nil {
+			s.log.Error("failed to generate user code", "error", err)
+			return nil, err
+		}
+		err = s.repo.DeviceAuthorization.Create(ctx, auth)
+		if !errors.Is(err, repository.ErrDeviceUserCodeExists) || attempt == userCodeAttempts-1 {
+			break
+		}
+	}
+	if err != nil {
+		s.log.Error("failed to save device authorization", "error", err)
+		return nil, err
+	}
+
+	userCode := formatUserCode(auth.UserCode)
+	s.log.Info("device authorization started", "client_id", client.ID)
+	return &model.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         s.deviceVerificationURI,
+		VerificationURIComplete: appendQuery(s.deviceVerificationURI, url.Values{"user_code": {userCode}}),
+		ExpiresIn:               int64(deviceCodeTTL.Seconds()),
+		Interval:                int64(devicePollInterval.Seconds()),
+	}, nil
+}
+
+// Возвращаем данные ожидающего запроса для экрана подтверждения
+func (s *OAuthService) DeviceVerification(ctx context.Context, userCode string) (*DeviceVerification, error) {
+	auth, err := s.pendingDeviceAuthorization(ctx, userCode)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.repo.Client.GetByID(ctx, auth.ClientID)
+	if err != nil {
+		s.log.Error("failed to get client", "error", err)
+		return nil, err
+	}
+
+	return &DeviceVerification{
+		UserCode: formatUserCode(auth.UserCode),
+		Client:   client,
+		Scopes:   strings.Fields(auth.Scope),
+	}, nil
+}
+
+// Пользователь, вошедший first-party токеном, подтверждает или отклоняет устройство
+func (s *OAuthService) VerifyDevice(ctx context.Context, claims *jwt.Claims, userCode, decision string) error {
+	auth, err := s.pendingDeviceAuthorization(ctx, userCode)
+	if err != nil {
+		return err
+	}
+
+	status := model.DeviceAuthorizationDenied
+	if decision == ConsentAllow {
+		if err := s.grantConsent(ctx, claims.UserID, auth.ClientID, strings.Fields(auth.Scope)); err != nil {
+			return err
+		}
+		status = model.DeviceAuthorizationApproved
+	}
+
+	err = s.repo.DeviceAuthorization.Decide(ctx, auth.UserCode, claims.UserID, status, authTime(claims))
+	if errors.Is(err, repository.ErrDeviceAuthorizationNotFound) {
+		return ErrInvalidUserCode
+	}
+	if err != nil {
+		s.log.Error("failed to save device decision", "error", err)
+		return err
+	}
+
+	s.log.Info("device authorization "+status, "user_id", claims.UserID, "client_id", auth.ClientID)
+	return nil
+}
+
+// Опрос /oauth/token устройством до решения пользователя
+func (s *OAuthService) deviceCodeGrant(ctx context.Context, client *model.Client, req model.TokenRequest) (*model.TokenResponse, error) {
+	if req.DeviceCode == "" {
+		return nil, invalidRequest("device_code is required")
+	}
+
+	deviceCodeHash := hash.HashSecret(req.DeviceCode)
+	now := time.Now()
+	auth, err := s.repo.DeviceAuthorization.Poll(ctx, deviceCodeHash, now, now.Add(devicePollInterval))
+	switch {
+	case errors.Is(err, repository.ErrDevicePollTooFrequent):
+		return nil, ErrSlowDown
+	case errors.Is(err, repository.ErrDeviceAuthorizationNotFound):
+		return nil, ErrInvalidGrant
+	case err != nil:
+		s.log.Error("failed to poll device authorization", "error", err)
+		return nil, err
+	}
+
+	switch {
+	case auth.ClientID != client.ID:
+		s.log.Error("device code issued to another client", "client_id", client.ID)
+		return nil, ErrInvalidGrant
+	case !auth.ExpiresAt.After(now):
+		return nil, ErrExpiredToken
+	case auth.Status == model.DeviceAuthorizationPending:
+		return nil, ErrAuthorizationPending
+	case auth.Status == model.DeviceAuthorizationDenied:
+		return nil, ErrAccessDenied
+	}
+
+	auth, err = s.repo.DeviceAuthorization.Consume(ctx, deviceCodeHash)
+	if errors.Is(err, repository.ErrDeviceAuthorizationNotFound) {
+		return nil, ErrInvalidGrant
+	}
+	if err != nil {
+		s.log.Error("failed to consume device authorization", "error", err)
+		return nil, err
+	}
+
+	response, err := s.issueUserTokens(ctx, client, userGrant{
+		userID:   auth.UserID,
+		scope:    auth.Scope,
+		audience: req.Audience,
+		authTime: auth.AuthTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("device code exchanged", "user_id", auth.UserID, "client_id", client.ID)
+	return response, nil
+}
+
+func (s *OAuthService) pendingDeviceAuthorization(ctx context.Context, userCode string) (*model.DeviceAuthorization, error) {
+	auth, err := s.repo.DeviceAuthorization.GetByUserCode(ctx, normalizeUserCode(userCode))
+	if errors.Is(err, repository.ErrDeviceAuthorizationNotFound) {
+		return nil, ErrInvalidUserCode
+	}
+	if err != nil {
+		s.log.Error("failed to get device authorization", "error", err)
+		return nil, err
+	}
+
+	if auth.Status != model.DeviceAuthorizationPending || !auth.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidUserCode
+	}
+	return auth, nil
+}
+
+func generateUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// Пользователю показываем код в виде XXXX-XXXX
+func formatUserCode(code string) string {
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// Принимаем код в любом регистре, с дефисом и пробелами
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+const (
+	GrantTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// Обмениваем и выдаём только access токены
+	TokenTypeAccessTokenURN = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+/*
+Обмениваем access токен пользователя на более узкий токен для вызова другого
+сервиса от его имени (RFC 8693). Актор - аутентифицированный клиент, он попадает
+в claim act. Audience проверены в Token, scope ограничены политикой клиента и scope исходного токена,
+а срок жизни не превышает оставшийся срок исходного токена
+*/
+func (s *OAuthService) tokenExchange(ctx context.Context, client *model.Client, req model.TokenRequest) (*model.TokenResponse, error) {
+	if client.Public || len(client.Audiences) == 0 {
+		return nil, ErrUnauthorizedClient
+	}
+
+	switch {
+	case req.SubjectToken == "" || req.SubjectTokenType != TokenTypeAccessTokenURN:
+		return nil, invalidRequest("subject_token must be an access token")
+	case req.RequestedTokenType != "" && req.RequestedTokenType != TokenTypeAccessTokenURN:
+		return nil, invalidRequest("only access tokens can be requested")
+	case req.ActorToken != "":
+		return nil, invalidRequest("actor_token is not supported, the client itself is the actor")
+	case len(req.Audience) == 0:
+		return nil, ErrInvalidTarget
+	}
+
+	claims, err := s.jwt.ParseToken(req.SubjectToken)
+	if err != nil || s.revocations.IsRevoked(claims) || claims.IsServiceToken() || !s.policy.accepts(claims.Audience) {
+		return nil, ErrInvalidGrant
+	}
+
+	scope, err := exchangeScope(s.policy, client, claims, req.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := min(s.accessTokenTTL, time.Until(claims.ExpiresAt))
+	access, err := s.jwt.GenerateAccessToken(jwt.Subject{
+		UserID:    claims.UserID,
+		SessionID: claims.SessionID,
+		ClientID:  client.ID,
+		Scope:     scope,
+		AuthTime:  claims.AuthTime,
+		ACR:       claims.ACR,
+		Audience:  req.Audience,
+		Actor:     &model.Actor{Subject: client.ID, Actor: claims.Actor},
+	}, ttl)
+	if err != nil {
+		s.log.Error("failed to generate access token", "error", err)
+		return nil, err
+	}
+
+	s.log.Info("token exchanged", "user_id", claims.UserID, "client_id", client.ID, "audience", req.Audience)
+	return &model.TokenResponse{
+		AccessToken:     access.Token,
+		IssuedTokenType: TokenTypeAccessTokenURN,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(ttl.Seconds()),
+		Scope:           scope,
+	}, nil
+}
+
+/*
+Клиент получает только scope, которые есть и в его политике, и в исходном токене,
+и которые пользователь вообще может делегировать. Токен без scope делегировать нечего.
+Без запрошенного scope выдаём всё допустимое
+*/
+func exchangeScope(policy TokenPolicy, client *model.Client, claims *jwt.Claims, requested string) (string, error) {
+	allowed := strings.Fields(policy.delegate(claims.Scope))
+	allowed = intersectScopes(client.Scopes, allowed)
+	if len(allowed) == 0 {
+		return "", ErrInvalidScope
+	}
+
+	if requested == "" {
+		return strings.Join(allowed, " "), nil
+	}
+	for _, scope := range strings.Fields(requested) {
+		if !slices.Contains(allowed, scope) {
+			return "", ErrInvalidScope
+		}
+	}
+	return requested, nil
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+func TestExchangeScope(t *testing.T) {
+	policy := TokenPolicy{Issuer: "https://auth.example.com", Scopes: []string{"payments:read", "payments:write"}}
+	client := &model.Client{ID: "orders", Scopes: []string{"payments:read", "payments:write", "authz:check"}}
+
+	tests := []struct {
+		name         string
+		subjectScope string
+		requested    string
+		want         string
+		err          error
+	}{
+		{name: "everything allowed", subjectScope: "payments:read payments:write profile", want: "payments:read payments:write"},
+		{name: "narrowed by subject", subjectScope: "payments:read", want: "payments:read"},
+		{name: "requested subset", subjectScope: "payments:read payments:write", requested: "payments:write", want: "payments:write"},
+		{name: "requested outside subject", subjectScope: "payments:read", requested: "payments:write", err: ErrInvalidScope},
+		{name: "requested outside client", subjectScope: "payments:read profile", requested: "profile", err: ErrInvalidScope},
+		{name: "nothing in common", subjectScope: "profile", err: ErrInvalidScope},
+		// authz:check есть у клиента и в токене, но пользователю его делегировать нельзя
+		{name: "not delegable", subjectScope: "payments:read authz:check", want: "payments:read"},
+		{name: "requested not delegable", subjectScope: "payments:read authz:check", requested: "authz:check", err: ErrInvalidScope},
+		// Токен без scope не даёт права ни на что, а не на все scopes клиента
+		{name: "empty subject scope", subjectScope: "", err: ErrInvalidScope},
+		{name: "empty subject scope requested", subjectScope: "", requested: "payments:read", err: ErrInvalidScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := exchangeScope(policy, client, &jwt.Claims{Scope: tt.subjectScope}, tt.requested)
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Fatalf("exchangeScope(%q, %q) = %q, %v, want %q, %v", tt.subjectScope, tt.requested, got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
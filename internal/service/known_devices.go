@@ -0,0 +1,362 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/mail"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/jwt"
+	"github.com/v7ktory/test/pkg/mailer"
+)
+
+const (
+	// Ссылка "это был не я" из письма о новом устройстве действует неделю
+	deviceReportTTL = 7 * 24 * time.Hour
+
+	deviceNetworkPurpose = "device-network"
+	deviceReportPurpose  = "device-report"
+
+	// Длина хэша сети в символах base64url, 128 бит
+	deviceNetworkHashLength = 22
+	unknownUserAgent        = "Unknown"
+	maxUserAgentFamily      = 64
+)
+
+var ErrInvalidDeviceReport = errors.New("invalid or expired device report link")
+
+type KnownDevices interface {
+	ListDevices(ctx context.Context, claims *jwt.Claims) ([]model.KnownDevice, error)
+	ForgetDevice(ctx context.Context, claims *jwt.Claims, id uuid.UUID) error
+	DeviceReport(ctx context.Context, token string) (*model.KnownDevice, error)
+	ReportDevice(ctx context.Context, token string) error
+}
+
+/*
+Известные устройства пользователей. При входе с нового устройства или из новой
+сети пользователю уходит письмо со ссылкой "это был не я": переход по ней
+завершает сессии и стирает пароль, новый задаётся по ссылке из следующего письма
+*/
+type KnownDeviceService struct {
+	repo        repository.Repository
+	jwt         jwt.JWT
+	log         *slog.Logger
+	revocations *RevocationService
+	audit       *AuditService
+	outbox      *OutboxService
+	mail        *MailService
+	reportURI   string
+	resetURI    string
+}
+
+func NewKnownDeviceService(repo repository.Repository, jwt jwt.JWT, log *slog.Logger, revocations *RevocationService, audit *AuditService, outbox *OutboxService, mail *MailService, reportURI, resetURI string) *KnownDeviceService {
+	return &KnownDeviceService{
+		repo:        repo,
+		jwt:         jwt,
+		log:         log,
+		revocations: revocations,
+		audit:       audit,
+		outbox:      outbox,
+		mail:        mail,
+		reportURI:   reportURI,
+		resetURI:    resetURI,
+	}
+}
+
+// Устройство текущего запроса по User-Agent и IP из контекста
+func (s *KnownDeviceService) Identify(ctx context.Context) model.Device {
+	meta := auditMetaFrom(ctx)
+	return model.Device{
+		UserAgent: userAgentFamily(meta.UserAgent),
+		Network:   s.networkHash(meta.IP),
+	}
+}
+
+/*
+Отмечаем вход пользователя с устройства, вызывается внутри транзакции входа.
+Письмо и событие уходят, только если у пользователя уже были другие устройства,
+чтобы первый вход после регистрации не выглядел подозрительным
+*/
+func (s *KnownDeviceService) Seen(ctx context.Context, user *model.User, sessionID uuid.UUID, device model.Device) error {
+	now := time.Now()
+	known, err := s.repo.KnownDevice.GetByDevice(ctx, user.UUID, device)
+	if err == nil {
+		return s.repo.KnownDevice.UpdateLastSeen(ctx, known.ID, now)
+	}
+	if !errors.Is(err, repository.ErrKnownDeviceNotFound) {
+		return err
+	}
+
+	devices, err := s.repo.KnownDevice.ListByUserID(ctx, user.UUID)
+	if err != nil {
+		return err
+	}
+	known = &model.KnownDevice{
+		ID:          uuid.New(),
+		UserID:      user.UUID,
+		Device:      device,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+	err = s.repo.KnownDevice.Create(ctx, *known)
+	// Параллельный вход с того же устройства уже его записал
+	if errors.Is(err, repository.ErrKnownDeviceExists) {
+		return nil
+	}
+	if err != nil || len(devices) == 0 {
+		return err
+	}
+
+	data := userEventData(user.UUID, user.Email)
+	data["device_id"] = known.ID.String()
+	data["user_agent"] = device.UserAgent
+	if err := s.outbox.Enqueue(ctx, model.EventUserNewDevice, user.UUID.String(), data); err != nil {
+		return err
+	}
+
+	err = s.mail.Send(ctx, user.Email, mail.TemplateNewDevice, "", map[string]string{
+		"Email":     user.Email,
+		"Time":      mailTime(now),
+		"Device":    device.UserAgent,
+		"IP":        auditMetaFrom(ctx).IP,
+		"ReportURL": s.reportURL(user.UUID, sessionID, known.ID, now.Add(deviceReportTTL)),
+	})
+	// Как и при смене пароля, неотправляемый адрес не мешает входу
+	if errors.Is(err, mailer.ErrInvalidAddress) {
+		s.log.Warn("new device notification skipped", "user_id", user.UUID, "error", err)
+		return nil
+	}
+	return err
+}
+
+func (s *KnownDeviceService) ListDevices(ctx context.Context, claims *jwt.Claims) ([]model.KnownDevice, error) {
+	devices, err := s.repo.KnownDevice.ListByUserID(ctx, claims.UserID)
+	if err != nil {
+		s.log.Error("failed to list known devices", "user_id", claims.UserID, "error", err)
+		return nil, err
+	}
+	if devices == nil {
+		devices = []model.KnownDevice{}
+	}
+	return devices, nil
+}
+
+// Забытое устройство при следующем входе снова считается новым
+func (s *KnownDeviceService) ForgetDevice(ctx context.Context, claims *jwt.Claims, id uuid.UUID) (err error) {
+	event := model.AuditEvent{
+		Action:  model.AuditDeviceForget,
+		Subject: userSubject(claims.UserID),
+		Details: map[string]string{"device_id": id.String()},
+	}
+	defer s.audit.Record(ctx, &event, &err)
+
+	if err := s.repo.KnownDevice.Delete(ctx, claims.UserID, id); err != nil {
+		s.log.Error("failed to forget device", "user_id", claims.UserID, "device_id", id, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Устройство из ссылки "это был не я", чтобы показать его перед подтверждением
+func (s *KnownDeviceService) DeviceReport(ctx context.Context, token string) (*model.KnownDevice, error) {
+	report, err := s.parseReport(token)
+	if err != nil {
+		return nil, err
+	}
+	device, err := s.repo.KnownDevice.GetByID(ctx, report.UserID, report.DeviceID)
+	if errors.Is(err, repository.ErrKnownDeviceNotFound) {
+		return nil, ErrInvalidDeviceReport
+	}
+	return device, err
+}
+
+/*
+Пользователь сообщил, что вход был не его. Устройство забываем и завершаем все сессии
+пользователя, включая сессию из письма. Пароль знает и тот, кто вошёл, поэтому его стираем:
+новый пользователь задаёт по одноразовой ссылке, которая уходит ему на почту.
+Ссылка об устройстве тоже одноразовая: после отчёта устройства уже нет
+*/
+func (s *KnownDeviceService) ReportDevice(ctx context.Context, token string) (err error) {
+	event := model.AuditEvent{Action: model.AuditDeviceReport}
+	defer s.audit.Record(ctx, &event, &err)
+
+	report, err := s.parseReport(token)
+	if err != nil {
+		return err
+	}
+	event.Actor = userActor(report.UserID)
+	event.Subject = userSubject(report.UserID)
+	event.Details = map[string]string{"device_id": report.DeviceID.String(), "session_id": report.SessionID.String()}
+
+	err = s.repo.WithinTransaction(ctx, func(ctx context.Context) error {
+		device, err := s.repo.KnownDevice.GetByID(ctx, report.UserID, report.DeviceID)
+		if errors.Is(err, repository.ErrKnownDeviceNotFound) {
+			return ErrInvalidDeviceReport
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.repo.KnownDevice.Delete(ctx, report.UserID, device.ID); err != nil {
+			return err
+		}
+
+		user, err := s.repo.Auth.GetByID(ctx, report.UserID)
+		if err != nil {
+			return err
+		}
+		user.Password = ""
+		user.PasswordResetRequired = true
+		if err := s.repo.Auth.Update(ctx, *user); err != nil {
+			return err
+		}
+
+		data := userEventData(user.UUID, user.Email)
+		data["device_id"] = device.ID.String()
+		data["user_agent"] = device.UserAgent
+		if err := s.outbox.Enqueue(ctx, model.EventUserDeviceReport, user.UUID.String(), data); err != nil {
+			return err
+		}
+
+		err = s.mail.Send(ctx, user.Email, mail.TemplatePasswordReset, "", map[string]string{
+			"Email":    user.Email,
+			"Time":     mailTime(time.Now()),
+			"ResetURL": passwordResetURL(s.jwt, s.resetURI, user.UUID, time.Now().Add(passwordResetTTL)),
+		})
+		// Сессии всё равно нужно завершить, пароль тогда задаст администратор
+		if errors.Is(err, mailer.ErrInvalidAddress) {
+			s.log.Warn("password reset link skipped", "user_id", user.UUID, "error", err)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		s.log.Error("failed to report device", "user_id", report.UserID, "error", err)
+		return err
+	}
+
+	// Отзыв всех токенов пользователя закрывает и сессию из письма
+	if err := endUserSessions(ctx, s.repo, s.revocations, report.UserID); err != nil {
+		s.log.Error("failed to end user sessions", "user_id", report.UserID, "error", err)
+		return err
+	}
+
+	s.log.Info("device reported", "user_id", report.UserID, "device_id", report.DeviceID)
+	return nil
+}
+
+// Содержимое ссылки "это был не я"
+type deviceReport struct {
+	UserID    uuid.UUID `json:"user"`
+	SessionID uuid.UUID `json:"session"`
+	DeviceID  uuid.UUID `json:"device"`
+	ExpiresAt int64     `json:"exp"`
+}
+
+func (s *KnownDeviceService) reportURL(userID, sessionID, deviceID uuid.UUID, expiresAt time.Time) string {
+	token := signToken(s.jwt, deviceReportPurpose, deviceReport{UserID: userID, SessionID: sessionID, DeviceID: deviceID, ExpiresAt: expiresAt.Unix()})
+	return linkWithToken(s.reportURI, token)
+}
+
+func (s *KnownDeviceService) parseReport(token string) (*deviceReport, error) {
+	var report deviceReport
+	if !parseSignedToken(s.jwt, deviceReportPurpose, token, &report) || time.Now().Unix() > report.ExpiresAt {
+		return nil, ErrInvalidDeviceReport
+	}
+	return &report, nil
+}
+
+/*
+Токен для ссылок и повторных запросов без хранения на сервере:
+JSON в base64url и подпись ключом сервиса с назначением purpose через точку
+*/
+func signToken(jwt jwt.JWT, purpose string, v any) string {
+	payload, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + jwt.SignData(purpose, payload)
+}
+
+func parseSignedToken(jwt jwt.JWT, purpose, token string, v any) bool {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || !jwt.VerifyData(purpose, payload, signature) {
+		return false
+	}
+	return json.Unmarshal(payload, v) == nil
+}
+
+/*
+Сеть клиента: /24 для IPv4 и /48 для IPv6, чтобы смена адреса у того же
+провайдера не считалась новым устройством. Храним только ключевой хэш сети
+*/
+func (s *KnownDeviceService) networkHash(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return s.jwt.SignData(deviceNetworkPurpose, []byte(prefix.String()))[:deviceNetworkHashLength]
+}
+
+// Браузер и ОС из User-Agent без версий, например "Firefox on Linux"
+func userAgentFamily(userAgent string) string {
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		// Порядок важен: Edge и Opera присылают и Chrome, а Chrome присылает Safari
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"CriOS/", "Chrome"},
+		{"Safari/", "Safari"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	if browser == "" {
+		// Утилиты вроде curl/8.0: берём имя продукта до версии
+		product, _, _ := strings.Cut(strings.TrimSpace(userAgent), "/")
+		product, _, _ = strings.Cut(product, " ")
+		browser = product
+	}
+	if browser == "" {
+		return unknownUserAgent
+	}
+	if len(browser) > maxUserAgentFamily {
+		browser = browser[:maxUserAgentFamily]
+	}
+
+	for _, os := range []struct{ token, name string }{
+		{"Windows", "Windows"},
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iOS"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, os.token) {
+			return browser + " on " + os.name
+		}
+	}
+	return browser
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/mail"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/mailer"
+)
+
+const (
+	mailPollInterval = time.Second
+	mailBatchSize    = 20
+	mailTimeout      = 30 * time.Second
+
+	// Повторы через 30s, 1m, 2m ... но не реже раза в час, после mailMaxAttempts письмо уходит в dead
+	mailMaxAttempts = 8
+	mailRetryBase   = 30 * time.Second
+	mailRetryMax    = time.Hour
+
+	// Отправленные и dead письма удаляет authctl purge через неделю
+	mailRetention = 7 * 24 * time.Hour
+
+	maxMailErrorLength = 512
+)
+
+type mailLocaleKey struct{}
+
+// Локаль писем для текущего запроса, используется, если вызывающий не передал свою
+func WithMailLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, mailLocaleKey{}, locale)
+}
+
+/*
+Очередь писем: письмо собирается из шаблона и сохраняется в хранилище,
+фоновый цикл каждой реплики отправляет его с повторами
+*/
+type MailService struct {
+	repo      repository.MailQueue
+	mailer    mailer.Mailer
+	templates *mailer.Templates
+	log       *slog.Logger
+	queue     *leasedQueue[model.MailMessage]
+}
+
+func NewMailService(repo repository.MailQueue, mailer mailer.Mailer, templates *mailer.Templates, log *slog.Logger) *MailService {
+	s := &MailService{
+		repo:      repo,
+		mailer:    mailer,
+		templates: templates,
+		log:       log,
+	}
+	s.queue = &leasedQueue[model.MailMessage]{
+		name:      "mail",
+		interval:  mailPollInterval,
+		timeout:   mailTimeout,
+		batchSize: mailBatchSize,
+		log:       log,
+		claim:     repo.Claim,
+		process:   s.process,
+		update:    repo.Update,
+	}
+	return s
+}
+
+/*
+Ставим в очередь письмо по шаблону. Внутри транзакции письмо уйдёт, только
+если она зафиксирована. Без локали берём локаль запроса, для неизвестной - локаль по умолчанию
+*/
+func (s *MailService) Send(ctx context.Context, to, template, locale string, data any) error {
+	if locale == "" {
+		locale, _ = ctx.Value(mailLocaleKey{}).(string)
+	}
+	msg, err := s.render(to, template, locale, data)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	message := model.MailMessage{
+		ID:            uuid.New(),
+		To:            msg.To,
+		Template:      template,
+		Subject:       msg.Subject,
+		Text:          msg.Text,
+		HTML:          msg.HTML,
+		Status:        model.MailPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	if err := s.repo.Create(ctx, message); err != nil {
+		s.log.Error("failed to enqueue mail", "template", template, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Тестовое письмо отправляем сразу, мимо очереди, чтобы увидеть ошибку настроек
+func (s *MailService) SendTest(ctx context.Context, to, locale string) error {
+	msg, err := s.render(to, mail.TemplateTest, locale, map[string]string{
+		"Email": to,
+		"Time":  mailTime(time.Now()),
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mailTimeout)
+	defer cancel()
+	return s.mailer.Send(ctx, msg)
+}
+
+func (s *MailService) render(to, template, locale string, data any) (mailer.Message, error) {
+	address, err := mailer.ParseAddress(to)
+	if err != nil {
+		return mailer.Message{}, err
+	}
+	msg, err := s.templates.Render(template, locale, data)
+	if err != nil {
+		s.log.Error("failed to render mail", "template", template, "error", err)
+		return mailer.Message{}, err
+	}
+	msg.To = address
+	return msg, nil
+}
+
+// Отправляем письма по мере наступления их срока, пока не отменён ctx
+func (s *MailService) Run(ctx context.Context) {
+	s.queue.run(ctx)
+}
+
+func (s *MailService) process(ctx context.Context, messages []model.MailMessage) error {
+	for _, message := range messages {
+		s.deliver(ctx, message)
+	}
+	return nil
+}
+
+// Одна попытка отправки, её итог сохраняем в очередь
+func (s *MailService) deliver(ctx context.Context, message model.MailMessage) {
+	sendCtx, cancel := context.WithTimeout(ctx, mailTimeout)
+	err := s.mailer.Send(sendCtx, mailer.Message{
+		To:      message.To,
+		Subject: message.Subject,
+		Text:    message.Text,
+		HTML:    message.HTML,
+	})
+	cancel()
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		message.Status = model.MailSent
+		message.SentAt = &now
+		message.Error = ""
+	case message.Attempts >= mailMaxAttempts:
+		message.Status = model.MailDead
+		message.Error = err.Error()
+	default:
+		message.NextAttemptAt = now.Add(backoff(message.Attempts, mailRetryBase, mailRetryMax))
+		message.Error = err.Error()
+	}
+	if len(message.Error) > maxMailErrorLength {
+		message.Error = message.Error[:maxMailErrorLength]
+	}
+
+	if !s.queue.save(ctx, message.ID, message) {
+		return
+	}
+	switch message.Status {
+	case model.MailDead:
+		s.log.Warn("mail message is dead", "mail_id", message.ID, "template", message.Template, "error", message.Error)
+	case model.MailPending:
+		s.log.Error("failed to send mail", "mail_id", message.ID, "attempts", message.Attempts, "error", message.Error)
+	}
+}
+
+// Время в письмах показываем в UTC, часовой пояс получателя неизвестен
+func mailTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04 MST")
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+)
+
+// Обслуживание хранилища, запускается из authctl
+type MaintenanceService struct {
+	repo repository.Repository
+	log  *slog.Logger
+}
+
+func NewMaintenanceService(repo repository.Repository, log *slog.Logger) *MaintenanceService {
+	return &MaintenanceService{
+		repo: repo,
+		log:  log,
+	}
+}
+
+/*
+Удаляем записи, истёкшие к now. Репозитории и так чистят их попутно
+или по TTL, но при редких записях просроченные данные копятся
+*/
+func (s *MaintenanceService) PurgeExpired(ctx context.Context, now time.Time) (*model.PurgeResult, error) {
+	var (
+		result model.PurgeResult
+		err    error
+	)
+	if result.Sessions, err = s.repo.Session.DeleteExpired(ctx, now); err != nil {
+		s.log.Error("failed to purge sessions", "error", err)
+		return nil, err
+	}
+	if result.AuthorizationCodes, err = s.repo.AuthorizationCode.DeleteExpired(ctx, now); err != nil {
+		s.log.Error("failed to purge authorization codes", "error", err)
+		return nil, err
+	}
+	if result.DeviceAuthorizations, err = s.repo.DeviceAuthorization.DeleteExpired(ctx, now); err != nil {
+		s.log.Error("failed to purge device authorizations", "error", err)
+		return nil, err
+	}
+	if result.Revocations, err = s.repo.Revocation.DeleteExpired(ctx, now); err != nil {
+		s.log.Error("failed to purge revocations", "error", err)
+		return nil, err
+	}
+	if result.Outbox, err = s.repo.Outbox.DeletePublished(ctx, now.Add(-outboxRetention)); err != nil {
+		s.log.Error("failed to purge outbox", "error", err)
+		return nil, err
+	}
+	if result.Mail, err = s.repo.MailQueue.DeleteFinished(ctx, now.Add(-mailRetention)); err != nil {
+		s.log.Error("failed to purge mail queue", "error", err)
+		return nil, err
+	}
+
+	s.log.Info("expired data purged",
+		"sessions", result.Sessions,
+		"authorization_codes", result.AuthorizationCodes,
+		"device_authorizations", result.DeviceAuthorizations,
+		"revocations", result.Revocations,
+		"outbox", result.Outbox,
+		"mail", result.Mail,
+	)
+	return &result, nil
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/hash"
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
+// Ошибка протокола OAuth 2.0, Code отдаётся клиенту как поле error
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+var (
+	ErrInvalidClient        = &OAuthError{Code: "invalid_client"}
+	ErrInvalidGrant         = &OAuthError{Code: "invalid_grant"}
+	ErrUnsupportedGrantType = &OAuthError{Code: "unsupported_grant_type"}
+	ErrUnauthorizedClient   = &OAuthError{Code: "unauthorized_client"}
+	ErrInvalidScope         = &OAuthError{Code: "invalid_scope"}
+	ErrInvalidTarget        = &OAuthError{Code: "invalid_target"}
+)
+
+func invalidRequest(description string) *OAuthError {
+	return &OAuthError{Code: "invalid_request", Description: description}
+}
+
+type OAuthService struct {
+	repo            repository.Repository
+	hash            hash.Hasher
+	jwt             jwt.JWT
+	idTokens        *jwt.IDTokenSigner
+	log             *slog.Logger
+	revocations     *RevocationService
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	policy          TokenPolicy
+	// Страница, где пользователь вводит user_code
+	deviceVerificationURI string
+}
+
+func NewOAuthService(repo repository.Repository, hash hash.Hasher, jwt jwt.JWT, idTokens *jwt.IDTokenSigner, log *slog.Logger, revocations *RevocationService, accessTokenTTL, refreshTokenTTL time.Duration, policy TokenPolicy, deviceVerificationURI string) *OAuthService {
+	return &OAuthService{
+		repo:            repo,
+		hash:            hash,
+		jwt:             jwt,
+		idTokens:        idTokens,
+		log:             log,
+		revocations:     revocations,
+		accessTokenTTL:  accessTokenTTL,
+		refreshTokenTTL: refreshTokenTTL,
+		policy:          policy,
+
+		deviceVerificationURI: deviceVerificationURI,
+	}
+}
+
+// Проверяем client_id и client_secret зарегистрированного клиента
+func (s *OAuthService) AuthenticateClient(ctx context.Context, clientID, clientSecret string) (*model.Client, error) {
+	client, err := s.repo.Client.GetByID(ctx, clientID)
+	if errors.Is(err, repository.ErrClientNotFound) {
+		s.log.Error("unknown client", "client_id", clientID)
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		s.log.Error("failed to get client", "error", err)
+		return nil, err
+	}
+
+	if !hash.CompareSecret(clientSecret, client.SecretHash) {
+		s.log.Error("invalid client secret", "client_id", clientID)
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+/*
+Проверяем, активен ли токен (RFC 7662).
+Подсказка hint определяет, с какого типа токена начинать проверку
+*/
+func (s *OAuthService) Introspect(ctx context.Context, token, hint string) (*model.Introspection, error) {
+	if hint == TokenTypeRefresh {
+		if result, err := s.introspectRefresh(ctx, token); err != nil || result.Active {
+			return result, err
+		}
+		return s.introspectAccess(token), nil
+	}
+
+	if result := s.introspectAccess(token); result.Active {
+		return result, nil
+	}
+	return s.introspectRefresh(ctx, token)
+}
+
+/*
+Отзываем токен (RFC 7009), выданный клиенту client.
+Отзыв refresh токена отзывает и все access токены его сессии.
+Неизвестный, уже недействительный или чужой токен ошибкой не считается и не отзывается
+*/
+func (s *OAuthService) Revoke(ctx context.Context, client *model.Client, token, hint string) error {
+	if hint != TokenTypeRefresh {
+		if claims, err := s.jwt.ParseToken(token); err == nil {
+			if claims.ClientID != client.ID {
+				s.log.Warn("client tried to revoke a token issued to another client", "client_id", client.ID, "jti", claims.TokenID)
+				return nil
+			}
+			if err := s.revocations.RevokeToken(ctx, claims); err != nil {
+				s.log.Error("failed to revoke token", "error", err)
+				return err
+			}
+			s.log.Info("access token revoked", "jti", claims.TokenID)
+			return nil
+		}
+	}
+
+	session, err := s.sessionByRefreshToken(ctx, token)
+	if err != nil || session == nil {
+		return err
+	}
+	if session.ClientID != client.ID {
+		s.log.Warn("client tried to revoke a session of another client", "client_id", client.ID, "session_id", session.ID)
+		return nil
+	}
+
+	if err := s.revocations.RevokeSession(ctx, session.ID); err != nil {
+		s.log.Error("failed to revoke session", "error", err)
+		return err
+	}
+
+	err = s.repo.Session.Update(ctx, model.Session{
+		ID: session.ID,
+		RefreshToken: model.RefreshToken{
+			UserID: session.RefreshToken.UserID,
+		},
+	})
+	if err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		s.log.Error("failed to reset session", "error", err)
+		return err
+	}
+
+	s.log.Info("refresh token revoked", "session_id", session.ID)
+	return nil
+}
+
+func (s *OAuthService) introspectAccess(token string) *model.Introspection {
+	claims, err := s.jwt.ParseToken(token)
+	if err != nil || s.revocations.IsRevoked(claims) {
+		return &model.Introspection{}
+	}
+
+	result := &model.Introspection{
+		Active:    true,
+		Subject:   claims.UserID.String(),
+		ClientID:  claims.ClientID,
+		Scope:     claims.Scope,
+		Audience:  claims.Audience,
+		Actor:     claims.Actor,
+		ACR:       claims.ACR,
+		TokenType: TokenTypeAccess,
+		ExpiresAt: claims.ExpiresAt.Unix(),
+		JTI:       claims.TokenID.String(),
+	}
+	if claims.IsServiceToken() {
+		result.Subject = claims.ClientID
+	}
+	if !claims.IssuedAt.IsZero() {
+		result.IssuedAt = claims.IssuedAt.Unix()
+	}
+	return result
+}
+
+func (s *OAuthService) introspectRefresh(ctx context.Context, token string) (*model.Introspection, error) {
+	session, err := s.sessionByRefreshToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return &model.Introspection{}, nil
+	}
+
+	return &model.Introspection{
+		Active:    true,
+		Subject:   session.RefreshToken.UserID.String(),
+		ClientID:  session.ClientID,
+		Scope:     session.Scope,
+		TokenType: TokenTypeRefresh,
+		ExpiresAt: session.RefreshToken.ExpiresAt.Unix(),
+		JTI:       session.RefreshToken.ID.String(),
+	}, nil
+}
+
+// Возвращаем сессию, если refresh токен действителен, иначе nil
+func (s *OAuthService) sessionByRefreshToken(ctx context.Context, token string) (*model.Session, error) {
+	sessionID, ok := jwt.SessionIDFromRefreshToken(token)
+	if !ok {
+		return nil, nil
+	}
+
+	session, err := s.repo.Session.GetByID(ctx, sessionID)
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		s.log.Error("failed to get session", "error", err)
+		return nil, err
+	}
+
+	if session.RefreshToken.Token == "" || !session.RefreshToken.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	if !s.hash.CompareHash(token, session.RefreshToken.Token) {
+		return nil, nil
+	}
+	return session, nil
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+const (
+	ScopeOpenID        = "openid"
+	ScopeProfile       = "profile"
+	ScopeEmail         = "email"
+	ScopeOfflineAccess = "offline_access"
+)
+
+var (
+	ErrInvalidToken      = &OAuthError{Code: "invalid_token"}
+	ErrInsufficientScope = &OAuthError{Code: "insufficient_scope"}
+)
+
+// Отдаём claims пользователя по access токену, выданному со scope openid
+func (s *OAuthService) UserInfo(ctx context.Context, claims *jwt.Claims) (map[string]any, error) {
+	if !hasScope(claims.Scope, ScopeOpenID) {
+		return nil, ErrInsufficientScope
+	}
+
+	user, err := s.repo.Auth.GetByID(ctx, claims.UserID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		s.log.Error("failed to get user", "error", err)
+		return nil, err
+	}
+
+	info := userClaims(user, claims.Scope)
+	info["sub"] = user.UUID
+	return info, nil
+}
+
+func (s *OAuthService) Discovery() *model.OpenIDConfiguration {
+	issuer := s.idTokens.Issuer()
+	return &model.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		DeviceAuthorizationEndpoint:       issuer + "/oauth/device_authorization",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		ScopesSupported:                   []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopeOfflineAccess},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{GrantAuthorizationCode, GrantRefreshToken, GrantClientCredentials, GrantDeviceCode, GrantTokenExchange},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "private_key_jwt", "none"},
+		TokenEndpointAuthSigningAlgs:      []string{"RS256", "ES256"},
+		CodeChallengeMethodsSupported:     []string{pkceMethodS256},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "at_hash", "email", "email_verified",
+		},
+	}
+}
+
+func (s *OAuthService) JWKS() jwt.JWKSet {
+	return s.idTokens.JWKS()
+}
+
+// Выпускаем ID токен вместе с access токеном клиента
+func (s *OAuthService) issueIDToken(ctx context.Context, clientID string, grant userGrant, accessToken string) (string, error) {
+	user, err := s.repo.Auth.GetByID(ctx, grant.userID)
+	if err != nil {
+		s.log.Error("failed to get user", "error", err)
+		return "", err
+	}
+
+	idToken, err := s.idTokens.Sign(jwt.IDToken{
+		UserID:      user.UUID,
+		ClientID:    clientID,
+		Nonce:       grant.nonce,
+		AuthTime:    grant.authTime,
+		AccessToken: accessToken,
+		UserClaims:  userClaims(user, grant.scope),
+	}, s.accessTokenTTL)
+	if err != nil {
+		s.log.Error("failed to sign id token", "error", err)
+		return "", err
+	}
+	return idToken, nil
+}
+
+/*
+Стандартные claims пользователя по выданным scope.
+profile принимается, но своих claims пока не добавляет:
+в model.User нет имени и других полей профиля
+*/
+func userClaims(user *model.User, scope string) map[string]any {
+	claims := map[string]any{}
+	if hasScope(scope, ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+	return claims
+}
+
+func hasScope(scope, want string) bool {
+	return slices.Contains(strings.Fields(scope), want)
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+)
+
+const (
+	outboxPollInterval = time.Second
+	outboxBatchSize    = 50
+	outboxTimeout      = 10 * time.Second
+
+	// Повторы через 5s, 10s, 20s ... но не реже раза в 10 минут, без ограничения числа попыток
+	outboxRetryBase = 5 * time.Second
+	outboxRetryMax  = 10 * time.Minute
+
+	// Опубликованные сообщения удаляет authctl purge через неделю
+	outboxRetention = 7 * 24 * time.Hour
+
+	maxOutboxErrorLength = 512
+)
+
+/*
+Получатель событий из outbox. Сообщение может прийти повторно (после сбоя
+или ошибки другого получателя), дубли отбрасываются по id события
+*/
+type EventSink interface {
+	Publish(ctx context.Context, message model.OutboxMessage) error
+}
+
+// Клиент брокера сообщений: NATS (subject, data) или Kafka (topic, key, value)
+type MessagePublisher interface {
+	Publish(ctx context.Context, topic, key string, payload []byte) error
+}
+
+// Передаём события в брокер, топик - prefix и тип события, например auth.user.signup
+type BrokerSink struct {
+	publisher MessagePublisher
+	prefix    string
+}
+
+func NewBrokerSink(publisher MessagePublisher, prefix string) *BrokerSink {
+	return &BrokerSink{
+		publisher: publisher,
+		prefix:    prefix,
+	}
+}
+
+func (s *BrokerSink) Publish(ctx context.Context, message model.OutboxMessage) error {
+	return s.publisher.Publish(ctx, s.prefix+message.Type, message.Key, []byte(message.Payload))
+}
+
+// Пишем события в лог, удобно для отладки и как пример получателя
+type LogSink struct {
+	log *slog.Logger
+}
+
+func NewLogSink(log *slog.Logger) *LogSink {
+	return &LogSink{
+		log: log,
+	}
+}
+
+func (s *LogSink) Publish(_ context.Context, message model.OutboxMessage) error {
+	s.log.Info("event published", "event_id", message.ID, "type", message.Type, "key", message.Key, "payload", message.Payload)
+	return nil
+}
+
+/*
+Transactional outbox: события пишутся в хранилище в одной транзакции с изменением,
+которое их породило, а фоновый диспетчер передаёт их получателям.
+Каждая реплика запускает диспетчер, сообщение берётся в аренду одной из них
+*/
+type OutboxService struct {
+	repo  repository.Outbox
+	log   *slog.Logger
+	sinks []EventSink
+	queue *leasedQueue[model.OutboxMessage]
+}
+
+func NewOutboxService(repo repository.Outbox, log *slog.Logger, owner string, sinks ...EventSink) *OutboxService {
+	s := &OutboxService{
+		repo:  repo,
+		log:   log,
+		sinks: sinks,
+	}
+	s.queue = &leasedQueue[model.OutboxMessage]{
+		name:      "outbox",
+		interval:  outboxPollInterval,
+		timeout:   outboxTimeout,
+		batchSize: outboxBatchSize,
+		log:       log,
+		claim: func(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.OutboxMessage, error) {
+			return repo.Claim(ctx, owner, now, leaseUntil, limit)
+		},
+		process: s.process,
+		update:  repo.Update,
+	}
+	return s
+}
+
+// Добавляем получателя, например брокер, вызывать до Run
+func (s *OutboxService) AddSink(sink EventSink) {
+	s.sinks = append(s.sinks, sink)
+}
+
+/*
+Записываем событие в outbox. Вызывается внутри транзакции изменения:
+если запись не удалась, откатывается и само изменение
+*/
+func (s *OutboxService) Enqueue(ctx context.Context, eventType, key string, data map[string]string) error {
+	event := model.Event{ID: uuid.New(), Type: eventType, Time: time.Now().UTC(), Data: data}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	message := model.OutboxMessage{
+		ID:            event.ID,
+		Type:          eventType,
+		Key:           key,
+		Payload:       string(payload),
+		CreatedAt:     event.Time,
+		NextAttemptAt: event.Time,
+	}
+	if err := s.repo.Create(ctx, message); err != nil {
+		s.log.Error("failed to write outbox message", "type", eventType, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Публикуем сообщения по мере наступления их срока, пока не отменён ctx
+func (s *OutboxService) Run(ctx context.Context) {
+	s.queue.run(ctx)
+}
+
+func (s *OutboxService) process(ctx context.Context, messages []model.OutboxMessage) error {
+	for _, message := range messages {
+		s.publish(ctx, message)
+	}
+	return nil
+}
+
+// Передаём сообщение всем получателям, при ошибке любого повторяем целиком
+func (s *OutboxService) publish(ctx context.Context, message model.OutboxMessage) {
+	publishCtx, cancel := context.WithTimeout(ctx, outboxTimeout)
+	var errs []error
+	for _, sink := range s.sinks {
+		if err := sink.Publish(publishCtx, message); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	cancel()
+
+	now := time.Now()
+	if err := errors.Join(errs...); err != nil {
+		message.NextAttemptAt = now.Add(backoff(message.Attempts, outboxRetryBase, outboxRetryMax))
+		message.Error = err.Error()
+		if len(message.Error) > maxOutboxErrorLength {
+			message.Error = message.Error[:maxOutboxErrorLength]
+		}
+		s.log.Error("failed to publish outbox message", "event_id", message.ID, "attempts", message.Attempts, "error", err)
+	} else {
+		message.PublishedAt = &now
+		message.Error = ""
+	}
+	s.queue.save(ctx, message.ID, message)
+}
+
+func userEventData(userID uuid.UUID, email string) map[string]string {
+	return map[string]string{"user_id": userID.String(), "email": email}
+}
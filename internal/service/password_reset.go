@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+const (
+	// Ссылка на сброс пароля после сообщения о чужом входе действует сутки
+	passwordResetTTL     = 24 * time.Hour
+	passwordResetPurpose = "password-reset"
+)
+
+var ErrInvalidPasswordReset = errors.New("invalid or expired password reset link")
+
+// Содержимое ссылки на сброс пароля
+type passwordReset struct {
+	UserID    uuid.UUID `json:"user"`
+	ExpiresAt int64     `json:"exp"`
+}
+
+/*
+Ссылка на сброс пароля не хранится на сервере. Одноразовой её делает то,
+что она действует, только пока пароль стёрт: после сброса он уже задан
+*/
+func passwordResetURL(jwt jwt.JWT, uri string, userID uuid.UUID, expiresAt time.Time) string {
+	return linkWithToken(uri, signToken(jwt, passwordResetPurpose, passwordReset{UserID: userID, ExpiresAt: expiresAt.Unix()}))
+}
+
+// Добавляем token к адресу страницы, у которой уже могут быть свои параметры
+func linkWithToken(uri, token string) string {
+	separator := "?"
+	if strings.Contains(uri, "?") {
+		separator = "&"
+	}
+	return uri + separator + url.Values{"token": {token}}.Encode()
+}
+
+// Email пользователя из ссылки на сброс пароля, чтобы показать его перед вводом нового пароля
+func (s *AuthService) PasswordReset(ctx context.Context, token string) (string, error) {
+	user, err := s.passwordResetUser(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	return user.Email, nil
+}
+
+// Задаём новый пароль по ссылке из письма, отправленного после сообщения о чужом входе
+func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) (err error) {
+	event := model.AuditEvent{Action: model.AuditPasswordReset}
+	defer s.audit.Record(ctx, &event, &err)
+
+	if newPassword == "" {
+		return model.ErrPasswordEmpty
+	}
+
+	user, err := s.passwordResetUser(ctx, token)
+	if err != nil {
+		return err
+	}
+	event.Actor = userActor(user.UUID)
+	event.Subject = userSubject(user.UUID)
+
+	// Пока пароля не было, входы не проходили, блокировка за них не нужна
+	user.FailedLogins = 0
+	user.LockedUntil = time.Time{}
+	if err := s.setPassword(ctx, user, newPassword); err != nil {
+		return err
+	}
+
+	s.log.Info("password reset", "user_id", user.UUID)
+	return nil
+}
+
+func (s *AuthService) passwordResetUser(ctx context.Context, token string) (*model.User, error) {
+	var reset passwordReset
+	if !parseSignedToken(s.jwt, passwordResetPurpose, token, &reset) || time.Now().Unix() > reset.ExpiresAt {
+		return nil, ErrInvalidPasswordReset
+	}
+
+	user, err := s.repo.Auth.GetByID(ctx, reset.UserID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, ErrInvalidPasswordReset
+	}
+	if err != nil {
+		s.log.Error("failed to get user", "error", err)
+		return nil, err
+	}
+	// Пароль уже задан заново по этой или другой ссылке
+	if !user.PasswordRevoked() {
+		return nil, ErrInvalidPasswordReset
+	}
+	return user, nil
+}
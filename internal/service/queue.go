@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/repository"
+)
+
+// Запас аренды сверх обработки пачки на сохранение итогов
+const queueLeaseMargin = 30 * time.Second
+
+/*
+Фоновая очередь с арендой: outbox, письма и доставки webhooks.
+Каждая реплика раз в interval забирает записи, срок которых наступил, на время аренды:
+если она упадёт посреди попытки, запись вернётся в очередь после окончания аренды
+*/
+type leasedQueue[T any] struct {
+	name     string
+	interval time.Duration
+	// Сколько может занять попытка обработки одной записи
+	timeout   time.Duration
+	batchSize int
+	log       *slog.Logger
+	// Берёт в работу до limit записей и увеличивает их Attempts
+	claim func(ctx context.Context, now, leaseUntil time.Time, limit int) ([]T, error)
+	// Обрабатывает взятые записи, итог каждой сохраняет через save
+	process func(ctx context.Context, batch []T) error
+	// Сохраняет итог попытки, ErrLeaseLost, если запись уже взяли заново
+	update func(ctx context.Context, item T) error
+}
+
+// Обрабатываем записи по мере наступления их срока, пока не отменён ctx
+func (q *leasedQueue[T]) run(ctx context.Context) {
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := q.drain(ctx); err != nil {
+				q.log.Error("failed to process queue", "queue", q.name, "error", err)
+			}
+		}
+	}
+}
+
+/*
+Аренда покрывает обработку всей пачки, даже если каждая запись займёт timeout.
+Иначе аренда первых записей кончилась бы раньше, чем до них дойдёт очередь,
+и другая реплика взяла бы их заново: письма и webhooks ушли бы дважды
+*/
+func (q *leasedQueue[T]) lease() time.Duration {
+	return time.Duration(q.batchSize)*q.timeout + queueLeaseMargin
+}
+
+/*
+Обрабатываем все записи, срок которых наступил. Обработка пачки прерывается
+до окончания её аренды, даже если process не уложился в timeout
+*/
+func (q *leasedQueue[T]) drain(ctx context.Context) error {
+	for ctx.Err() == nil {
+		now := time.Now()
+		leaseUntil := now.Add(q.lease())
+		batch, err := q.claim(ctx, now, leaseUntil, q.batchSize)
+		if err != nil {
+			return err
+		}
+
+		processCtx, cancel := context.WithDeadline(ctx, leaseUntil.Add(-queueLeaseMargin))
+		err = q.process(processCtx, batch)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if len(batch) < q.batchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+/*
+Сохраняем итог попытки и при остановке сервиса, иначе запись ждёт окончания аренды.
+false, если итог не сохранён: запись взяла другая реплика или произошла ошибка
+*/
+func (q *leasedQueue[T]) save(ctx context.Context, id uuid.UUID, item T) bool {
+	err := q.update(context.WithoutCancel(ctx), item)
+	switch {
+	case errors.Is(err, repository.ErrLeaseLost):
+		q.log.Warn("queue item was taken over by another replica or deleted", "queue", q.name, "id", id)
+		return false
+	case err != nil:
+		q.log.Error("failed to save queue item", "queue", q.name, "id", id, "error", err)
+		return false
+	}
+	return true
+}
+
+// Задержка перед следующей попыткой после attempts неудачных: base, 2*base, 4*base ... но не больше maxDelay
+func backoff(attempts int, base, maxDelay time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// Аренда пачки покрывает обработку каждой записи до timeout, а обработка кончается раньше аренды
+func TestLeasedQueueLeaseCoversBatch(t *testing.T) {
+	var leaseUntil, deadline time.Time
+	q := &leasedQueue[int]{
+		name:      "test",
+		timeout:   30 * time.Second,
+		batchSize: 20,
+		log:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		claim: func(_ context.Context, _, until time.Time, limit int) ([]int, error) {
+			leaseUntil = until
+			return make([]int, limit-1), nil
+		},
+		process: func(ctx context.Context, _ []int) error {
+			deadline, _ = ctx.Deadline()
+			return nil
+		},
+	}
+
+	start := time.Now()
+	if err := q.drain(context.Background()); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if need := start.Add(20 * 30 * time.Second); leaseUntil.Before(need) {
+		t.Fatalf("lease ends at %v, want at least %v", leaseUntil.Sub(start), need.Sub(start))
+	}
+	if deadline.IsZero() || !deadline.Before(leaseUntil) {
+		t.Fatalf("process deadline is %v, want before the lease end %v", deadline, leaseUntil)
+	}
+}
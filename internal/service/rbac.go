@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+const (
+	// Все роли пользователя попадают в access токен, поэтому их число и длина имён ограничены
+	maxUserRoles       = 16
+	maxRolePermissions = 64
+
+	// Разрешение на всё, например для роли суперадминистратора
+	PermissionAll = "*"
+
+	PermissionClientsManage  = "clients:manage"
+	PermissionRolesManage    = "roles:manage"
+	PermissionUsersManage    = "users:manage"
+	PermissionAuditRead      = "audit:read"
+	PermissionWebhooksManage = "webhooks:manage"
+)
+
+var (
+	ErrInvalidRole  = errors.New("invalid role")
+	ErrTooManyRoles = errors.New("too many roles assigned to user")
+
+	roleNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+	// resource:action, action может быть * для всех действий над ресурсом
+	permissionPattern = regexp.MustCompile(`^[a-z0-9_.-]{1,64}:([a-z0-9_.-]{1,64}|\*)$`)
+)
+
+type Roles interface {
+	CreateRole(ctx context.Context, role model.Role) (*model.Role, error)
+	ListRoles(ctx context.Context) ([]model.Role, error)
+	UpdateRole(ctx context.Context, role model.Role) (*model.Role, error)
+	DeleteRole(ctx context.Context, name string) error
+	UserRoles(ctx context.Context, userID uuid.UUID) ([]string, error)
+	AssignRole(ctx context.Context, userID uuid.UUID, name string) error
+	UnassignRole(ctx context.Context, userID uuid.UUID, name string) error
+	HasPermission(ctx context.Context, claims *jwt.Claims, permission string) (bool, error)
+}
+
+/*
+Управление ролями и проверка разрешений.
+Имена ролей берутся из токена, а разрешения ролей - из хранилища,
+поэтому изменение роли действует сразу, без перевыпуска токенов
+*/
+type RoleService struct {
+	repo        repository.Repository
+	log         *slog.Logger
+	revocations *RevocationService
+	audit       *AuditService
+}
+
+func NewRoleService(repo repository.Repository, log *slog.Logger, revocations *RevocationService, audit *AuditService) *RoleService {
+	return &RoleService{
+		repo:        repo,
+		log:         log,
+		revocations: revocations,
+		audit:       audit,
+	}
+}
+
+// Создаём роль
+func (s *RoleService) CreateRole(ctx context.Context, role model.Role) (_ *model.Role, err error) {
+	event := model.AuditEvent{Action: model.AuditRoleCreate, Subject: roleSubject(role.Name), Details: roleDetails(role)}
+	defer s.audit.Record(ctx, &event, &err)
+
+	if err := validateRole(role); err != nil {
+		return nil, err
+	}
+
+	role.CreatedAt = time.Now()
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	if err := s.repo.Role.Create(ctx, role); err != nil {
+		s.log.Error("failed to create role", "error", err)
+		return nil, err
+	}
+
+	s.log.Info("role created", "role", role.Name)
+	return &role, nil
+}
+
+func (s *RoleService) ListRoles(ctx context.Context) ([]model.Role, error) {
+	roles, err := s.repo.Role.List(ctx)
+	if err != nil {
+		s.log.Error("failed to list roles", "error", err)
+		return nil, err
+	}
+	if roles == nil {
+		roles = []model.Role{}
+	}
+	return roles, nil
+}
+
+// Заменяем описание и разрешения роли
+func (s *RoleService) UpdateRole(ctx context.Context, role model.Role) (_ *model.Role, err error) {
+	event := model.AuditEvent{Action: model.AuditRoleUpdate, Subject: roleSubject(role.Name), Details: roleDetails(role)}
+	defer s.audit.Record(ctx, &event, &err)
+
+	if err := validateRole(role); err != nil {
+		return nil, err
+	}
+
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	if err := s.repo.Role.Update(ctx, role); err != nil {
+		s.log.Error("failed to update role", "error", err)
+		return nil, err
+	}
+
+	s.log.Info("role updated", "role", role.Name)
+	return s.repo.Role.GetByName(ctx, role.Name)
+}
+
+// Удаляем роль вместе с назначениями, её разрешения перестают действовать сразу
+func (s *RoleService) DeleteRole(ctx context.Context, name string) (err error) {
+	event := model.AuditEvent{Action: model.AuditRoleDelete, Subject: roleSubject(name)}
+	defer s.audit.Record(ctx, &event, &err)
+
+	err = s.repo.WithinTransaction(ctx, func(ctx context.Context) error {
+		return s.repo.Role.Delete(ctx, name)
+	})
+	if err != nil {
+		s.log.Error("failed to delete role", "error", err)
+		return err
+	}
+
+	s.log.Info("role deleted", "role", name)
+	return nil
+}
+
+func (s *RoleService) UserRoles(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	if _, err := s.repo.Auth.GetByID(ctx, userID); err != nil {
+		s.log.Error("failed to get user", "error", err)
+		return nil, err
+	}
+
+	roles, err := s.repo.Role.ListUserRoles(ctx, userID)
+	if err != nil {
+		s.log.Error("failed to list user roles", "error", err)
+		return nil, err
+	}
+	return roles, nil
+}
+
+// Назначаем роль, она попадёт в токены пользователя со следующего входа
+func (s *RoleService) AssignRole(ctx context.Context, userID uuid.UUID, name string) (err error) {
+	event := model.AuditEvent{Action: model.AuditRoleAssign, Subject: userSubject(userID), Details: map[string]string{"role": name}}
+	defer s.audit.Record(ctx, &event, &err)
+
+	err = s.repo.WithinTransaction(ctx, func(ctx context.Context) error {
+		if _, err := s.repo.Auth.GetByID(ctx, userID); err != nil {
+			return err
+		}
+		if _, err := s.repo.Role.GetByName(ctx, name); err != nil {
+			return err
+		}
+
+		assigned, err := s.repo.Role.ListUserRoles(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if len(assigned) >= maxUserRoles && !slices.Contains(assigned, name) {
+			return ErrTooManyRoles
+		}
+		return s.repo.Role.Assign(ctx, userID, name)
+	})
+	if err != nil {
+		s.log.Error("failed to assign role", "user_id", userID, "role", name, "error", err)
+		return err
+	}
+
+	s.log.Info("role assigned", "user_id", userID, "role", name)
+	return nil
+}
+
+/*
+Снимаем роль. Выданные токены ещё содержат её имя,
+поэтому отзываем их: пользователь войдёт заново уже без роли
+*/
+func (s *RoleService) UnassignRole(ctx context.Context, userID uuid.UUID, name string) (err error) {
+	event := model.AuditEvent{Action: model.AuditRoleUnassign, Subject: userSubject(userID), Details: map[string]string{"role": name}}
+	defer s.audit.Record(ctx, &event, &err)
+
+	if err := s.repo.Role.Unassign(ctx, userID, name); err != nil {
+		s.log.Error("failed to unassign role", "user_id", userID, "role", name, "error", err)
+		return err
+	}
+	if err := s.revocations.RevokeUser(ctx, userID); err != nil {
+		s.log.Error("failed to revoke user tokens", "user_id", userID, "error", err)
+		return err
+	}
+
+	s.log.Info("role unassigned", "user_id", userID, "role", name)
+	return nil
+}
+
+// Проверяем, даёт ли хотя бы одна роль из токена нужное разрешение
+func (s *RoleService) HasPermission(ctx context.Context, claims *jwt.Claims, permission string) (bool, error) {
+	if len(claims.Roles) == 0 {
+		return false, nil
+	}
+
+	roles, err := s.repo.Role.GetByNames(ctx, claims.Roles)
+	if err != nil {
+		s.log.Error("failed to get roles", "error", err)
+		return false, err
+	}
+
+	for _, role := range roles {
+		for _, granted := range role.Permissions {
+			if permissionGrants(granted, permission) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Роли пользователя для access токена, сверх лимита не добавляем
+func (s *AuthService) tokenRoles(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	roles, err := s.repo.Role.ListUserRoles(ctx, userID)
+	if err != nil {
+		s.log.Error("failed to list user roles", "error", err)
+		return nil, err
+	}
+	if len(roles) > maxUserRoles {
+		s.log.Warn("user has too many roles, extra roles are left out of the token", "user_id", userID)
+		roles = roles[:maxUserRoles]
+	}
+	return roles, nil
+}
+
+func roleSubject(name string) model.AuditSubject {
+	return model.AuditSubject{Type: model.AuditSubjectRole, ID: name}
+}
+
+func roleDetails(role model.Role) map[string]string {
+	return map[string]string{"permissions": strings.Join(role.Permissions, ",")}
+}
+
+func permissionGrants(granted, required string) bool {
+	if granted == PermissionAll || granted == required {
+		return true
+	}
+	resource, action, ok := strings.Cut(granted, ":")
+	return ok && action == "*" && strings.HasPrefix(required, resource+":")
+}
+
+func validateRole(role model.Role) error {
+	if !roleNamePattern.MatchString(role.Name) {
+		return fmt.Errorf("%w: name must match %s", ErrInvalidRole, roleNamePattern)
+	}
+	if len(role.Permissions) > maxRolePermissions {
+		return fmt.Errorf("%w: at most %d permissions", ErrInvalidRole, maxRolePermissions)
+	}
+	for _, permission := range role.Permissions {
+		if permission != PermissionAll && !permissionPattern.MatchString(permission) {
+			return fmt.Errorf("%w: permission %q must look like resource:action", ErrInvalidRole, permission)
+		}
+	}
+	return nil
+}
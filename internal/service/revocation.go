@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+// Запас на расхождение часов между репликами при синхронизации
+const revocationSyncSkew = 30 * time.Second
+
+var ErrTokenRevoked = errors.New("token revoked")
+
+/*
+Кэш отзывов access токенов.
+Отзывы пишутся в репозиторий и сразу применяются локально,
+остальные реплики подтягивают их периодическим опросом
+*/
+type RevocationService struct {
+	repo           repository.Revocation
+	log            *slog.Logger
+	accessTokenTTL time.Duration
+	syncInterval   time.Duration
+
+	mu       sync.RWMutex
+	tokens   map[uuid.UUID]time.Time
+	users    map[uuid.UUID]time.Time
+	sessions map[uuid.UUID]time.Time
+	synced   time.Time
+}
+
+func NewRevocationService(repo repository.Revocation, log *slog.Logger, accessTokenTTL, syncInterval time.Duration) *RevocationService {
+	return &RevocationService{
+		repo:           repo,
+		log:            log,
+		accessTokenTTL: accessTokenTTL,
+		syncInterval:   syncInterval,
+		tokens:         make(map[uuid.UUID]time.Time),
+		users:          make(map[uuid.UUID]time.Time),
+		sessions:       make(map[uuid.UUID]time.Time),
+	}
+}
+
+// Отзываем один access токен до истечения его срока
+func (s *RevocationService) RevokeToken(ctx context.Context, claims *jwt.Claims) error {
+	return s.revoke(ctx, model.RevokeToken, claims.TokenID, claims.ExpiresAt)
+}
+
+// Отзываем все выпущенные к этому моменту токены пользователя
+func (s *RevocationService) RevokeUser(ctx context.Context, userID uuid.UUID) error {
+	return s.revoke(ctx, model.RevokeUser, userID, time.Now().Add(s.accessTokenTTL))
+}
+
+// Отзываем все выпущенные к этому моменту токены сессии
+func (s *RevocationService) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	return s.revoke(ctx, model.RevokeSession, sessionID, time.Now().Add(s.accessTokenTTL))
+}
+
+func (s *RevocationService) IsRevoked(claims *jwt.Claims) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.tokens[claims.TokenID]; ok && claims.TokenID != uuid.Nil {
+		return true
+	}
+	if revokedAt, ok := s.users[claims.UserID]; ok && issuedBefore(claims, revokedAt) {
+		return true
+	}
+	if revokedAt, ok := s.sessions[claims.SessionID]; ok && claims.SessionID != uuid.Nil && issuedBefore(claims, revokedAt) {
+		return true
+	}
+	return false
+}
+
+// Периодически подтягиваем отзывы других реплик, пока не отменён ctx
+func (s *RevocationService) Run(ctx context.Context) {
+	if err := s.Sync(ctx); err != nil {
+		s.log.Error("failed to sync revocations", "error", err)
+	}
+
+	ticker := time.NewTicker(s.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Sync(ctx); err != nil {
+				s.log.Error("failed to sync revocations", "error", err)
+			}
+		}
+	}
+}
+
+func (s *RevocationService) Sync(ctx context.Context) error {
+	s.mu.RLock()
+	since := s.synced.Add(-revocationSyncSkew)
+	s.mu.RUnlock()
+
+	now := time.Now()
+	revocations, err := s.repo.ListSince(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range revocations {
+		s.apply(r)
+	}
+	s.purge(now)
+	s.synced = now
+	return nil
+}
+
+/*
+iat токенов хранится с точностью до миллисекунды, поэтому время отзыва округляем вверх
+до следующей миллисекунды: токен, выданный в ту же миллисекунду, считается отозванным.
+Новый вход занимает намного дольше, так что токены, выданные после отзыва, под него не попадают.
+Такую точность сохраняют все хранилища, и после синхронизации время отзыва не сдвигается
+*/
+func (s *RevocationService) revoke(ctx context.Context, kind model.RevocationKind, subject uuid.UUID, expiresAt time.Time) error {
+	r := model.Revocation{
+		ID:        uuid.New(),
+		Kind:      kind,
+		Subject:   subject,
+		RevokedAt: time.Now().Truncate(time.Millisecond).Add(time.Millisecond),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.repo.Create(ctx, r); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.apply(r)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *RevocationService) apply(r model.Revocation) {
+	switch r.Kind {
+	case model.RevokeToken:
+		s.tokens[r.Subject] = r.ExpiresAt
+	case model.RevokeUser:
+		if r.RevokedAt.After(s.users[r.Subject]) {
+			s.users[r.Subject] = r.RevokedAt
+		}
+	case model.RevokeSession:
+		if r.RevokedAt.After(s.sessions[r.Subject]) {
+			s.sessions[r.Subject] = r.RevokedAt
+		}
+	}
+}
+
+// Удаляем записи, после которых все затронутые токены уже истекли
+func (s *RevocationService) purge(now time.Time) {
+	for id, expiresAt := range s.tokens {
+		if !expiresAt.After(now) {
+			delete(s.tokens, id)
+		}
+	}
+	for id, revokedAt := range s.users {
+		if !revokedAt.Add(s.accessTokenTTL).After(now) {
+			delete(s.users, id)
+		}
+	}
+	for id, revokedAt := range s.sessions {
+		if !revokedAt.Add(s.accessTokenTTL).After(now) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// Токен выпущен до отзыва, если его iat раньше времени отзыва
+func issuedBefore(claims *jwt.Claims, revokedAt time.Time) bool {
+	return claims.IssuedAt.Before(revokedAt)
+}
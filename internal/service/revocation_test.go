@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+/*
+Выход и новый вход в ту же секунду: first-party сессия сохраняет ID,
+но токен нового входа не должен считаться отозванным, ни локально, ни на другой реплике
+*/
+func TestRevokeSessionKeepsLaterTokens(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tokens := jwt.NewJWT("secret")
+	sessionID := uuid.New()
+
+	issue := func() *jwt.Claims {
+		t.Helper()
+		access, _, err := tokens.GenerateTokenPair(jwt.Subject{UserID: uuid.New(), SessionID: sessionID}, time.Hour, time.Hour)
+		if err != nil {
+			t.Fatalf("GenerateTokenPair: %v", err)
+		}
+		claims, err := tokens.ParseToken(access.Token)
+		if err != nil {
+			t.Fatalf("ParseToken: %v", err)
+		}
+		return claims
+	}
+
+	revocations := NewRevocationService(repo.Revocation, log, time.Hour, time.Minute)
+	before := issue()
+	if err := revocations.RevokeSession(ctx, sessionID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	after := issue()
+
+	replica := NewRevocationService(repo.Revocation, log, time.Hour, time.Minute)
+	if err := replica.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	for name, s := range map[string]*RevocationService{"local": revocations, "replica": replica} {
+		if !s.IsRevoked(before) {
+			t.Fatalf("%s: token issued before the revocation is not revoked", name)
+		}
+		if s.IsRevoked(after) {
+			t.Fatalf("%s: token issued after the revocation is revoked", name)
+		}
+	}
+}
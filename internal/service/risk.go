@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+)
+
+// Вес признаков риска, оценка - их сумма
+const (
+	riskWeightNewDevice     = 30
+	riskWeightNewNetwork    = 20
+	riskWeightIPVelocity    = 30
+	riskWeightUnusualHour   = 15
+	riskWeightNetworkChange = 40
+	// За каждую неудачную попытку перед входом, но не больше riskMaxFailedLogins
+	riskWeightFailedLogin = 10
+	riskMaxFailedLogins   = 3
+)
+
+const (
+	// Вход из другой сети, чем устройства, использованные за последний час
+	riskVelocityWindow = time.Hour
+
+	// Час входа сравниваем с последними входами, если их набралось достаточно
+	riskHourHistory    = 20
+	riskMinHourHistory = 5
+	riskHourTolerance  = 2
+)
+
+var ErrRiskDenied = errors.New("sign-in denied as too risky")
+
+/*
+Пороги оценки риска: с StepUpScore вход требует код из письма,
+а обновление токенов - повторного входа, с DenyScore отклоняется
+*/
+type RiskPolicy struct {
+	StepUpScore int
+	DenyScore   int
+}
+
+/*
+Новое устройство, сеть или час говорят только о том, что пользователь входит
+по-новому, поэтому их вклад ограничен StepUpScore: сами по себе они требуют
+подтверждения, а отклонить вход могут только вместе с неудачными попытками
+*/
+func (p RiskPolicy) decide(novelty, failed int) model.RiskDecision {
+	score := min(novelty, p.StepUpScore) + failed
+	switch {
+	case score >= p.DenyScore:
+		return model.RiskDeny
+	case score >= p.StepUpScore:
+		return model.RiskStepUp
+	default:
+		return model.RiskAllow
+	}
+}
+
+/*
+Оценка риска входа и обновления токенов по данным сервиса: известным устройствам
+пользователя, неудачным попыткам и журналу аудита. Внешние источники не используются
+*/
+type RiskService struct {
+	repo   repository.Repository
+	policy RiskPolicy
+}
+
+func NewRiskService(repo repository.Repository, policy RiskPolicy) *RiskService {
+	return &RiskService{
+		repo:   repo,
+		policy: policy,
+	}
+}
+
+/*
+Оцениваем вход с устройства device. failedLogins - неудачные попытки перед этим входом.
+Устройства и сети сравниваем, только если пользователь уже входил, иначе сравнивать не с чем
+*/
+func (s *RiskService) AssessLogin(ctx context.Context, user *model.User, failedLogins int, device model.Device) (*model.Risk, error) {
+	now := time.Now()
+	risk := &model.Risk{AssessedAt: now}
+
+	devices, err := s.repo.KnownDevice.ListByUserID(ctx, user.UUID)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) > 0 {
+		knownAgent, knownNetwork, recentNetwork := false, false, false
+		for _, d := range devices {
+			knownAgent = knownAgent || d.UserAgent == device.UserAgent
+			knownNetwork = knownNetwork || d.Network == device.Network
+			recentNetwork = recentNetwork || d.Network != device.Network && now.Sub(d.LastSeenAt) < riskVelocityWindow
+		}
+		if !knownAgent {
+			risk.Add(model.RiskNewDevice, riskWeightNewDevice)
+		}
+		if !knownNetwork {
+			risk.Add(model.RiskNewNetwork, riskWeightNewNetwork)
+		}
+		if recentNetwork {
+			risk.Add(model.RiskIPVelocity, riskWeightIPVelocity)
+		}
+	}
+
+	failed := riskWeightFailedLogin * min(failedLogins, riskMaxFailedLogins)
+	if failed > 0 {
+		risk.Add(model.RiskFailedLogins, failed)
+	}
+
+	unusual, err := s.unusualHour(ctx, user, now)
+	if err != nil {
+		return nil, err
+	}
+	if unusual {
+		risk.Add(model.RiskUnusualHour, riskWeightUnusualHour)
+	}
+
+	risk.Decision = s.policy.decide(risk.Score-failed, failed)
+	return risk, nil
+}
+
+/*
+Оцениваем обновление токенов сессии session с устройства device.
+Смена сети после входа подозрительна, а сеть, из которой пользователь не входил, - вдвойне
+*/
+func (s *RiskService) AssessRefresh(ctx context.Context, session *model.Session, device model.Device) (*model.Risk, error) {
+	risk := &model.Risk{AssessedAt: time.Now()}
+	if session.Device == nil || session.Device.Network == device.Network {
+		risk.Decision = s.policy.decide(risk.Score, 0)
+		return risk, nil
+	}
+	risk.Add(model.RiskNetworkChange, riskWeightNetworkChange)
+
+	known, err := s.repo.KnownDevice.ListByUserID(ctx, session.RefreshToken.UserID)
+	if err != nil {
+		return nil, err
+	}
+	knownNetwork := false
+	for _, d := range known {
+		knownNetwork = knownNetwork || d.Network == device.Network
+	}
+	if !knownNetwork {
+		risk.Add(model.RiskNewNetwork, riskWeightNewNetwork)
+	}
+
+	risk.Decision = s.policy.decide(risk.Score, 0)
+	return risk, nil
+}
+
+/*
+Час входа необычен, если ни один из последних удачных входов не был ближе
+riskHourTolerance часов к нему. Время сравниваем в UTC, часовой пояс пользователя неизвестен
+*/
+func (s *RiskService) unusualHour(ctx context.Context, user *model.User, now time.Time) (bool, error) {
+	var hours []int
+	for _, action := range []string{model.AuditLogin, model.AuditLoginVerify} {
+		events, err := s.repo.Audit.List(ctx, model.AuditFilter{UserID: user.UUID, Action: action, Limit: riskHourHistory})
+		if err != nil {
+			return false, err
+		}
+		for _, e := range events {
+			if e.Outcome == model.AuditSuccess {
+				hours = append(hours, e.Time.UTC().Hour())
+			}
+		}
+	}
+	if len(hours) < riskMinHourHistory {
+		return false, nil
+	}
+
+	current := now.UTC().Hour()
+	for _, hour := range hours {
+		diff := (current - hour + 24) % 24
+		if min(diff, 24-diff) <= riskHourTolerance {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Оценка риска в событии аудита входа или обновления токенов
+func addRiskDetails(event *model.AuditEvent, risk *model.Risk) {
+	if event.Details == nil {
+		event.Details = map[string]string{}
+	}
+	event.Details["risk_score"] = strconv.Itoa(risk.Score)
+	event.Details["risk_decision"] = string(risk.Decision)
+	if len(risk.Signals) > 0 {
+		event.Details["risk_signals"] = strings.Join(risk.Signals, " ")
+	}
+}
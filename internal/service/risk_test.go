@@ -0,0 +1,50 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/v7ktory/test/internal/model"
+)
+
+func TestRiskPolicyDecide(t *testing.T) {
+	policy := RiskPolicy{StepUpScore: 50, DenyScore: 80}
+
+	tests := []struct {
+		name    string
+		novelty int
+		failed  int
+		want    model.RiskDecision
+	}{
+		{name: "known device", want: model.RiskAllow},
+		{name: "new device", novelty: riskWeightNewDevice, want: model.RiskAllow},
+		{name: "new device and network", novelty: riskWeightNewDevice + riskWeightNewNetwork, want: model.RiskStepUp},
+		// Все признаки новизны вместе не отклоняют вход
+		{
+			name:    "all novelty signals",
+			novelty: riskWeightNewDevice + riskWeightNewNetwork + riskWeightIPVelocity + riskWeightUnusualHour,
+			want:    model.RiskStepUp,
+		},
+		{name: "network change on refresh", novelty: riskWeightNetworkChange + riskWeightNewNetwork, want: model.RiskStepUp},
+		{name: "failed logins only", failed: riskWeightFailedLogin * riskMaxFailedLogins, want: model.RiskAllow},
+		{name: "new device after a failed login", novelty: riskWeightNewDevice, failed: riskWeightFailedLogin, want: model.RiskAllow},
+		{
+			name:    "new device and network after a failed login",
+			novelty: riskWeightNewDevice + riskWeightNewNetwork,
+			failed:  riskWeightFailedLogin,
+			want:    model.RiskStepUp,
+		},
+		{
+			name:    "new device and network after failed logins",
+			novelty: riskWeightNewDevice + riskWeightNewNetwork,
+			failed:  riskWeightFailedLogin * riskMaxFailedLogins,
+			want:    model.RiskDeny,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.decide(tt.novelty, tt.failed); got != tt.want {
+				t.Fatalf("decide(%d, %d) = %s, want %s", tt.novelty, tt.failed, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/v7ktory/test/internal/model"
+)
+
+var ErrInvalidAudience = errors.New("token is issued for another audience")
+
+/*
+Какие scope и audience могут получить токены пользователя.
+Issuer входит в aud каждого токена, который принимает этот сервис:
+токены без aud и выпущенные для других сервисов он не принимает
+*/
+type TokenPolicy struct {
+	Issuer    string
+	Scopes    []string
+	Audiences []string
+}
+
+// Оставляем от запроса только разрешённое, без запрошенного scope выдаём все разрешённые
+func (p TokenPolicy) grant(req model.ScopeRequest) (string, []string) {
+	scope := strings.Join(p.Scopes, " ")
+	if req.Scope != "" {
+		scope = strings.Join(intersectScopes(strings.Fields(req.Scope), p.Scopes), " ")
+	}
+
+	var audience []string
+	for _, requested := range req.Audience {
+		if slices.Contains(p.Audiences, requested) {
+			audience = append(audience, requested)
+		}
+	}
+	return scope, p.audience(audience)
+}
+
+/*
+Scope, которые пользователь может доверить OAuth клиенту: OIDC и разрешённые
+ему самому. Остальные отбрасываем, иначе любой клиент получил бы, например, authz:check
+*/
+func (p TokenPolicy) delegate(scope string) string {
+	allowed := append([]string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopeOfflineAccess}, p.Scopes...)
+	return strings.Join(intersectScopes(strings.Fields(scope), allowed), " ")
+}
+
+// Issuer и уже проверенные audience без повторов
+func (p TokenPolicy) audience(requested []string) []string {
+	audience := []string{p.Issuer}
+	for _, aud := range requested {
+		if !slices.Contains(audience, aud) {
+			audience = append(audience, aud)
+		}
+	}
+	return audience
+}
+
+// Принимаем только токены, в aud которых есть issuer
+func (p TokenPolicy) accepts(audience []string) bool {
+	return slices.Contains(audience, p.Issuer)
+}
+
+func intersectScopes(requested, allowed []string) []string {
+	var scopes []string
+	for _, scope := range requested {
+		if slices.Contains(allowed, scope) && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// Все запрошенные scope должны входить в granted
+func containsScopes(granted, requested string) bool {
+	grantedScopes := strings.Fields(granted)
+	for _, scope := range strings.Fields(requested) {
+		if !slices.Contains(grantedScopes, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -10,20 +10,78 @@ import (
 	"github.com/v7ktory/test/internal/repository"
 	"github.com/v7ktory/test/pkg/hash"
 	"github.com/v7ktory/test/pkg/jwt"
+	"github.com/v7ktory/test/pkg/mailer"
+	"github.com/v7ktory/test/pkg/policy"
 )
 
 type Auth interface {
 	SignUp(ctx context.Context, user *model.User) (uuid.UUID, error)
-	Login(ctx context.Context, userID uuid.UUID, email, password string) (*model.AccessToken, *model.RefreshToken, error)
-	Refresh(ctx context.Context, userID uuid.UUID, accessTokenBearer, refreshTokenCookie string) (*model.AccessToken, *model.RefreshToken, error)
+	Login(ctx context.Context, userID uuid.UUID, email, password string, req model.ScopeRequest) (*model.AccessToken, *model.RefreshToken, error)
+	VerifyLogin(ctx context.Context, challenge, code string) (*model.AccessToken, *model.RefreshToken, error)
+	Refresh(ctx context.Context, userID uuid.UUID, accessTokenBearer, refreshTokenCookie string, req model.ScopeRequest) (*model.AccessToken, *model.RefreshToken, error)
+	Logout(ctx context.Context, claims *jwt.Claims) error
+	ChangePassword(ctx context.Context, email, password, newPassword string) error
+	PasswordReset(ctx context.Context, token string) (string, error)
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	ValidateAccessToken(ctx context.Context, accessToken string) (*jwt.Claims, error)
+}
+
+type OAuth interface {
+	AuthenticateClient(ctx context.Context, clientID, clientSecret string) (*model.Client, error)
+	Introspect(ctx context.Context, token, hint string) (*model.Introspection, error)
+	Revoke(ctx context.Context, client *model.Client, token, hint string) error
+	Authorize(ctx context.Context, claims *jwt.Claims, req model.AuthorizationRequest, decision string) (*AuthorizationResult, error)
+	Token(ctx context.Context, req model.TokenRequest) (*model.TokenResponse, error)
+	DeviceAuthorization(ctx context.Context, req model.TokenRequest) (*model.DeviceAuthorizationResponse, error)
+	DeviceVerification(ctx context.Context, userCode string) (*DeviceVerification, error)
+	VerifyDevice(ctx context.Context, claims *jwt.Claims, userCode, decision string) error
+	UserInfo(ctx context.Context, claims *jwt.Claims) (map[string]any, error)
+	Discovery() *model.OpenIDConfiguration
+	JWKS() jwt.JWKSet
 }
 
 type Service struct {
 	Auth
+	OAuth
+	Clients
+	Roles
+	Users
+	Authz
+	Audit
+	Webhooks
+	KnownDevices
+	Revocation        *RevocationService
+	AuditLog          *AuditService
+	WebhookDispatcher *WebhookService
+	Outbox            *OutboxService
+	Mail              *MailService
 }
 
-func NewService(repo repository.Repository, hash hash.Hasher, jwt jwt.JWT, log *slog.Logger, accessTokenTTL, refreshTokenTTL time.Duration) *Service {
+func NewService(repo repository.Repository, hash hash.Hasher, jwt jwt.JWT, idTokens *jwt.IDTokenSigner, log *slog.Logger, accessTokenTTL, refreshTokenTTL, revocationSyncInterval time.Duration, deviceVerificationURI, deviceReportURI, passwordResetURI, auditStream string, auditCheckpointInterval time.Duration, mailer mailer.Mailer, mailTemplates *mailer.Templates, policy TokenPolicy, riskPolicy RiskPolicy, authzPolicy *policy.Policy) *Service {
+	revocations := NewRevocationService(repo.Revocation, log, accessTokenTTL, revocationSyncInterval)
+	audit := NewAuditService(repo.Audit, idTokens, log, auditStream, auditCheckpointInterval)
+	webhooks := NewWebhookService(repo, log, audit)
+	// Аренду сообщений outbox различаем по реплике и запуску процесса
+	outbox := NewOutboxService(repo.Outbox, log, auditStream+"/"+uuid.NewString())
+	mail := NewMailService(repo.MailQueue, mailer, mailTemplates, log)
+	devices := NewKnownDeviceService(repo, jwt, log, revocations, audit, outbox, mail, deviceReportURI, passwordResetURI)
+	risk := NewRiskService(repo, riskPolicy)
 	return &Service{
-		Auth: NewAuthService(repo, hash, jwt, log, accessTokenTTL, refreshTokenTTL),
+		Auth:     NewAuthService(repo, hash, jwt, log, revocations, audit, outbox, mail, devices, risk, accessTokenTTL, refreshTokenTTL, policy),
+		OAuth:    NewOAuthService(repo, hash, jwt, idTokens, log, revocations, accessTokenTTL, refreshTokenTTL, policy, deviceVerificationURI),
+		Clients:  NewClientService(repo, log, audit),
+		Roles:    NewRoleService(repo, log, revocations, audit),
+		Users:    NewUserService(repo, hash, log, revocations, audit),
+		Authz:    NewAuthzService(repo, jwt, log, revocations, authzPolicy),
+		Audit:    audit,
+		Webhooks: webhooks,
+
+		KnownDevices: devices,
+
+		Revocation:        revocations,
+		AuditLog:          audit,
+		WebhookDispatcher: webhooks,
+		Outbox:            outbox,
+		Mail:              mail,
 	}
 }
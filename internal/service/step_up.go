@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/mail"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/pkg/mailer"
+)
+
+const (
+	// Код из письма действует 10 минут, неверный код считается неудачным входом
+	stepUpTTL        = 10 * time.Minute
+	stepUpCodeDigits = 6
+
+	stepUpPurpose     = "login-step-up"
+	stepUpCodePurpose = "login-step-up-code"
+)
+
+var (
+	ErrInvalidStepUp            = errors.New("invalid or expired login challenge")
+	ErrInvalidStepUpCode        = errors.New("invalid login code")
+	ErrReauthenticationRequired = errors.New("sign in again to continue")
+)
+
+/*
+Вход требует подтверждения кодом, отправленным на почту пользователя.
+Challenge вместе с кодом передаётся в VerifyLogin
+*/
+type StepUpRequiredError struct {
+	Challenge string
+	ExpiresAt time.Time
+}
+
+func (e *StepUpRequiredError) Error() string {
+	return "login code sent by email is required"
+}
+
+/*
+Незавершённый вход. Хранится у клиента, подписан ключом сервиса, а сам код - только
+в виде подписи. Вызов привязан к refresh токену сессии на момент входа: после
+любого входа или обновления токенов тот меняется, поэтому вызов одноразовый
+*/
+type stepUpChallenge struct {
+	UserID         uuid.UUID    `json:"user"`
+	SessionID      uuid.UUID    `json:"session"`
+	RefreshTokenID uuid.UUID    `json:"rt"`
+	Device         model.Device `json:"device"`
+	Risk           model.Risk   `json:"risk"`
+	Scope          string       `json:"scope,omitempty"`
+	Audience       []string     `json:"aud,omitempty"`
+	Nonce          string       `json:"nonce"`
+	Code           string       `json:"code"`
+	ExpiresAt      int64        `json:"exp"`
+}
+
+// Отправляем пользователю код и возвращаем вызов, которым клиент завершит вход
+func (s *AuthService) startStepUp(ctx context.Context, user *model.User, session *model.Session, device model.Device, risk model.Risk, req model.ScopeRequest) error {
+	code, err := generateLoginCode()
+	if err != nil {
+		return err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	challenge := stepUpChallenge{
+		UserID:         user.UUID,
+		SessionID:      session.ID,
+		RefreshTokenID: session.RefreshToken.ID,
+		Device:         device,
+		Risk:           risk,
+		Scope:          req.Scope,
+		Audience:       req.Audience,
+		Nonce:          nonce,
+		Code:           s.jwt.SignData(stepUpCodePurpose, []byte(nonce+"."+code)),
+		ExpiresAt:      now.Add(stepUpTTL).Unix(),
+	}
+
+	err = s.mail.Send(ctx, user.Email, mail.TemplateLoginCode, "", map[string]string{
+		"Email":  user.Email,
+		"Time":   mailTime(now),
+		"Code":   code,
+		"Device": device.UserAgent,
+		"IP":     auditMetaFrom(ctx).IP,
+	})
+	// Без письма подтвердить вход нечем
+	if errors.Is(err, mailer.ErrInvalidAddress) {
+		s.log.Warn("login code cannot be sent, login denied", "user_id", user.UUID, "error", err)
+		return ErrRiskDenied
+	}
+	if err != nil {
+		s.log.Error("failed to send login code", "user_id", user.UUID, "error", err)
+		return err
+	}
+
+	return &StepUpRequiredError{
+		Challenge: signToken(s.jwt, stepUpPurpose, challenge),
+		ExpiresAt: time.Unix(challenge.ExpiresAt, 0),
+	}
+}
+
+// Завершаем рискованный вход кодом из письма, токены получают acr подтверждения по почте
+func (s *AuthService) VerifyLogin(ctx context.Context, challenge, code string) (*model.AccessToken, *model.RefreshToken, error) {
+	event := model.AuditEvent{Action: model.AuditLoginVerify}
+	access, refresh, err := s.verifyLogin(ctx, &event, challenge, code)
+	if err == nil {
+		event.Actor = userActor(access.UserID)
+	}
+	s.audit.Record(ctx, &event, &err)
+	return access, refresh, err
+}
+
+func (s *AuthService) verifyLogin(ctx context.Context, event *model.AuditEvent, token, code string) (*model.AccessToken, *model.RefreshToken, error) {
+	var challenge stepUpChallenge
+	if !parseSignedToken(s.jwt, stepUpPurpose, token, &challenge) || time.Now().Unix() > challenge.ExpiresAt {
+		return nil, nil, ErrInvalidStepUp
+	}
+	event.Subject = userSubject(challenge.UserID)
+
+	user, err := s.repo.Auth.GetByID(ctx, challenge.UserID)
+	if err != nil {
+		s.log.Error("failed to get user", "user_id", challenge.UserID, "error", err)
+		return nil, nil, err
+	}
+	switch {
+	case user.IsLocked(time.Now()):
+		return nil, nil, ErrUserLocked
+	case user.Disabled:
+		return nil, nil, ErrUserDisabled
+	case user.PasswordResetRequired:
+		return nil, nil, ErrPasswordResetRequired
+	}
+
+	code = strings.TrimSpace(code)
+	if !s.jwt.VerifyData(stepUpCodePurpose, []byte(challenge.Nonce+"."+code), challenge.Code) {
+		s.log.Error("invalid login code", "user_id", user.UUID)
+		s.countFailedLogin(ctx, user)
+		return nil, nil, ErrInvalidStepUpCode
+	}
+
+	session, err := s.repo.Session.GetByUserID(ctx, user.UUID)
+	if err != nil {
+		s.log.Error("failed to get session", "error", err)
+		return nil, nil, err
+	}
+	if session.ID != challenge.SessionID || session.RefreshToken.ID != challenge.RefreshTokenID {
+		return nil, nil, ErrInvalidStepUp
+	}
+	if err := s.resetFailedLogins(ctx, user); err != nil {
+		return nil, nil, err
+	}
+
+	risk := challenge.Risk
+	risk.ACR = model.ACREmailCode
+	addRiskDetails(event, &risk)
+	req := model.ScopeRequest{Scope: challenge.Scope, Audience: challenge.Audience}
+	return s.completeLogin(ctx, user, session, challenge.Device, &risk, req)
+}
+
+func generateLoginCode() (string, error) {
+	max := big.NewInt(1)
+	for range stepUpCodeDigits {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", stepUpCodeDigits, n), nil
+}
@@ -0,0 +1,392 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/hash"
+)
+
+const (
+	defaultUsersPageSize = 50
+	maxUsersPageSize     = 200
+)
+
+var (
+	ErrInvalidPagination = errors.New("invalid pagination")
+	ErrInvalidEmail      = errors.New("invalid email")
+)
+
+type Users interface {
+	CreateUser(ctx context.Context, email, password string, roles []string) (uuid.UUID, error)
+	SetPassword(ctx context.Context, id uuid.UUID, password string, temporary bool) error
+	ListUsers(ctx context.Context, filter model.UserFilter) (*model.UserPage, error)
+	GetUser(ctx context.Context, id uuid.UUID) (*model.UserDetails, error)
+	SetUserDisabled(ctx context.Context, id uuid.UUID, disabled bool) error
+	UnlockUser(ctx context.Context, id uuid.UUID) error
+	RequirePasswordReset(ctx context.Context, id uuid.UUID) error
+	LogoutUser(ctx context.Context, id uuid.UUID) error
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+}
+
+// Управление пользователями из admin API
+type UserService struct {
+	repo        repository.Repository
+	hash        hash.Hasher
+	log         *slog.Logger
+	revocations *RevocationService
+	audit       *AuditService
+}
+
+func NewUserService(repo repository.Repository, hash hash.Hasher, log *slog.Logger, revocations *RevocationService, audit *AuditService) *UserService {
+	return &UserService{
+		repo:        repo,
+		hash:        hash,
+		log:         log,
+		revocations: revocations,
+		audit:       audit,
+	}
+}
+
+// Создаём пользователя и сразу назначаем ему роли, например для первого администратора
+func (s *UserService) CreateUser(ctx context.Context, email, password string, roles []string) (userID uuid.UUID, err error) {
+	event := model.AuditEvent{Action: model.AuditUserCreate, Details: map[string]string{"email": email, "roles": strings.Join(roles, ",")}}
+	defer s.audit.Record(ctx, &event, &err)
+
+	user := model.User{Email: email, Password: password}
+	if !model.IsEmailValid(email) {
+		return uuid.Nil, ErrInvalidEmail
+	}
+	if err := user.Validate(); err != nil {
+		return uuid.Nil, err
+	}
+	if len(roles) > maxUserRoles {
+		return uuid.Nil, ErrTooManyRoles
+	}
+
+	err = s.repo.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if userID, err = createUser(ctx, s.repo, s.hash, s.log, email, password); err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if _, err := s.repo.Role.GetByName(ctx, role); err != nil {
+				return err
+			}
+			if err := s.repo.Role.Assign(ctx, userID, role); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.log.Error("failed to create user", "error", err)
+		return uuid.Nil, err
+	}
+	event.Subject = userSubject(userID)
+
+	s.log.Info("user created by admin", "user_id", userID, "roles", roles)
+	return userID, nil
+}
+
+/*
+Задаём пароль за пользователя. Временный пароль подходит только для
+/auth/password: войти с ним нельзя, пока пользователь не сменит его сам
+*/
+func (s *UserService) SetPassword(ctx context.Context, id uuid.UUID, password string, temporary bool) (err error) {
+	event := model.AuditEvent{Action: model.AuditUserSetPassword, Subject: userSubject(id), Details: map[string]string{"temporary": strconv.FormatBool(temporary)}}
+	defer s.audit.Record(ctx, &event, &err)
+
+	if password == "" {
+		return model.ErrPasswordEmpty
+	}
+
+	hashedPassword, err := s.hash.Hash(password)
+	if err != nil {
+		s.log.Error("failed to hash password", "error", err)
+		return err
+	}
+
+	err = s.updateUser(ctx, id, func(user *model.User) {
+		user.Password = hashedPassword
+		user.PasswordResetRequired = temporary
+		user.FailedLogins = 0
+		user.LockedUntil = time.Time{}
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.logoutUser(ctx, id); err != nil {
+		return err
+	}
+
+	s.log.Info("password set by admin", "user_id", id, "temporary", temporary)
+	return nil
+}
+
+// Возвращаем страницу пользователей, по умолчанию по 50, не больше 200 за раз
+func (s *UserService) ListUsers(ctx context.Context, filter model.UserFilter) (*model.UserPage, error) {
+	if filter.Offset < 0 || filter.Limit < 0 {
+		return nil, ErrInvalidPagination
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultUsersPageSize
+	}
+	filter.Limit = min(filter.Limit, maxUsersPageSize)
+
+	total, err := s.repo.Auth.Count(ctx, filter)
+	if err != nil {
+		s.log.Error("failed to count users", "error", err)
+		return nil, err
+	}
+	users, err := s.repo.Auth.List(ctx, filter)
+	if err != nil {
+		s.log.Error("failed to list users", "error", err)
+		return nil, err
+	}
+
+	page := &model.UserPage{
+		Users:  make([]model.UserSummary, 0, len(users)),
+		Total:  total,
+		Offset: filter.Offset,
+		Limit:  filter.Limit,
+	}
+	now := time.Now()
+	for _, user := range users {
+		page.Users = append(page.Users, userSummary(user, now))
+	}
+	return page, nil
+}
+
+// Возвращаем пользователя с его ролями и сессиями
+func (s *UserService) GetUser(ctx context.Context, id uuid.UUID) (*model.UserDetails, error) {
+	user, err := s.repo.Auth.GetByID(ctx, id)
+	if err != nil {
+		s.log.Error("failed to get user", "error", err)
+		return nil, err
+	}
+
+	roles, err := s.repo.Role.ListUserRoles(ctx, id)
+	if err != nil {
+		s.log.Error("failed to list user roles", "error", err)
+		return nil, err
+	}
+
+	sessions, err := s.repo.Session.ListByUserID(ctx, id)
+	if err != nil {
+		s.log.Error("failed to list user sessions", "error", err)
+		return nil, err
+	}
+
+	now := time.Now()
+	details := &model.UserDetails{
+		UserSummary: userSummary(*user, now),
+		Roles:       roles,
+		Sessions:    make([]model.SessionInfo, 0, len(sessions)),
+	}
+	for _, session := range sessions {
+		details.Sessions = append(details.Sessions, sessionInfo(session, now))
+	}
+	return details, nil
+}
+
+// Отключаем или включаем пользователя, при отключении его сессии завершаются
+func (s *UserService) SetUserDisabled(ctx context.Context, id uuid.UUID, disabled bool) (err error) {
+	event := model.AuditEvent{Action: model.AuditUserEnable, Subject: userSubject(id)}
+	if disabled {
+		event.Action = model.AuditUserDisable
+	}
+	defer s.audit.Record(ctx, &event, &err)
+
+	err = s.updateUser(ctx, id, func(user *model.User) {
+		user.Disabled = disabled
+	})
+	if err != nil {
+		return err
+	}
+
+	if disabled {
+		if err := s.logoutUser(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	s.log.Info("user status changed", "user_id", id, "disabled", disabled)
+	return nil
+}
+
+// Снимаем блокировку после неудачных входов
+func (s *UserService) UnlockUser(ctx context.Context, id uuid.UUID) (err error) {
+	event := model.AuditEvent{Action: model.AuditUserUnlock, Subject: userSubject(id)}
+	defer s.audit.Record(ctx, &event, &err)
+
+	err = s.updateUser(ctx, id, func(user *model.User) {
+		user.FailedLogins = 0
+		user.LockedUntil = time.Time{}
+	})
+	if err != nil {
+		return err
+	}
+
+	s.log.Info("user unlocked", "user_id", id)
+	return nil
+}
+
+/*
+Требуем сменить пароль: вход будет отклоняться, пока пользователь
+не сменит пароль через /auth/password. Текущие сессии завершаются
+*/
+func (s *UserService) RequirePasswordReset(ctx context.Context, id uuid.UUID) (err error) {
+	event := model.AuditEvent{Action: model.AuditUserPasswordReset, Subject: userSubject(id)}
+	defer s.audit.Record(ctx, &event, &err)
+
+	err = s.updateUser(ctx, id, func(user *model.User) {
+		user.PasswordResetRequired = true
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.logoutUser(ctx, id); err != nil {
+		return err
+	}
+
+	s.log.Info("password reset required", "user_id", id)
+	return nil
+}
+
+// Завершаем все сессии пользователя и отзываем его токены
+func (s *UserService) LogoutUser(ctx context.Context, id uuid.UUID) (err error) {
+	event := model.AuditEvent{Action: model.AuditUserLogout, Subject: userSubject(id)}
+	defer s.audit.Record(ctx, &event, &err)
+
+	return s.logoutUser(ctx, id)
+}
+
+// Выход без отдельного события, для действий, которые пишут в аудит своё
+func (s *UserService) logoutUser(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.repo.Auth.GetByID(ctx, id); err != nil {
+		s.log.Error("failed to get user", "error", err)
+		return err
+	}
+
+	if err := endUserSessions(ctx, s.repo, s.revocations, id); err != nil {
+		s.log.Error("failed to end user sessions", "user_id", id, "error", err)
+		return err
+	}
+
+	s.log.Info("user logged out by admin", "user_id", id)
+	return nil
+}
+
+// Удаляем пользователя с сессиями и ролями, выданные токены отзываются
+func (s *UserService) DeleteUser(ctx context.Context, id uuid.UUID) (err error) {
+	event := model.AuditEvent{Action: model.AuditUserDelete, Subject: userSubject(id)}
+	defer s.audit.Record(ctx, &event, &err)
+
+	err = s.repo.WithinTransaction(ctx, func(ctx context.Context) error {
+		roles, err := s.repo.Role.ListUserRoles(ctx, id)
+		if err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if err := s.repo.Role.Unassign(ctx, id, role); err != nil {
+				return err
+			}
+		}
+		if err := s.repo.Session.DeleteByUserID(ctx, id); err != nil {
+			return err
+		}
+		if err := s.repo.KnownDevice.DeleteByUserID(ctx, id); err != nil {
+			return err
+		}
+		return s.repo.Auth.Delete(ctx, id)
+	})
+	if err != nil {
+		s.log.Error("failed to delete user", "user_id", id, "error", err)
+		return err
+	}
+
+	if err := s.revocations.RevokeUser(ctx, id); err != nil {
+		s.log.Error("failed to revoke user tokens", "user_id", id, "error", err)
+		return err
+	}
+
+	s.log.Info("user deleted", "user_id", id)
+	return nil
+}
+
+func (s *UserService) updateUser(ctx context.Context, id uuid.UUID, update func(user *model.User)) error {
+	err := s.repo.WithinTransaction(ctx, func(ctx context.Context) error {
+		user, err := s.repo.Auth.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		update(user)
+		return s.repo.Auth.Update(ctx, *user)
+	})
+	if err != nil {
+		s.log.Error("failed to update user", "user_id", id, "error", err)
+		return err
+	}
+	return nil
+}
+
+/*
+Отзываем все токены пользователя и сбрасываем refresh токены его сессий,
+чтобы их нельзя было обменять на новые
+*/
+func endUserSessions(ctx context.Context, repo repository.Repository, revocations *RevocationService, userID uuid.UUID) error {
+	sessions, err := repo.Session.ListByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.RefreshToken.Token == "" {
+			continue
+		}
+		session.RefreshToken = model.RefreshToken{UserID: userID}
+		// Сессия клиента могла истечь после ListByUserID
+		if err := repo.Session.Update(ctx, session); err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+			return err
+		}
+	}
+	return revocations.RevokeUser(ctx, userID)
+}
+
+func userSummary(user model.User, now time.Time) model.UserSummary {
+	summary := model.UserSummary{
+		UserID:                user.UUID,
+		Email:                 user.Email,
+		EmailVerified:         user.EmailVerified,
+		Disabled:              user.Disabled,
+		PasswordResetRequired: user.PasswordResetRequired,
+	}
+	if user.IsLocked(now) {
+		lockedUntil := user.LockedUntil
+		summary.LockedUntil = &lockedUntil
+	}
+	return summary
+}
+
+func sessionInfo(session model.Session, now time.Time) model.SessionInfo {
+	info := model.SessionInfo{
+		ID:       session.ID,
+		ClientID: session.ClientID,
+		Scope:    session.Scope,
+		Active:   session.RefreshToken.Token != "" && session.RefreshToken.ExpiresAt.After(now),
+		Device:   session.Device,
+		Risk:     session.Risk,
+	}
+	if info.Active {
+		expiresAt := session.RefreshToken.ExpiresAt
+		info.ExpiresAt = &expiresAt
+	}
+	return info
+}
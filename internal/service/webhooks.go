@@ -0,0 +1,446 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+)
+
+const (
+	webhookPollInterval = time.Second
+	webhookBatchSize    = 20
+	webhookTimeout      = 10 * time.Second
+
+	// Повторы через 30s, 1m, 2m ... но не реже раза в час, после webhookMaxAttempts доставка уходит в dead
+	webhookMaxAttempts = 10
+	webhookRetryBase   = 30 * time.Second
+	webhookRetryMax    = time.Hour
+
+	maxWebhookURLLength    = 2048
+	maxWebhookDescription  = 256
+	maxWebhookErrorLength  = 512
+	defaultWebhookPageSize = 50
+	maxWebhookPageSize     = 200
+)
+
+// Заголовки доставки, подпись считается от "timestamp.body"
+const (
+	WebhookIDHeader        = "X-Webhook-ID"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+var (
+	ErrInvalidWebhook          = errors.New("invalid webhook")
+	ErrWebhookDeliveryNotDead  = errors.New("only dead deliveries can be retried")
+	errWebhookInactive         = errors.New("webhook is inactive")
+	errWebhookUnexpectedStatus = errors.New("unexpected response status")
+)
+
+type Webhooks interface {
+	CreateWebhook(ctx context.Context, input model.WebhookInput) (*model.WebhookSecret, error)
+	ListWebhooks(ctx context.Context) ([]model.Webhook, error)
+	GetWebhook(ctx context.Context, id uuid.UUID) (*model.Webhook, error)
+	UpdateWebhook(ctx context.Context, id uuid.UUID, input model.WebhookInput) (*model.Webhook, error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+	RotateWebhookSecret(ctx context.Context, id uuid.UUID) (*model.WebhookSecret, error)
+	ListWebhookDeliveries(ctx context.Context, filter model.WebhookDeliveryFilter) (*model.WebhookDeliveryPage, error)
+	RetryWebhookDelivery(ctx context.Context, webhookID, deliveryID uuid.UUID) (*model.WebhookDelivery, error)
+}
+
+/*
+Webhooks: подписки управляются через admin API, события сервиса
+превращаются в доставки, которые фоновый цикл отправляет с повторами
+*/
+type WebhookService struct {
+	repo   repository.Repository
+	log    *slog.Logger
+	audit  *AuditService
+	client *http.Client
+	queue  *leasedQueue[model.WebhookDelivery]
+}
+
+func NewWebhookService(repo repository.Repository, log *slog.Logger, audit *AuditService) *WebhookService {
+	s := &WebhookService{
+		repo:  repo,
+		log:   log,
+		audit: audit,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+			// Редирект мог бы увести подписанное тело на чужой адрес
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+	s.queue = &leasedQueue[model.WebhookDelivery]{
+		name:      "webhooks",
+		interval:  webhookPollInterval,
+		timeout:   webhookTimeout,
+		batchSize: webhookBatchSize,
+		log:       log,
+		claim:     repo.Webhook.ClaimDeliveries,
+		process:   s.process,
+		update:    repo.Webhook.UpdateDelivery,
+	}
+	return s
+}
+
+// Создаём подписку, секрет для проверки подписи возвращается только здесь
+func (s *WebhookService) CreateWebhook(ctx context.Context, input model.WebhookInput) (_ *model.WebhookSecret, err error) {
+	event := model.AuditEvent{Action: model.AuditWebhookCreate, Details: map[string]string{"url": input.URL}}
+	defer s.audit.Record(ctx, &event, &err)
+
+	if err := validateWebhook(input); err != nil {
+		return nil, err
+	}
+	secret, err := randomToken()
+	if err != nil {
+		s.log.Error("failed to generate webhook secret", "error", err)
+		return nil, err
+	}
+
+	now := time.Now()
+	webhook := model.Webhook{
+		ID:          uuid.New(),
+		URL:         input.URL,
+		Events:      webhookEvents(input.Events),
+		Description: input.Description,
+		Active:      input.Active == nil || *input.Active,
+		Secret:      secret,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	event.Subject = webhookSubject(webhook.ID)
+	if err := s.repo.Webhook.Create(ctx, webhook); err != nil {
+		s.log.Error("failed to create webhook", "error", err)
+		return nil, err
+	}
+
+	s.log.Info("webhook created", "webhook_id", webhook.ID)
+	return &model.WebhookSecret{Webhook: webhook, Secret: secret}, nil
+}
+
+func (s *WebhookService) ListWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	webhooks, err := s.repo.Webhook.List(ctx)
+	if err != nil {
+		s.log.Error("failed to list webhooks", "error", err)
+		return nil, err
+	}
+	if webhooks == nil {
+		webhooks = []model.Webhook{}
+	}
+	return webhooks, nil
+}
+
+func (s *WebhookService) GetWebhook(ctx context.Context, id uuid.UUID) (*model.Webhook, error) {
+	return s.repo.Webhook.Get(ctx, id)
+}
+
+// Заменяем адрес, события и описание подписки, active можно не передавать
+func (s *WebhookService) UpdateWebhook(ctx context.Context, id uuid.UUID, input model.WebhookInput) (_ *model.Webhook, err error) {
+	event := model.AuditEvent{Action: model.AuditWebhookUpdate, Subject: webhookSubject(id), Details: map[string]string{"url": input.URL}}
+	defer s.audit.Record(ctx, &event, &err)
+
+	if err := validateWebhook(input); err != nil {
+		return nil, err
+	}
+	webhook, err := s.repo.Webhook.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.URL = input.URL
+	webhook.Events = webhookEvents(input.Events)
+	webhook.Description = input.Description
+	if input.Active != nil {
+		webhook.Active = *input.Active
+	}
+	webhook.UpdatedAt = time.Now()
+	if err := s.repo.Webhook.Update(ctx, *webhook); err != nil {
+		s.log.Error("failed to update webhook", "webhook_id", id, "error", err)
+		return nil, err
+	}
+
+	s.log.Info("webhook updated", "webhook_id", id)
+	return webhook, nil
+}
+
+// Удаляем подписку вместе с журналом доставок
+func (s *WebhookService) DeleteWebhook(ctx context.Context, id uuid.UUID) (err error) {
+	event := model.AuditEvent{Action: model.AuditWebhookDelete, Subject: webhookSubject(id)}
+	defer s.audit.Record(ctx, &event, &err)
+
+	err = s.repo.WithinTransaction(ctx, func(ctx context.Context) error {
+		return s.repo.Webhook.Delete(ctx, id)
+	})
+	if err != nil {
+		s.log.Error("failed to delete webhook", "webhook_id", id, "error", err)
+		return err
+	}
+
+	s.log.Info("webhook deleted", "webhook_id", id)
+	return nil
+}
+
+// Меняем секрет подписки, доставки с этого момента подписываются новым
+func (s *WebhookService) RotateWebhookSecret(ctx context.Context, id uuid.UUID) (_ *model.WebhookSecret, err error) {
+	event := model.AuditEvent{Action: model.AuditWebhookRotateSecret, Subject: webhookSubject(id)}
+	defer s.audit.Record(ctx, &event, &err)
+
+	webhook, err := s.repo.Webhook.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomToken()
+	if err != nil {
+		s.log.Error("failed to generate webhook secret", "error", err)
+		return nil, err
+	}
+
+	webhook.Secret = secret
+	webhook.UpdatedAt = time.Now()
+	if err := s.repo.Webhook.Update(ctx, *webhook); err != nil {
+		s.log.Error("failed to update webhook", "webhook_id", id, "error", err)
+		return nil, err
+	}
+
+	s.log.Info("webhook secret rotated", "webhook_id", id)
+	return &model.WebhookSecret{Webhook: *webhook, Secret: secret}, nil
+}
+
+// Журнал доставок подписки, по умолчанию по 50, не больше 200 за раз
+func (s *WebhookService) ListWebhookDeliveries(ctx context.Context, filter model.WebhookDeliveryFilter) (*model.WebhookDeliveryPage, error) {
+	if filter.Offset < 0 || filter.Limit < 0 {
+		return nil, ErrInvalidPagination
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultWebhookPageSize
+	}
+	filter.Limit = min(filter.Limit, maxWebhookPageSize)
+
+	if _, err := s.repo.Webhook.Get(ctx, filter.WebhookID); err != nil {
+		return nil, err
+	}
+	deliveries, err := s.repo.Webhook.ListDeliveries(ctx, filter)
+	if err != nil {
+		s.log.Error("failed to list webhook deliveries", "webhook_id", filter.WebhookID, "error", err)
+		return nil, err
+	}
+	if deliveries == nil {
+		deliveries = []model.WebhookDelivery{}
+	}
+	return &model.WebhookDeliveryPage{Deliveries: deliveries, Offset: filter.Offset, Limit: filter.Limit}, nil
+}
+
+// Возвращаем доставку из dead в очередь с новым набором попыток
+func (s *WebhookService) RetryWebhookDelivery(ctx context.Context, webhookID, deliveryID uuid.UUID) (_ *model.WebhookDelivery, err error) {
+	event := model.AuditEvent{
+		Action:  model.AuditWebhookRetryDelivery,
+		Subject: webhookSubject(webhookID),
+		Details: map[string]string{"delivery_id": deliveryID.String()},
+	}
+	defer s.audit.Record(ctx, &event, &err)
+
+	delivery, err := s.repo.Webhook.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.WebhookID != webhookID {
+		return nil, repository.ErrWebhookDeliveryNotFound
+	}
+	if delivery.Status != model.WebhookDeliveryDead {
+		return nil, ErrWebhookDeliveryNotDead
+	}
+
+	now := time.Now()
+	if err := s.repo.Webhook.RetryDelivery(ctx, deliveryID, now); err != nil {
+		s.log.Error("failed to retry webhook delivery", "delivery_id", deliveryID, "error", err)
+		return nil, err
+	}
+	delivery.Status = model.WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = now
+	return delivery, nil
+}
+
+/*
+Получатель событий outbox: ставим событие в очередь доставки всем активным
+подписчикам на его тип. Повторная передача того же события новых доставок не создаёт
+*/
+func (s *WebhookService) Publish(ctx context.Context, message model.OutboxMessage) error {
+	webhooks, err := s.repo.Webhook.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, webhook := range webhooks {
+		if !webhook.Active || !slices.Contains(webhook.Events, message.Type) {
+			continue
+		}
+		delivery := model.WebhookDelivery{
+			ID:            uuid.New(),
+			WebhookID:     webhook.ID,
+			EventID:       message.ID,
+			EventType:     message.Type,
+			Payload:       message.Payload,
+			Status:        model.WebhookDeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+		err := s.repo.Webhook.CreateDelivery(ctx, delivery)
+		if err != nil && !errors.Is(err, repository.ErrWebhookDeliveryExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Отправляем доставки по мере наступления их срока, пока не отменён ctx
+func (s *WebhookService) Run(ctx context.Context) {
+	s.queue.run(ctx)
+}
+
+func (s *WebhookService) process(ctx context.Context, deliveries []model.WebhookDelivery) error {
+	webhooks := make(map[uuid.UUID]*model.Webhook)
+	for _, delivery := range deliveries {
+		webhook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			var err error
+			if webhook, err = s.repo.Webhook.Get(ctx, delivery.WebhookID); err != nil && !errors.Is(err, repository.ErrWebhookNotFound) {
+				return err
+			}
+			webhooks[delivery.WebhookID] = webhook
+		}
+		// Подписку удалили вместе с доставками, пока доставка была в работе
+		if webhook == nil {
+			continue
+		}
+		s.deliver(ctx, webhook, delivery)
+	}
+	return nil
+}
+
+// Одна попытка доставки, её итог сохраняем в журнал
+func (s *WebhookService) deliver(ctx context.Context, webhook *model.Webhook, delivery model.WebhookDelivery) {
+	now := time.Now()
+	status, err := 0, errWebhookInactive
+	if webhook.Active {
+		status, err = s.send(ctx, webhook, delivery, now)
+	}
+
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = status
+	switch {
+	case err == nil:
+		delivery.Status = model.WebhookDeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.Error = ""
+	case !webhook.Active || delivery.Attempts >= webhookMaxAttempts:
+		delivery.Status = model.WebhookDeliveryDead
+		delivery.Error = err.Error()
+	default:
+		delivery.NextAttemptAt = now.Add(backoff(delivery.Attempts, webhookRetryBase, webhookRetryMax))
+		delivery.Error = err.Error()
+	}
+	if len(delivery.Error) > maxWebhookErrorLength {
+		delivery.Error = delivery.Error[:maxWebhookErrorLength]
+	}
+
+	if !s.queue.save(ctx, delivery.ID, delivery) {
+		return
+	}
+	if delivery.Status == model.WebhookDeliveryDead {
+		s.log.Warn("webhook delivery is dead", "webhook_id", webhook.ID, "delivery_id", delivery.ID, "error", delivery.Error)
+	}
+}
+
+// Отправляем подписанное тело, успехом считается любой ответ 2xx
+func (s *WebhookService) send(ctx context.Context, webhook *model.Webhook, delivery model.WebhookDelivery, now time.Time) (int, error) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, delivery.ID.String())
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "v1="+WebhookSignature(webhook.Secret, timestamp, []byte(delivery.Payload)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookErrorLength))
+		return resp.StatusCode, fmt.Errorf("%w %d: %s", errWebhookUnexpectedStatus, resp.StatusCode, bytes.TrimSpace(body))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookErrorLength))
+	return resp.StatusCode, nil
+}
+
+// Подпись доставки: hex(HMAC-SHA256(secret, timestamp + "." + body))
+func WebhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookSubject(id uuid.UUID) model.AuditSubject {
+	return model.AuditSubject{Type: model.AuditSubjectWebhook, ID: id.String()}
+}
+
+// Типы событий без повторов в порядке model.EventTypes
+func webhookEvents(events []string) []string {
+	var unique []string
+	for _, eventType := range model.EventTypes {
+		if slices.Contains(events, eventType) {
+			unique = append(unique, eventType)
+		}
+	}
+	return unique
+}
+
+func validateWebhook(input model.WebhookInput) error {
+	u, err := url.Parse(input.URL)
+	switch {
+	case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	case len(input.URL) > maxWebhookURLLength:
+		return fmt.Errorf("%w: url must be at most %d characters", ErrInvalidWebhook, maxWebhookURLLength)
+	case len(input.Description) > maxWebhookDescription:
+		return fmt.Errorf("%w: description must be at most %d characters", ErrInvalidWebhook, maxWebhookDescription)
+	case len(input.Events) == 0:
+		return fmt.Errorf("%w: events are required", ErrInvalidWebhook)
+	}
+	for _, eventType := range input.Events {
+		if !slices.Contains(model.EventTypes, eventType) {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, eventType)
+		}
+	}
+	return nil
+}
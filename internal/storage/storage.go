@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/v7ktory/test/internal/config"
+	"github.com/v7ktory/test/internal/migration"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/pkg/database/mongodb"
+	"github.com/v7ktory/test/pkg/database/postgres"
+	"github.com/v7ktory/test/pkg/database/redis"
+	"github.com/v7ktory/test/pkg/database/sqlite"
+	"github.com/v7ktory/test/pkg/migrate"
+)
+
+// Хранилище, выбранное через STORAGE_DRIVER
+type Storage struct {
+	Repository  *repository.Repository
+	Migrator    *migrate.Migrator
+	AutoMigrate bool
+
+	close func(ctx context.Context) error
+}
+
+func Open(ctx context.Context, cfg *config.Cfg) (*Storage, error) {
+	store, err := openStorage(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Storage.SessionDriver {
+	case "":
+		return store, nil
+	case config.SessionRedis:
+		if err := store.useRedisSessions(ctx, cfg.Redis); err != nil {
+			store.Close(ctx)
+			return nil, err
+		}
+		return store, nil
+	default:
+		store.Close(ctx)
+		return nil, fmt.Errorf("unknown session driver: %s", cfg.Storage.SessionDriver)
+	}
+}
+
+func (s *Storage) Close(ctx context.Context) error {
+	return s.close(ctx)
+}
+
+func openStorage(ctx context.Context, cfg *config.Cfg) (*Storage, error) {
+	switch cfg.Storage.Driver {
+	case config.StorageMongo:
+		return openMongo(ctx, cfg.Mongo)
+	case config.StoragePostgres:
+		return openPostgres(ctx, cfg.Postgres)
+	case config.StorageSQLite:
+		return openSQLite(ctx, cfg.SQLite)
+	case config.StorageMemory:
+		return openMemory()
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", cfg.Storage.Driver)
+	}
+}
+
+/*
+Переносим сессии в Redis.
+Redis не участвует в транзакциях основного хранилища, поэтому сессию
+всегда пишем последней: при её ошибке откатится только основное хранилище
+*/
+func (s *Storage) useRedisSessions(ctx context.Context, redisCfg config.RedisCfg) error {
+	provider, err := redis.NewRedis(ctx, redisCfg)
+	if err != nil {
+		return err
+	}
+
+	s.Repository.Session = repository.NewRedisSessionRepository(provider)
+
+	closeStorage := s.close
+	s.close = func(ctx context.Context) error {
+		return errors.Join(provider.Close(), closeStorage(ctx))
+	}
+	return nil
+}
+
+func openMongo(ctx context.Context, mongoCfg config.MongoCfg) (*Storage, error) {
+	provider, err := mongodb.NewMongoDB(ctx, mongoCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := migration.NewMongoMigrator(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Storage{
+		Repository:  repository.NewRepository(provider),
+		Migrator:    migrator,
+		AutoMigrate: mongoCfg.AutoMigrate,
+		close: func(ctx context.Context) error {
+			return provider.GetClient().Disconnect(ctx)
+		},
+	}, nil
+}
+
+func openPostgres(ctx context.Context, pgCfg config.PostgresCfg) (*Storage, error) {
+	provider, err := postgres.NewPostgres(ctx, pgCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := migration.NewPostgresMigrator(provider)
+	if err != nil {
+		provider.Close()
+		return nil, err
+	}
+
+	return &Storage{
+		Repository:  repository.NewPostgresRepository(provider),
+		Migrator:    migrator,
+		AutoMigrate: pgCfg.AutoMigrate,
+		close: func(context.Context) error {
+			return provider.Close()
+		},
+	}, nil
+}
+
+func openSQLite(ctx context.Context, sqliteCfg config.SQLiteCfg) (*Storage, error) {
+	provider, err := sqlite.NewSQLite(ctx, sqliteCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := migration.NewSQLiteMigrator(provider)
+	if err != nil {
+		provider.Close()
+		return nil, err
+	}
+
+	return &Storage{
+		Repository:  repository.NewSQLiteRepository(provider),
+		Migrator:    migrator,
+		AutoMigrate: sqliteCfg.AutoMigrate,
+		close: func(context.Context) error {
+			return provider.Close()
+		},
+	}, nil
+}
+
+func openMemory() (*Storage, error) {
+	migrator, err := migrate.NewMigrator(migrate.NewMemoryStore(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Storage{
+		Repository: repository.NewMemoryRepository(),
+		Migrator:   migrator,
+		close: func(context.Context) error {
+			return nil
+		},
+	}, nil
+}
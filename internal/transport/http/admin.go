@@ -0,0 +1,64 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/internal/service"
+)
+
+/*
+Регистрируем OAuth клиента.
+Секрет конфиденциального клиента возвращается только в этом ответе
+*/
+func (h *Handler) CreateClient(w http.ResponseWriter, r *http.Request) {
+	var input model.ClientRegistration
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		BadRequestErrorHandler(w, r)
+		return
+	}
+
+	credentials, err := h.Svc.CreateClient(r.Context(), input)
+	switch {
+	case errors.Is(err, service.ErrInvalidClientRegistration):
+		BadRequestMessageHandler(w, r, err.Error())
+		return
+	case errors.Is(err, repository.ErrClientExists):
+		ConflictErrorHandler(w, r)
+		return
+	case err != nil:
+		InternalServerErrorHandler(w, r)
+		return
+	}
+
+	writeCredentials(w, http.StatusCreated, credentials)
+}
+
+// Выдаём клиенту новый секрет, старый перестаёт действовать сразу
+func (h *Handler) RotateClientSecret(w http.ResponseWriter, r *http.Request) {
+	credentials, err := h.Svc.RotateClientSecret(r.Context(), mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, repository.ErrClientNotFound):
+		NotFoundErrorHandler(w, r)
+		return
+	case errors.Is(err, service.ErrClientHasNoSecret):
+		BadRequestMessageHandler(w, r, err.Error())
+		return
+	case err != nil:
+		InternalServerErrorHandler(w, r)
+		return
+	}
+
+	writeCredentials(w, http.StatusOK, credentials)
+}
+
+func writeCredentials(w http.ResponseWriter, status int, credentials *model.ClientCredentials) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(credentials)
+}
@@ -0,0 +1,63 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/service"
+)
+
+/*
+Журнал аудита. Параметры: user_id - события, где пользователь действовал
+или над ним действовали, action, from и to в RFC 3339, offset и limit
+*/
+func (h *Handler) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := model.AuditFilter{Action: query.Get("action")}
+
+	var err error
+	if v := query.Get("user_id"); v != "" {
+		if filter.UserID, err = uuid.Parse(v); err != nil {
+			BadRequestMessageHandler(w, r, "user_id must be a UUID")
+			return
+		}
+	}
+	if filter.From, err = timeParam(query.Get("from")); err != nil {
+		BadRequestMessageHandler(w, r, "from must be an RFC 3339 time")
+		return
+	}
+	if filter.To, err = timeParam(query.Get("to")); err != nil {
+		BadRequestMessageHandler(w, r, "to must be an RFC 3339 time")
+		return
+	}
+	if filter.Offset, err = intParam(query.Get("offset")); err != nil {
+		BadRequestMessageHandler(w, r, "offset must be a number")
+		return
+	}
+	if filter.Limit, err = intParam(query.Get("limit")); err != nil {
+		BadRequestMessageHandler(w, r, "limit must be a number")
+		return
+	}
+
+	page, err := h.Svc.ListAuditEvents(r.Context(), filter)
+	switch {
+	case errors.Is(err, service.ErrInvalidPagination):
+		BadRequestMessageHandler(w, r, "offset and limit must not be negative")
+	case errors.Is(err, service.ErrInvalidTimeRange):
+		BadRequestMessageHandler(w, r, "from must be before to")
+	case err != nil:
+		InternalServerErrorHandler(w, r)
+	default:
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+func timeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
@@ -2,11 +2,14 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/service"
 )
 
 /*
@@ -49,6 +52,12 @@ func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Тело запроса на вход: учётные данные и необязательные scope и audience токена
+type loginInput struct {
+	model.User
+	model.ScopeRequest
+}
+
 /*
 Достаем userID из параметров запроса, email и password из тела запроса.
 Передаем в сервисный слой и если всё ок создаем пару accessToken и refreshToken
@@ -66,29 +75,62 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var input model.User
+	var input loginInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		BadRequestErrorHandler(w, r)
 		return
 	}
 
-	if !model.IsEmailValid(input.Email) || input.Validate() != nil {
+	if !model.IsEmailValid(input.Email) || input.User.Validate() != nil {
 		BadRequestErrorHandler(w, r)
 		return
 	}
 
-	access, refresh, err := h.Svc.Login(r.Context(), userID, input.Email, input.Password)
+	access, refresh, err := h.Svc.Login(r.Context(), userID, input.Email, input.Password, input.ScopeRequest)
 	if err != nil {
+		loginErrorHandler(w, r, err)
+		return
+	}
+
+	writeLoginResponse(w, r, access, refresh)
+}
+
+// Тело запроса на завершение входа кодом из письма
+type verifyLoginInput struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// Завершаем вход, для которого Login вернул challenge, кодом из письма
+func (h *Handler) VerifyLogin(w http.ResponseWriter, r *http.Request) {
+	var input verifyLoginInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		BadRequestErrorHandler(w, r)
+		return
+	}
+	if input.Challenge == "" || input.Code == "" {
 		BadRequestErrorHandler(w, r)
 		return
 	}
 
+	access, refresh, err := h.Svc.VerifyLogin(r.Context(), input.Challenge, input.Code)
+	if err != nil {
+		loginErrorHandler(w, r, err)
+		return
+	}
+
+	writeLoginResponse(w, r, access, refresh)
+}
+
+func writeLoginResponse(w http.ResponseWriter, r *http.Request, access *model.AccessToken, refresh *model.RefreshToken) {
 	w.Header().Set("Authorization", "Bearer "+access.Token)
 	setRefreshTokenCookie(w, refresh.Token)
+	setOAuthSessionCookie(w, access.Token)
 
 	response := model.AccessToken{
 		ID:     access.ID,
 		UserID: access.UserID,
+		Scope:  access.Scope,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -99,7 +141,8 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 
 /*
 Достаем userID из параметров запроса, refreshToken из куки и accessToken из header.
-Передаем в сервисный слой и если всё ок обновляем пару
+Передаем в сервисный слой и если всё ок обновляем пару.
+Scope и audience нового токена можно запросить параметрами scope и audience
 */
 func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -123,17 +166,30 @@ func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	access, refresh, err := h.Svc.Refresh(r.Context(), uuid.MustParse(userID), accessToken, refreshCookie.Value)
-	if err != nil {
+	scopeRequest := model.ScopeRequest{
+		Scope:    r.URL.Query().Get("scope"),
+		Audience: r.URL.Query()["audience"],
+	}
+	access, refresh, err := h.Svc.Refresh(r.Context(), uuid.MustParse(userID), accessToken, refreshCookie.Value, scopeRequest)
+	switch {
+	case errors.Is(err, service.ErrReauthenticationRequired):
+		UnauthorizedMessageHandler(w, r, err.Error())
+		return
+	case errors.Is(err, service.ErrRiskDenied):
+		ForbiddenMessageHandler(w, r, err.Error())
+		return
+	case err != nil:
 		InternalServerErrorHandler(w, r)
 		return
 	}
 
 	setRefreshTokenCookie(w, refresh.Token)
+	setOAuthSessionCookie(w, access.Token)
 
 	response := model.AccessToken{
 		ID:     access.ID,
 		UserID: access.UserID,
+		Scope:  access.Scope,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -142,6 +198,134 @@ func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Тело запроса на смену пароля
+type changePasswordInput struct {
+	Email       string `json:"email"`
+	Password    string `json:"password"`
+	NewPassword string `json:"new_password"`
+}
+
+/*
+Меняем пароль по email и текущему паролю. Работает и когда вход
+отклоняется из-за требования сменить пароль
+*/
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var input changePasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		BadRequestErrorHandler(w, r)
+		return
+	}
+
+	if !model.IsEmailValid(input.Email) || input.Password == "" || input.NewPassword == "" {
+		BadRequestErrorHandler(w, r)
+		return
+	}
+
+	if err := h.Svc.ChangePassword(r.Context(), input.Email, input.Password, input.NewPassword); err != nil {
+		loginErrorHandler(w, r, err)
+		return
+	}
+
+	clearRefreshTokenCookie(w)
+	clearOAuthSessionCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type resetPasswordInput struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// Показываем, для какой учётной записи ссылка на сброс пароля, сама ссылка ничего не меняет
+func (h *Handler) PasswordReset(w http.ResponseWriter, r *http.Request) {
+	email, err := h.Svc.PasswordReset(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		passwordResetErrorHandler(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"email": email})
+}
+
+// Задаём новый пароль по ссылке из письма после сообщения о чужом входе
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input resetPasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" || input.NewPassword == "" {
+		BadRequestErrorHandler(w, r)
+		return
+	}
+
+	if err := h.Svc.ResetPassword(r.Context(), input.Token, input.NewPassword); err != nil {
+		passwordResetErrorHandler(w, r, err)
+		return
+	}
+
+	clearRefreshTokenCookie(w)
+	clearOAuthSessionCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func passwordResetErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, service.ErrInvalidPasswordReset) {
+		BadRequestMessageHandler(w, r, err.Error())
+		return
+	}
+	InternalServerErrorHandler(w, r)
+}
+
+// Ответ на вход, которому нужен код из письма
+type stepUpResponse struct {
+	Message   string    `json:"message"`
+	Challenge string    `json:"challenge"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+/*
+Отказ во входе из-за статуса пользователя или риска отдаём с причиной,
+на вход с кодом из письма - 401 с challenge, остальные ошибки - 400
+*/
+func loginErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	var stepUp *service.StepUpRequiredError
+	switch {
+	case errors.As(err, &stepUp):
+		writeJSON(w, http.StatusUnauthorized, stepUpResponse{
+			Message:   stepUp.Error(),
+			Challenge: stepUp.Challenge,
+			ExpiresAt: stepUp.ExpiresAt,
+		})
+	case errors.Is(err, service.ErrUserDisabled),
+		errors.Is(err, service.ErrUserLocked),
+		errors.Is(err, service.ErrPasswordResetRequired),
+		errors.Is(err, service.ErrRiskDenied):
+		ForbiddenMessageHandler(w, r, err.Error())
+	case errors.Is(err, service.ErrInvalidStepUp),
+		errors.Is(err, service.ErrInvalidStepUpCode):
+		BadRequestMessageHandler(w, r, err.Error())
+	default:
+		BadRequestErrorHandler(w, r)
+	}
+}
+
+/*
+Отзываем access токен из header Authorization и все токены сессии,
+refresh токен удаляем из куки
+*/
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	if err := h.Svc.Logout(r.Context(), claims); err != nil {
+		InternalServerErrorHandler(w, r)
+		return
+	}
+
+	// Кука хранит refresh токен first-party сессии, выход OAuth клиента её не касается
+	if claims.ClientID == "" {
+		clearRefreshTokenCookie(w)
+		clearOAuthSessionCookie(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // Устанавливаем refresh token в httpOnly куку
 func setRefreshTokenCookie(w http.ResponseWriter, refreshToken string) {
 	cookie := http.Cookie{
@@ -157,6 +341,53 @@ func setRefreshTokenCookie(w http.ResponseWriter, refreshToken string) {
 	http.SetCookie(w, &cookie)
 }
 
+// Удаляем куку с refresh token
+func clearRefreshTokenCookie(w http.ResponseWriter) {
+	cookie := http.Cookie{
+		Name:     "refresh_token",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+		Domain:   "localhost",
+		Path:     "/auth",
+		MaxAge:   -1,
+	}
+	http.SetCookie(w, &cookie)
+}
+
+const oauthSessionCookie = "oauth_session"
+
+/*
+Копия access токена для /oauth/authorize и /oauth/device, куда браузер приходит переходом
+от клиента. Lax отправляет её при переходе с другого сайта, но не с его POST,
+поэтому согласие и подтверждение устройства с чужой страницы отправить нельзя
+*/
+func setOAuthSessionCookie(w http.ResponseWriter, accessToken string) {
+	cookie := http.Cookie{
+		Name:     oauthSessionCookie,
+		Value:    accessToken,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		Domain:   "localhost",
+		Path:     "/oauth",
+	}
+	http.SetCookie(w, &cookie)
+}
+
+func clearOAuthSessionCookie(w http.ResponseWriter) {
+	cookie := http.Cookie{
+		Name:     oauthSessionCookie,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		Domain:   "localhost",
+		Path:     "/oauth",
+		MaxAge:   -1,
+	}
+	http.SetCookie(w, &cookie)
+}
+
 // Извлекаем access token из header Authorization
 func extractAccessToken(r *http.Request) string {
 	authHeader := r.Header.Get("Authorization")
@@ -0,0 +1,34 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/service"
+)
+
+// Решение авторизации для другого сервиса, отказ - тоже ответ 200
+func (h *Handler) CheckAccess(w http.ResponseWriter, r *http.Request) {
+	var input model.AuthzCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		BadRequestErrorHandler(w, r)
+		return
+	}
+
+	decision, err := h.Svc.CheckAccess(r.Context(), claimsFromContext(r.Context()), input)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidAuthzRequest):
+			BadRequestMessageHandler(w, r, "action is required")
+		case errors.Is(err, service.ErrInvalidSubjectToken):
+			BadRequestMessageHandler(w, r, err.Error())
+		default:
+			InternalServerErrorHandler(w, r)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, decision)
+}
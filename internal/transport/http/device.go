@@ -0,0 +1,79 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/v7ktory/test/internal/service"
+)
+
+// Экран подтверждения устройства
+type DeviceVerificationResponse struct {
+	UserCode string `json:"user_code"`
+	ConsentResponse
+}
+
+// Выдаём device_code и user_code устройству без браузера (RFC 8628)
+func (h *Handler) DeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	response, err := h.Svc.DeviceAuthorization(r.Context(), tokenRequest(r))
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	writeOAuthJSON(w, response)
+}
+
+// Показываем, какой клиент и какие scope запрашивает устройство
+func (h *Handler) DeviceVerification(w http.ResponseWriter, r *http.Request) {
+	if claimsFromContext(r.Context()).ClientID != "" {
+		UnauthorizedErrorHandler(w, r)
+		return
+	}
+
+	verification, err := h.Svc.DeviceVerification(r.Context(), r.URL.Query().Get("user_code"))
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	writeOAuthJSON(w, DeviceVerificationResponse{
+		UserCode: verification.UserCode,
+		ConsentResponse: ConsentResponse{
+			ClientID:   verification.Client.ID,
+			ClientName: verification.Client.Name,
+			Scopes:     verification.Scopes,
+		},
+	})
+}
+
+// Пользователь подтверждает устройство: user_code и consent=allow|deny
+func (h *Handler) VerifyDevice(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if claims.ClientID != "" {
+		UnauthorizedErrorHandler(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	decision := r.PostForm.Get("consent")
+	if decision != service.ConsentAllow && decision != service.ConsentDeny {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "consent must be allow or deny")
+		return
+	}
+
+	if err := h.Svc.VerifyDevice(r.Context(), claims, r.PostForm.Get("user_code"), decision); err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -26,3 +26,42 @@ func BadRequestErrorHandler(w http.ResponseWriter, r *http.Request) {
 	response := ErrorResponse{Message: "Bad Request"}
 	json.NewEncoder(w).Encode(response)
 }
+
+func UnauthorizedErrorHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusUnauthorized)
+	response := ErrorResponse{Message: "Unauthorized"}
+	json.NewEncoder(w).Encode(response)
+}
+
+func ForbiddenErrorHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusForbidden)
+	response := ErrorResponse{Message: "Forbidden"}
+	json.NewEncoder(w).Encode(response)
+}
+
+func ConflictErrorHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusConflict)
+	response := ErrorResponse{Message: "Conflict"}
+	json.NewEncoder(w).Encode(response)
+}
+
+// Ошибка валидации с пояснением для вызывающего
+func BadRequestMessageHandler(w http.ResponseWriter, r *http.Request, message string) {
+	w.WriteHeader(http.StatusBadRequest)
+	response := ErrorResponse{Message: message}
+	json.NewEncoder(w).Encode(response)
+}
+
+// Требуется аутентификация, с пояснением, что сделать дальше
+func UnauthorizedMessageHandler(w http.ResponseWriter, r *http.Request, message string) {
+	w.WriteHeader(http.StatusUnauthorized)
+	response := ErrorResponse{Message: message}
+	json.NewEncoder(w).Encode(response)
+}
+
+// Отказ с причиной, которую вызывающий может показать пользователю
+func ForbiddenMessageHandler(w http.ResponseWriter, r *http.Request, message string) {
+	w.WriteHeader(http.StatusForbidden)
+	response := ErrorResponse{Message: message}
+	json.NewEncoder(w).Encode(response)
+}
@@ -2,19 +2,30 @@ package http
 
 import (
 	"net/http"
+	"net/netip"
 
 	"github.com/gorilla/mux"
 	"github.com/v7ktory/test/internal/service"
+	"github.com/v7ktory/test/pkg/hash"
 )
 
 type Handler struct {
 	Svc service.Service
+	// Хэш токена admin API, пустой если вход в admin API только по ролям
+	adminTokenHash string
+	// Прокси, которым верим X-Forwarded-For и Forwarded
+	trustedProxies []netip.Prefix
 }
 
-func NewHandler(svc service.Service) *Handler {
-	return &Handler{
-		Svc: svc,
+func NewHandler(svc service.Service, adminToken string, trustedProxies []netip.Prefix) *Handler {
+	h := &Handler{
+		Svc:            svc,
+		trustedProxies: trustedProxies,
 	}
+	if adminToken != "" {
+		h.adminTokenHash = hash.HashSecret(adminToken)
+	}
+	return h
 }
 
 func (h *Handler) InitRoutes() http.Handler {
@@ -23,7 +34,62 @@ func (h *Handler) InitRoutes() http.Handler {
 
 	r.HandleFunc("/auth/signup", h.SignUp).Methods("POST")
 	r.HandleFunc("/auth/login", h.Login).Methods("POST")
+	r.HandleFunc("/auth/login/verify", h.VerifyLogin).Methods("POST")
 	r.HandleFunc("/auth/refresh", h.Refresh).Methods("POST")
+	r.Handle("/auth/logout", h.authenticate(http.HandlerFunc(h.Logout))).Methods("POST")
+	r.HandleFunc("/auth/password", h.ChangePassword).Methods("POST")
+	r.HandleFunc("/auth/password/reset", h.PasswordReset).Methods("GET")
+	r.HandleFunc("/auth/password/reset", h.ResetPassword).Methods("POST")
+	r.Handle("/auth/devices", h.authenticate(http.HandlerFunc(h.ListDevices))).Methods("GET")
+	r.Handle("/auth/devices/{id}", h.authenticate(http.HandlerFunc(h.ForgetDevice))).Methods("DELETE")
+	r.HandleFunc("/auth/devices/report", h.DeviceReport).Methods("GET")
+	r.HandleFunc("/auth/devices/report", h.ReportDevice).Methods("POST")
+
+	r.Handle("/oauth/authorize", h.authenticateBrowser(http.HandlerFunc(h.Authorize))).Methods("GET", "POST")
+	r.HandleFunc("/oauth/token", h.Token).Methods("POST")
+	r.HandleFunc("/oauth/device_authorization", h.DeviceAuthorization).Methods("POST")
+	r.Handle("/oauth/device", h.authenticateBrowser(http.HandlerFunc(h.DeviceVerification))).Methods("GET")
+	r.Handle("/oauth/device", h.authenticateBrowser(http.HandlerFunc(h.VerifyDevice))).Methods("POST")
+	r.HandleFunc("/oauth/revoke", h.Revoke).Methods("POST")
+	r.HandleFunc("/oauth/introspect", h.Introspect).Methods("POST")
+
+	r.HandleFunc("/.well-known/openid-configuration", h.Discovery).Methods("GET")
+	r.HandleFunc("/.well-known/jwks.json", h.JWKS).Methods("GET")
+	r.Handle("/userinfo", h.authenticate(http.HandlerFunc(h.UserInfo))).Methods("GET", "POST")
+
+	r.Handle("/authz/check", h.authenticate(RequireScope(service.ScopeAuthzCheck)(http.HandlerFunc(h.CheckAccess)))).Methods("POST")
+
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Handle("/clients", h.requireAdmin(service.PermissionClientsManage, h.CreateClient)).Methods("POST")
+	admin.Handle("/clients/{id}/secret", h.requireAdmin(service.PermissionClientsManage, h.RotateClientSecret)).Methods("POST")
+
+	admin.Handle("/roles", h.requireAdmin(service.PermissionRolesManage, h.ListRoles)).Methods("GET")
+	admin.Handle("/roles", h.requireAdmin(service.PermissionRolesManage, h.CreateRole)).Methods("POST")
+	admin.Handle("/roles/{name}", h.requireAdmin(service.PermissionRolesManage, h.UpdateRole)).Methods("PUT")
+	admin.Handle("/roles/{name}", h.requireAdmin(service.PermissionRolesManage, h.DeleteRole)).Methods("DELETE")
+	admin.Handle("/users", h.requireAdmin(service.PermissionUsersManage, h.ListUsers)).Methods("GET")
+	admin.Handle("/users/{id}", h.requireAdmin(service.PermissionUsersManage, h.GetUser)).Methods("GET")
+	admin.Handle("/users/{id}", h.requireAdmin(service.PermissionUsersManage, h.DeleteUser)).Methods("DELETE")
+	admin.Handle("/users/{id}/disable", h.requireAdmin(service.PermissionUsersManage, h.DisableUser)).Methods("POST")
+	admin.Handle("/users/{id}/enable", h.requireAdmin(service.PermissionUsersManage, h.EnableUser)).Methods("POST")
+	admin.Handle("/users/{id}/unlock", h.requireAdmin(service.PermissionUsersManage, h.UnlockUser)).Methods("POST")
+	admin.Handle("/users/{id}/password-reset", h.requireAdmin(service.PermissionUsersManage, h.RequirePasswordReset)).Methods("POST")
+	admin.Handle("/users/{id}/logout", h.requireAdmin(service.PermissionUsersManage, h.LogoutUser)).Methods("POST")
+
+	admin.Handle("/audit", h.requireAdmin(service.PermissionAuditRead, h.ListAuditEvents)).Methods("GET")
+
+	admin.Handle("/webhooks", h.requireAdmin(service.PermissionWebhooksManage, h.ListWebhooks)).Methods("GET")
+	admin.Handle("/webhooks", h.requireAdmin(service.PermissionWebhooksManage, h.CreateWebhook)).Methods("POST")
+	admin.Handle("/webhooks/{id}", h.requireAdmin(service.PermissionWebhooksManage, h.GetWebhook)).Methods("GET")
+	admin.Handle("/webhooks/{id}", h.requireAdmin(service.PermissionWebhooksManage, h.UpdateWebhook)).Methods("PUT")
+	admin.Handle("/webhooks/{id}", h.requireAdmin(service.PermissionWebhooksManage, h.DeleteWebhook)).Methods("DELETE")
+	admin.Handle("/webhooks/{id}/secret", h.requireAdmin(service.PermissionWebhooksManage, h.RotateWebhookSecret)).Methods("POST")
+	admin.Handle("/webhooks/{id}/deliveries", h.requireAdmin(service.PermissionWebhooksManage, h.ListWebhookDeliveries)).Methods("GET")
+	admin.Handle("/webhooks/{id}/deliveries/{delivery_id}/retry", h.requireAdmin(service.PermissionWebhooksManage, h.RetryWebhookDelivery)).Methods("POST")
+
+	admin.Handle("/users/{id}/roles", h.requireAdmin(service.PermissionRolesManage, h.UserRoles)).Methods("GET")
+	admin.Handle("/users/{id}/roles/{name}", h.requireAdmin(service.PermissionRolesManage, h.AssignRole)).Methods("PUT")
+	admin.Handle("/users/{id}/roles/{name}", h.requireAdmin(service.PermissionRolesManage, h.UnassignRole)).Methods("DELETE")
 
-	return r
+	return h.auditMeta(mailLocale(r))
 }
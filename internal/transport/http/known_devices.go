@@ -0,0 +1,82 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/internal/service"
+)
+
+// Устройства, с которых пользователь входил, только для first-party токена
+func (h *Handler) ListDevices(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if claims.ClientID != "" {
+		UnauthorizedErrorHandler(w, r)
+		return
+	}
+
+	devices, err := h.Svc.ListDevices(r.Context(), claims)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, devices)
+}
+
+func (h *Handler) ForgetDevice(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if claims.ClientID != "" {
+		UnauthorizedErrorHandler(w, r)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		NotFoundErrorHandler(w, r)
+		return
+	}
+
+	err = h.Svc.ForgetDevice(r.Context(), claims, id)
+	if errors.Is(err, repository.ErrKnownDeviceNotFound) {
+		NotFoundErrorHandler(w, r)
+		return
+	}
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Показываем устройство из ссылки "это был не я", сама ссылка ничего не меняет
+func (h *Handler) DeviceReport(w http.ResponseWriter, r *http.Request) {
+	device, err := h.Svc.DeviceReport(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		deviceReportErrorHandler(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, device)
+}
+
+// Подтверждаем, что вход был чужой: token в query или в форме
+func (h *Handler) ReportDevice(w http.ResponseWriter, r *http.Request) {
+	if err := h.Svc.ReportDevice(r.Context(), r.FormValue("token")); err != nil {
+		deviceReportErrorHandler(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func deviceReportErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, service.ErrInvalidDeviceReport) {
+		BadRequestMessageHandler(w, r, err.Error())
+		return
+	}
+	InternalServerErrorHandler(w, r)
+}
@@ -0,0 +1,182 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/service"
+	"github.com/v7ktory/test/pkg/hash"
+	"github.com/v7ktory/test/pkg/jwt"
+)
+
+type claimsKey struct{}
+
+// Заголовок с id запроса, по нему событие аудита связывается с логами прокси и клиента
+const requestIDHeader = "X-Request-ID"
+
+/*
+Кладём в контекст данные запроса для журнала аудита: IP, User-Agent и id запроса.
+Id берём из X-Request-ID, если его прислали, иначе генерируем и возвращаем в ответе
+*/
+func (h *Handler) auditMeta(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		ctx := service.WithAuditMeta(r.Context(), service.AuditMeta{
+			IP:        h.clientIP(r),
+			UserAgent: r.UserAgent(),
+			RequestID: requestID,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Письма, отправленные при обработке запроса, пишем на первом языке из Accept-Language
+func mailLocale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale, _, _ := strings.Cut(r.Header.Get("Accept-Language"), ",")
+		locale, _, _ = strings.Cut(locale, ";")
+		if locale = strings.TrimSpace(locale); locale != "" && locale != "*" {
+			r = r.WithContext(service.WithMailLocale(r.Context(), locale))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Пропускаем запрос дальше только с валидным и не отозванным access токеном
+func (h *Handler) authenticate(next http.Handler) http.Handler {
+	return h.authenticateWith(extractAccessToken, next)
+}
+
+/*
+То же для страниц, куда браузер попадает переходом от клиента и не может передать
+заголовок Authorization: access токен берётся и из куки oauth_session
+*/
+func (h *Handler) authenticateBrowser(next http.Handler) http.Handler {
+	return h.authenticateWith(func(r *http.Request) string {
+		if token := extractAccessToken(r); token != "" {
+			return token
+		}
+		if cookie, err := r.Cookie(oauthSessionCookie); err == nil {
+			return cookie.Value
+		}
+		return ""
+	}, next)
+}
+
+func (h *Handler) authenticateWith(extract func(r *http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessToken := extract(r)
+		if accessToken == "" {
+			UnauthorizedErrorHandler(w, r)
+			return
+		}
+
+		claims, err := h.Svc.ValidateAccessToken(r.Context(), accessToken)
+		if err != nil {
+			UnauthorizedErrorHandler(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), claimsKey{}, claims)
+		ctx = service.WithAuditActor(ctx, service.TokenActor(claims))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+/*
+Пропускаем запрос, только если токену выданы все перечисленные scope.
+Ставится после authenticate, иначе токена в контексте нет
+*/
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := claimsFromContext(r.Context())
+			if claims == nil {
+				UnauthorizedErrorHandler(w, r)
+				return
+			}
+
+			granted := strings.Fields(claims.Scope)
+			for _, scope := range scopes {
+				if !slices.Contains(granted, scope) {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(scopes, " ")))
+					ForbiddenErrorHandler(w, r)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+/*
+Пропускаем запрос, только если роли из токена дают разрешение.
+Ставится после authenticate, иначе токена в контексте нет
+*/
+func (h *Handler) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := claimsFromContext(r.Context())
+			if claims == nil {
+				UnauthorizedErrorHandler(w, r)
+				return
+			}
+
+			allowed, err := h.Svc.HasPermission(r.Context(), claims, permission)
+			if err != nil {
+				InternalServerErrorHandler(w, r)
+				return
+			}
+			if !allowed {
+				ForbiddenErrorHandler(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+/*
+Пропускаем в admin API с токеном из ADMIN_API_TOKEN
+или с токеном пользователя, роли которого дают разрешение
+*/
+func (h *Handler) requireAdmin(permission string, next http.HandlerFunc) http.Handler {
+	withPermission := h.authenticate(h.RequirePermission(permission)(next))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := extractAccessToken(r)
+		if h.adminTokenHash != "" && token != "" && hash.CompareSecret(token, h.adminTokenHash) {
+			ctx := service.WithAuditActor(r.Context(), model.AuditActor{Type: model.AuditActorAdminToken})
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		withPermission.ServeHTTP(w, r)
+	})
+}
+
+// Возвращаем данные токена, сохранённые middleware authenticate
+func claimsFromContext(ctx context.Context) *jwt.Claims {
+	claims, _ := ctx.Value(claimsKey{}).(*jwt.Claims)
+	return claims
+}
@@ -0,0 +1,223 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/service"
+)
+
+// Ответ, когда пользователю нужно показать экран согласия
+type ConsentResponse struct {
+	ClientID   string   `json:"client_id"`
+	ClientName string   `json:"client_name"`
+	Scopes     []string `json:"scopes"`
+}
+
+// Ошибка в формате OAuth 2.0 (RFC 6749, раздел 5.2)
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+/*
+Отзываем access или refresh токен (RFC 7009).
+Клиент аутентифицируется через Basic или client_id/client_secret в теле запроса
+и может отозвать только выданные ему токены
+*/
+func (h *Handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	if err := h.Svc.Revoke(r.Context(), client, token, r.PostForm.Get("token_type_hint")); err != nil {
+		oauthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Возвращаем состояние токена (RFC 7662)
+func (h *Handler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authenticateClient(w, r); !ok {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	result, err := h.Svc.Introspect(r.Context(), token, r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		return
+	}
+
+	writeOAuthJSON(w, result)
+}
+
+/*
+Выдаём код авторизации (authorization code + PKCE).
+Пользователь должен быть авторизован first-party access токеном.
+GET проверяет согласие, POST с consent=allow|deny фиксирует решение пользователя
+*/
+func (h *Handler) Authorize(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if claims.ClientID != "" {
+		UnauthorizedErrorHandler(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "malformed request")
+		return
+	}
+
+	req := model.AuthorizationRequest{
+		ResponseType:        r.Form.Get("response_type"),
+		ClientID:            r.Form.Get("client_id"),
+		RedirectURI:         r.Form.Get("redirect_uri"),
+		Scope:               r.Form.Get("scope"),
+		State:               r.Form.Get("state"),
+		Nonce:               r.Form.Get("nonce"),
+		CodeChallenge:       r.Form.Get("code_challenge"),
+		CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+	}
+
+	var decision string
+	if r.Method == http.MethodPost {
+		decision = r.PostForm.Get("consent")
+		if decision != service.ConsentAllow && decision != service.ConsentDeny {
+			oauthError(w, http.StatusBadRequest, "invalid_request", "consent must be allow or deny")
+			return
+		}
+	}
+
+	result, err := h.Svc.Authorize(r.Context(), claims, req, decision)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	if result.ConsentRequired {
+		writeOAuthJSON(w, ConsentResponse{
+			ClientID:   result.Client.ID,
+			ClientName: result.Client.Name,
+			Scopes:     result.Scopes,
+		})
+		return
+	}
+
+	http.Redirect(w, r, result.RedirectURI, http.StatusFound)
+}
+
+// Выдаём токены по коду авторизации, refresh токену или учётным данным клиента
+func (h *Handler) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	response, err := h.Svc.Token(r.Context(), tokenRequest(r))
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	writeOAuthJSON(w, response)
+}
+
+// Параметры /oauth/token из разобранной формы, Basic имеет приоритет над client_id в теле
+func tokenRequest(r *http.Request) model.TokenRequest {
+	req := model.TokenRequest{
+		GrantType:           r.PostForm.Get("grant_type"),
+		ClientID:            r.PostForm.Get("client_id"),
+		ClientSecret:        r.PostForm.Get("client_secret"),
+		ClientAssertionType: r.PostForm.Get("client_assertion_type"),
+		ClientAssertion:     r.PostForm.Get("client_assertion"),
+		Code:                r.PostForm.Get("code"),
+		RedirectURI:         r.PostForm.Get("redirect_uri"),
+		CodeVerifier:        r.PostForm.Get("code_verifier"),
+		RefreshToken:        r.PostForm.Get("refresh_token"),
+		DeviceCode:          r.PostForm.Get("device_code"),
+		Scope:               r.PostForm.Get("scope"),
+		SubjectToken:        r.PostForm.Get("subject_token"),
+		SubjectTokenType:    r.PostForm.Get("subject_token_type"),
+		ActorToken:          r.PostForm.Get("actor_token"),
+		RequestedTokenType:  r.PostForm.Get("requested_token_type"),
+		Audience:            r.PostForm["audience"],
+	}
+	if clientID, clientSecret, ok := r.BasicAuth(); ok {
+		req.ClientID = clientID
+		req.ClientSecret = clientSecret
+	}
+	return req
+}
+
+// Разбираем форму и проверяем учётные данные клиента, при ошибке сами пишем ответ
+func (h *Handler) authenticateClient(w http.ResponseWriter, r *http.Request) (*model.Client, bool) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return nil, false
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	if clientID == "" || clientSecret == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		oauthError(w, http.StatusUnauthorized, "invalid_client", "client authentication required")
+		return nil, false
+	}
+
+	client, err := h.Svc.AuthenticateClient(r.Context(), clientID, clientSecret)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		oauthError(w, http.StatusUnauthorized, "invalid_client", "")
+		return nil, false
+	}
+	return client, true
+}
+
+// Ошибки протокола отдаём как есть, остальные скрываем за server_error
+func writeOAuthError(w http.ResponseWriter, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		oauthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == service.ErrInvalidClient.Code {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		status = http.StatusUnauthorized
+	}
+	oauthError(w, status, oauthErr.Code, oauthErr.Description)
+}
+
+func oauthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(OAuthErrorResponse{Error: code, ErrorDescription: description})
+}
+
+func writeOAuthJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
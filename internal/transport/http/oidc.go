@@ -0,0 +1,49 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/v7ktory/test/internal/service"
+)
+
+// Метаданные OpenID провайдера
+func (h *Handler) Discovery(w http.ResponseWriter, r *http.Request) {
+	writePublicJSON(w, h.Svc.Discovery())
+}
+
+// Открытые ключи для проверки ID токенов
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	writePublicJSON(w, h.Svc.JWKS())
+}
+
+/*
+Возвращаем claims пользователя (OIDC Core, раздел 5.3).
+Ошибки отдаются в WWW-Authenticate, как требует RFC 6750
+*/
+func (h *Handler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	info, err := h.Svc.UserInfo(r.Context(), claimsFromContext(r.Context()))
+	switch {
+	case errors.Is(err, service.ErrInsufficientScope):
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		oauthError(w, http.StatusForbidden, service.ErrInsufficientScope.Code, "openid scope is required")
+		return
+	case errors.Is(err, service.ErrInvalidToken):
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		oauthError(w, http.StatusUnauthorized, service.ErrInvalidToken.Code, "")
+		return
+	case err != nil:
+		InternalServerErrorHandler(w, r)
+		return
+	}
+
+	writeOAuthJSON(w, info)
+}
+
+// Публичные метаданные можно кэшировать, в отличие от ответов с токенами
+func writePublicJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+/*
+IP клиента для аудита и оценки риска. Заголовкам прокси верим, только если
+соединение пришло от доверенного прокси: цепочку адресов идём справа налево
+и останавливаемся на первом недоверенном, его и считаем клиентом.
+Forwarded (RFC 7239) важнее X-Forwarded-For
+*/
+func (h *Handler) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+
+	ip = ip.Unmap()
+	hops := forwardedFor(r.Header)
+	for i := len(hops) - 1; i >= 0 && h.trustedProxy(ip); i-- {
+		hop, ok := parseHop(hops[i])
+		// Скрытый (unknown, _name) или испорченный адрес: дальше цепочке верить нельзя
+		if !ok {
+			break
+		}
+		ip = hop
+	}
+	return ip.String()
+}
+
+func (h *Handler) trustedProxy(ip netip.Addr) bool {
+	return slices.ContainsFunc(h.trustedProxies, func(prefix netip.Prefix) bool {
+		return prefix.Contains(ip)
+	})
+}
+
+// Адреса из Forwarded for=, а без него из X-Forwarded-For, от клиента к последнему прокси
+func forwardedFor(header http.Header) []string {
+	var hops []string
+	if forwarded := header.Values("Forwarded"); len(forwarded) > 0 {
+		for _, element := range strings.Split(strings.Join(forwarded, ","), ",") {
+			// Элемент без for= ничего не говорит об адресе, цепочка для нас обрывается
+			hop := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(key, "for") {
+					hop = value
+				}
+			}
+			hops = append(hops, hop)
+		}
+		return hops
+	}
+
+	for _, value := range header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	return hops
+}
+
+// Адрес с портом или без, IPv6 в Forwarded приходит в кавычках и скобках: "[2001:db8::1]:4711"
+func parseHop(hop string) (netip.Addr, bool) {
+	hop = strings.Trim(strings.TrimSpace(hop), `"`)
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,139 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/internal/service"
+)
+
+// Роли пользователя в ответе admin API
+type UserRolesResponse struct {
+	UserID uuid.UUID `json:"user_id"`
+	Roles  []string  `json:"roles"`
+}
+
+func (h *Handler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.Svc.ListRoles(r.Context())
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, roles)
+}
+
+// Создаём роль из тела с name, description и permissions
+func (h *Handler) CreateRole(w http.ResponseWriter, r *http.Request) {
+	var input model.Role
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		BadRequestErrorHandler(w, r)
+		return
+	}
+
+	role, err := h.Svc.CreateRole(r.Context(), input)
+	if err != nil {
+		roleErrorHandler(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, role)
+}
+
+// Заменяем описание и разрешения роли, имя берётся из пути
+func (h *Handler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	var input model.Role
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		BadRequestErrorHandler(w, r)
+		return
+	}
+	input.Name = mux.Vars(r)["name"]
+
+	role, err := h.Svc.UpdateRole(r.Context(), input)
+	if err != nil {
+		roleErrorHandler(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, role)
+}
+
+func (h *Handler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	if err := h.Svc.DeleteRole(r.Context(), mux.Vars(r)["name"]); err != nil {
+		roleErrorHandler(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) UserRoles(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		NotFoundErrorHandler(w, r)
+		return
+	}
+
+	roles, err := h.Svc.UserRoles(r.Context(), userID)
+	if err != nil {
+		roleErrorHandler(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, UserRolesResponse{UserID: userID, Roles: roles})
+}
+
+func (h *Handler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		NotFoundErrorHandler(w, r)
+		return
+	}
+
+	if err := h.Svc.AssignRole(r.Context(), userID, mux.Vars(r)["name"]); err != nil {
+		roleErrorHandler(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Снимаем роль, выданные пользователю токены при этом отзываются
+func (h *Handler) UnassignRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		NotFoundErrorHandler(w, r)
+		return
+	}
+
+	if err := h.Svc.UnassignRole(r.Context(), userID, mux.Vars(r)["name"]); err != nil {
+		roleErrorHandler(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func roleErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrTooManyRoles):
+		BadRequestMessageHandler(w, r, err.Error())
+	case errors.Is(err, repository.ErrRoleExists):
+		ConflictErrorHandler(w, r)
+	case errors.Is(err, repository.ErrRoleNotFound), errors.Is(err, repository.ErrUserNotFound):
+		NotFoundErrorHandler(w, r)
+	default:
+		InternalServerErrorHandler(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/internal/service"
+)
+
+/*
+Список пользователей. Параметры: email - подстрока email,
+disabled=true|false, offset и limit для постраничного вывода
+*/
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := model.UserFilter{Email: query.Get("email")}
+
+	var err error
+	if v := query.Get("disabled"); v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			BadRequestMessageHandler(w, r, "disabled must be true or false")
+			return
+		}
+		filter.Disabled = &disabled
+	}
+	if filter.Offset, err = intParam(query.Get("offset")); err != nil {
+		BadRequestMessageHandler(w, r, "offset must be a number")
+		return
+	}
+	if filter.Limit, err = intParam(query.Get("limit")); err != nil {
+		BadRequestMessageHandler(w, r, "limit must be a number")
+		return
+	}
+
+	page, err := h.Svc.ListUsers(r.Context(), filter)
+	if err != nil {
+		userErrorHandler(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	h.withUserID(w, r, func(userID uuid.UUID) {
+		user, err := h.Svc.GetUser(r.Context(), userID)
+		if err != nil {
+			userErrorHandler(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, user)
+	})
+}
+
+func (h *Handler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, func(userID uuid.UUID) error {
+		return h.Svc.SetUserDisabled(r.Context(), userID, true)
+	})
+}
+
+func (h *Handler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, func(userID uuid.UUID) error {
+		return h.Svc.SetUserDisabled(r.Context(), userID, false)
+	})
+}
+
+func (h *Handler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, func(userID uuid.UUID) error {
+		return h.Svc.UnlockUser(r.Context(), userID)
+	})
+}
+
+func (h *Handler) RequirePasswordReset(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, func(userID uuid.UUID) error {
+		return h.Svc.RequirePasswordReset(r.Context(), userID)
+	})
+}
+
+func (h *Handler) LogoutUser(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, func(userID uuid.UUID) error {
+		return h.Svc.LogoutUser(r.Context(), userID)
+	})
+}
+
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, func(userID uuid.UUID) error {
+		return h.Svc.DeleteUser(r.Context(), userID)
+	})
+}
+
+// Действие над пользователем из пути, при успехе отвечаем 204
+func (h *Handler) userAction(w http.ResponseWriter, r *http.Request, action func(userID uuid.UUID) error) {
+	h.withUserID(w, r, func(userID uuid.UUID) {
+		if err := action(userID); err != nil {
+			userErrorHandler(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (h *Handler) withUserID(w http.ResponseWriter, r *http.Request, next func(userID uuid.UUID)) {
+	userID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		NotFoundErrorHandler(w, r)
+		return
+	}
+	next(userID)
+}
+
+func userErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidPagination):
+		BadRequestMessageHandler(w, r, "offset and limit must not be negative")
+	case errors.Is(err, repository.ErrUserNotFound):
+		NotFoundErrorHandler(w, r)
+	default:
+		InternalServerErrorHandler(w, r)
+	}
+}
+
+func intParam(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(v)
+}
@@ -0,0 +1,180 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/v7ktory/test/internal/model"
+	"github.com/v7ktory/test/internal/repository"
+	"github.com/v7ktory/test/internal/service"
+)
+
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.Svc.ListWebhooks(r.Context())
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, webhooks)
+}
+
+// Создаём подписку из тела с url, events и description, секрет возвращается только в этом ответе
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var input model.WebhookInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		BadRequestErrorHandler(w, r)
+		return
+	}
+
+	webhook, err := h.Svc.CreateWebhook(r.Context(), input)
+	if err != nil {
+		webhookErrorHandler(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, webhook)
+}
+
+func (h *Handler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		NotFoundErrorHandler(w, r)
+		return
+	}
+
+	webhook, err := h.Svc.GetWebhook(r.Context(), id)
+	if err != nil {
+		webhookErrorHandler(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+// Заменяем url, events и description подписки, active меняется, только если передан
+func (h *Handler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		NotFoundErrorHandler(w, r)
+		return
+	}
+	var input model.WebhookInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		BadRequestErrorHandler(w, r)
+		return
+	}
+
+	webhook, err := h.Svc.UpdateWebhook(r.Context(), id, input)
+	if err != nil {
+		webhookErrorHandler(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		NotFoundErrorHandler(w, r)
+		return
+	}
+
+	if err := h.Svc.DeleteWebhook(r.Context(), id); err != nil {
+		webhookErrorHandler(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) RotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		NotFoundErrorHandler(w, r)
+		return
+	}
+
+	webhook, err := h.Svc.RotateWebhookSecret(r.Context(), id)
+	if err != nil {
+		webhookErrorHandler(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+// Журнал доставок подписки. Параметры: status (pending, delivered, dead), offset и limit
+func (h *Handler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		NotFoundErrorHandler(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := model.WebhookDeliveryFilter{WebhookID: id, Status: model.WebhookDeliveryStatus(query.Get("status"))}
+	switch filter.Status {
+	case "", model.WebhookDeliveryPending, model.WebhookDeliveryDelivered, model.WebhookDeliveryDead:
+	default:
+		BadRequestMessageHandler(w, r, "status must be pending, delivered or dead")
+		return
+	}
+	if filter.Offset, err = intParam(query.Get("offset")); err != nil {
+		BadRequestMessageHandler(w, r, "offset must be a number")
+		return
+	}
+	if filter.Limit, err = intParam(query.Get("limit")); err != nil {
+		BadRequestMessageHandler(w, r, "limit must be a number")
+		return
+	}
+
+	page, err := h.Svc.ListWebhookDeliveries(r.Context(), filter)
+	if err != nil {
+		webhookErrorHandler(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// Возвращаем доставку из dead в очередь
+func (h *Handler) RetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		NotFoundErrorHandler(w, r)
+		return
+	}
+	deliveryID, err := uuid.Parse(mux.Vars(r)["delivery_id"])
+	if err != nil {
+		NotFoundErrorHandler(w, r)
+		return
+	}
+
+	delivery, err := h.Svc.RetryWebhookDelivery(r.Context(), id, deliveryID)
+	if err != nil {
+		webhookErrorHandler(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+func webhookErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidWebhook):
+		BadRequestMessageHandler(w, r, err.Error())
+	case errors.Is(err, service.ErrInvalidPagination):
+		BadRequestMessageHandler(w, r, "offset and limit must not be negative")
+	case errors.Is(err, service.ErrWebhookDeliveryNotDead):
+		ConflictErrorHandler(w, r)
+	case errors.Is(err, repository.ErrWebhookNotFound), errors.Is(err, repository.ErrWebhookDeliveryNotFound):
+		NotFoundErrorHandler(w, r)
+	default:
+		InternalServerErrorHandler(w, r)
+	}
+}
@@ -0,0 +1,48 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/v7ktory/test/pkg/migrate"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const migrationsCollection = "schema_migrations"
+
+type MigrationStore struct {
+	provider *Provider
+}
+
+func NewMigrationStore(provider *Provider) *MigrationStore {
+	return &MigrationStore{
+		provider: provider,
+	}
+}
+
+func (s *MigrationStore) Applied(ctx context.Context) ([]migrate.Record, error) {
+	cursor, err := s.provider.GetCollection(migrationsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []migrate.Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (s *MigrationStore) Insert(ctx context.Context, record migrate.Record) error {
+	_, err := s.provider.GetCollection(migrationsCollection).InsertOne(ctx, record)
+	if mongo.IsDuplicateKeyError(err) {
+		// Миграцию параллельно применила другая реплика
+		return nil
+	}
+	return err
+}
+
+func (s *MigrationStore) Delete(ctx context.Context, version int) error {
+	_, err := s.provider.GetCollection(migrationsCollection).DeleteOne(ctx, bson.M{"_id": version})
+	return err
+}
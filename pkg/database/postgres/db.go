@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/v7ktory/test/internal/config"
+)
+
+const uniqueViolationCode = "23505"
+
+var errNoDSN = errors.New("no postgres dsn")
+
+type Provider struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+}
+
+func NewPostgres(ctx context.Context, pgCfg config.PostgresCfg) (*Provider, error) {
+	if pgCfg.DSN == "" {
+		return nil, errNoDSN
+	}
+
+	db, err := sql.Open("pgx", pgCfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("can't open postgres: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pgCfg.QueryTimeout)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can't ping postgres: %w", err)
+	}
+
+	return &Provider{
+		DB:           db,
+		QueryTimeout: pgCfg.QueryTimeout,
+	}, nil
+}
+
+func (p *Provider) Close() error {
+	return p.DB.Close()
+}
+
+// Проверяем, что ошибка вызвана нарушением уникального ограничения
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode
+}
@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/v7ktory/test/internal/config"
+)
+
+var errNoAddr = errors.New("no redis addr")
+
+type Provider struct {
+	Client       *redis.Client
+	QueryTimeout time.Duration
+}
+
+func NewRedis(ctx context.Context, redisCfg config.RedisCfg) (*Provider, error) {
+	if redisCfg.Addr == "" {
+		return nil, errNoAddr
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     redisCfg.Addr,
+		Username: redisCfg.Username,
+		Password: redisCfg.Password,
+		DB:       redisCfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, redisCfg.QueryTimeout)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("can't ping redis: %w", err)
+	}
+
+	return &Provider{
+		Client:       client,
+		QueryTimeout: redisCfg.QueryTimeout,
+	}, nil
+}
+
+func (p *Provider) Close() error {
+	return p.Client.Close()
+}
@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/v7ktory/test/internal/config"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var errNoPath = errors.New("no sqlite path")
+
+type Provider struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+}
+
+func NewSQLite(ctx context.Context, sqliteCfg config.SQLiteCfg) (*Provider, error) {
+	if sqliteCfg.Path == "" {
+		return nil, errNoPath
+	}
+
+	/*
+		WAL позволяет читать параллельно с записью,
+		immediate транзакции сразу берут блокировку на запись и не падают с SQLITE_BUSY при её повышении
+	*/
+	params := url.Values{}
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "synchronous(NORMAL)")
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+sqliteCfg.Path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("can't open sqlite: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sqliteCfg.QueryTimeout)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can't ping sqlite: %w", err)
+	}
+
+	return &Provider{
+		DB:           db,
+		QueryTimeout: sqliteCfg.QueryTimeout,
+	}, nil
+}
+
+func (p *Provider) Close() error {
+	return p.DB.Close()
+}
+
+// Проверяем, что ошибка вызвана нарушением уникального ограничения
+func IsUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
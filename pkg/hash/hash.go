@@ -1,6 +1,12 @@
 package hash
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+
+	"golang.org/x/crypto/bcrypt"
+)
 
 type Hasher struct {
 	salt string
@@ -19,3 +25,16 @@ func (h *Hasher) CompareHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+/*
+Для случайных секретов с высокой энтропией (секреты клиентов, коды)
+достаточно SHA-256, bcrypt здесь только замедлил бы каждую проверку
+*/
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func CompareSecret(secret, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(hash)) == 1
+}
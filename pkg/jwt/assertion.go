@@ -0,0 +1,80 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Тип client_assertion для аутентификации клиента через private_key_jwt (RFC 7523)
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// Ограничиваем срок жизни assertion, чтобы сузить окно для повторного использования
+const maxAssertionLifetime = 10 * time.Minute
+
+// Достаём client_id из assertion без проверки подписи, чтобы найти ключ клиента
+func ClientAssertionIssuer(assertion string) (string, error) {
+	token, _, err := jwt.NewParser().ParseUnverified(assertion, jwt.MapClaims{})
+	if err != nil {
+		return "", fmt.Errorf("client assertion parsing failed: %w", err)
+	}
+	issuer, err := token.Claims.GetIssuer()
+	if err != nil || issuer == "" {
+		return "", errors.New("client assertion has no issuer")
+	}
+	return issuer, nil
+}
+
+/*
+Проверяем assertion клиента: подпись его открытым ключом (RS256 или ES256),
+iss и sub равны client_id, aud - один из адресов сервера авторизации
+*/
+func VerifyClientAssertion(assertion, clientID, publicKeyPEM string, audiences []string) error {
+	token, err := jwt.Parse(assertion, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA:
+			return jwt.ParseRSAPublicKeyFromPEM([]byte(publicKeyPEM))
+		case *jwt.SigningMethodECDSA:
+			return jwt.ParseECPublicKeyFromPEM([]byte(publicKeyPEM))
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+	},
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(clientID),
+		jwt.WithSubject(clientID),
+	)
+	if err != nil {
+		return fmt.Errorf("client assertion validation failed: %w", err)
+	}
+
+	exp, err := token.Claims.GetExpirationTime()
+	if err != nil || time.Until(exp.Time) > maxAssertionLifetime {
+		return errors.New("client assertion lifetime is too long")
+	}
+
+	aud, err := token.Claims.GetAudience()
+	if err != nil {
+		return fmt.Errorf("invalid client assertion audience: %w", err)
+	}
+	for _, a := range aud {
+		if slices.Contains(audiences, a) {
+			return nil
+		}
+	}
+	return errors.New("client assertion audience mismatch")
+}
+
+// Проверяем, что PEM содержит открытый RSA или EC ключ
+func ValidatePublicKey(publicKeyPEM string) error {
+	if _, err := jwt.ParseRSAPublicKeyFromPEM([]byte(publicKeyPEM)); err == nil {
+		return nil
+	}
+	if _, err := jwt.ParseECPublicKeyFromPEM([]byte(publicKeyPEM)); err == nil {
+		return nil
+	}
+	return errors.New("public_key must be an RSA or EC public key in PEM format")
+}
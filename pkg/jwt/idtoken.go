@@ -0,0 +1,250 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const idTokenKeyBits = 2048
+
+// Данные для ID токена OpenID Connect
+type IDToken struct {
+	UserID   uuid.UUID
+	ClientID string
+	Nonce    string
+	AuthTime time.Time
+	// Access токен, выданный вместе с ID токеном, для at_hash
+	AccessToken string
+	// Claims пользователя по выданным scope (email, email_verified и т.д.)
+	UserClaims map[string]any
+}
+
+// Открытый ключ в формате JWK (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+/*
+Подписываем ID токены асимметричным ключом RS256,
+чтобы сторонние клиенты могли проверить их по опубликованному JWKS
+без доступа к секрету access токенов
+*/
+type IDTokenSigner struct {
+	issuer string
+	key    *rsa.PrivateKey
+	keyID  string
+	// Ключи до ротации: ими уже не подписываем, но публикуем, пока живут выданные ими токены
+	previous []*rsa.PublicKey
+}
+
+func NewIDTokenSigner(issuer string, key *rsa.PrivateKey, previous ...*rsa.PublicKey) *IDTokenSigner {
+	return &IDTokenSigner{
+		issuer:   issuer,
+		key:      key,
+		keyID:    KeyID(&key.PublicKey),
+		previous: previous,
+	}
+}
+
+/*
+Загружаем текущий ключ и, если файл предыдущего ключа есть, его открытую часть.
+Предыдущий ключ после ротации нужен, чтобы проверять подписанное им раньше
+*/
+func LoadIDTokenSigner(issuer, keyFile, previousKeyFile string) (*IDTokenSigner, error) {
+	key, err := LoadRSAKey(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load signing key: %w", err)
+	}
+	var previous []*rsa.PublicKey
+	if _, err := os.Stat(previousKeyFile); err == nil {
+		previousKey, err := LoadRSAKey(previousKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load previous signing key: %w", err)
+		}
+		previous = append(previous, &previousKey.PublicKey)
+	}
+	return NewIDTokenSigner(issuer, key, previous...), nil
+}
+
+// kid ключа - начало SHA-256 от его DER представления
+func KeyID(key *rsa.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(key)
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+func (s *IDTokenSigner) Issuer() string {
+	return s.issuer
+}
+
+func (s *IDTokenSigner) Sign(token IDToken, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for name, value := range token.UserClaims {
+		claims[name] = value
+	}
+	claims["iss"] = s.issuer
+	claims["sub"] = token.UserID
+	claims["aud"] = token.ClientID
+	claims["azp"] = token.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	if token.Nonce != "" {
+		claims["nonce"] = token.Nonce
+	}
+	if !token.AuthTime.IsZero() {
+		claims["auth_time"] = token.AuthTime.Unix()
+	}
+	if token.AccessToken != "" {
+		// Левая половина SHA-256 access токена (OIDC Core, раздел 3.1.3.6)
+		sum := sha256.Sum256([]byte(token.AccessToken))
+		claims["at_hash"] = base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+	}
+
+	signed := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	signed.Header["kid"] = s.keyID
+	return signed.SignedString(s.key)
+}
+
+// Публикуем текущий и предыдущие открытые ключи для /.well-known/jwks.json
+func (s *IDTokenSigner) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{publicJWK(&s.key.PublicKey)}}
+	for _, key := range s.previous {
+		set.Keys = append(set.Keys, publicJWK(key))
+	}
+	return set
+}
+
+/*
+Подписываем произвольные данные текущим ключом (RSA PKCS#1 v1.5, SHA-256) и возвращаем
+kid ключа вместе с подписью. В подпись входит назначение purpose, поэтому её нельзя
+выдать за подпись ID токена или данных с другим назначением
+*/
+func (s *IDTokenSigner) SignData(purpose string, data []byte) (string, string, error) {
+	digest := dataDigest(purpose, data)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", "", err
+	}
+	return s.keyID, base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// Проверяем подпись ключом keyID среди текущего и предыдущих ключей
+func (s *IDTokenSigner) VerifyData(purpose string, data []byte, keyID, signature string) bool {
+	key := s.publicKey(keyID)
+	if key == nil {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	digest := dataDigest(purpose, data)
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+}
+
+func (s *IDTokenSigner) publicKey(keyID string) *rsa.PublicKey {
+	if keyID == s.keyID {
+		return &s.key.PublicKey
+	}
+	for _, key := range s.previous {
+		if KeyID(key) == keyID {
+			return key
+		}
+	}
+	return nil
+}
+
+func dataDigest(purpose string, data []byte) [sha256.Size]byte {
+	return sha256.Sum256(append([]byte(purpose+"\x00"), data...))
+}
+
+func publicJWK(key *rsa.PublicKey) JWK {
+	return JWK{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: jwt.SigningMethodRS256.Alg(),
+		KeyID:     KeyID(key),
+		N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+/*
+Читаем RSA ключ из PEM файла (PKCS#1 или PKCS#8).
+Без пути генерируем временный ключ: ID токены перестанут проверяться после
+перезапуска и не совпадут между репликами, поэтому это только для разработки
+*/
+func LoadRSAKey(path string) (*rsa.PrivateKey, error) {
+	if path == "" {
+		return GenerateRSAKey()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found in signing key file")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse signing key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an RSA key")
+	}
+	return key, nil
+}
+
+// Новый RSA ключ для подписи ID токенов
+func GenerateRSAKey() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, idTokenKeyBits)
+}
+
+/*
+Записываем ключ в PEM файл (PKCS#8) с правами 0600.
+Пишем во временный файл и переименовываем, чтобы не оставить файл с половиной ключа
+*/
+func WriteRSAKey(path string, key *rsa.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,33 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+)
+
+/*
+Подписываем произвольные данные ключом access токенов (HMAC-SHA512).
+Для подписи выводим отдельный ключ по назначению purpose, поэтому такую
+подпись нельзя выдать за токен или за подпись с другим назначением
+*/
+func (j *JWT) SignData(purpose string, data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(j.mac(purpose, data))
+}
+
+func (j *JWT) VerifyData(purpose string, data []byte, signature string) bool {
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(sig, j.mac(purpose, data))
+}
+
+func (j *JWT) mac(purpose string, data []byte) []byte {
+	derive := hmac.New(sha512.New, []byte(j.signingKey))
+	derive.Write([]byte(purpose))
+
+	mac := hmac.New(sha512.New, derive.Sum(nil))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -4,6 +4,8 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,6 +13,50 @@ import (
 	"github.com/v7ktory/test/internal/model"
 )
 
+/*
+Кому выдаётся пара токенов.
+Без UserID токен выдаётся самому клиенту (client_credentials), sub = ClientID
+*/
+type Subject struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	// Пустой для first-party токенов
+	ClientID string
+	// Scope через пробел, выданные OAuth клиенту
+	Scope string
+	// Время входа пользователя, переносится между обновлениями токенов
+	AuthTime time.Time
+	// Уровень проверки пользователя при входе (acr), переносится как и AuthTime
+	ACR string
+	// Сервисы, для которых предназначен токен
+	Audience []string
+	// Сервис, получивший токен обменом от имени пользователя
+	Actor *model.Actor
+	// Роли пользователя, только в first-party токенах
+	Roles []string
+}
+
+// Данные, извлечённые из валидного access токена
+type Claims struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	ClientID  string
+	Scope     string
+	AuthTime  time.Time
+	ACR       string
+	Audience  []string
+	Actor     *model.Actor
+	Roles     []string
+	TokenID   uuid.UUID
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// Токен выдан сервису через client_credentials, пользователя за ним нет
+func (c *Claims) IsServiceToken() bool {
+	return c.UserID == uuid.Nil && c.ClientID != ""
+}
+
 type JWT struct {
 	signingKey string
 }
@@ -21,13 +67,13 @@ func NewJWT(signingKey string) *JWT {
 	}
 }
 
-func (j *JWT) GenerateTokenPair(userID uuid.UUID, accessTokenTTL, refreshTokenTTL time.Duration) (*model.AccessToken, *model.RefreshToken, error) {
-	accessToken, err := j.generateAccessToken(userID, accessTokenTTL)
+func (j *JWT) GenerateTokenPair(subject Subject, accessTokenTTL, refreshTokenTTL time.Duration) (*model.AccessToken, *model.RefreshToken, error) {
+	accessToken, err := j.generateAccessToken(subject, accessTokenTTL)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	refreshToken, err := j.generateRefreshToken(userID, accessToken.ID, refreshTokenTTL)
+	refreshToken, err := j.generateRefreshToken(subject.UserID, subject.SessionID, accessToken.ID, refreshTokenTTL)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -35,11 +81,49 @@ func (j *JWT) GenerateTokenPair(userID uuid.UUID, accessTokenTTL, refreshTokenTT
 	return accessToken, refreshToken, nil
 }
 
-func (j *JWT) generateAccessToken(userID uuid.UUID, ttl time.Duration) (*model.AccessToken, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
-		"sub": userID,
-		"exp": time.Now().Add(ttl).Unix(),
-	})
+// Выпускаем только access токен, без сессии и refresh токена
+func (j *JWT) GenerateAccessToken(subject Subject, ttl time.Duration) (*model.AccessToken, error) {
+	return j.generateAccessToken(subject, ttl)
+}
+
+func (j *JWT) generateAccessToken(subject Subject, ttl time.Duration) (*model.AccessToken, error) {
+	id := uuid.New()
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub": subject.UserID,
+		"jti": id,
+		// iat с миллисекундами: отзыв сессии отделяет токены, выданные в ту же секунду до и после него
+		"iat": float64(now.UnixMilli()) / 1000,
+		"exp": now.Add(ttl).Unix(),
+	}
+	if subject.UserID == uuid.Nil {
+		claims["sub"] = subject.ClientID
+	}
+	if subject.SessionID != uuid.Nil {
+		claims["sid"] = subject.SessionID
+	}
+	if subject.ClientID != "" {
+		claims["client_id"] = subject.ClientID
+	}
+	if subject.Scope != "" {
+		claims["scope"] = subject.Scope
+	}
+	if !subject.AuthTime.IsZero() {
+		claims["auth_time"] = subject.AuthTime.Unix()
+	}
+	if subject.ACR != "" {
+		claims["acr"] = subject.ACR
+	}
+	if len(subject.Audience) > 0 {
+		claims["aud"] = subject.Audience
+	}
+	if subject.Actor != nil {
+		claims["act"] = subject.Actor
+	}
+	if len(subject.Roles) > 0 {
+		claims["roles"] = subject.Roles
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
 
 	signedString, err := token.SignedString([]byte(j.signingKey))
 	if err != nil {
@@ -47,20 +131,25 @@ func (j *JWT) generateAccessToken(userID uuid.UUID, ttl time.Duration) (*model.A
 	}
 
 	accessToken := &model.AccessToken{
-		ID:     uuid.New(),
-		UserID: userID,
+		ID:     id,
+		UserID: subject.UserID,
 		Token:  signedString,
+		Scope:  subject.Scope,
 	}
 	return accessToken, nil
 }
 
-func (j *JWT) generateRefreshToken(userID, accessTokenID uuid.UUID, ttl time.Duration) (*model.RefreshToken, error) {
-	tokenBytes := make([]byte, 32)
+/*
+Refresh токен имеет вид <session_id>.<random>, чтобы по нему можно было найти сессию.
+Токен хэшируется bcrypt, поэтому вместе с префиксом должен укладываться в 72 байта
+*/
+func (j *JWT) generateRefreshToken(userID, sessionID, accessTokenID uuid.UUID, ttl time.Duration) (*model.RefreshToken, error) {
+	tokenBytes := make([]byte, 24)
 	_, err := rand.Read(tokenBytes)
 	if err != nil {
 		return nil, err
 	}
-	token := base64.URLEncoding.EncodeToString(tokenBytes)
+	token := sessionID.String() + "." + base64.URLEncoding.EncodeToString(tokenBytes)
 	refreshToken := &model.RefreshToken{
 		ID:            uuid.New(),
 		UserID:        userID,
@@ -71,7 +160,28 @@ func (j *JWT) generateRefreshToken(userID, accessTokenID uuid.UUID, ttl time.Dur
 	return refreshToken, nil
 }
 
+// Извлекаем ID сессии из refresh токена
+func SessionIDFromRefreshToken(token string) (uuid.UUID, bool) {
+	prefix, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return uuid.Nil, false
+	}
+	sessionID, err := uuid.Parse(prefix)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return sessionID, true
+}
+
 func (j *JWT) ValidateToken(signedToken string) (*uuid.UUID, error) {
+	claims, err := j.ParseToken(signedToken)
+	if err != nil {
+		return nil, err
+	}
+	return &claims.UserID, nil
+}
+
+func (j *JWT) ParseToken(signedToken string) (*Claims, error) {
 	// Парсинг и валидация токена
 	token, err := jwt.ParseWithClaims(signedToken, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
 		// Проверка метода подписи
@@ -96,10 +206,80 @@ func (j *JWT) ValidateToken(signedToken string) (*uuid.UUID, error) {
 		return nil, fmt.Errorf("subject not found in claims")
 	}
 
-	// Парсинг идентификатора пользователя в UUID
-	userID, err := uuid.Parse(subject)
-	if err != nil {
-		return nil, fmt.Errorf("invalid user ID: %w", err)
+	result := &Claims{}
+	if clientID, ok := (*claims)["client_id"].(string); ok {
+		result.ClientID = clientID
+	}
+
+	// Парсинг идентификатора пользователя в UUID, у сервисных токенов sub = client_id
+	if result.ClientID == "" || subject != result.ClientID {
+		if result.UserID, err = uuid.Parse(subject); err != nil {
+			return nil, fmt.Errorf("invalid user ID: %w", err)
+		}
+	}
+
+	// Токены, выпущенные до появления jti и sid, их не содержат
+	if sid, ok := (*claims)["sid"].(string); ok {
+		if result.SessionID, err = uuid.Parse(sid); err != nil {
+			return nil, fmt.Errorf("invalid session ID: %w", err)
+		}
+	}
+	if jti, ok := (*claims)["jti"].(string); ok {
+		if result.TokenID, err = uuid.Parse(jti); err != nil {
+			return nil, fmt.Errorf("invalid token ID: %w", err)
+		}
+	}
+	if scope, ok := (*claims)["scope"].(string); ok {
+		result.Scope = scope
+	}
+	if authTime, ok := (*claims)["auth_time"].(float64); ok {
+		result.AuthTime = time.Unix(int64(authTime), 0)
+	}
+	if acr, ok := (*claims)["acr"].(string); ok {
+		result.ACR = acr
+	}
+	if aud, err := claims.GetAudience(); err == nil {
+		result.Audience = aud
+	}
+	if act, ok := (*claims)["act"]; ok {
+		if result.Actor, err = parseActor(act); err != nil {
+			return nil, err
+		}
+	}
+	if roles, ok := (*claims)["roles"].([]any); ok {
+		for _, role := range roles {
+			if name, ok := role.(string); ok {
+				result.Roles = append(result.Roles, name)
+			}
+		}
+	}
+	// GetIssuedAt отбрасывает доли секунды, а они нужны для сравнения с временем отзыва
+	if iat, ok := (*claims)["iat"].(float64); ok {
+		result.IssuedAt = time.UnixMilli(int64(math.Round(iat * 1000)))
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		result.ExpiresAt = exp.Time
+	}
+	return result, nil
+}
+
+// Разбираем claim act вместе с цепочкой предыдущих акторов
+func parseActor(value any) (*model.Actor, error) {
+	act, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid act claim")
+	}
+	subject, ok := act["sub"].(string)
+	if !ok || subject == "" {
+		return nil, fmt.Errorf("subject not found in act claim")
+	}
+
+	actor := &model.Actor{Subject: subject}
+	if prior, ok := act["act"]; ok {
+		var err error
+		if actor.Actor, err = parseActor(prior); err != nil {
+			return nil, err
+		}
 	}
-	return &userID, nil
+	return actor, nil
 }
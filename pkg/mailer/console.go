@@ -0,0 +1,30 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Печатаем текстовую часть письма, для локальной разработки
+type ConsoleMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewConsoleMailer(w io.Writer, from string) *ConsoleMailer {
+	return &ConsoleMailer{
+		w:    w,
+		from: from,
+	}
+}
+
+func (m *ConsoleMailer) Send(_ context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "--- mail\nFrom: %s\nTo: %s\nSubject: %s\n\n%s\n---\n", m.from, msg.To, msg.Subject, msg.Text)
+	return err
+}
@@ -0,0 +1,292 @@
+package mailer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Что получил тестовый SMTP сервер
+type received struct {
+	from string
+	to   []string
+	data string
+	tls  bool
+	err  error
+}
+
+/*
+Тестовый SMTP сервер на одно соединение: отвечает 250 на всё и сохраняет письмо.
+С cert предлагает STARTTLS
+*/
+func startSMTPServer(t *testing.T, cert *tls.Certificate) (string, <-chan received) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	done := make(chan received, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- received{err: err}
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+		var r received
+		r.err = serveSMTP(conn, cert, &r)
+		done <- r
+	}()
+	return ln.Addr().String(), done
+}
+
+func serveSMTP(conn net.Conn, cert *tls.Certificate, r *received) error {
+	text := textproto.NewConn(conn)
+	reply := func(code int, lines ...string) error {
+		for i, line := range lines {
+			sep := " "
+			if i < len(lines)-1 {
+				sep = "-"
+			}
+			if err := text.PrintfLine("%d%s%s", code, sep, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := reply(220, "localhost ESMTP"); err != nil {
+		return err
+	}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return err
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			extensions := []string{"localhost", "8BITMIME"}
+			if cert != nil && !r.tls {
+				extensions = append(extensions, "STARTTLS")
+			}
+			err = reply(250, extensions...)
+		case "STARTTLS":
+			if err := reply(220, "ready to start TLS"); err != nil {
+				return err
+			}
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{*cert}})
+			if err := tlsConn.Handshake(); err != nil {
+				return err
+			}
+			conn, text, r.tls = tlsConn, textproto.NewConn(tlsConn), true
+			continue
+		case "MAIL":
+			r.from = envelopeAddress(arg)
+			err = reply(250, "ok")
+		case "RCPT":
+			r.to = append(r.to, envelopeAddress(arg))
+			err = reply(250, "ok")
+		case "DATA":
+			if err := reply(354, "go ahead"); err != nil {
+				return err
+			}
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return err
+			}
+			r.data = string(data)
+			err = reply(250, "queued")
+		case "QUIT":
+			return reply(221, "bye")
+		default:
+			err = reply(502, "not implemented")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Самоподписанный сертификат для 127.0.0.1 и пул, которому клиент его доверяет
+func selfSignedCert(t *testing.T) (*tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func send(t *testing.T, m *SMTPMailer, msg Message, done <-chan received) received {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	r := <-done
+	if r.err != nil {
+		t.Fatalf("smtp server: %v", r.err)
+	}
+	return r
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	addr, done := startSMTPServer(t, nil)
+	m, err := NewSMTPMailer(addr, "", "", "Auth <noreply@example.com>")
+	if err != nil {
+		t.Fatalf("NewSMTPMailer: %v", err)
+	}
+
+	r := send(t, m, Message{To: "bob@example.com", Subject: "Код входа", Text: "Ваш код: 123456"}, done)
+	if r.tls {
+		t.Fatalf("server without STARTTLS got a TLS session")
+	}
+	if r.from != "noreply@example.com" || len(r.to) != 1 || r.to[0] != "bob@example.com" {
+		t.Fatalf("envelope is %q -> %q, want noreply@example.com -> bob@example.com", r.from, r.to)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(r.data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Код входа" {
+		t.Fatalf("Subject is %q, %v", subject, err)
+	}
+	if got := msg.Header.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Fatalf("Content-Type is %q, want text/plain", got)
+	}
+	// SMTP клиент завершает данные переводом строки
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil || strings.TrimSuffix(string(body), "\n") != "Ваш код: 123456" {
+		t.Fatalf("body is %q, %v", body, err)
+	}
+}
+
+func TestSMTPMailerSendStartTLS(t *testing.T) {
+	cert, pool := selfSignedCert(t)
+	addr, done := startSMTPServer(t, cert)
+	m, err := NewSMTPMailer(addr, "", "", "noreply@example.com")
+	if err != nil {
+		t.Fatalf("NewSMTPMailer: %v", err)
+	}
+	m.tls.RootCAs = pool
+
+	r := send(t, m, Message{To: "bob@example.com", Subject: "Hello", Text: "over tls"}, done)
+	if !r.tls {
+		t.Fatalf("server offered STARTTLS, but the message was sent in plain text")
+	}
+	if !strings.Contains(r.data, "over tls") {
+		t.Fatalf("message is %q, want the text body", r.data)
+	}
+}
+
+// Сертификат, которому клиент не доверяет, обрывает отправку, а не отправляет письмо открыто
+func TestSMTPMailerSendStartTLSUntrusted(t *testing.T) {
+	cert, _ := selfSignedCert(t)
+	addr, _ := startSMTPServer(t, cert)
+	m, err := NewSMTPMailer(addr, "", "", "noreply@example.com")
+	if err != nil {
+		t.Fatalf("NewSMTPMailer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, Message{To: "bob@example.com", Subject: "Hello", Text: "secret"}); err == nil {
+		t.Fatalf("Send with an untrusted certificate succeeded")
+	}
+}
+
+func TestSMTPMailerSendMultipart(t *testing.T) {
+	addr, done := startSMTPServer(t, nil)
+	m, err := NewSMTPMailer(addr, "", "", "noreply@example.com")
+	if err != nil {
+		t.Fatalf("NewSMTPMailer: %v", err)
+	}
+
+	text := "Подтвердите адрес: https://example.com/verify?token=" + strings.Repeat("x", 80)
+	html := `<p>Подтвердите <a href="https://example.com/verify">адрес</a></p>`
+	r := send(t, m, Message{To: "bob@example.com", Subject: "Verify", Text: text, HTML: html}, done)
+
+	msg, err := mail.ReadMessage(strings.NewReader(r.data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if msg.Header.Get("Message-ID") == "" || !strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.com>") {
+		t.Fatalf("Message-ID is %q, want one in the sender domain", msg.Header.Get("Message-ID"))
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type is %q, %v, want multipart/alternative", msg.Header.Get("Content-Type"), err)
+	}
+
+	// multipart.Reader сам снимает quoted-printable с частей
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	want := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	}
+	for _, w := range want {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("NextPart: %v", err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		if got := part.Header.Get("Content-Type"); got != w.contentType || string(body) != w.body {
+			t.Fatalf("part is %q %q, want %q %q", got, body, w.contentType, w.body)
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Fatalf("NextPart after the HTML part returned %v, want io.EOF", err)
+	}
+}
+
+// Адрес из аргумента MAIL FROM:<...> или RCPT TO:<...>, параметры после него отбрасываем
+func envelopeAddress(arg string) string {
+	_, addr, _ := strings.Cut(arg, "<")
+	addr, _, _ = strings.Cut(addr, ">")
+	return addr
+}
@@ -0,0 +1,122 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+var ErrTemplateNotFound = errors.New("mail template not found")
+
+/*
+Шаблоны писем из каталога с файлами NAME.LOCALE.txt и NAME.LOCALE.html.
+Текстовый шаблон обязателен и задаёт тему блоком {{define "subject"}},
+HTML необязателен. Локаль подбирается от точной (pt-br) к языку (pt) и к локали по умолчанию
+*/
+type Templates struct {
+	defaultLocale string
+	templates     map[string]map[string]*template
+}
+
+type template struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+func NewTemplates(fsys fs.FS, defaultLocale string) (*Templates, error) {
+	t := &Templates{
+		defaultLocale: normalizeLocale(defaultLocale),
+		templates:     make(map[string]map[string]*template),
+	}
+
+	files, err := fs.Glob(fsys, "*.*.txt")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		name, locale, _ := strings.Cut(strings.TrimSuffix(path.Base(file), ".txt"), ".")
+		locale = normalizeLocale(locale)
+
+		text, err := texttemplate.New(file).Option("missingkey=error").ParseFS(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		if text.Lookup("subject") == nil {
+			return nil, fmt.Errorf("mail template %s: missing subject block", file)
+		}
+		tmpl := &template{text: text}
+
+		htmlFile := strings.TrimSuffix(file, ".txt") + ".html"
+		if _, err := fs.Stat(fsys, htmlFile); err == nil {
+			if tmpl.html, err = htmltemplate.New(htmlFile).Option("missingkey=error").ParseFS(fsys, htmlFile); err != nil {
+				return nil, err
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		if t.templates[name] == nil {
+			t.templates[name] = make(map[string]*template)
+		}
+		t.templates[name][locale] = tmpl
+	}
+
+	// Без варианта по умолчанию письмо на неизвестной локали не собрать
+	for name, locales := range t.templates {
+		if locales[t.defaultLocale] == nil {
+			return nil, fmt.Errorf("mail template %s: missing %s variant", name, t.defaultLocale)
+		}
+	}
+	return t, nil
+}
+
+// Собираем письмо по шаблону name на локали locale, получателя заполняет вызывающий
+func (t *Templates) Render(name, locale string, data any) (Message, error) {
+	tmpl := t.lookup(name, locale)
+	if tmpl == nil {
+		return Message{}, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.text.Execute(&text, data); err != nil {
+		return Message{}, err
+	}
+	if tmpl.html != nil {
+		if err := tmpl.html.Execute(&html, data); err != nil {
+			return Message{}, err
+		}
+	}
+
+	return Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
+
+func (t *Templates) lookup(name, locale string) *template {
+	locales := t.templates[name]
+	if locales == nil {
+		return nil
+	}
+	locale = normalizeLocale(locale)
+	language, _, _ := strings.Cut(locale, "-")
+	for _, l := range []string{locale, language, t.defaultLocale} {
+		if tmpl := locales[l]; tmpl != nil {
+			return tmpl
+		}
+	}
+	return nil
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
@@ -0,0 +1,45 @@
+package migrate
+
+import (
+	"context"
+	"sync"
+)
+
+// Хранилище версий в памяти, для бэкендов без постоянной схемы
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[int]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[int]Record),
+	}
+}
+
+func (s *MemoryStore) Applied(ctx context.Context) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]Record, 0, len(s.records))
+	for _, r := range s.records {
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func (s *MemoryStore) Insert(ctx context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[record.Version] = record
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, version)
+	return nil
+}
@@ -0,0 +1,193 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	ErrNoApplied        = errors.New("no applied migrations")
+	ErrUnknownMigration = errors.New("applied migration is unknown")
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+)
+
+type Func func(ctx context.Context) error
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      Func
+	Down    Func
+}
+
+type Record struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Хранилище применённых версий (коллекция или таблица schema_migrations)
+type Store interface {
+	Applied(ctx context.Context) ([]Record, error)
+	Insert(ctx context.Context, record Record) error
+	Delete(ctx context.Context, version int) error
+}
+
+/*
+Хранилище, которое записывает версию в той же транзакции, что и миграция.
+Тогда сбой между ними не оставит применённую, но не записанную миграцию
+*/
+type TxStore interface {
+	Store
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type Migrator struct {
+	store      Store
+	migrations []Migration
+}
+
+func NewMigrator(store Store, migrations []Migration) (*Migrator, error) {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			return nil, fmt.Errorf("%w: %d", ErrDuplicateVersion, sorted[i].Version)
+		}
+	}
+
+	return &Migrator{
+		store:      store,
+		migrations: sorted,
+	}, nil
+}
+
+// Применяем все ещё не применённые миграции по возрастанию версии
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mg := range m.migrations {
+		if _, ok := applied[mg.Version]; ok {
+			continue
+		}
+		err := m.inTx(ctx, func(ctx context.Context) error {
+			if err := mg.Up(ctx); err != nil {
+				return fmt.Errorf("migration %d (%s) up: %w", mg.Version, mg.Name, err)
+			}
+
+			err := m.store.Insert(ctx, Record{
+				Version:   mg.Version,
+				Name:      mg.Name,
+				AppliedAt: time.Now().UTC(),
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d (%s) record: %w", mg.Version, mg.Name, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return done, err
+		}
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// Откатываем последнюю применённую миграцию
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	applied, err := m.store.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(applied) == 0 {
+		return nil, ErrNoApplied
+	}
+
+	last := applied[0]
+	for _, r := range applied[1:] {
+		if r.Version > last.Version {
+			last = r
+		}
+	}
+
+	mg, ok := m.find(last.Version)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownMigration, last.Version)
+	}
+	err = m.inTx(ctx, func(ctx context.Context) error {
+		if mg.Down != nil {
+			if err := mg.Down(ctx); err != nil {
+				return fmt.Errorf("migration %d (%s) down: %w", mg.Version, mg.Name, err)
+			}
+		}
+		return m.store.Delete(ctx, mg.Version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &mg, nil
+}
+
+// Возвращаем состояние всех известных миграций
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		st := Status{Version: mg.Version, Name: mg.Name}
+		if r, ok := applied[mg.Version]; ok {
+			st.Applied = true
+			st.AppliedAt = r.AppliedAt
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]Record, error) {
+	records, err := m.store.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]Record, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+func (m *Migrator) inTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if store, ok := m.store.(TxStore); ok {
+		return store.InTx(ctx, fn)
+	}
+	return fn(ctx)
+}
+
+func (m *Migrator) find(version int) (Migration, bool) {
+	for _, mg := range m.migrations {
+		if mg.Version == version {
+			return mg, true
+		}
+	}
+	return Migration{}, false
+}
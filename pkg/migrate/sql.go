@@ -0,0 +1,171 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const createTableQuery = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`
+
+type txKey struct{}
+
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+type SQLStore struct {
+	db *sql.DB
+}
+
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{
+		db: db,
+	}
+}
+
+func (s *SQLStore) Applied(ctx context.Context) ([]Record, error) {
+	if _, err := s.db.ExecContext(ctx, createTableQuery); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT version, name, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var r Record
+		if err := rows.Scan(&r.Version, &r.Name, &r.AppliedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+func (s *SQLStore) Insert(ctx context.Context, record Record) error {
+	_, err := executor(ctx, s.db).ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+		record.Version, record.Name, record.AppliedAt,
+	)
+	return err
+}
+
+func (s *SQLStore) Delete(ctx context.Context, version int) error {
+	_, err := executor(ctx, s.db).ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, version)
+	return err
+}
+
+// Миграции из FromFS, выполненные внутри fn, используют ту же транзакцию
+func (s *SQLStore) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+/*
+Собираем миграции из файлов вида 0001_name.up.sql и 0001_name.down.sql.
+Каждый файл выполняется в отдельной транзакции или в транзакции SQLStore.InTx
+*/
+func FromFS(db *sql.DB, fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		prefix, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", name)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", name, err)
+		}
+
+		query, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		mg, ok := byVersion[version]
+		if !ok {
+			mg = &Migration{Version: version, Name: label}
+			byVersion[version] = mg
+		}
+		if direction == "up" {
+			mg.Up = execFunc(db, string(query))
+		} else {
+			mg.Down = execFunc(db, string(query))
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mg := range byVersion {
+		if mg.Up == nil {
+			return nil, fmt.Errorf("migration %d has no up file", mg.Version)
+		}
+		migrations = append(migrations, *mg)
+	}
+	return migrations, nil
+}
+
+func execFunc(db *sql.DB, query string) Func {
+	return func(ctx context.Context) error {
+		if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+			_, err := tx.ExecContext(ctx, query)
+			return err
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	}
+}
+
+func executor(ctx context.Context, db *sql.DB) sqlExecutor {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
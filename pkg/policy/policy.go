@@ -0,0 +1,314 @@
+/*
+Пакет policy вычисляет решения авторизации по атрибутам (ABAC).
+Политика - JSON со списком правил: правило срабатывает, если совпали действие,
+тип ресурса и выполнены все условия. Запрещающее правило сильнее разрешающего,
+если не сработало ни одно правило, доступ запрещён
+*/
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+
+	// Операторы условий
+	OpEq       = "eq"
+	OpNe       = "ne"
+	OpIn       = "in"
+	OpContains = "contains"
+	OpExists   = "exists"
+)
+
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+/*
+Actions поддерживают * и resource:*, как разрешения ролей.
+Пустой Resources подходит к ресурсу любого типа
+*/
+type Rule struct {
+	ID          string      `json:"id"`
+	Description string      `json:"description,omitempty"`
+	Effect      string      `json:"effect"`
+	Actions     []string    `json:"actions"`
+	Resources   []string    `json:"resources,omitempty"`
+	Conditions  []Condition `json:"conditions,omitempty"`
+}
+
+/*
+Условие сравнивает атрибут Attr с литералом Value или с другим атрибутом Ref.
+Атрибуты адресуются путём subject.org, resource.owner.id, context.ip
+*/
+type Condition struct {
+	Attr  string `json:"attr"`
+	Op    string `json:"op"`
+	Ref   string `json:"ref,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+// Атрибуты субъекта, ресурса или контекста, вложенные объекты - тоже Attributes
+type Attributes map[string]any
+
+// Запрос на решение. Тип ресурса передаётся атрибутом resource.type
+type Request struct {
+	Subject  Attributes
+	Action   string
+	Resource Attributes
+	Context  Attributes
+}
+
+// Решение и правило, которое его определило. Rule пустой, если не сработало ни одно правило
+type Decision struct {
+	Allowed bool
+	Rule    string
+}
+
+// Пустая политика запрещает всё
+func Empty() *Policy {
+	return &Policy{}
+}
+
+// Читаем политику из JSON файла
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Разбираем и проверяем политику, неизвестные поля считаются ошибкой
+func Parse(data []byte) (*Policy, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var p Policy
+	if err := decoder.Decode(&p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *Policy) validate() error {
+	ids := make(map[string]bool, len(p.Rules))
+	for i, rule := range p.Rules {
+		switch {
+		case rule.ID == "":
+			return fmt.Errorf("%w: rule %d has no id", ErrInvalidPolicy, i)
+		case ids[rule.ID]:
+			return fmt.Errorf("%w: duplicate rule id %q", ErrInvalidPolicy, rule.ID)
+		case rule.Effect != EffectAllow && rule.Effect != EffectDeny:
+			return fmt.Errorf("%w: rule %q has unknown effect %q", ErrInvalidPolicy, rule.ID, rule.Effect)
+		case len(rule.Actions) == 0:
+			return fmt.Errorf("%w: rule %q has no actions", ErrInvalidPolicy, rule.ID)
+		}
+		ids[rule.ID] = true
+
+		for _, c := range rule.Conditions {
+			if err := c.validate(); err != nil {
+				return fmt.Errorf("%w: rule %q: %v", ErrInvalidPolicy, rule.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c Condition) validate() error {
+	if !validPath(c.Attr) {
+		return fmt.Errorf("attr %q is not a subject, resource or context path", c.Attr)
+	}
+	if c.Ref != "" && !validPath(c.Ref) {
+		return fmt.Errorf("ref %q is not a subject, resource or context path", c.Ref)
+	}
+
+	switch c.Op {
+	case OpExists:
+		if c.Ref != "" || c.Value != nil {
+			return fmt.Errorf("%s takes no operand", c.Op)
+		}
+	case OpEq, OpNe, OpIn, OpContains:
+		if (c.Ref == "") == (c.Value == nil) {
+			return fmt.Errorf("%s needs exactly one of ref or value", c.Op)
+		}
+	default:
+		return fmt.Errorf("unknown op %q", c.Op)
+	}
+	return nil
+}
+
+/*
+Вычисляем решение: сработавшее запрещающее правило сразу даёт отказ,
+иначе разрешает первое сработавшее разрешающее правило
+*/
+func (p *Policy) Evaluate(req Request) Decision {
+	var allowedBy string
+	for _, rule := range p.Rules {
+		if !rule.matches(req) {
+			continue
+		}
+		if rule.Effect == EffectDeny {
+			return Decision{Allowed: false, Rule: rule.ID}
+		}
+		if allowedBy == "" {
+			allowedBy = rule.ID
+		}
+	}
+	return Decision{Allowed: allowedBy != "", Rule: allowedBy}
+}
+
+func (r Rule) matches(req Request) bool {
+	if !matchesAction(r.Actions, req.Action) {
+		return false
+	}
+	if len(r.Resources) > 0 {
+		resourceType, _ := req.Resource["type"].(string)
+		if !slices.Contains(r.Resources, resourceType) {
+			return false
+		}
+	}
+	for _, c := range r.Conditions {
+		if !c.holds(req) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) holds(req Request) bool {
+	left, ok := req.lookup(c.Attr)
+	if c.Op == OpExists {
+		return ok
+	}
+	if !ok {
+		return false
+	}
+
+	right := c.Value
+	if c.Ref != "" {
+		if right, ok = req.lookup(c.Ref); !ok {
+			return false
+		}
+	}
+
+	switch c.Op {
+	case OpEq:
+		return equal(left, right)
+	case OpNe:
+		return !equal(left, right)
+	case OpIn:
+		return contains(right, left)
+	case OpContains:
+		return contains(left, right)
+	}
+	return false
+}
+
+// Находим атрибут по пути вида subject.org или resource.owner.id
+func (req Request) lookup(path string) (any, bool) {
+	root, rest, _ := strings.Cut(path, ".")
+
+	var current any
+	switch root {
+	case "subject":
+		current = map[string]any(req.Subject)
+	case "resource":
+		current = map[string]any(req.Resource)
+	case "context":
+		current = map[string]any(req.Context)
+	default:
+		return nil, false
+	}
+
+	for _, key := range strings.Split(rest, ".") {
+		var attrs map[string]any
+		switch v := current.(type) {
+		case map[string]any:
+			attrs = v
+		case Attributes:
+			attrs = v
+		default:
+			return nil, false
+		}
+
+		value, ok := attrs[key]
+		if !ok || value == nil {
+			return nil, false
+		}
+		current = value
+	}
+	return current, true
+}
+
+func validPath(path string) bool {
+	root, rest, ok := strings.Cut(path, ".")
+	return ok && rest != "" && (root == "subject" || root == "resource" || root == "context")
+}
+
+func matchesAction(patterns []string, action string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == action {
+			return true
+		}
+		if resource, ok := strings.CutSuffix(pattern, ":*"); ok && strings.HasPrefix(action, resource+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// Значения из JSON и из Go кода приводим к одному виду перед сравнением
+func normalize(v any) any {
+	switch v := v.(type) {
+	case []string:
+		items := make([]any, len(v))
+		for i, s := range v {
+			items[i] = s
+		}
+		return items
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+func equal(a, b any) bool {
+	a, b = normalize(a), normalize(b)
+	switch a.(type) {
+	case string, float64, bool:
+		return a == b
+	}
+	return false
+}
+
+// Список list содержит item
+func contains(list, item any) bool {
+	items, ok := normalize(list).([]any)
+	if !ok {
+		return false
+	}
+	for _, v := range items {
+		if equal(v, item) {
+			return true
+		}
+	}
+	return false
+}
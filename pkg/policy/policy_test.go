@@ -0,0 +1,145 @@
+package policy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const testPolicy = `{"rules": [
+	{"id": "owner", "effect": "allow", "actions": ["document:*"], "resources": ["document"],
+	 "conditions": [{"attr": "resource.owner.id", "op": "eq", "ref": "subject.id"}]},
+	{"id": "same-org-read", "effect": "allow", "actions": ["document:read"],
+	 "conditions": [{"attr": "resource.org", "op": "eq", "ref": "subject.org"}]},
+	{"id": "admin", "effect": "allow", "actions": ["*"],
+	 "conditions": [{"attr": "subject.roles", "op": "contains", "value": "admin"}]},
+	{"id": "archived", "effect": "deny", "actions": ["document:write", "document:delete"],
+	 "conditions": [{"attr": "resource.archived", "op": "eq", "value": true}]},
+	{"id": "blocked-network", "effect": "deny", "actions": ["*"],
+	 "conditions": [{"attr": "context.network", "op": "in", "value": ["blocked", "tor"]}]},
+	{"id": "no-mfa-delete", "effect": "deny", "actions": ["document:delete"],
+	 "conditions": [{"attr": "subject.mfa", "op": "ne", "value": true}]},
+	{"id": "report-reviewers", "effect": "allow", "actions": ["report:read"], "resources": ["report"],
+	 "conditions": [{"attr": "subject.reviewer", "op": "exists"}]}
+]}`
+
+func TestEvaluate(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	alice, bob := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name    string
+		req     Request
+		allowed bool
+		rule    string
+	}{
+		{
+			name:    "owner by ref",
+			req:     Request{Subject: Attributes{"id": alice}, Action: "document:write", Resource: Attributes{"type": "document", "owner": Attributes{"id": alice.String()}}},
+			allowed: true, rule: "owner",
+		},
+		{
+			name: "not the owner",
+			req:  Request{Subject: Attributes{"id": bob}, Action: "document:write", Resource: Attributes{"type": "document", "owner": Attributes{"id": alice.String()}}},
+		},
+		{
+			name: "owner of another resource type",
+			req:  Request{Subject: Attributes{"id": alice}, Action: "document:write", Resource: Attributes{"type": "report", "owner": Attributes{"id": alice.String()}}},
+		},
+		{
+			name:    "same org by ref",
+			req:     Request{Subject: Attributes{"id": bob, "org": "acme"}, Action: "document:read", Resource: Attributes{"type": "document", "org": "acme"}},
+			allowed: true, rule: "same-org-read",
+		},
+		{
+			name: "ref to a missing attribute",
+			req:  Request{Subject: Attributes{"id": bob}, Action: "document:read", Resource: Attributes{"type": "document", "org": "acme"}},
+		},
+		{
+			name: "wildcard action does not cover other resources",
+			req:  Request{Subject: Attributes{"id": alice}, Action: "documents:write", Resource: Attributes{"type": "document", "owner": Attributes{"id": alice.String()}}},
+		},
+		{
+			name:    "global wildcard",
+			req:     Request{Subject: Attributes{"roles": []string{"user", "admin"}}, Action: "billing:refund", Resource: Attributes{"type": "invoice"}},
+			allowed: true, rule: "admin",
+		},
+		{
+			name: "deny over allow",
+			req:  Request{Subject: Attributes{"id": alice}, Action: "document:write", Resource: Attributes{"type": "document", "owner": Attributes{"id": alice.String()}, "archived": true}},
+			rule: "archived",
+		},
+		{
+			name: "deny over a global wildcard allow",
+			req:  Request{Subject: Attributes{"roles": []string{"admin"}}, Action: "document:read", Context: Attributes{"network": "tor"}},
+			rule: "blocked-network",
+		},
+		{
+			name: "deny by ne",
+			req:  Request{Subject: Attributes{"id": alice, "mfa": false}, Action: "document:delete", Resource: Attributes{"type": "document", "owner": Attributes{"id": alice.String()}}},
+			rule: "no-mfa-delete",
+		},
+		{
+			name:    "delete with mfa",
+			req:     Request{Subject: Attributes{"id": alice, "mfa": true}, Action: "document:delete", Resource: Attributes{"type": "document", "owner": Attributes{"id": alice.String()}}},
+			allowed: true, rule: "owner",
+		},
+		{
+			name:    "exists",
+			req:     Request{Subject: Attributes{"reviewer": "finance"}, Action: "report:read", Resource: Attributes{"type": "report"}},
+			allowed: true, rule: "report-reviewers",
+		},
+		{
+			name: "no rule matches",
+			req:  Request{Subject: Attributes{"id": alice}, Action: "report:read", Resource: Attributes{"type": "report"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.Evaluate(tt.req)
+			if got.Allowed != tt.allowed || got.Rule != tt.rule {
+				t.Fatalf("Evaluate = %+v, want allowed %v by %q", got, tt.allowed, tt.rule)
+			}
+		})
+	}
+}
+
+func TestEmptyDeniesEverything(t *testing.T) {
+	if d := Empty().Evaluate(Request{Action: "document:read"}); d.Allowed || d.Rule != "" {
+		t.Fatalf("Evaluate = %+v, want denied without a rule", d)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		reason string
+	}{
+		{name: "not json", policy: `{"rules": [`, reason: "unexpected EOF"},
+		{name: "unknown field", policy: `{"rules": [{"id": "a", "effect": "allow", "actions": ["*"], "priority": 1}]}`, reason: "unknown field"},
+		{name: "no id", policy: `{"rules": [{"effect": "allow", "actions": ["*"]}]}`, reason: "has no id"},
+		{name: "duplicate id", policy: `{"rules": [{"id": "a", "effect": "allow", "actions": ["*"]}, {"id": "a", "effect": "deny", "actions": ["*"]}]}`, reason: "duplicate rule id"},
+		{name: "unknown effect", policy: `{"rules": [{"id": "a", "effect": "permit", "actions": ["*"]}]}`, reason: "unknown effect"},
+		{name: "no actions", policy: `{"rules": [{"id": "a", "effect": "allow"}]}`, reason: "has no actions"},
+		{name: "bad attr path", policy: `{"rules": [{"id": "a", "effect": "allow", "actions": ["*"], "conditions": [{"attr": "user.id", "op": "exists"}]}]}`, reason: "attr"},
+		{name: "bad ref path", policy: `{"rules": [{"id": "a", "effect": "allow", "actions": ["*"], "conditions": [{"attr": "subject.id", "op": "eq", "ref": "subject"}]}]}`, reason: "ref"},
+		{name: "unknown op", policy: `{"rules": [{"id": "a", "effect": "allow", "actions": ["*"], "conditions": [{"attr": "subject.id", "op": "gt", "value": 1}]}]}`, reason: "unknown op"},
+		{name: "exists with operand", policy: `{"rules": [{"id": "a", "effect": "allow", "actions": ["*"], "conditions": [{"attr": "subject.id", "op": "exists", "value": 1}]}]}`, reason: "takes no operand"},
+		{name: "no operand", policy: `{"rules": [{"id": "a", "effect": "allow", "actions": ["*"], "conditions": [{"attr": "subject.id", "op": "eq"}]}]}`, reason: "exactly one of ref or value"},
+		{name: "both operands", policy: `{"rules": [{"id": "a", "effect": "allow", "actions": ["*"], "conditions": [{"attr": "subject.id", "op": "eq", "ref": "resource.owner", "value": "x"}]}]}`, reason: "exactly one of ref or value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.policy))
+			if !errors.Is(err, ErrInvalidPolicy) || !strings.Contains(err.Error(), tt.reason) {
+				t.Fatalf("Parse returned %v, want ErrInvalidPolicy with %q", err, tt.reason)
+			}
+		})
+	}
+}